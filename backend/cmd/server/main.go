@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -90,10 +91,19 @@ func main() {
 	userService := services.NewUserService(db, redisCache)
 	pluginService := services.NewPluginService(db, redisCache)
 	uploadService := services.NewUploadService("uploads")
-	dependencyService := services.NewDependencyService(client)
+	pluginSettingService := services.NewPluginSettingService(db)
+	dependencyService := services.NewDependencyService(client, pluginSettingService)
+
+	// 插件配置存储中的值用于补充缺失的环境变量，需要在创建插件之前加载
+	if err := pluginSettingService.EnsureIndexes(context.Background()); err != nil {
+		log.Warn("创建插件配置索引失败", zap.Error(err))
+	}
+	if err := pluginSettingService.Load(context.Background()); err != nil {
+		log.Warn("加载插件配置失败", zap.Error(err))
+	}
 
 	// 初始化插件管理器
-	pluginManager := plugins.NewManager(db, redisCache)
+	pluginManager := plugins.NewManager(db, redisCache, pluginSettingService)
 
 	// 初始化处理器
 	userHandler := handlers.NewUserHandler(userService)
@@ -103,6 +113,11 @@ func main() {
 	// 创建 Gin 引擎
 	r := gin.New() // 使用 New() 而不是 Default()，避免重复的中间件
 
+	// 只采信受信任反向代理转发的客户端地址（X-Forwarded-For 等），未配置时使用连接的对端地址，防止伪造来源 IP
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("受信任代理配置无效", zap.Error(err))
+	}
+
 	// 中间件
 	r.Use(middleware.Cors())
 	r.Use(middleware.Logger())
@@ -147,6 +162,11 @@ func main() {
 		api.GET("/plugins/:id/dependencies/check", pluginHandler.CheckPluginDependencies)
 		api.POST("/plugins/:id/dependencies/setup", pluginHandler.SetupPluginDatabase)
 
+		// 插件配置路由，敏感值只写不读
+		api.GET("/plugins/:id/settings", pluginHandler.GetPluginSettings)
+		api.PUT("/plugins/:id/settings", pluginHandler.UpdatePluginSettings)
+		api.DELETE("/plugins/:id/settings/:name", pluginHandler.DeletePluginSetting)
+
 		// 文件上传相关路由
 		api.POST("/upload", uploadHandler.UploadFile)
 		api.GET("/files/:filename", uploadHandler.GetFile)
@@ -167,6 +187,9 @@ func main() {
 		Handler: r,
 	}
 
+	// 启动插件后台任务
+	pluginManager.Start(context.Background())
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal("启动服务器失败", zap.Error(err))
@@ -184,4 +207,16 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("服务器关闭失败", zap.Error(err))
 	}
+	pluginManager.Stop()
+}
+
+// trustedProxies 读取 TRUSTED_PROXIES 中逗号分隔的代理地址或网段
+func trustedProxies() []string {
+	var proxies []string
+	for _, item := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			proxies = append(proxies, item)
+		}
+	}
+	return proxies
 }
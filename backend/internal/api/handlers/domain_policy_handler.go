@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// DomainPolicyHandler 域名检测策略处理器
+type DomainPolicyHandler struct {
+	policyService *services.DomainPolicyService
+}
+
+// NewDomainPolicyHandler 创建域名检测策略处理器实例
+func NewDomainPolicyHandler(policyService *services.DomainPolicyService) *DomainPolicyHandler {
+	return &DomainPolicyHandler{
+		policyService: policyService,
+	}
+}
+
+// ListPolicies 获取全部域名策略
+func (h *DomainPolicyHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.policyService.ListPolicies(c.Request.Context())
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": policies})
+}
+
+// GetPolicy 获取单个域名策略
+func (h *DomainPolicyHandler) GetPolicy(c *gin.Context) {
+	policy, err := h.policyService.GetPolicy(c.Request.Context(), c.Param("policyId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// CreatePolicy 创建域名策略
+func (h *DomainPolicyHandler) CreatePolicy(c *gin.Context) {
+	var req models.DomainPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	policy, err := h.policyService.CreatePolicy(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, policy)
+}
+
+// UpdatePolicy 更新域名策略
+func (h *DomainPolicyHandler) UpdatePolicy(c *gin.Context) {
+	var req models.DomainPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	policy, err := h.policyService.UpdatePolicy(c.Request.Context(), c.Param("policyId"), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeletePolicy 删除域名策略
+func (h *DomainPolicyHandler) DeletePolicy(c *gin.Context) {
+	if err := h.policyService.DeletePolicy(c.Request.Context(), c.Param("policyId")); err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "域名策略删除成功"})
+}
+
+// PreviewPolicy 预览某个URL实际生效的域名策略
+func (h *DomainPolicyHandler) PreviewPolicy(c *gin.Context) {
+	rawURL := c.Query("url")
+	if rawURL == "" {
+		c.JSON(http.StatusBadRequest, errors.NewError("缺少url参数", http.StatusBadRequest))
+		return
+	}
+
+	preview, err := h.policyService.Preview(c.Request.Context(), rawURL)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -37,7 +41,7 @@ func (h *ExternalLinkHandler) CreateExternalLink(c *gin.Context) {
 	}
 
 	if err := h.externalLinkService.CreateExternalLink(c.Request.Context(), &link); err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("创建外链失败", http.StatusInternalServerError))
+		respondLinkError(c, err)
 		return
 	}
 
@@ -66,7 +70,7 @@ func (h *ExternalLinkHandler) UpdateExternalLink(c *gin.Context) {
 	}
 
 	if err := h.externalLinkService.UpdateExternalLink(c.Request.Context(), id, update); err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("更新外链失败", http.StatusInternalServerError))
+		respondLinkError(c, err)
 		return
 	}
 
@@ -89,7 +93,7 @@ func (h *ExternalLinkHandler) BatchDeleteExternalLinks(c *gin.Context) {
 	var request struct {
 		IDs []string `json:"ids"`
 	}
-	
+
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
 		return
@@ -107,7 +111,7 @@ func (h *ExternalLinkHandler) BatchDeleteExternalLinks(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "批量删除成功",
+		"message":       "批量删除成功",
 		"deleted_count": deletedCount,
 	})
 }
@@ -122,61 +126,111 @@ func (h *ExternalLinkHandler) ListExternalLinks(c *gin.Context) {
 
 	response, err := h.externalLinkService.ListExternalLinks(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("获取外链列表失败", http.StatusInternalServerError))
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// streamFlushEvery 流式输出时每写出多少条刷新一次
+const streamFlushEvery = 100
+
 // GetAllExternalLinks 获取所有外链（不分页）
+// 响应格式保持 {"data": [...], "total": n}，但逐条写出，不在内存中缓存全部链接
 func (h *ExternalLinkHandler) GetAllExternalLinks(c *gin.Context) {
-	links, err := h.externalLinkService.GetAllExternalLinks(c.Request.Context())
+	total := 0
+	err := h.externalLinkService.StreamExternalLinks(c.Request.Context(), models.ExternalLinkQuery{}, func(link models.ExternalLink) error {
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		prefix := ","
+		if total == 0 {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Status(http.StatusOK)
+			prefix = `{"data":[`
+		}
+		if _, err := c.Writer.WriteString(prefix); err != nil {
+			return err
+		}
+		if _, err := c.Writer.Write(data); err != nil {
+			return err
+		}
+		total++
+		if total%streamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("获取所有外链失败", http.StatusInternalServerError))
+		if total == 0 {
+			c.JSON(http.StatusInternalServerError, errors.NewError("获取所有外链失败", http.StatusInternalServerError))
+			return
+		}
+		// 已开始输出，无法再返回错误响应，客户端会收到不完整的 JSON
+		logger.Error("输出所有外链中断", zap.Int("written", total), zap.Error(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": links,
-		"total": len(links),
-	})
+	if total == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"data":  []models.ExternalLink{},
+			"total": 0,
+		})
+		return
+	}
+	fmt.Fprintf(c.Writer, `],"total":%d}`, total)
 }
 
-// BatchCheckExternalLinks 批量检测外链
-func (h *ExternalLinkHandler) BatchCheckExternalLinks(c *gin.Context) {
-	log := logger.NewLogger()
-	
-	var request struct {
-		IDs []string `json:"ids"`
-		All bool     `json:"all,omitempty"` // 是否检测所有链接
-	}
-	
-	if err := c.ShouldBindJSON(&request); err != nil {
-		log.Error("请求参数绑定失败", zap.Error(err))
-		c.JSON(http.StatusBadRequest, errors.NewError(fmt.Sprintf("无效的请求参数: %v", err), http.StatusBadRequest))
+// StreamExternalLinks 按列表筛选条件以 NDJSON 格式逐条输出外链，分页参数会被忽略
+func (h *ExternalLinkHandler) StreamExternalLinks(c *gin.Context) {
+	var query models.ExternalLinkQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的查询参数", http.StatusBadRequest))
 		return
 	}
-	
-	log.Info("批量检测请求", zap.Any("request", request))
 
-	results, err := h.externalLinkService.BatchCheckExternalLinks(c.Request.Context(), request.IDs, request.All)
+	written := 0
+	encoder := json.NewEncoder(c.Writer)
+	err := h.externalLinkService.StreamExternalLinks(c.Request.Context(), query, func(link models.ExternalLink) error {
+		if written == 0 {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("X-Content-Type-Options", "nosniff")
+			c.Status(http.StatusOK)
+		}
+		if err := encoder.Encode(link); err != nil {
+			return err
+		}
+		written++
+		if written%streamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("批量检测外链失败", http.StatusInternalServerError))
+		if written == 0 {
+			code, resp := errors.NewErrorResponse(err)
+			c.JSON(code, resp)
+			return
+		}
+		logger.Error("流式输出外链中断", zap.Int("written", written), zap.Error(err))
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "批量检测完成",
-		"results": results,
-	})
+	if written == 0 {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+	}
+	c.Writer.Flush()
 }
 
-// GetExternalStatistics 获取外链统计信息
+// GetExternalStatistics 获取外链统计信息，owner 可按所有者统计
 func (h *ExternalLinkHandler) GetExternalStatistics(c *gin.Context) {
-	stats, err := h.externalLinkService.GetExternalStatistics(c.Request.Context())
+	stats, err := h.externalLinkService.GetExternalStatistics(c.Request.Context(), c.Query("owner"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("获取统计信息失败", http.StatusInternalServerError))
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
 		return
 	}
 
@@ -184,33 +238,236 @@ func (h *ExternalLinkHandler) GetExternalStatistics(c *gin.Context) {
 }
 
 // GetExternalTrends 获取外链趋势数据
+// interval（兼容 period）可选 hour、day、week、month，tz 为 IANA 时区名，from/to 或 limit 指定时间范围
 func (h *ExternalLinkHandler) GetExternalTrends(c *gin.Context) {
-	period := c.DefaultQuery("period", "day")
-	limit := 7
-	if period == "week" {
-		limit = 4
-	} else if period == "month" {
-		limit = 6
+	var query models.ExternalTrendQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的查询参数", http.StatusBadRequest))
+		return
 	}
 
-	trends, err := h.externalLinkService.GetExternalTrends(c.Request.Context(), period, limit)
+	trends, err := h.externalLinkService.GetExternalTrends(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("获取趋势数据失败", http.StatusInternalServerError))
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
 		return
 	}
 
 	c.JSON(http.StatusOK, trends)
 }
 
-// IncrementClicks 增加点击量
-func (h *ExternalLinkHandler) IncrementClicks(c *gin.Context) {
+// ListLinkChecks 获取链接的检测记录
+func (h *ExternalLinkHandler) ListLinkChecks(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.externalLinkService.IncrementClicks(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewError("增加点击量失败", http.StatusInternalServerError))
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	response, err := h.externalLinkService.ListLinkChecks(c.Request.Context(), id, page, perPage)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetLinkUptime 获取链接在指定时间范围内的可用率和故障区间
+// from/to 支持 RFC3339 或 2006-01-02 格式，默认最近7天
+func (h *ExternalLinkHandler) GetLinkUptime(c *gin.Context) {
+	from, to, ok := bindTimeRange(c, 7)
+	if !ok {
+		return
+	}
+
+	report, err := h.externalLinkService.GetLinkUptime(c.Request.Context(), c.Param("id"), from, to)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// bindTimeRange 读取 from/to 查询参数，默认最近 days 天；参数无效时写入错误响应并返回 false
+func bindTimeRange(c *gin.Context, days int) (time.Time, time.Time, bool) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -days)
+
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := parseTimeParam(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errors.NewError("无效的结束时间", http.StatusBadRequest))
+			return from, to, false
+		}
+		to = parsed
+	}
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := parseTimeParam(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errors.NewError("无效的开始时间", http.StatusBadRequest))
+			return from, to, false
+		}
+		from = parsed
+	}
+	return from, to, true
+}
+
+// parseTimeParam 解析时间查询参数
+func parseTimeParam(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// SetLinkAssertions 设置链接的内容校验规则，提交空规则表示清除
+func (h *ExternalLinkHandler) SetLinkAssertions(c *gin.Context) {
+	var assertion models.ContentAssertion
+	if err := c.ShouldBindJSON(&assertion); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "点击量增加成功"})
+	if err := h.externalLinkService.SetLinkAssertions(c.Request.Context(), c.Param("id"), &assertion); err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "内容校验规则已保存"})
+}
+
+// RefreshLinkMetadata 立即重新提取链接的页面元数据
+func (h *ExternalLinkHandler) RefreshLinkMetadata(c *gin.Context) {
+	metadata, err := h.externalLinkService.RefreshLinkMetadata(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "页面元数据已更新",
+		"data":    metadata,
+	})
+}
+
+// ListCategoryAssertions 获取分类级别的内容校验规则
+func (h *ExternalLinkHandler) ListCategoryAssertions(c *gin.Context) {
+	items, err := h.externalLinkService.ListCategoryAssertions(c.Request.Context())
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+// SaveCategoryAssertions 保存分类级别的内容校验规则
+func (h *ExternalLinkHandler) SaveCategoryAssertions(c *gin.Context) {
+	var assertion models.ContentAssertion
+	if err := c.ShouldBindJSON(&assertion); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	item, err := h.externalLinkService.SaveCategoryAssertions(c.Request.Context(), c.Param("category"), assertion)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteCategoryAssertions 删除分类级别的内容校验规则
+func (h *ExternalLinkHandler) DeleteCategoryAssertions(c *gin.Context) {
+	if err := h.externalLinkService.DeleteCategoryAssertions(c.Request.Context(), c.Param("category")); err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "分类内容校验规则已删除"})
+}
+
+// CanonicalizeExternalLink 将单个链接地址改写为检测到的永久重定向目标
+func (h *ExternalLinkHandler) CanonicalizeExternalLink(c *gin.Context) {
+	result, err := h.externalLinkService.RewriteToCanonical(c.Request.Context(), models.CanonicalRewriteRequest{
+		IDs: []string{c.Param("id")},
+	})
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if len(result.Conflicts) > 0 {
+		c.JSON(http.StatusConflict, errors.NewError("重定向目标地址已作为其他链接存在，请合并重复链接", http.StatusConflict))
+		return
+	}
+	if result.Updated == 0 {
+		c.JSON(http.StatusBadRequest, errors.NewError("该链接没有可改写的永久重定向地址", http.StatusBadRequest))
+		return
+	}
+
+	c.JSON(http.StatusOK, result.Links[0])
+}
+
+// BatchCanonicalizeExternalLinks 批量将链接地址改写为永久重定向目标
+func (h *ExternalLinkHandler) BatchCanonicalizeExternalLinks(c *gin.Context) {
+	var req models.CanonicalRewriteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	result, err := h.externalLinkService.RewriteToCanonical(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   fmt.Sprintf("成功改写 %d 个链接地址", result.Updated),
+		"updated":   result.Updated,
+		"data":      result.Links,
+		"conflicts": result.Conflicts,
+	})
+}
+
+// ExportExternalLinks 按列表筛选条件导出外链，format 可选 csv、jsonl、bookmarks
+func (h *ExternalLinkHandler) ExportExternalLinks(c *gin.Context) {
+	var query models.ExternalLinkQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的查询参数", http.StatusBadRequest))
+		return
+	}
+
+	format := c.DefaultQuery("format", models.LinkFormatCSV)
+	contentType, ext := services.LinkExportContentType(format)
+	if contentType == "" {
+		c.JSON(http.StatusBadRequest, errors.NewError("不支持的导出格式，可选值: csv, jsonl, bookmarks", http.StatusBadRequest))
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=external-links-%s.%s", time.Now().Format("20060102"), ext))
+
+	if err := h.externalLinkService.ExportExternalLinks(c.Request.Context(), query, format, c.Writer); err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			code, resp := errors.NewErrorResponse(err)
+			c.JSON(code, resp)
+			return
+		}
+		logger.Error("导出外链中断", zap.Error(err))
+	}
 }
 
 // GetInvalidExternalLinks 获取所有不可用的外链
@@ -222,7 +479,7 @@ func (h *ExternalLinkHandler) GetInvalidExternalLinks(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"data": links,
+		"data":  links,
 		"total": len(links),
 	})
 }
@@ -236,7 +493,153 @@ func (h *ExternalLinkHandler) BatchDeleteInvalidExternalLinks(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "批量删除不可用外链成功",
+		"message":       "批量删除不可用外链成功",
 		"deleted_count": deletedCount,
 	})
-} 
\ No newline at end of file
+}
+
+// FindDuplicateLinks 查找重复链接分组，mode 可选 exact（默认）和 loose
+func (h *ExternalLinkHandler) FindDuplicateLinks(c *gin.Context) {
+	groups, err := h.externalLinkService.FindDuplicateGroups(c.Request.Context(), c.Query("mode"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  groups,
+		"total": len(groups),
+	})
+}
+
+// MergeDuplicateLinks 合并重复链接，点击数累加到保留的链接
+func (h *ExternalLinkHandler) MergeDuplicateLinks(c *gin.Context) {
+	var req models.DuplicateMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	result, err := h.externalLinkService.MergeDuplicates(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("成功合并 %d 个重复链接", result.Merged),
+		"data":    result,
+	})
+}
+
+// TransferLinkOwnership 批量转移链接所有权
+func (h *ExternalLinkHandler) TransferLinkOwnership(c *gin.Context) {
+	var req models.LinkTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	result, err := h.externalLinkService.TransferLinkOwnership(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("成功转移 %d 个链接", result.Updated),
+		"data":    result,
+	})
+}
+
+// respondLinkError 输出外链错误，链接重复时返回 409 并附带已存在的链接
+func respondLinkError(c *gin.Context, err error) {
+	var dupErr *services.DuplicateLinkError
+	if stderrors.As(err, &dupErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":          http.StatusConflict,
+			"message":       dupErr.Error(),
+			"existing_id":   dupErr.Existing.ID.Hex(),
+			"existing_link": dupErr.Existing,
+		})
+		return
+	}
+
+	code, resp := errors.NewErrorResponse(err)
+	c.JSON(code, resp)
+}
+
+// ListTags 获取全部标签及使用次数
+func (h *ExternalLinkHandler) ListTags(c *gin.Context) {
+	tags, err := h.externalLinkService.ListTags(c.Request.Context())
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  tags,
+		"total": len(tags),
+	})
+}
+
+// RenameTag 重命名标签，新名称已存在时合并
+func (h *ExternalLinkHandler) RenameTag(c *gin.Context) {
+	var req models.TagRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	updated, err := h.externalLinkService.RenameTag(c.Request.Context(), c.Param("tag"), req.Name)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "标签已重命名",
+		"updated": updated,
+	})
+}
+
+// MergeTags 将多个标签合并为一个
+func (h *ExternalLinkHandler) MergeTags(c *gin.Context) {
+	var req models.TagMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	updated, err := h.externalLinkService.MergeTags(c.Request.Context(), req.Sources, req.Target)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "标签已合并",
+		"updated": updated,
+	})
+}
+
+// DeleteTag 从所有链接中移除标签
+func (h *ExternalLinkHandler) DeleteTag(c *gin.Context) {
+	updated, err := h.externalLinkService.DeleteTag(c.Request.Context(), c.Param("tag"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "标签已删除",
+		"updated": updated,
+	})
+}
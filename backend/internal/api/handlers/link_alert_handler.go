@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// LinkAlertHandler 链接告警处理器
+type LinkAlertHandler struct {
+	alerts *services.LinkAlertService
+}
+
+// NewLinkAlertHandler 创建链接告警处理器实例
+func NewLinkAlertHandler(alerts *services.LinkAlertService) *LinkAlertHandler {
+	return &LinkAlertHandler{
+		alerts: alerts,
+	}
+}
+
+// ListEvents 获取最近的链接状态变化事件，pending=true 时只返回尚未发送的
+func (h *LinkAlertHandler) ListEvents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	var pending *bool
+	if value, err := strconv.ParseBool(c.Query("pending")); err == nil {
+		pending = &value
+	}
+
+	events, err := h.alerts.ListEvents(c.Request.Context(), pending, limit)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": events})
+}
+
+// ListDigests 获取最近的告警摘要及发送结果
+func (h *LinkAlertHandler) ListDigests(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	digests, err := h.alerts.ListDigests(c.Request.Context(), limit)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": digests})
+}
+
+// SendTestAlert 向已配置的 Webhook 和邮箱发送测试通知，返回各渠道的发送结果
+func (h *LinkAlertHandler) SendTestAlert(c *gin.Context) {
+	digest, err := h.alerts.SendTestAlert(c.Request.Context())
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, digest)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// LinkCheckJobHandler 批量检测任务处理器
+type LinkCheckJobHandler struct {
+	jobService *services.LinkCheckJobService
+}
+
+// NewLinkCheckJobHandler 创建批量检测任务处理器实例
+func NewLinkCheckJobHandler(jobService *services.LinkCheckJobService) *LinkCheckJobHandler {
+	return &LinkCheckJobHandler{
+		jobService: jobService,
+	}
+}
+
+// CreateJob 创建批量检测任务，立即返回任务ID
+func (h *LinkCheckJobHandler) CreateJob(c *gin.Context) {
+	var req models.LinkCheckJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	job, err := h.jobService.CreateJob(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "检测任务已创建",
+		"job_id":  job.ID.Hex(),
+		"job":     job,
+	})
+}
+
+// ListJobs 获取最近的检测任务
+func (h *LinkCheckJobHandler) ListJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	jobs, err := h.jobService.ListJobs(c.Request.Context(), limit)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetJob 获取检测任务状态和进度
+func (h *LinkCheckJobHandler) GetJob(c *gin.Context) {
+	job, err := h.jobService.GetJob(c.Request.Context(), c.Param("jobId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ListJobResults 分页获取检测任务结果
+func (h *LinkCheckJobHandler) ListJobResults(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+
+	var isValid *bool
+	if raw := c.Query("is_valid"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errors.NewError("无效的查询参数", http.StatusBadRequest))
+			return
+		}
+		isValid = &value
+	}
+
+	response, err := h.jobService.ListJobResults(c.Request.Context(), c.Param("jobId"), isValid, page, perPage)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelJob 取消检测任务
+func (h *LinkCheckJobHandler) CancelJob(c *gin.Context) {
+	job, err := h.jobService.CancelJob(c.Request.Context(), c.Param("jobId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已请求取消检测任务",
+		"job":     job,
+	})
+}
+
+// StreamJobEvents 通过 Server-Sent Events 推送任务进度
+// 客户端断开只会结束推送，不影响任务执行
+func (h *LinkCheckJobHandler) StreamJobEvents(c *gin.Context) {
+	jobID := c.Param("jobId")
+	job, err := h.jobService.GetJob(c.Request.Context(), jobID)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastProcessed, lastStatus := -1, ""
+	c.Stream(func(w io.Writer) bool {
+		if job.Processed != lastProcessed || job.Status != lastStatus {
+			lastProcessed, lastStatus = job.Processed, job.Status
+			c.SSEvent("progress", job)
+		}
+		if job.IsFinished() {
+			c.SSEvent("done", job)
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+
+		latest, err := h.jobService.GetJob(c.Request.Context(), jobID)
+		if err != nil {
+			c.SSEvent("error", gin.H{"message": err.Error()})
+			return false
+		}
+		job = latest
+		return true
+	})
+}
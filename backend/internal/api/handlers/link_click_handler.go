@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// LinkClickHandler 外链跳转与点击统计处理器
+type LinkClickHandler struct {
+	clickService *services.LinkClickService
+}
+
+// NewLinkClickHandler 创建外链跳转与点击统计处理器实例
+func NewLinkClickHandler(clickService *services.LinkClickService) *LinkClickHandler {
+	return &LinkClickHandler{
+		clickService: clickService,
+	}
+}
+
+// Redirect 记录点击并跳转到外链，slug 可以是链接ID或短链标识，collection 为来源集合的标识
+func (h *LinkClickHandler) Redirect(c *gin.Context) {
+	link, err := h.clickService.ResolveLink(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	click := clickContext(c, models.ClickSourceRedirect)
+	if collection := c.Query("collection"); collection != "" {
+		click.Source = models.ClickSourceCollection
+		click.Collection = collection
+	}
+	h.clickService.RecordClick(link, click)
+
+	// 禁止缓存跳转结果，保证每次点击都经过服务端
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, link.URL)
+}
+
+// RecordClick 前端上报点击，与跳转接口一样过滤爬虫并去重
+func (h *LinkClickHandler) RecordClick(c *gin.Context) {
+	link, err := h.clickService.ResolveLink(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	counted := h.clickService.RecordClick(link, clickContext(c, models.ClickSourceAPI))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "点击已记录",
+		"counted": counted,
+	})
+}
+
+// GetLinkClickAnalytics 获取单个链接的点击分析
+// from/to 支持 RFC3339 或 2006-01-02 格式，默认最近30天；interval 可选 hour、day
+func (h *LinkClickHandler) GetLinkClickAnalytics(c *gin.Context) {
+	h.clickAnalytics(c, c.Param("id"))
+}
+
+// GetClickAnalytics 获取全部链接的点击分析及点击排行
+func (h *LinkClickHandler) GetClickAnalytics(c *gin.Context) {
+	h.clickAnalytics(c, "")
+}
+
+func (h *LinkClickHandler) clickAnalytics(c *gin.Context, linkID string) {
+	from, to, ok := bindTimeRange(c, 30)
+	if !ok {
+		return
+	}
+
+	analytics, err := h.clickService.GetClickAnalytics(c.Request.Context(), linkID, from, to, c.Query("interval"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
+
+// clickContext 提取点击请求的访客信息
+// 访客 IP 只采信受信任代理（TRUSTED_PROXIES）转发的地址，未配置时为连接的对端地址，避免伪造请求头绕过去重
+func clickContext(c *gin.Context, source string) models.ClickContext {
+	return models.ClickContext{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Referrer:  c.Request.Referer(),
+		Source:    source,
+	}
+}
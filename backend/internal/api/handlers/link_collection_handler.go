@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// CollectionPasswordHeader 访问受密码保护的集合 JSON 时携带密码的请求头
+const CollectionPasswordHeader = "X-Collection-Password"
+
+// LinkCollectionHandler 链接集合处理器
+type LinkCollectionHandler struct {
+	collectionService *services.LinkCollectionService
+	redirectBase      string
+}
+
+// NewLinkCollectionHandler 创建链接集合处理器实例，basePath 为跳转接口所在路由组的前缀
+// publicURL 为对外访问的地址（如 https://links.example.com），为空时公开集合中的跳转地址使用相对路径，
+// 不根据请求的 Host 和 X-Forwarded-Proto 拼接，避免伪造的请求头污染缓存的页面
+func NewLinkCollectionHandler(collectionService *services.LinkCollectionService, basePath, publicURL string) *LinkCollectionHandler {
+	return &LinkCollectionHandler{
+		collectionService: collectionService,
+		redirectBase:      strings.TrimSuffix(publicURL, "/") + basePath,
+	}
+}
+
+// ListCollections 获取链接集合列表
+func (h *LinkCollectionHandler) ListCollections(c *gin.Context) {
+	collections, err := h.collectionService.ListCollections(c.Request.Context())
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": collections})
+}
+
+// GetCollection 获取单个集合
+func (h *LinkCollectionHandler) GetCollection(c *gin.Context) {
+	collection, err := h.collectionService.GetCollection(c.Request.Context(), c.Param("collectionId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// GetCollectionLinks 按顺序获取集合中的链接
+func (h *LinkCollectionHandler) GetCollectionLinks(c *gin.Context) {
+	links, err := h.collectionService.GetCollectionLinks(c.Request.Context(), c.Param("collectionId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": links})
+}
+
+// CreateCollection 创建集合
+func (h *LinkCollectionHandler) CreateCollection(c *gin.Context) {
+	var req models.LinkCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	collection, err := h.collectionService.CreateCollection(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, collection)
+}
+
+// UpdateCollection 更新集合，传入 link_ids 时按顺序整体替换集合中的链接
+func (h *LinkCollectionHandler) UpdateCollection(c *gin.Context) {
+	var req models.LinkCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	collection, err := h.collectionService.UpdateCollection(c.Request.Context(), c.Param("collectionId"), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// DeleteCollection 删除集合
+func (h *LinkCollectionHandler) DeleteCollection(c *gin.Context) {
+	if err := h.collectionService.DeleteCollection(c.Request.Context(), c.Param("collectionId")); err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// AddCollectionLinks 向集合插入链接
+func (h *LinkCollectionHandler) AddCollectionLinks(c *gin.Context) {
+	var req models.LinkCollectionItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	collection, err := h.collectionService.AddLinks(c.Request.Context(), c.Param("collectionId"), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// RemoveCollectionLink 从集合中移除链接
+func (h *LinkCollectionHandler) RemoveCollectionLink(c *gin.Context) {
+	collection, err := h.collectionService.RemoveLink(c.Request.Context(), c.Param("collectionId"), c.Param("linkId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// PublicFeed 以 JSON 输出公开集合，受密码保护时通过 X-Collection-Password 请求头传入密码
+func (h *LinkCollectionHandler) PublicFeed(c *gin.Context) {
+	collection, err := h.collectionService.GetPublicCollection(c.Request.Context(), c.Param("slug"),
+		c.GetHeader(CollectionPasswordHeader), c.ClientIP(), h.redirectBase)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.JSON(http.StatusOK, collection)
+}
+
+// PublicPage 以 HTML 页面展示公开集合，受密码保护时先显示密码表单，表单以 POST 提交到同一地址
+func (h *LinkCollectionHandler) PublicPage(c *gin.Context) {
+	password := ""
+	if c.Request.Method == http.MethodPost {
+		password = c.PostForm("password")
+	}
+
+	collection, err := h.collectionService.GetPublicCollection(c.Request.Context(), c.Param("slug"), password, c.ClientIP(), h.redirectBase)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https: http:; form-action 'self'")
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		data := gin.H{"Message": resp.Message}
+		switch code {
+		case http.StatusUnauthorized:
+			data["PasswordRequired"] = true
+			data["Retry"] = password != ""
+		case http.StatusTooManyRequests:
+			data["PasswordRequired"] = true
+			data["Retry"] = true
+		}
+		c.Status(code)
+		_ = collectionPageTemplate.Execute(c.Writer, data)
+		return
+	}
+
+	c.Status(http.StatusOK)
+	_ = collectionPageTemplate.Execute(c.Writer, gin.H{"Collection": collection})
+}
+
+// collectionPageTemplate 公开集合页面，html/template 会对所有内容转义
+var collectionPageTemplate = template.Must(template.New("collection").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{with .Collection}}{{.Name}}{{else}}链接集合{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", sans-serif; max-width: 720px; margin: 40px auto; padding: 0 16px; color: #222; }
+h1 { font-size: 24px; margin-bottom: 4px; }
+.desc { color: #666; margin-bottom: 24px; white-space: pre-line; }
+ul { list-style: none; padding: 0; }
+li { display: flex; gap: 12px; padding: 12px 0; border-bottom: 1px solid #eee; }
+li img { width: 64px; height: 64px; object-fit: cover; border-radius: 4px; flex-shrink: 0; }
+a { color: #1a56db; font-weight: 600; text-decoration: none; }
+a:hover { text-decoration: underline; }
+.meta { color: #888; font-size: 13px; margin-top: 4px; }
+.error { color: #b91c1c; }
+form { display: flex; gap: 8px; }
+input { padding: 6px 8px; }
+</style>
+</head>
+<body>
+{{with .Collection}}
+<h1>{{.Name}}</h1>
+{{if .Description}}<div class="desc">{{.Description}}</div>{{end}}
+<ul>
+{{range .Links}}
+<li>
+{{if .ImageURL}}<img src="{{.ImageURL}}" alt="" loading="lazy" referrerpolicy="no-referrer">{{end}}
+<div>
+<a href="{{.URL}}" rel="noopener" target="_blank">{{.Title}}</a>
+{{if .Description}}<div>{{.Description}}</div>{{end}}
+<div class="meta">{{.Host}}{{if .Category}} · {{.Category}}{{end}}</div>
+</div>
+</li>
+{{else}}
+<li>集合中暂无链接</li>
+{{end}}
+</ul>
+{{else}}
+{{if .PasswordRequired}}
+<h1>该集合需要访问密码</h1>
+{{if .Retry}}<p class="error">{{.Message}}</p>{{end}}
+<form method="post">
+<input type="password" name="password" placeholder="访问密码" autofocus required>
+<button type="submit">访问</button>
+</form>
+{{else}}
+<h1>{{.Message}}</h1>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// LinkCrawlHandler 站点爬取任务处理器
+type LinkCrawlHandler struct {
+	crawlService *services.LinkCrawlService
+}
+
+// NewLinkCrawlHandler 创建站点爬取任务处理器实例
+func NewLinkCrawlHandler(crawlService *services.LinkCrawlService) *LinkCrawlHandler {
+	return &LinkCrawlHandler{
+		crawlService: crawlService,
+	}
+}
+
+// CreateJob 创建站点爬取任务，立即返回任务ID
+func (h *LinkCrawlHandler) CreateJob(c *gin.Context) {
+	var req models.LinkCrawlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无效的请求参数", http.StatusBadRequest))
+		return
+	}
+
+	job, err := h.crawlService.CreateJob(c.Request.Context(), req)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "爬取任务已创建",
+		"job_id":  job.ID.Hex(),
+		"job":     job,
+	})
+}
+
+// ListJobs 获取最近的爬取任务
+func (h *LinkCrawlHandler) ListJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	jobs, err := h.crawlService.ListJobs(c.Request.Context(), limit)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetJob 获取爬取任务进度，完成后 check_job_id 为对应的检测任务
+func (h *LinkCrawlHandler) GetJob(c *gin.Context) {
+	job, err := h.crawlService.GetJob(c.Request.Context(), c.Param("jobId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ListJobPages 分页获取爬取过的页面，failed=true 只返回抓取失败的页面
+func (h *LinkCrawlHandler) ListJobPages(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+
+	var failed *bool
+	if raw := c.Query("failed"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errors.NewError("无效的查询参数", http.StatusBadRequest))
+			return
+		}
+		failed = &value
+	}
+
+	response, err := h.crawlService.ListJobPages(c.Request.Context(), c.Param("jobId"), failed, page, perPage)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelJob 取消爬取任务
+func (h *LinkCrawlHandler) CancelJob(c *gin.Context) {
+	job, err := h.crawlService.CancelJob(c.Request.Context(), c.Param("jobId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已请求取消爬取任务",
+		"job":     job,
+	})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// LinkImportHandler 外链批量导入处理器
+type LinkImportHandler struct {
+	importService *services.LinkImportService
+	maxFileBytes  int64
+}
+
+// NewLinkImportHandler 创建外链批量导入处理器实例，maxFileBytes 为上传请求体的大小上限
+func NewLinkImportHandler(importService *services.LinkImportService, maxFileBytes int64) *LinkImportHandler {
+	if maxFileBytes <= 0 {
+		maxFileBytes = 20 << 20
+	}
+	return &LinkImportHandler{
+		importService: importService,
+		maxFileBytes:  maxFileBytes,
+	}
+}
+
+// ImportExternalLinks 上传文件批量导入外链
+// 表单字段: file 文件, format 格式(默认按扩展名推断), mapping 字段映射JSON, default_category 默认分类, dry_run 只预演不写入
+func (h *LinkImportHandler) ImportExternalLinks(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxFileBytes)
+	fileHeader, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		msg := fmt.Sprintf("导入文件过大，最大 %d MB", h.maxFileBytes>>20)
+		c.JSON(http.StatusRequestEntityTooLarge, errors.NewError(msg, http.StatusRequestEntityTooLarge))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("请上传导入文件", http.StatusBadRequest))
+		return
+	}
+
+	opts := models.LinkImportOptions{
+		Format:          c.PostForm("format"),
+		DefaultCategory: c.PostForm("default_category"),
+	}
+	if opts.Format == "" {
+		opts.Format = services.DetectLinkFormat(fileHeader.Filename)
+	}
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts.Mapping); err != nil {
+			c.JSON(http.StatusBadRequest, errors.NewError("无效的字段映射", http.StatusBadRequest))
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewError("无法读取导入文件", http.StatusBadRequest))
+		return
+	}
+	defer file.Close()
+
+	if dryRun, _ := strconv.ParseBool(c.PostForm("dry_run")); dryRun {
+		preview, err := h.importService.Preview(c.Request.Context(), file, opts)
+		if err != nil {
+			code, resp := errors.NewErrorResponse(err)
+			c.JSON(code, resp)
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+		return
+	}
+
+	job, err := h.importService.CreateJob(c.Request.Context(), file, fileHeader.Filename, opts)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "导入任务已创建",
+		"job_id":  job.ID.Hex(),
+		"job":     job,
+	})
+}
+
+// ListImportJobs 获取最近的导入任务
+func (h *LinkImportHandler) ListImportJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	jobs, err := h.importService.ListJobs(c.Request.Context(), limit)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetImportJob 获取导入任务进度
+func (h *LinkImportHandler) GetImportJob(c *gin.Context) {
+	job, err := h.importService.GetJob(c.Request.Context(), c.Param("jobId"))
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ListImportJobErrors 分页获取导入任务的错误行
+func (h *LinkImportHandler) ListImportJobErrors(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+
+	response, err := h.importService.ListJobErrors(c.Request.Context(), c.Param("jobId"), page, perPage)
+	if err != nil {
+		code, resp := errors.NewErrorResponse(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -1118,6 +1118,68 @@ func (h *PluginHandler) SetupPluginDatabase(c *gin.Context) {
 	})
 }
 
+// GetPluginSettings 获取插件配置（敏感值已掩码）
+func (h *PluginHandler) GetPluginSettings(c *gin.Context) {
+	pluginKey := c.Param("id")
+	dependencies := h.getPluginDependencyConfig(pluginKey)
+
+	statuses := h.dependencyService.GetPluginSettings(c.Request.Context(), pluginKey, dependencies.Environment)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    statuses,
+	})
+}
+
+// UpdatePluginSettings 设置插件配置，用于补充缺失的环境变量
+func (h *PluginHandler) UpdatePluginSettings(c *gin.Context) {
+	pluginKey := c.Param("id")
+
+	var req models.PluginSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Values) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的配置数据",
+		})
+		return
+	}
+
+	dependencies := h.getPluginDependencyConfig(pluginKey)
+	if err := h.dependencyService.SavePluginSettings(c.Request.Context(), pluginKey, dependencies.Environment, req.Values); err != nil {
+		code, resp := customerrors.NewErrorResponse(err)
+		c.JSON(code, gin.H{
+			"success": false,
+			"message": resp.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "插件配置已保存",
+		"data":    h.dependencyService.GetPluginSettings(c.Request.Context(), pluginKey, dependencies.Environment),
+	})
+}
+
+// DeletePluginSetting 删除插件配置项
+func (h *PluginHandler) DeletePluginSetting(c *gin.Context) {
+	pluginKey := c.Param("id")
+	name := c.Param("name")
+
+	if err := h.dependencyService.DeletePluginSetting(c.Request.Context(), pluginKey, name); err != nil {
+		code, resp := customerrors.NewErrorResponse(err)
+		c.JSON(code, gin.H{
+			"success": false,
+			"message": resp.Message,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "插件配置已删除",
+	})
+}
+
 // getPluginDependencyConfig 获取插件依赖配置
 func (h *PluginHandler) getPluginDependencyConfig(pluginKey string) *models.PluginDependency {
 	// 这里应该从插件目录中的依赖配置文件读取
@@ -1163,8 +1225,12 @@ func (h *PluginHandler) getPluginDependencyConfig(pluginKey string) *models.Plug
 					Name:        "MONGODB_URI",
 					Required:    true,
 					Type:        "url",
+					Secret:      true,
 					Description: "MongoDB连接字符串",
 					Default:     "mongodb://localhost:27017",
+					Validation: &models.EnvironmentValidation{
+						AllowedSchemes: []string{"mongodb", "mongodb+srv"},
+					},
 				},
 			},
 			Dependencies: []models.Dependency{
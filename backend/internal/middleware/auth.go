@@ -43,6 +43,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("teams", claims.Teams)
 
 		c.Next()
 	}
@@ -97,4 +98,4 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		// 调用下一个处理器
 		next.ServeHTTP(w, r)
 	})
-} 
\ No newline at end of file
+}
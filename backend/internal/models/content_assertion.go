@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 内容校验失败项
+const (
+	AssertionMustContain    = "must_contain"
+	AssertionMustNotContain = "must_not_contain"
+	AssertionTitlePattern   = "title_pattern"
+	AssertionMinBodyBytes   = "min_body_bytes"
+	AssertionContentType    = "content_type"
+	AssertionSoft404        = "soft_404"
+)
+
+// ContentAssertion 链接内容校验规则
+type ContentAssertion struct {
+	MustContain    []string `bson:"must_contain,omitempty" json:"must_contain,omitempty"`         // 页面必须包含的文本（不区分大小写）
+	MustNotContain []string `bson:"must_not_contain,omitempty" json:"must_not_contain,omitempty"` // 页面不能包含的文本（不区分大小写）
+	TitlePattern   string   `bson:"title_pattern,omitempty" json:"title_pattern,omitempty"`       // 页面标题需匹配的正则
+	MinBodyBytes   int      `bson:"min_body_bytes,omitempty" json:"min_body_bytes,omitempty"`     // 响应内容最小字节数
+	ContentType    string   `bson:"content_type,omitempty" json:"content_type,omitempty"`         // 期望的内容类型，如 text/html
+	DetectSoft404  bool     `bson:"detect_soft_404,omitempty" json:"detect_soft_404,omitempty"`   // 是否启用软404检测
+}
+
+// IsEmpty 是否未配置任何校验规则
+func (a *ContentAssertion) IsEmpty() bool {
+	return a == nil || (len(a.MustContain) == 0 && len(a.MustNotContain) == 0 &&
+		a.TitlePattern == "" && a.MinBodyBytes == 0 && a.ContentType == "" && !a.DetectSoft404)
+}
+
+// CategoryAssertion 分类级别的内容校验规则，链接未单独配置时生效
+type CategoryAssertion struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Category   string             `bson:"category" json:"category"`
+	Assertions ContentAssertion   `bson:"assertions" json:"assertions"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
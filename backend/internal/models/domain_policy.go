@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 域名策略匹配方式
+const (
+	DomainMatchExact    = "exact"    // 主机名完全一致，策略开启 IncludeWWW 时也匹配 www. 前缀
+	DomainMatchSuffix   = "suffix"   // 主机名等于该域名或为其子域名
+	DomainMatchWildcard = "wildcard" // 通配符匹配，如 *.google.com、api-*.example.com
+)
+
+// DomainPolicy 按域名配置的检测策略
+type DomainPolicy struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Pattern             string             `bson:"pattern" json:"pattern"`
+	MatchType           string             `bson:"match_type" json:"match_type"`
+	IncludeWWW          bool               `bson:"include_www,omitempty" json:"include_www,omitempty"` // 精确匹配时同时匹配 www. 前缀的主机
+	Description         string             `bson:"description,omitempty" json:"description,omitempty"`
+	Enabled             bool               `bson:"enabled" json:"enabled"`
+	TimeoutSeconds      int                `bson:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
+	AllowedMethods      []string           `bson:"allowed_methods,omitempty" json:"allowed_methods,omitempty"`
+	Headers             map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"`
+	ExpectedStatusCodes []int              `bson:"expected_status_codes,omitempty" json:"expected_status_codes,omitempty"`
+	ResetIsHealthy      bool               `bson:"reset_is_healthy" json:"reset_is_healthy"`
+	ErrorIsHealthy      bool               `bson:"error_is_healthy" json:"error_is_healthy"`
+	HealthyMessage      string             `bson:"healthy_message,omitempty" json:"healthy_message,omitempty"`
+	RateLimitPerMinute  int                `bson:"rate_limit_per_minute,omitempty" json:"rate_limit_per_minute,omitempty"`
+	CheckProfile        string             `bson:"check_profile,omitempty" json:"check_profile,omitempty"` // 检测器配置，为空时由检测来源决定
+	Proxy               string             `bson:"proxy,omitempty" json:"proxy,omitempty"`                 // 出站代理：direct、pool、region:<地区>、代理名称或代理地址，为空时使用默认配置
+	CreatedAt           time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt           time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Timeout 返回策略的请求超时时间
+func (p *DomainPolicy) Timeout() time.Duration {
+	return time.Duration(p.TimeoutSeconds) * time.Second
+}
+
+// AllowsMethod 策略是否允许使用指定的请求方法
+func (p *DomainPolicy) AllowsMethod(method string) bool {
+	for _, m := range p.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpectedStatus 状态码是否符合策略预期，未配置时 2xx/3xx 视为可用
+func (p *DomainPolicy) IsExpectedStatus(code int) bool {
+	if len(p.ExpectedStatusCodes) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, expected := range p.ExpectedStatusCodes {
+		if expected == code {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainPolicyRequest 创建/更新域名策略请求
+type DomainPolicyRequest struct {
+	Pattern             string            `json:"pattern" binding:"required"`
+	MatchType           string            `json:"match_type"`
+	IncludeWWW          bool              `json:"include_www"`
+	Description         string            `json:"description"`
+	Enabled             *bool             `json:"enabled"`
+	TimeoutSeconds      int               `json:"timeout_seconds"`
+	AllowedMethods      []string          `json:"allowed_methods"`
+	Headers             map[string]string `json:"headers"`
+	ExpectedStatusCodes []int             `json:"expected_status_codes"`
+	ResetIsHealthy      bool              `json:"reset_is_healthy"`
+	ErrorIsHealthy      bool              `json:"error_is_healthy"`
+	HealthyMessage      string            `json:"healthy_message"`
+	RateLimitPerMinute  int               `json:"rate_limit_per_minute"`
+	CheckProfile        string            `json:"check_profile"`
+	Proxy               string            `json:"proxy"`
+}
+
+// DomainPolicyPreview 域名策略匹配预览
+type DomainPolicyPreview struct {
+	URL        string         `json:"url"`
+	Host       string         `json:"host"`
+	Matched    bool           `json:"matched"`
+	Policy     *DomainPolicy  `json:"policy,omitempty"`
+	Effective  DomainPolicy   `json:"effective"`
+	Candidates []DomainPolicy `json:"candidates"`
+}
@@ -8,43 +8,168 @@ import (
 
 // ExternalLink 表示一个外部链接
 type ExternalLink struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	URL       string            `bson:"url" json:"url"`
-	Category  string            `bson:"category" json:"category"`
-	Clicks    int               `bson:"clicks" json:"clicks"`
-	Status    bool              `bson:"status" json:"status"`
-	IsValid   bool              `bson:"is_valid" json:"is_valid"`
-	IsActive  bool              `bson:"is_active" json:"is_active"`
-	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	URL           string             `bson:"url" json:"url"`
+	NormalizedURL string             `bson:"normalized_url,omitempty" json:"normalized_url,omitempty"`
+	Slug          string             `bson:"slug,omitempty" json:"slug,omitempty"`
+	Title         string             `bson:"title,omitempty" json:"title,omitempty"`
+	Description   string             `bson:"description,omitempty" json:"description,omitempty"`
+	Tags          []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	Priority      int                `bson:"priority" json:"priority"`
+	ExpiresAt     *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Category      string             `bson:"category" json:"category"`
+	Clicks        int                `bson:"clicks" json:"clicks"`
+	Status        bool               `bson:"status" json:"status"`
+	IsValid       bool               `bson:"is_valid" json:"is_valid"`
+	IsActive      bool               `bson:"is_active" json:"is_active"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Owner 所有者，user:<用户ID> 或 team:<团队名>，为空表示所有用户共享
+	Owner     string `bson:"owner,omitempty" json:"owner,omitempty"`
+	CreatedBy string `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	UpdatedBy string `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+
+	LastCheckedAt  *time.Time    `bson:"last_checked_at,omitempty" json:"last_checked_at,omitempty"`
+	LastClickedAt  *time.Time    `bson:"last_clicked_at,omitempty" json:"last_clicked_at,omitempty"`
+	LastCheckError string        `bson:"last_check_error,omitempty" json:"last_check_error,omitempty"`
+	LastErrorCode  LinkErrorCode `bson:"last_error_code,omitempty" json:"last_error_code,omitempty"` // 最近一次检测失败的分类，检测成功时清除
+	SkipReason     string        `bson:"skip_reason,omitempty" json:"skip_reason,omitempty"`         // 最近一次检测被跳过的原因，为空表示已正常检测
+
+	// ConsecutiveFailures 连续检测失败次数，AlertState 为 down 表示已发出告警且尚未恢复
+	ConsecutiveFailures int    `bson:"consecutive_failures,omitempty" json:"consecutive_failures,omitempty"`
+	AlertState          string `bson:"alert_state,omitempty" json:"alert_state,omitempty"`
+
+	Assertions *ContentAssertion `bson:"assertions,omitempty" json:"assertions,omitempty"`
+
+	// CheckProfile 检测器配置，为空时使用域名策略中的配置
+	CheckProfile string `bson:"check_profile,omitempty" json:"check_profile,omitempty"`
+
+	CanonicalURL string            `bson:"canonical_url,omitempty" json:"canonical_url,omitempty"`
+	URLHistory   []URLHistoryEntry `bson:"url_history,omitempty" json:"url_history,omitempty"`
+
+	TLS *TLSInfo `bson:"tls,omitempty" json:"tls,omitempty"`
+	DNS *DNSInfo `bson:"dns,omitempty" json:"dns,omitempty"`
+
+	// FoundOn 爬取自有站点时发现该链接的页面
+	FoundOn []string `bson:"found_on,omitempty" json:"found_on,omitempty"`
+
+	// Metadata 页面元数据，由检测流程定期提取
+	Metadata *LinkMetadata `bson:"metadata,omitempty" json:"metadata,omitempty"`
+
+	// Score 关键词搜索的相关度，只在搜索结果中出现
+	Score float64 `bson:"score,omitempty" json:"score,omitempty"`
+}
+
+// TLSCertificate 证书链中的单个证书摘要
+type TLSCertificate struct {
+	Subject  string    `bson:"subject" json:"subject"`
+	Issuer   string    `bson:"issuer" json:"issuer"`
+	NotAfter time.Time `bson:"not_after" json:"not_after"`
+}
+
+// TLSInfo HTTPS 链接的证书信息
+type TLSInfo struct {
+	Subject          string           `bson:"subject" json:"subject"`
+	Issuer           string           `bson:"issuer" json:"issuer"`
+	SANs             []string         `bson:"sans,omitempty" json:"sans,omitempty"`
+	NotBefore        time.Time        `bson:"not_before" json:"not_before"`
+	NotAfter         time.Time        `bson:"not_after" json:"not_after"`
+	DaysRemaining    int              `bson:"days_remaining" json:"days_remaining"`
+	Version          string           `bson:"version" json:"version"`
+	Chain            []TLSCertificate `bson:"chain,omitempty" json:"chain,omitempty"`
+	Trusted          bool             `bson:"trusted" json:"trusted"`
+	VerifyError      string           `bson:"verify_error,omitempty" json:"verify_error,omitempty"`
+	Expired          bool             `bson:"expired" json:"expired"`
+	ExpiringSoon     bool             `bson:"expiring_soon" json:"expiring_soon"`
+	HostnameMismatch bool             `bson:"hostname_mismatch" json:"hostname_mismatch"`
+	WeakProtocol     bool             `bson:"weak_protocol" json:"weak_protocol"`
+	Error            string           `bson:"error,omitempty" json:"error,omitempty"`
+	CheckedAt        time.Time        `bson:"checked_at" json:"checked_at"`
+}
+
+// URLHistoryEntry 链接地址变更记录
+type URLHistoryEntry struct {
+	URL        string              `bson:"url" json:"url"`
+	ReplacedAt time.Time           `bson:"replaced_at" json:"replaced_at"`
+	Reason     string              `bson:"reason" json:"reason"`
+	MergedID   *primitive.ObjectID `bson:"merged_id,omitempty" json:"merged_id,omitempty"` // 合并重复链接时被合并链接的ID
+}
+
+// RedirectHop 重定向链中的一跳
+type RedirectHop struct {
+	URL        string `bson:"url" json:"url"`
+	StatusCode int    `bson:"status_code" json:"status_code"`
+	Location   string `bson:"location,omitempty" json:"location,omitempty"`
+	DurationMs int64  `bson:"duration_ms" json:"duration_ms"`
+}
+
+// CanonicalRewriteRequest 将链接地址改写为永久重定向目标的请求
+type CanonicalRewriteRequest struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all,omitempty"`
+}
+
+// CanonicalRewriteResult 地址改写结果
+type CanonicalRewriteResult struct {
+	Updated   int            `json:"updated"`
+	Links     []ExternalLink `json:"links"`
+	Conflicts []string       `json:"conflicts,omitempty"`
 }
 
 // ExternalLinkQuery 外链查询参数
 type ExternalLinkQuery struct {
-	Page        int    `form:"page"`
-	PerPage     int    `form:"per_page"`
-	Keyword     string `form:"keyword"`
-	Category    string `form:"category"`
-	Status      string `form:"status"`
-	IsValid     *bool  `form:"is_valid"`
-	MinPriority int    `form:"min_priority"`
-	MaxPriority int    `form:"max_priority"`
-	MinClicks   int    `form:"min_clicks"`
-	OnlyValid   bool   `form:"only_valid"`
-	Popular     bool   `form:"popular"`
-	SortField   string `form:"sort_field"`
-	SortOrder   string `form:"sort_order"`
+	Page         int     `form:"page"`
+	PerPage      int     `form:"per_page"`
+	Keyword      string  `form:"keyword"`
+	Category     string  `form:"category"`
+	Status       string  `form:"status"`
+	IsValid      *bool   `form:"is_valid"`
+	Tags         string  `form:"tags"` // 逗号分隔，需同时包含全部标签
+	MinPriority  *int    `form:"min_priority"`
+	MaxPriority  *int    `form:"max_priority"`
+	MinClicks    int     `form:"min_clicks"`
+	OnlyValid    bool    `form:"only_valid"`
+	Popular      bool    `form:"popular"` // 只返回有点击的链接，未指定排序时按点击量降序
+	Expired      *bool   `form:"expired"`
+	ExpiringDays int     `form:"expiring_days"` // 未过期且在指定天数内到期
+	Redirected   bool    `form:"redirected"`
+	TLSIssue     string  `form:"tls_issue"`
+	TLSDays      int     `form:"tls_expiring_days"`
+	SortField    string  `form:"sort_field"`
+	SortOrder    string  `form:"sort_order"`
+	Cursor       *string `form:"cursor"` // 指定时使用游标分页，首页传空字符串，之后传上一页返回的 next_cursor
+	Count        string  `form:"count"`  // exact、approx 或 none，页码分页默认 exact，游标分页默认 none
+	Owner        string  `form:"owner"`  // user:<ID>、team:<名称>、none 或 me，只能在调用者可见的范围内筛选
 }
 
 // ExternalLinkResponse 外链响应结构
 type ExternalLinkResponse struct {
 	Data []ExternalLink `json:"data"`
 	Meta struct {
-		Total       int `json:"total"`
-		PerPage     int `json:"per_page"`
-		CurrentPage int `json:"current_page"`
-		LastPage    int `json:"last_page"`
+		Total            int    `json:"total"`
+		PerPage          int    `json:"per_page"`
+		CurrentPage      int    `json:"current_page"`
+		LastPage         int    `json:"last_page"`
+		TotalApproximate bool   `json:"total_approximate,omitempty"`
+		NextCursor       string `json:"next_cursor,omitempty"`
+		HasMore          bool   `json:"has_more,omitempty"`
 	} `json:"meta"`
+	Facets *LinkFacets `json:"facets,omitempty"`
+}
+
+// FacetCount 分面中的一个取值及匹配的链接数
+type FacetCount struct {
+	Value string `bson:"_id" json:"value"`
+	Count int    `bson:"count" json:"count"`
+}
+
+// LinkFacets 当前筛选条件下按分类、标签、可用性和主机统计的链接数
+type LinkFacets struct {
+	Categories []FacetCount `bson:"categories" json:"categories"`
+	Tags       []FacetCount `bson:"tags" json:"tags"`
+	Validity   []FacetCount `bson:"validity" json:"validity"`
+	Hosts      []FacetCount `bson:"hosts" json:"hosts"`
 }
 
 // ExternalStatistics 外链统计信息
@@ -52,27 +177,103 @@ type ExternalStatistics struct {
 	TotalLinks    int            `json:"total_links"`
 	ActiveLinks   int            `json:"active_links"`
 	ExpiredLinks  int            `json:"expired_links"`
+	ExpiringLinks int            `json:"expiring_links"`
 	InvalidLinks  int            `json:"invalid_links"`
 	TotalClicks   int            `json:"total_clicks"`
 	AverageClicks float64        `json:"average_clicks"`
 	Categories    map[string]int `json:"categories"`
 	Tags          map[string]int `json:"tags"`
+	Priorities    map[int]int    `json:"priorities"`
+	TLS           TLSStatistics  `json:"tls"`
+}
+
+// LinkTag 标签及使用该标签的链接数
+type LinkTag struct {
+	Name  string `bson:"_id" json:"name"`
+	Count int    `bson:"count" json:"count"`
+}
+
+// TagRenameRequest 重命名标签，目标标签已存在时合并
+type TagRenameRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// TagMergeRequest 将多个标签合并为一个
+type TagMergeRequest struct {
+	Sources []string `json:"sources" binding:"required"`
+	Target  string   `json:"target" binding:"required"`
+}
+
+// 证书问题筛选条件
+const (
+	TLSIssueAny              = "any"
+	TLSIssueExpiring         = "expiring"
+	TLSIssueExpired          = "expired"
+	TLSIssueHostnameMismatch = "hostname_mismatch"
+	TLSIssueWeakProtocol     = "weak_protocol"
+	TLSIssueUntrusted        = "untrusted"
+)
+
+// TLSStatistics HTTPS 证书统计
+type TLSStatistics struct {
+	WindowDays       int `json:"window_days"`
+	Monitored        int `json:"monitored"`
+	ExpiringSoon     int `json:"expiring_soon"`
+	Expired          int `json:"expired"`
+	HostnameMismatch int `json:"hostname_mismatch"`
+	WeakProtocol     int `json:"weak_protocol"`
+	Untrusted        int `json:"untrusted"`
 }
 
-// ExternalTrend 外链趋势数据
+// ExternalTrend 外链趋势数据，每个时间桶一条
+// Date 为时间桶起点（按请求时区的 RFC3339），ChecksValid/ChecksInvalid 为该时间段内检测结果可用/不可用的次数
 type ExternalTrend struct {
-	Date        string `json:"date"`
-	NewLinks    int    `json:"new_links"`
-	TotalClicks int    `json:"total_clicks"`
-	ActiveLinks int    `json:"active_links"`
+	Date          string `json:"date"`
+	NewLinks      int    `json:"new_links"`
+	TotalClicks   int    `json:"total_clicks"`
+	ChecksValid   int    `json:"checks_valid"`
+	ChecksInvalid int    `json:"checks_invalid"`
+}
+
+// ExternalTrendQuery 趋势查询参数
+// Interval 可选 hour、day、week、month，Period 为 Interval 的旧参数名；未指定 From 时取最近 Limit 个时间桶
+type ExternalTrendQuery struct {
+	Interval string `form:"interval"`
+	Period   string `form:"period"`
+	Timezone string `form:"tz"`
+	From     string `form:"from"`
+	To       string `form:"to"`
+	Limit    int    `form:"limit"`
+	Owner    string `form:"owner"` // 按所有者统计，取值同 ExternalLinkQuery.Owner
 }
 
 // LinkCheckResult 链接检测结果
 type LinkCheckResult struct {
-	ID           string `json:"id"`
-	URL          string `json:"url"`
-	IsValid      bool   `json:"is_valid"`
-	Message      string `json:"message"`
-	ErrorMessage string `json:"error_message,omitempty"`
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	IsValid      bool      `json:"is_valid"`
+	Message      string    `json:"message"`
+	ErrorMessage string    `json:"error_message,omitempty"`
 	CheckedAt    time.Time `json:"checked_at"`
-} 
\ No newline at end of file
+
+	StatusCode int           `json:"status_code,omitempty"`
+	LatencyMs  int64         `json:"latency_ms"`
+	FinalURL   string        `json:"final_url,omitempty"`
+	ErrorClass LinkErrorCode `json:"error_class,omitempty"`
+	Profile    string        `json:"profile,omitempty"`
+	Attempts   int           `json:"attempts,omitempty"`
+	Proxy      string        `json:"proxy,omitempty"`
+
+	FailedAssertion string `json:"failed_assertion,omitempty"`
+
+	RedirectChain     []RedirectHop `json:"redirect_chain,omitempty"`
+	PermanentRedirect bool          `json:"permanent_redirect,omitempty"`
+	CanonicalURL      string        `json:"canonical_url,omitempty"`
+
+	TLS *TLSInfo `json:"tls,omitempty"`
+	DNS *DNSInfo `json:"dns,omitempty"`
+
+	// Skipped 为 true 表示没有实际检测，IsValid 没有意义
+	Skipped    bool   `json:"skipped,omitempty"`
+	SkipReason string `json:"skip_reason,omitempty"`
+}
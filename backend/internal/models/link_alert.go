@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 告警事件类型
+const (
+	LinkAlertDown      = "down"      // 连续失败次数达到阈值
+	LinkAlertRecovered = "recovered" // 告警后重新可用
+)
+
+// 告警通知渠道
+const (
+	LinkAlertChannelWebhook = "webhook"
+	LinkAlertChannelEmail   = "email"
+)
+
+// 通知发送状态
+const (
+	LinkAlertDeliverySent   = "sent"
+	LinkAlertDeliveryFailed = "failed"
+)
+
+// LinkAlertEvent 链接状态变化事件，DigestID 为空表示尚未发送
+type LinkAlertEvent struct {
+	ID                  primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	LinkID              primitive.ObjectID  `bson:"link_id" json:"link_id"`
+	URL                 string              `bson:"url" json:"url"`
+	Title               string              `bson:"title,omitempty" json:"title,omitempty"`
+	Type                string              `bson:"type" json:"type"`
+	ConsecutiveFailures int                 `bson:"consecutive_failures" json:"consecutive_failures"`
+	StatusCode          int                 `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	ErrorClass          LinkErrorCode       `bson:"error_class,omitempty" json:"error_class,omitempty"`
+	ErrorMessage        string              `bson:"error_message,omitempty" json:"error_message,omitempty"`
+	OccurredAt          time.Time           `bson:"occurred_at" json:"occurred_at"`
+	DigestID            *primitive.ObjectID `bson:"digest_id,omitempty" json:"digest_id,omitempty"`
+}
+
+// LinkAlertDelivery 一次摘要在单个渠道上的发送结果
+type LinkAlertDelivery struct {
+	Channel     string     `bson:"channel" json:"channel"`
+	Target      string     `bson:"target" json:"target"`
+	Status      string     `bson:"status" json:"status"`
+	Attempts    int        `bson:"attempts" json:"attempts"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	DeliveredAt *time.Time `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+}
+
+// LinkAlertDigest 告警摘要，一个时间窗口内的事件合并为一次通知
+// 同一链接在窗口内多次变化时保留第一次和最后一次，Suppressed 为被合并的事件数
+// Requeued 表示所有渠道都发送失败，事件已退回等待下一个窗口重新发送
+type LinkAlertDigest struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Test       bool                `bson:"test,omitempty" json:"test,omitempty"`
+	Down       int                 `bson:"down" json:"down"`
+	Recovered  int                 `bson:"recovered" json:"recovered"`
+	Suppressed int                 `bson:"suppressed" json:"suppressed"`
+	Events     []LinkAlertEvent    `bson:"events" json:"events"`
+	Deliveries []LinkAlertDelivery `bson:"deliveries" json:"deliveries"`
+	Requeued   bool                `bson:"requeued,omitempty" json:"requeued,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 检测来源
+const (
+	LinkCheckSourceBatch     = "batch"
+	LinkCheckSourceScheduler = "scheduler"
+	LinkCheckSourceJob       = "job"
+)
+
+// 检测器配置，可在链接或域名策略上指定，域名策略配置了代理时结果中的配置名带 +proxy 后缀
+const (
+	LinkCheckProfileHeadGet = "head_get" // 先 HEAD，失败或不支持时再 GET
+	LinkCheckProfileGet     = "get"      // 只使用 GET
+	LinkCheckProfileBrowser = "browser"  // GET 并模拟浏览器请求头
+)
+
+// 跳过检测的原因
+const (
+	LinkSkipRobots = "robots_disallowed" // 礼貌模式下 robots.txt 禁止访问
+	LinkSkipProxy  = "proxy_unavailable" // 域名策略要求的出站代理均不可用
+)
+
+// LinkErrorCode 检测失败分类，保存在检测记录和链接上，界面按分类显示本地化的说明
+type LinkErrorCode string
+
+// 检测失败分类
+const (
+	LinkErrorTimeout           LinkErrorCode = "timeout"
+	LinkErrorDNS               LinkErrorCode = "dns"
+	LinkErrorDNSNXDomain       LinkErrorCode = "dns_nxdomain"
+	LinkErrorDNSServFail       LinkErrorCode = "dns_servfail"
+	LinkErrorDNSTimeout        LinkErrorCode = "dns_timeout"
+	LinkErrorTLS               LinkErrorCode = "tls"
+	LinkErrorConnectionRefused LinkErrorCode = "connection_refused"
+	LinkErrorConnectionReset   LinkErrorCode = "connection_reset"
+	LinkErrorNetwork           LinkErrorCode = "network"
+	LinkErrorTooManyRedirects  LinkErrorCode = "too_many_redirects"
+	LinkErrorInvalidRequest    LinkErrorCode = "invalid_request"
+	LinkErrorRateLimited       LinkErrorCode = "rate_limited"
+	LinkErrorClientError       LinkErrorCode = "client_error"
+	LinkErrorServerError       LinkErrorCode = "server_error"
+	LinkErrorUnknownStatus     LinkErrorCode = "unknown_status"
+	LinkErrorUnexpectedStatus  LinkErrorCode = "unexpected_status"
+	LinkErrorCancelled         LinkErrorCode = "cancelled"
+	LinkErrorAssertionFailed   LinkErrorCode = "assertion_failed"
+	LinkErrorSoft404           LinkErrorCode = "soft_404"
+	LinkErrorProxy             LinkErrorCode = "proxy"
+)
+
+// Transient 是否为暂时性失败，检测时会退避后重试，重试用尽仍失败才标记为失效
+func (c LinkErrorCode) Transient() bool {
+	switch c {
+	case LinkErrorTimeout, LinkErrorConnectionReset, LinkErrorNetwork, LinkErrorRateLimited, LinkErrorServerError,
+		LinkErrorDNSServFail, LinkErrorDNSTimeout:
+		return true
+	}
+	return false
+}
+
+// IsDNS 是否为域名解析失败
+func (c LinkErrorCode) IsDNS() bool {
+	switch c {
+	case LinkErrorDNS, LinkErrorDNSNXDomain, LinkErrorDNSServFail, LinkErrorDNSTimeout:
+		return true
+	}
+	return false
+}
+
+// LinkCheck 单次链接检测记录，保存在 link_checks 时序集合中
+type LinkCheck struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	LinkID       primitive.ObjectID `bson:"link_id" json:"link_id"`
+	URL          string             `bson:"url" json:"url"`
+	IsValid      bool               `bson:"is_valid" json:"is_valid"`
+	Message      string             `bson:"message,omitempty" json:"message,omitempty"`
+	ErrorMessage string             `bson:"error_message,omitempty" json:"error_message,omitempty"`
+	Source       string             `bson:"source" json:"source"`
+	CheckedAt    time.Time          `bson:"checked_at" json:"checked_at"`
+	StatusCode   int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	LatencyMs    int64              `bson:"latency_ms" json:"latency_ms"`
+	FinalURL     string             `bson:"final_url,omitempty" json:"final_url,omitempty"`
+	ErrorClass   LinkErrorCode      `bson:"error_class,omitempty" json:"error_class,omitempty"`
+	Profile      string             `bson:"profile,omitempty" json:"profile,omitempty"`
+	Attempts     int                `bson:"attempts,omitempty" json:"attempts,omitempty"` // 请求次数，重试过时大于 1
+	Proxy        string             `bson:"proxy,omitempty" json:"proxy,omitempty"`       // 经过的出站代理名称
+	DNS          *DNSInfo           `bson:"dns,omitempty" json:"dns,omitempty"`
+
+	FailedAssertion   string        `bson:"failed_assertion,omitempty" json:"failed_assertion,omitempty"`
+	RedirectChain     []RedirectHop `bson:"redirect_chain,omitempty" json:"redirect_chain,omitempty"`
+	PermanentRedirect bool          `bson:"permanent_redirect,omitempty" json:"permanent_redirect,omitempty"`
+	CanonicalURL      string        `bson:"canonical_url,omitempty" json:"canonical_url,omitempty"`
+}
+
+// LinkCheckDaily 按天汇总的检测数据，原始记录过期后用于长期统计
+type LinkCheckDaily struct {
+	LinkID        primitive.ObjectID `bson:"link_id" json:"link_id"`
+	Day           time.Time          `bson:"day" json:"day"`
+	Checks        int                `bson:"checks" json:"checks"`
+	Up            int                `bson:"up" json:"up"`
+	LatencySumMs  int64              `bson:"latency_sum_ms" json:"latency_sum_ms"`
+	LatencyMinMs  int64              `bson:"latency_min_ms" json:"latency_min_ms"`
+	LatencyMaxMs  int64              `bson:"latency_max_ms" json:"latency_max_ms"`
+	LatencyChecks int                `bson:"latency_checks" json:"latency_checks"`
+}
+
+// LinkIncident 链接故障区间
+type LinkIncident struct {
+	Start      time.Time     `json:"start"`
+	End        *time.Time    `json:"end,omitempty"` // 为空表示故障仍在持续
+	DurationMs int64         `json:"duration_ms"`
+	Checks     int           `json:"checks"`
+	ErrorClass LinkErrorCode `json:"error_class,omitempty"`
+	LastError  string        `json:"last_error,omitempty"`
+}
+
+// LinkUptimeReport 链接可用率报告
+type LinkUptimeReport struct {
+	LinkID        string         `json:"link_id"`
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	Checks        int            `json:"checks"`
+	Up            int            `json:"up"`
+	Down          int            `json:"down"`
+	UptimePercent float64        `json:"uptime_percent"`
+	MeanLatencyMs float64        `json:"mean_latency_ms"`
+	MinLatencyMs  int64          `json:"min_latency_ms"`
+	MaxLatencyMs  int64          `json:"max_latency_ms"`
+	RollupFrom    *time.Time     `json:"rollup_from,omitempty"` // 该时间之前的数据来自按天汇总
+	Incidents     []LinkIncident `json:"incidents"`
+	DowntimeMs    int64          `json:"downtime_ms"`
+	OngoingOutage bool           `json:"ongoing_outage"`
+}
+
+// LinkCheckListResponse 检测记录分页响应
+type LinkCheckListResponse struct {
+	Data []LinkCheck `json:"data"`
+	Meta struct {
+		Total       int `json:"total"`
+		PerPage     int `json:"per_page"`
+		CurrentPage int `json:"current_page"`
+		LastPage    int `json:"last_page"`
+	} `json:"meta"`
+}
+
+// LinkMonitorStatus 后台巡检状态
+type LinkMonitorStatus struct {
+	Enabled        bool       `json:"enabled"`
+	Running        bool       `json:"running"`
+	InstanceID     string     `json:"instance_id"`
+	Interval       string     `json:"interval"`
+	StaleAfter     string     `json:"stale_after"`
+	BatchSize      int        `json:"batch_size"`
+	Concurrency    int        `json:"concurrency"`
+	HostInterval   string     `json:"host_interval"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastRunChecked int        `json:"last_run_checked"`
+	LastRunSkipped int        `json:"last_run_skipped"`
+	TotalChecked   int64      `json:"total_checked"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 批量检测任务状态
+const (
+	LinkCheckJobPending   = "pending"
+	LinkCheckJobRunning   = "running"
+	LinkCheckJobCompleted = "completed"
+	LinkCheckJobCancelled = "cancelled"
+	LinkCheckJobFailed    = "failed"
+)
+
+// LinkCheckJob 异步批量检测任务
+type LinkCheckJob struct {
+	ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Status          string               `bson:"status" json:"status"`
+	CheckAll        bool                 `bson:"check_all" json:"check_all"`
+	LinkIDs         []primitive.ObjectID `bson:"link_ids,omitempty" json:"-"`
+	Owners          []string             `bson:"owners,omitempty" json:"-"`
+	CreatedBy       string               `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	Total           int                  `bson:"total" json:"total"`
+	Processed       int                  `bson:"processed" json:"processed"`
+	Valid           int                  `bson:"valid" json:"valid"`
+	Invalid         int                  `bson:"invalid" json:"invalid"`
+	Skipped         int                  `bson:"skipped" json:"skipped"`
+	Percent         float64              `bson:"-" json:"percent"`
+	CancelRequested bool                 `bson:"cancel_requested" json:"cancel_requested"`
+	Error           string               `bson:"error,omitempty" json:"error,omitempty"`
+	Worker          string               `bson:"worker,omitempty" json:"worker,omitempty"`
+	CreatedAt       time.Time            `bson:"created_at" json:"created_at"`
+	StartedAt       *time.Time           `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt      *time.Time           `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	UpdatedAt       time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// Progress 返回任务完成百分比
+func (j *LinkCheckJob) Progress() float64 {
+	if j.Total == 0 {
+		return 100
+	}
+	return float64(j.Processed) * 100 / float64(j.Total)
+}
+
+// IsFinished 任务是否已结束
+func (j *LinkCheckJob) IsFinished() bool {
+	return j.Status == LinkCheckJobCompleted || j.Status == LinkCheckJobCancelled || j.Status == LinkCheckJobFailed
+}
+
+// LinkCheckJobRequest 创建批量检测任务请求
+type LinkCheckJobRequest struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all,omitempty"`
+}
+
+// LinkCheckJobResult 批量检测任务中单个链接的结果
+type LinkCheckJobResult struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	JobID        primitive.ObjectID `bson:"job_id" json:"job_id"`
+	LinkID       primitive.ObjectID `bson:"link_id" json:"link_id"`
+	URL          string             `bson:"url" json:"url"`
+	IsValid      bool               `bson:"is_valid" json:"is_valid"`
+	Skipped      bool               `bson:"skipped,omitempty" json:"skipped,omitempty"`
+	Message      string             `bson:"message,omitempty" json:"message,omitempty"`
+	ErrorMessage string             `bson:"error_message,omitempty" json:"error_message,omitempty"`
+	ErrorClass   LinkErrorCode      `bson:"error_class,omitempty" json:"error_class,omitempty"`
+	FoundOn      []string           `bson:"found_on,omitempty" json:"found_on,omitempty"` // 包含该链接的页面，来自站点爬取
+	CheckedAt    time.Time          `bson:"checked_at" json:"checked_at"`
+}
+
+// LinkCheckJobResultResponse 批量检测任务结果分页响应
+type LinkCheckJobResultResponse struct {
+	Data []LinkCheckJobResult `json:"data"`
+	Meta struct {
+		Total       int `json:"total"`
+		PerPage     int `json:"per_page"`
+		CurrentPage int `json:"current_page"`
+		LastPage    int `json:"last_page"`
+	} `json:"meta"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 访问设备分类
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// 点击来源
+const (
+	ClickSourceRedirect   = "redirect"   // 通过 /go/:slug 跳转
+	ClickSourceAPI        = "api"        // 前端调用点击接口上报
+	ClickSourceCollection = "collection" // 从公开的链接集合跳转
+)
+
+// LinkClickEvent 一次有效点击
+type LinkClickEvent struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	LinkID       primitive.ObjectID `bson:"link_id" json:"link_id"`
+	ClickedAt    time.Time          `bson:"clicked_at" json:"clicked_at"`
+	Source       string             `bson:"source" json:"source"`
+	Collection   string             `bson:"collection,omitempty" json:"collection,omitempty"` // 来源集合的标识
+	Referrer     string             `bson:"referrer,omitempty" json:"referrer,omitempty"`
+	ReferrerHost string             `bson:"referrer_host,omitempty" json:"referrer_host,omitempty"`
+	Device       string             `bson:"device" json:"device"`
+	Country      string             `bson:"country,omitempty" json:"country,omitempty"`
+	IPHash       string             `bson:"ip_hash" json:"-"`
+}
+
+// ClickContext 点击请求的上下文信息
+type ClickContext struct {
+	IP         string
+	UserAgent  string
+	Referrer   string
+	Source     string
+	Collection string
+}
+
+// ClickBucket 按时间分桶的点击数
+type ClickBucket struct {
+	Time   time.Time `bson:"_id" json:"time"`
+	Clicks int       `bson:"clicks" json:"clicks"`
+	Unique int       `bson:"unique" json:"unique"`
+}
+
+// ClickDimension 按维度汇总的点击数
+type ClickDimension struct {
+	Key    string `bson:"_id" json:"key"`
+	Clicks int    `bson:"clicks" json:"clicks"`
+}
+
+// LinkClickSummary 单个链接在时间范围内的点击数，用于排行
+type LinkClickSummary struct {
+	LinkID primitive.ObjectID `bson:"_id" json:"link_id"`
+	URL    string             `bson:"url" json:"url"`
+	Clicks int                `bson:"clicks" json:"clicks"`
+	Unique int                `bson:"unique" json:"unique"`
+}
+
+// ClickAnalytics 点击分析结果，全部由点击事件计算
+type ClickAnalytics struct {
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	Interval    string             `json:"interval"`
+	Clicks      int                `json:"clicks"`
+	Unique      int                `json:"unique"`
+	Series      []ClickBucket      `json:"series"`
+	Referrers   []ClickDimension   `json:"referrers"`
+	Countries   []ClickDimension   `json:"countries"`
+	Devices     []ClickDimension   `json:"devices"`
+	Collections []ClickDimension   `json:"collections"`
+	TopLinks    []LinkClickSummary `json:"top_links,omitempty"`
+}
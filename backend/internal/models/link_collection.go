@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LinkCollection 有序的链接集合，同一链接可以出现在多个集合中
+// 公开后可通过 /c/:slug 访问页面、/c/:slug/feed 获取 JSON，设置密码后需要验证才能访问
+type LinkCollection struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name         string               `bson:"name" json:"name"`
+	Slug         string               `bson:"slug" json:"slug"`
+	Description  string               `bson:"description,omitempty" json:"description,omitempty"`
+	LinkIDs      []primitive.ObjectID `bson:"link_ids" json:"link_ids"`
+	Public       bool                 `bson:"public" json:"public"`
+	PasswordHash string               `bson:"password_hash,omitempty" json:"-"`
+	HasPassword  bool                 `bson:"-" json:"has_password"`
+	Owner        string               `bson:"owner,omitempty" json:"owner,omitempty"`
+	CreatedBy    string               `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	UpdatedBy    string               `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// LinkCollectionRequest 创建或更新集合，更新时未传的字段保持不变
+// Password 为空字符串表示取消密码；LinkIDs 按顺序整体替换集合中的链接
+type LinkCollectionRequest struct {
+	Name        *string   `json:"name"`
+	Slug        *string   `json:"slug"`
+	Description *string   `json:"description"`
+	Public      *bool     `json:"public"`
+	Password    *string   `json:"password"`
+	LinkIDs     *[]string `json:"link_ids"`
+}
+
+// LinkCollectionItemsRequest 向集合追加链接，Position 为插入位置（从 0 开始），为空时追加到末尾
+type LinkCollectionItemsRequest struct {
+	IDs      []string `json:"ids" binding:"required"`
+	Position *int     `json:"position"`
+}
+
+// PublicLinkCollection 公开的集合内容，链接地址为带统计的跳转地址
+type PublicLinkCollection struct {
+	Name        string                 `json:"name"`
+	Slug        string                 `json:"slug"`
+	Description string                 `json:"description,omitempty"`
+	Links       []PublicCollectionLink `json:"links"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// PublicCollectionLink 公开集合中的链接，只包含可以对外展示的字段
+type PublicCollectionLink struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Category    string   `json:"category,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	URL         string   `json:"url"`            // 跳转地址，点击会计入统计
+	Host        string   `json:"host,omitempty"` // 目标网站的主机名，不公开完整的目标地址
+	ImageURL    string   `json:"image_url,omitempty"`
+}
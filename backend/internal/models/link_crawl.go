@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 站点爬取任务状态
+const (
+	LinkCrawlPending   = "pending"
+	LinkCrawlRunning   = "running"
+	LinkCrawlCompleted = "completed"
+	LinkCrawlCancelled = "cancelled"
+	LinkCrawlFailed    = "failed"
+)
+
+// LinkCrawlRequest 创建站点爬取任务
+// 从 Seeds 开始抓取起始页面所在主机及 Hosts 中的主机，范围外的链接作为外链写入
+type LinkCrawlRequest struct {
+	Seeds    []string `json:"seeds" binding:"required"`
+	Hosts    []string `json:"hosts"`
+	MaxDepth *int     `json:"max_depth"` // 0 表示只抓取起始页面，为空时使用默认深度
+	MaxPages int      `json:"max_pages"`
+	Category string   `json:"category"` // 新发现链接的分类
+	Check    *bool    `json:"check"`    // 完成后是否对发现的链接创建检测任务，默认创建
+}
+
+// LinkCrawlJob 后台站点爬取任务
+// 完成后发现的链接交给批量检测任务，失效链接可通过 CheckJobID 对应任务的结果查看，结果中包含来源页面
+type LinkCrawlJob struct {
+	ID              primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Status          string              `bson:"status" json:"status"`
+	Seeds           []string            `bson:"seeds" json:"seeds"`
+	Hosts           []string            `bson:"hosts" json:"hosts"`
+	MaxDepth        int                 `bson:"max_depth" json:"max_depth"`
+	MaxPages        int                 `bson:"max_pages" json:"max_pages"`
+	Category        string              `bson:"category,omitempty" json:"category,omitempty"`
+	Check           bool                `bson:"check" json:"check"`
+	PagesCrawled    int                 `bson:"pages_crawled" json:"pages_crawled"`
+	PagesFailed     int                 `bson:"pages_failed" json:"pages_failed"`
+	LinksFound      int                 `bson:"links_found" json:"links_found"`
+	LinksCreated    int                 `bson:"links_created" json:"links_created"`
+	Truncated       bool                `bson:"truncated,omitempty" json:"truncated,omitempty"` // 达到页面数或链接数上限，未抓取完整
+	CheckJobID      *primitive.ObjectID `bson:"check_job_id,omitempty" json:"check_job_id,omitempty"`
+	CancelRequested bool                `bson:"cancel_requested" json:"cancel_requested"`
+	Error           string              `bson:"error,omitempty" json:"error,omitempty"`
+	Owner           string              `bson:"owner,omitempty" json:"owner,omitempty"` // 新发现链接的所有者，为创建任务的用户
+	Owners          []string            `bson:"owners,omitempty" json:"-"`
+	CreatedBy       string              `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	Worker          string              `bson:"worker,omitempty" json:"worker,omitempty"`             // 执行任务的实例
+	HeartbeatAt     *time.Time          `bson:"heartbeat_at,omitempty" json:"heartbeat_at,omitempty"` // 执行实例最近一次心跳，过期后任务视为中断
+	CreatedAt       time.Time           `bson:"created_at" json:"created_at"`
+	StartedAt       *time.Time          `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt      *time.Time          `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	UpdatedAt       time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// LinkCrawlPage 爬取任务抓取过的页面
+type LinkCrawlPage struct {
+	JobID      primitive.ObjectID `bson:"job_id" json:"-"`
+	URL        string             `bson:"url" json:"url"`
+	Depth      int                `bson:"depth" json:"depth"`
+	StatusCode int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Links      int                `bson:"links" json:"links"` // 页面中的站外链接数
+	Failed     bool               `bson:"failed" json:"failed"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	CrawledAt  time.Time          `bson:"crawled_at" json:"crawled_at"`
+}
+
+// LinkCrawlPageResponse 爬取页面分页响应
+type LinkCrawlPageResponse struct {
+	Data []LinkCrawlPage `json:"data"`
+	Meta struct {
+		Total       int `json:"total"`
+		PerPage     int `json:"per_page"`
+		CurrentPage int `json:"current_page"`
+		LastPage    int `json:"last_page"`
+	} `json:"meta"`
+}
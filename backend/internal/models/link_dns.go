@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// 域名解析结果
+const (
+	DNSStatusOK       = "ok"
+	DNSStatusNXDomain = "nxdomain" // 域名不存在
+	DNSStatusNoData   = "nodata"   // 域名存在但没有 A/AAAA 记录
+	DNSStatusServFail = "servfail" // DNS 服务器无法完成解析，通常是权威服务器故障或 DNSSEC 校验失败
+	DNSStatusRefused  = "refused"  // DNS 服务器拒绝查询
+	DNSStatusTimeout  = "timeout"
+	DNSStatusError    = "error" // 其他错误，如无法连接 DNS 服务器或响应格式错误
+)
+
+// DNSInfo 检测时的域名解析结果，同一主机在缓存有效期内共用一次解析
+type DNSInfo struct {
+	Host       string    `bson:"host" json:"host"`
+	Resolver   string    `bson:"resolver" json:"resolver"` // 使用的解析器，如 system、udp://1.1.1.1:53 或 DoH 地址
+	Status     string    `bson:"status" json:"status"`
+	A          []string  `bson:"a,omitempty" json:"a,omitempty"`
+	AAAA       []string  `bson:"aaaa,omitempty" json:"aaaa,omitempty"`
+	CNAME      []string  `bson:"cname,omitempty" json:"cname,omitempty"` // CNAME 链，按解析顺序
+	LatencyMs  int64     `bson:"latency_ms" json:"latency_ms"`
+	Cached     bool      `bson:"cached,omitempty" json:"cached,omitempty"` // 结果来自缓存，LatencyMs 为实际解析时的耗时
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	ResolvedAt time.Time `bson:"resolved_at" json:"resolved_at"`
+}
+
+// Resolved 是否解析到了地址
+func (d *DNSInfo) Resolved() bool {
+	return d.Status == DNSStatusOK
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 重复链接分组方式
+const (
+	DuplicateModeExact = "exact" // 规范化地址完全相同
+	DuplicateModeLoose = "loose" // 忽略 www 前缀和查询参数
+)
+
+// DuplicateLink 重复分组中的链接摘要
+type DuplicateLink struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	URL       string             `bson:"url" json:"url"`
+	Category  string             `bson:"category" json:"category"`
+	Clicks    int                `bson:"clicks" json:"clicks"`
+	IsValid   bool               `bson:"is_valid" json:"is_valid"`
+	IsActive  bool               `bson:"is_active" json:"is_active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+
+	NormalizedURL string `bson:"normalized_url,omitempty" json:"normalized_url,omitempty"`
+}
+
+// DuplicateGroup 一组重复链接，SuggestedKeepID 为点击最多（相同时最早创建）的链接
+type DuplicateGroup struct {
+	Key             string          `json:"key"`
+	Count           int             `json:"count"`
+	TotalClicks     int             `json:"total_clicks"`
+	SuggestedKeepID string          `json:"suggested_keep_id"`
+	Links           []DuplicateLink `json:"links"`
+}
+
+// DuplicateMergeRequest 合并重复链接的请求，IDs 中的链接会被删除，点击数累加到 KeepID
+type DuplicateMergeRequest struct {
+	KeepID string   `json:"keep_id" binding:"required"`
+	IDs    []string `json:"ids" binding:"required"`
+}
+
+// DuplicateMergeResult 合并结果
+type DuplicateMergeResult struct {
+	Link        ExternalLink `json:"link"`
+	Merged      int          `json:"merged"`
+	ClicksAdded int          `json:"clicks_added"`
+}
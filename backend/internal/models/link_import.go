@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 导入导出文件格式
+const (
+	LinkFormatCSV       = "csv"
+	LinkFormatJSONL     = "jsonl"
+	LinkFormatBookmarks = "bookmarks"
+)
+
+// 导入任务状态
+const (
+	LinkImportPending   = "pending"
+	LinkImportRunning   = "running"
+	LinkImportCompleted = "completed"
+	LinkImportFailed    = "failed"
+)
+
+// LinkImportOptions 导入选项
+type LinkImportOptions struct {
+	Format          string            `bson:"format" json:"format"`
+	Mapping         map[string]string `bson:"mapping,omitempty" json:"mapping,omitempty"` // 目标字段 -> 文件中的列名/键名
+	DefaultCategory string            `bson:"default_category,omitempty" json:"default_category,omitempty"`
+}
+
+// LinkImportJob 后台导入任务
+type LinkImportJob struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Status      string             `bson:"status" json:"status"`
+	FileName    string             `bson:"file_name" json:"file_name"`
+	Options     LinkImportOptions  `bson:"options" json:"options"`
+	Total       int                `bson:"total" json:"total"`
+	Created     int                `bson:"created" json:"created"`
+	Duplicates  int                `bson:"duplicates" json:"duplicates"`
+	Failed      int                `bson:"failed" json:"failed"`
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	Owner       string             `bson:"owner,omitempty" json:"owner,omitempty"` // 导入链接的所有者，为创建任务的用户
+	CreatedBy   string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	Worker      string             `bson:"worker,omitempty" json:"worker,omitempty"`             // 执行任务的实例，上传文件只保存在该实例上
+	HeartbeatAt *time.Time         `bson:"heartbeat_at,omitempty" json:"heartbeat_at,omitempty"` // 执行实例最近一次心跳，过期后任务视为中断
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	StartedAt   *time.Time         `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt  *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LinkImportRowError 导入失败的行
+type LinkImportRowError struct {
+	JobID  primitive.ObjectID `bson:"job_id,omitempty" json:"-"`
+	Row    int                `bson:"row" json:"row"`
+	URL    string             `bson:"url,omitempty" json:"url,omitempty"`
+	Reason string             `bson:"reason" json:"reason"`
+
+	ExistingID string `bson:"existing_id,omitempty" json:"existing_id,omitempty"`
+}
+
+// LinkImportErrorResponse 导入错误分页响应
+type LinkImportErrorResponse struct {
+	Data []LinkImportRowError `json:"data"`
+	Meta struct {
+		Total       int `json:"total"`
+		PerPage     int `json:"per_page"`
+		CurrentPage int `json:"current_page"`
+		LastPage    int `json:"last_page"`
+	} `json:"meta"`
+}
+
+// LinkImportPreview 导入预演结果，不写入数据库
+type LinkImportPreview struct {
+	Format     string               `json:"format"`
+	Total      int                  `json:"total"`
+	Valid      int                  `json:"valid"`
+	Duplicates int                  `json:"duplicates"`
+	Failed     int                  `json:"failed"`
+	Sample     []ExternalLink       `json:"sample"`
+	Errors     []LinkImportRowError `json:"errors"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LinkMetadata 从链接页面提取的元数据
+type LinkMetadata struct {
+	Title        string    `bson:"title,omitempty" json:"title,omitempty"`
+	Description  string    `bson:"description,omitempty" json:"description,omitempty"`
+	ImageURL     string    `bson:"image_url,omitempty" json:"image_url,omitempty"`       // Open Graph 图片
+	FaviconURL   string    `bson:"favicon_url,omitempty" json:"favicon_url,omitempty"`   // 站点图标原始地址
+	FaviconFile  string    `bson:"favicon_file,omitempty" json:"favicon_file,omitempty"` // 本地缓存的图标文件名，通过 /api/files/:filename 访问
+	Language     string    `bson:"language,omitempty" json:"language,omitempty"`
+	CanonicalURL string    `bson:"canonical_url,omitempty" json:"canonical_url,omitempty"` // 页面声明的 <link rel=canonical>
+	Error        string    `bson:"error,omitempty" json:"error,omitempty"`                 // 最近一次提取失败的原因
+	FetchedAt    time.Time `bson:"fetched_at" json:"fetched_at"`
+}
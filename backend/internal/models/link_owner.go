@@ -0,0 +1,82 @@
+package models
+
+import "strings"
+
+// 用户角色，RoleAdmin 可以查看和管理全部链接，注册的用户统一为 RoleUser
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// 链接所有者类型，所有者以 "类型:标识" 的形式保存，例如 user:<用户ID>、team:<团队名>
+const (
+	LinkOwnerUser = "user"
+	LinkOwnerTeam = "team"
+)
+
+// 按所有者筛选时的特殊取值：none 表示未分配所有者，me 表示调用者本人
+const (
+	LinkOwnerNone = "none"
+	LinkOwnerMe   = "me"
+)
+
+// LinkActor 当前请求的调用者，来自 JWT 声明
+type LinkActor struct {
+	UserID   string
+	Username string
+	Role     string
+	Teams    []string
+}
+
+// IsAdmin 是否为管理员
+func (a *LinkActor) IsAdmin() bool {
+	return a.Role == RoleAdmin
+}
+
+// OwnerKey 调用者本人作为所有者时的标识
+func (a *LinkActor) OwnerKey() string {
+	return LinkOwnerUser + ":" + a.UserID
+}
+
+// OwnerKeys 调用者本人及所在团队的所有者标识
+func (a *LinkActor) OwnerKeys() []string {
+	keys := make([]string, 0, len(a.Teams)+1)
+	keys = append(keys, a.OwnerKey())
+	for _, team := range a.Teams {
+		keys = append(keys, LinkOwnerTeam+":"+team)
+	}
+	return keys
+}
+
+// Owns 所有者是否为调用者本人或其所在团队
+func (a *LinkActor) Owns(owner string) bool {
+	for _, key := range a.OwnerKeys() {
+		if key == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLinkOwner 解析所有者标识，返回类型和标识
+func ParseLinkOwner(owner string) (kind, id string, ok bool) {
+	kind, id, found := strings.Cut(owner, ":")
+	if !found || id == "" || (kind != LinkOwnerUser && kind != LinkOwnerTeam) {
+		return "", "", false
+	}
+	return kind, id, true
+}
+
+// LinkTransferRequest 批量转移链接所有权
+// IDs 与 From 二选一：IDs 转移指定链接，From 转移某个所有者的全部链接，none 表示未分配所有者的链接
+type LinkTransferRequest struct {
+	IDs  []string `json:"ids"`
+	From string   `json:"from"`
+	To   string   `json:"to" binding:"required"`
+}
+
+// LinkTransferResult 所有权转移结果
+type LinkTransferResult struct {
+	Matched int64 `json:"matched"`
+	Updated int64 `json:"updated"`
+}
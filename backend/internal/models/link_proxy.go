@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// 域名策略中的代理选择，也可以填写代理名称或完整的代理地址
+const (
+	LinkProxyDirect       = "direct"  // 不经过代理
+	LinkProxyPool         = "pool"    // 使用代理池中任意可用代理
+	LinkProxyRegionPrefix = "region:" // 使用指定地区的代理，如 region:eu
+)
+
+// LinkProxyStats 出站代理的健康状态和使用统计，统计从服务启动时开始
+type LinkProxyStats struct {
+	Name                string     `json:"name"`
+	URL                 string     `json:"url"` // 隐去密码
+	Region              string     `json:"region,omitempty"`
+	Healthy             bool       `json:"healthy"`
+	DownUntil           *time.Time `json:"down_until,omitempty"` // 连接失败后暂停使用到该时间
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"` // 代理本身不可用的次数，目标网站的错误不计入
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	AvgLatencyMs        int64      `json:"avg_latency_ms"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastUsedAt          *time.Time `json:"last_used_at,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+}
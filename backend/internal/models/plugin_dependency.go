@@ -82,11 +82,22 @@ type ServiceRequirement struct {
 
 // EnvironmentVariable 环境变量需求
 type EnvironmentVariable struct {
-	Name        string `json:"name" bson:"name"`
-	Required    bool   `json:"required" bson:"required"`
-	Default     string `json:"default,omitempty" bson:"default,omitempty"`
-	Description string `json:"description" bson:"description"`
-	Type        string `json:"type" bson:"type"` // string, int, bool, url, etc.
+	Name        string                 `json:"name" bson:"name"`
+	Required    bool                   `json:"required" bson:"required"`
+	Default     string                 `json:"default,omitempty" bson:"default,omitempty"`
+	Description string                 `json:"description" bson:"description"`
+	Type        string                 `json:"type" bson:"type"`     // string, int, float, bool, url, port, duration, enum
+	Secret      bool                   `json:"secret" bson:"secret"` // 敏感值，任何接口都不返回明文
+	Validation  *EnvironmentValidation `json:"validation,omitempty" bson:"validation,omitempty"`
+}
+
+// EnvironmentValidation 环境变量校验规则
+type EnvironmentValidation struct {
+	AllowedSchemes []string `json:"allowed_schemes,omitempty" bson:"allowed_schemes,omitempty"` // url 允许的协议，为空时默认 http/https
+	Enum           []string `json:"enum,omitempty" bson:"enum,omitempty"`                       // enum 可选值
+	Pattern        string   `json:"pattern,omitempty" bson:"pattern,omitempty"`                 // 正则表达式，需完整匹配
+	Min            *float64 `json:"min,omitempty" bson:"min,omitempty"`                         // 数值下限；duration 以秒计；string 为长度
+	Max            *float64 `json:"max,omitempty" bson:"max,omitempty"`                         // 数值上限；duration 以秒计；string 为长度
 }
 
 // PermissionRequirement 权限需求
@@ -150,7 +161,9 @@ type EnvironmentStatus struct {
 	Requirement EnvironmentVariable `json:"requirement"`
 	Status      string              `json:"status"` // set, missing, invalid
 	Message     string              `json:"message"`
-	Current     string              `json:"current,omitempty"`
+	Current     string              `json:"current,omitempty"` // 敏感值始终为掩码
+	Source      string              `json:"source,omitempty"`  // env, settings, default
+	Masked      bool                `json:"masked"`
 }
 
 // PermissionStatus 权限状态
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PluginSetting 插件级配置项，用于补充进程环境变量中缺失的值
+type PluginSetting struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	PluginKey string    `json:"plugin_key" bson:"plugin_key"`
+	Name      string    `json:"name" bson:"name"`
+	Value     string    `json:"value" bson:"value"`
+	Secret    bool      `json:"secret" bson:"secret"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// PluginSettingsRequest 批量设置插件配置请求
+type PluginSettingsRequest struct {
+	Values map[string]string `json:"values" binding:"required"`
+}
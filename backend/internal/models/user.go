@@ -9,12 +9,13 @@ import (
 // User 表示用户信息
 type User struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Username  string            `bson:"username" json:"username"`
-	Password  string            `bson:"password" json:"-"` // 不在JSON中显示密码
-	Email     string            `bson:"email" json:"email"`
-	Role      string            `bson:"role" json:"role"`
-	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+	Username  string             `bson:"username" json:"username"`
+	Password  string             `bson:"password" json:"-"` // 不在JSON中显示密码
+	Email     string             `bson:"email" json:"email"`
+	Role      string             `bson:"role" json:"role"`
+	Teams     []string           `bson:"teams,omitempty" json:"teams,omitempty"` // 所在团队，由管理员在数据库中分配
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
 // LoginRequest 登录请求
@@ -36,4 +37,4 @@ type UserResponse struct {
 	Message string `json:"message"`
 	Data    *User  `json:"data,omitempty"`
 	Token   string `json:"token,omitempty"`
-} 
\ No newline at end of file
+}
@@ -0,0 +1,130 @@
+package external_links
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/lock"
+	"vite-pluginend/pkg/logger"
+)
+
+// LoadAlertConfig 从环境变量读取链接告警配置
+// LINK_ALERT_WEBHOOKS 逗号分隔的 Webhook 地址，LINK_ALERT_WEBHOOK_SECRET 签名密钥，
+// LINK_ALERT_SMTP_HOST/PORT/USERNAME/PASSWORD/FROM/TO 邮件配置，配置了任一渠道时默认启用；
+// LINK_ALERT_FAILURE_THRESHOLD 连续失败次数阈值，LINK_ALERT_DIGEST_WINDOW 摘要发送间隔，
+// LINK_ALERT_MAX_ATTEMPTS 和 LINK_ALERT_RETRY_BACKOFF 发送失败时的重试次数和首次等待时间
+func LoadAlertConfig(env services.PluginEnv) services.LinkAlertConfig {
+	webhooks := splitEnvList(env, "LINK_ALERT_WEBHOOKS")
+	smtpHost := env("LINK_ALERT_SMTP_HOST")
+
+	return services.LinkAlertConfig{
+		Enabled:          envBool(env, "LINK_ALERT_ENABLED", len(webhooks) > 0 || smtpHost != ""),
+		FailureThreshold: envInt(env, "LINK_ALERT_FAILURE_THRESHOLD", 3),
+		DigestWindow:     envDuration(env, "LINK_ALERT_DIGEST_WINDOW", 5*time.Minute),
+		MaxDigestEvents:  envInt(env, "LINK_ALERT_DIGEST_MAX_EVENTS", 100),
+		Retention:        envDuration(env, "LINK_ALERT_RETENTION", 90*24*time.Hour),
+
+		Webhooks:       webhooks,
+		WebhookSecret:  env("LINK_ALERT_WEBHOOK_SECRET"),
+		WebhookTimeout: envDuration(env, "LINK_ALERT_WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxAttempts:    envInt(env, "LINK_ALERT_MAX_ATTEMPTS", 5),
+		RetryBackoff:   envDuration(env, "LINK_ALERT_RETRY_BACKOFF", 2*time.Second),
+
+		SMTP: services.SMTPConfig{
+			Host:     smtpHost,
+			Port:     envInt(env, "LINK_ALERT_SMTP_PORT", 25),
+			Username: env("LINK_ALERT_SMTP_USERNAME"),
+			Password: env("LINK_ALERT_SMTP_PASSWORD"),
+			From:     env("LINK_ALERT_SMTP_FROM"),
+			To:       splitEnvList(env, "LINK_ALERT_SMTP_TO"),
+			Timeout:  envDuration(env, "LINK_ALERT_SMTP_TIMEOUT", 30*time.Second),
+		},
+	}
+}
+
+// splitEnvList 读取逗号分隔的环境变量，忽略空项
+func splitEnvList(env services.PluginEnv, name string) []string {
+	var values []string
+	for _, value := range strings.Split(env(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// alertDispatcher 按摘要窗口定期发送告警，多实例时通过锁保证只有一个实例发送
+type alertDispatcher struct {
+	alerts *services.LinkAlertService
+	locker *lock.MongoLock
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newAlertDispatcher(alerts *services.LinkAlertService, locker *lock.MongoLock) *alertDispatcher {
+	return &alertDispatcher{alerts: alerts, locker: locker}
+}
+
+// Start 创建索引并启动摘要发送，未启用告警时不运行
+func (d *alertDispatcher) Start(ctx context.Context) {
+	if !d.alerts.Enabled() {
+		return
+	}
+	if err := d.alerts.EnsureIndexes(ctx); err != nil {
+		logger.Warn("创建告警事件索引失败", zap.Error(err))
+	}
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.alerts.DigestWindow())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			d.dispatch(ctx)
+		}
+	}()
+}
+
+// Stop 停止摘要发送
+func (d *alertDispatcher) Stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+}
+
+func (d *alertDispatcher) dispatch(ctx context.Context) {
+	// 租约覆盖整个窗口，包括重试等待的时间
+	ok, err := d.locker.TryAcquire(ctx, "alerts:digest", d.alerts.DigestWindow()+10*time.Minute)
+	if err != nil || !ok {
+		return
+	}
+	defer d.locker.Release(context.Background(), "alerts:digest")
+
+	digest, err := d.alerts.DispatchDigest(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("发送告警摘要失败", zap.Error(err))
+		}
+		return
+	}
+	if digest != nil && digest.Requeued {
+		logger.Warn("告警摘要发送失败，事件将在下一个窗口重新发送", zap.String("digest_id", digest.ID.Hex()), zap.Int("events", len(digest.Events)))
+	} else if digest != nil {
+		logger.Info("已发送告警摘要", zap.String("digest_id", digest.ID.Hex()), zap.Int("down", digest.Down), zap.Int("recovered", digest.Recovered))
+	}
+}
@@ -0,0 +1,67 @@
+package external_links
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"vite-pluginend/internal/middleware"
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/errors"
+)
+
+// AuthConfig 外链接口认证配置
+type AuthConfig struct {
+	Required bool // LINK_AUTH_REQUIRED，为 false 时未携带令牌的请求不限定访问范围，仅用于开发环境
+}
+
+// LoadAuthConfig 从环境变量读取认证配置
+func LoadAuthConfig(env services.PluginEnv) AuthConfig {
+	return AuthConfig{
+		Required: envBool(env, "LINK_AUTH_REQUIRED", true),
+	}
+}
+
+// linkAuth 使用 AuthMiddleware 校验令牌，未携带令牌时按配置决定是否放行
+func linkAuth(config AuthConfig) gin.HandlerFunc {
+	authenticate := middleware.AuthMiddleware()
+	return func(c *gin.Context) {
+		if !config.Required && c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// withLinkActor 将 AuthMiddleware 解析出的调用者保存到请求上下文，服务据此限定可访问的链接
+func withLinkActor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := c.GetString("user_id"); userID != "" {
+			c.Request = c.Request.WithContext(services.WithLinkActor(c.Request.Context(), &models.LinkActor{
+				UserID:   userID,
+				Username: c.GetString("username"),
+				Role:     c.GetString("role"),
+				Teams:    c.GetStringSlice("teams"),
+			}))
+		}
+		c.Next()
+	}
+}
+
+// adminOnly 仅管理员可以调用，用于影响全部链接的操作；未启用认证且未携带令牌时放行
+func adminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if actor := services.LinkActorFrom(c.Request.Context()); actor != nil && !actor.IsAdmin() {
+			abortWithError(c, errors.NewError("禁止访问", http.StatusForbidden))
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortWithError(c *gin.Context, err error) {
+	code, resp := errors.NewErrorResponse(err)
+	c.AbortWithStatusJSON(code, resp)
+}
@@ -0,0 +1,19 @@
+package external_links
+
+import (
+	"time"
+
+	"vite-pluginend/internal/services"
+)
+
+// LoadClickConfig 从环境变量读取点击统计配置
+// LINK_CLICK_RETENTION 点击事件保留时长，LINK_CLICK_DEDUP_WINDOW 重复点击去重窗口，
+// LINK_CLICK_IP_SALT IP 哈希盐值，LINK_GEOIP_FILE 本地 GeoIP CSV 文件
+func LoadClickConfig(env services.PluginEnv) services.LinkClickConfig {
+	return services.LinkClickConfig{
+		Retention:   envDuration(env, "LINK_CLICK_RETENTION", 365*24*time.Hour),
+		DedupWindow: envDuration(env, "LINK_CLICK_DEDUP_WINDOW", 30*time.Minute),
+		IPSalt:      env("LINK_CLICK_IP_SALT"),
+		GeoIPFile:   env("LINK_GEOIP_FILE"),
+	}
+}
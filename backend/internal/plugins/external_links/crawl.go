@@ -0,0 +1,28 @@
+package external_links
+
+import (
+	"time"
+
+	"vite-pluginend/internal/services"
+)
+
+// LoadCrawlConfig 从环境变量读取站点爬取配置
+// LINK_CRAWL_DEFAULT_DEPTH 默认深度，LINK_CRAWL_MAX_DEPTH 最大深度，LINK_CRAWL_MAX_PAGES 单个任务最多抓取的页面数，
+// LINK_CRAWL_MAX_LINKS 单个任务最多记录的站外链接数，LINK_CRAWL_CONCURRENCY 同时抓取的页面数，
+// LINK_CRAWL_TIMEOUT 单个页面的超时时间，LINK_CRAWL_MAX_BYTES 每个页面最多解析的字节数，LINK_CRAWL_USER_AGENT 爬取使用的 User-Agent
+func LoadCrawlConfig(env services.PluginEnv) services.LinkCrawlConfig {
+	userAgent := env("LINK_CRAWL_USER_AGENT")
+	if userAgent == "" {
+		userAgent = "vite-pluginend-crawler/1.0"
+	}
+	return services.LinkCrawlConfig{
+		DefaultDepth: envInt(env, "LINK_CRAWL_DEFAULT_DEPTH", 2),
+		MaxDepth:     envInt(env, "LINK_CRAWL_MAX_DEPTH", 5),
+		MaxPages:     envInt(env, "LINK_CRAWL_MAX_PAGES", 500),
+		MaxLinks:     envInt(env, "LINK_CRAWL_MAX_LINKS", 5000),
+		Concurrency:  envInt(env, "LINK_CRAWL_CONCURRENCY", 4),
+		PageTimeout:  envDuration(env, "LINK_CRAWL_TIMEOUT", 15*time.Second),
+		MaxPageBytes: int64(envInt(env, "LINK_CRAWL_MAX_BYTES", 2<<20)),
+		UserAgent:    userAgent,
+	}
+}
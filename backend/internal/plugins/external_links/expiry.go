@@ -0,0 +1,59 @@
+package external_links
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/logger"
+)
+
+// expiryInterval 检查过期链接的间隔
+const expiryInterval = time.Minute
+
+// expiryWatcher 定期停用已过期的链接
+// 停用操作是幂等的条件更新，多实例同时执行也不会冲突，因此不需要加锁
+type expiryWatcher struct {
+	service *services.ExternalLinkService
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newExpiryWatcher(service *services.ExternalLinkService) *expiryWatcher {
+	return &expiryWatcher{service: service}
+}
+
+// Start 启动过期检查
+func (w *expiryWatcher) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := w.service.DeactivateExpiredLinks(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				logger.Error("停用过期链接失败", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止过期检查
+func (w *expiryWatcher) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
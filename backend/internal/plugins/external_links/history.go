@@ -0,0 +1,101 @@
+package external_links
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/lock"
+	"vite-pluginend/pkg/logger"
+)
+
+// HistoryConfig 检测记录保留配置
+type HistoryConfig struct {
+	Retention       time.Duration // LINK_CHECK_RETENTION，原始检测记录保留时长
+	RollupRetention time.Duration // LINK_CHECK_ROLLUP_RETENTION，按天汇总数据保留时长
+	RollupInterval  time.Duration // 汇总任务执行间隔
+}
+
+// LoadHistoryConfig 从环境变量读取检测记录保留配置
+func LoadHistoryConfig(env services.PluginEnv) HistoryConfig {
+	return HistoryConfig{
+		Retention:       envDuration(env, "LINK_CHECK_RETENTION", 30*24*time.Hour),
+		RollupRetention: envDuration(env, "LINK_CHECK_ROLLUP_RETENTION", 365*24*time.Hour),
+		RollupInterval:  time.Hour,
+	}
+}
+
+// historyMaintainer 定期将原始检测记录降采样为按天汇总，原始记录由 TTL 自动清理；同时按小时汇总全局和各所有者的趋势数据
+type historyMaintainer struct {
+	config  HistoryConfig
+	service *services.ExternalLinkService
+	locker  *lock.MongoLock
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newHistoryMaintainer(config HistoryConfig, service *services.ExternalLinkService, locker *lock.MongoLock) *historyMaintainer {
+	return &historyMaintainer{
+		config:  config,
+		service: service,
+		locker:  locker,
+	}
+}
+
+// Start 创建索引并启动汇总任务
+func (m *historyMaintainer) Start(ctx context.Context) {
+	if err := m.service.EnsureCheckIndexes(ctx, m.config.Retention, m.config.RollupRetention); err != nil {
+		logger.Warn("创建检测记录索引失败", zap.Error(err))
+	}
+	if err := m.service.EnsureTrendIndexes(ctx); err != nil {
+		logger.Warn("创建趋势汇总索引失败", zap.Error(err))
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(m.config.RollupInterval)
+		defer ticker.Stop()
+		for {
+			m.rollup(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止汇总任务
+func (m *historyMaintainer) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+}
+
+func (m *historyMaintainer) rollup(ctx context.Context) {
+	ok, err := m.locker.TryAcquire(ctx, "rollup:link_checks", 10*time.Minute)
+	if err != nil || !ok {
+		return
+	}
+	defer m.locker.Release(context.Background(), "rollup:link_checks")
+
+	if err := m.service.RollupLinkChecks(ctx, time.Now()); err != nil && ctx.Err() == nil {
+		logger.Error("检测记录汇总失败", zap.Error(err))
+	}
+	if err := m.service.RollupTrends(ctx, time.Now()); err != nil && ctx.Err() == nil {
+		logger.Error("趋势数据汇总失败", zap.Error(err))
+	}
+	if err := m.service.RollupOwnerTrends(ctx, time.Now()); err != nil && ctx.Err() == nil {
+		logger.Error("所有者趋势数据汇总失败", zap.Error(err))
+	}
+}
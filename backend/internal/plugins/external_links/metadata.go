@@ -0,0 +1,22 @@
+package external_links
+
+import (
+	"time"
+
+	"vite-pluginend/internal/services"
+)
+
+// metadataUploadDir 站点图标缓存目录，与文件上传接口使用同一目录
+const metadataUploadDir = "uploads"
+
+// LoadMetadataConfig 从环境变量读取页面元数据提取配置
+// LINK_METADATA_ENABLED 检测时是否提取元数据，LINK_METADATA_REFRESH 重新提取间隔，
+// LINK_METADATA_MAX_BYTES 最多读取的 HTML 字节数，LINK_FAVICON_CACHE 是否缓存站点图标
+func LoadMetadataConfig(env services.PluginEnv) services.LinkMetadataConfig {
+	return services.LinkMetadataConfig{
+		Enabled:       envBool(env, "LINK_METADATA_ENABLED", true),
+		RefreshAfter:  envDuration(env, "LINK_METADATA_REFRESH", 7*24*time.Hour),
+		MaxBytes:      int64(envInt(env, "LINK_METADATA_MAX_BYTES", 512<<10)),
+		CacheFavicons: envBool(env, "LINK_FAVICON_CACHE", true),
+	}
+}
@@ -1,35 +1,133 @@
 package external_links
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
 	"vite-pluginend/internal/api/handlers"
 	"vite-pluginend/internal/services"
 	"vite-pluginend/pkg/cache"
+	"vite-pluginend/pkg/lock"
+	"vite-pluginend/pkg/logger"
 )
 
 // Plugin 外链插件
 type Plugin struct {
-	db    *mongo.Database
-	cache cache.Cache
+	db          *mongo.Database
+	cache       cache.Cache
+	service     *services.ExternalLinkService
+	policies    *services.DomainPolicyService
+	jobService  *services.LinkCheckJobService
+	importer    *services.LinkImportService
+	crawler     *services.LinkCrawlService
+	clicks      *services.LinkClickService
+	alerts      *services.LinkAlertService
+	collections *services.LinkCollectionService
+	scheduler   *Scheduler
+	history     *historyMaintainer
+	expiry      *expiryWatcher
+	dispatcher  *alertDispatcher
+	auth        AuthConfig
+	env         services.PluginEnv
 }
 
-// NewPlugin 创建外链插件实例
-func NewPlugin(db *mongo.Database, cache cache.Cache) *Plugin {
+// SettingsKey 插件配置存储中外链插件的标识，与前端插件 dependencies.json 中的 plugin_key 一致
+const SettingsKey = "wailki"
+
+// NewPlugin 创建外链插件实例，配置通过 env 读取
+func NewPlugin(db *mongo.Database, cache cache.Cache, env services.PluginEnv) *Plugin {
+	policies := services.NewDomainPolicyService(db)
+	service := services.NewExternalLinkService(db, cache, policies)
+	service.ConfigureMetadata(LoadMetadataConfig(env), services.NewUploadService(metadataUploadDir))
+	service.ConfigurePoliteness(LoadPolitenessConfig(env))
+	service.ConfigureCheckers(LoadCheckerConfig(env))
+	alerts := services.NewLinkAlertService(db, LoadAlertConfig(env))
+	service.ConfigureAlerts(alerts)
+	locker := lock.NewMongoLock(db, "link_check_locks", "")
+	jobService := services.NewLinkCheckJobService(db, service, locker)
+
 	return &Plugin{
-		db:    db,
-		cache: cache,
+		db:          db,
+		cache:       cache,
+		service:     service,
+		policies:    policies,
+		jobService:  jobService,
+		importer:    services.NewLinkImportService(db, locker.Owner()),
+		crawler:     services.NewLinkCrawlService(db, service, jobService, LoadCrawlConfig(env), locker.Owner()),
+		clicks:      services.NewLinkClickService(db, LoadClickConfig(env)),
+		alerts:      alerts,
+		collections: services.NewLinkCollectionService(db),
+		scheduler:   NewScheduler(LoadSchedulerConfig(env), service, locker),
+		history:     newHistoryMaintainer(LoadHistoryConfig(env), service, locker),
+		expiry:      newExpiryWatcher(service),
+		dispatcher:  newAlertDispatcher(alerts, locker),
+		auth:        LoadAuthConfig(env),
+		env:         env,
+	}
+}
+
+// Start 启动插件后台任务
+func (p *Plugin) Start(ctx context.Context) {
+	if err := p.policies.EnsureDefaults(ctx); err != nil {
+		logger.Warn("初始化域名检测策略失败", zap.Error(err))
+	}
+	if err := p.service.EnsureLinkIndexes(ctx); err != nil {
+		logger.Warn("初始化链接规范化地址失败", zap.Error(err))
+	}
+	if err := p.service.EnsureAssertionIndexes(ctx); err != nil {
+		logger.Warn("初始化内容校验规则索引失败", zap.Error(err))
 	}
+	if err := p.collections.EnsureIndexes(ctx); err != nil {
+		logger.Warn("初始化链接集合索引失败", zap.Error(err))
+	}
+	p.history.Start(ctx)
+	p.clicks.Start(ctx)
+	p.expiry.Start(ctx)
+	p.dispatcher.Start(ctx)
+	p.importer.Start(ctx)
+	p.jobService.Start(ctx)
+	p.crawler.Start(ctx)
+	p.scheduler.Start(ctx)
+}
+
+// Stop 停止插件后台任务
+func (p *Plugin) Stop() {
+	p.scheduler.Stop()
+	p.crawler.Stop()
+	p.jobService.Stop()
+	p.importer.Stop()
+	p.dispatcher.Stop()
+	p.expiry.Stop()
+	p.history.Stop()
 }
 
 // Register 注册插件路由
 func (p *Plugin) Register(r *gin.RouterGroup) {
-	// 创建服务和处理器
-	externalLinkService := services.NewExternalLinkService(p.db, p.cache)
-	externalLinkHandler := handlers.NewExternalLinkHandler(externalLinkService)
+	// 创建处理器
+	externalLinkHandler := handlers.NewExternalLinkHandler(p.service)
+	linkCheckJobHandler := handlers.NewLinkCheckJobHandler(p.jobService)
+	domainPolicyHandler := handlers.NewDomainPolicyHandler(p.policies)
+	linkImportHandler := handlers.NewLinkImportHandler(p.importer, int64(envInt(p.env, "LINK_IMPORT_MAX_BYTES", 20<<20)))
+	linkCrawlHandler := handlers.NewLinkCrawlHandler(p.crawler)
+	linkClickHandler := handlers.NewLinkClickHandler(p.clicks)
+	linkAlertHandler := handlers.NewLinkAlertHandler(p.alerts)
+	linkCollectionHandler := handlers.NewLinkCollectionHandler(p.collections, r.BasePath(), p.env("LINK_PUBLIC_URL"))
+
+	// 跳转地址不放在 /external-links 下，便于对外分享；跳转和点击上报不需要登录
+	r.GET("/go/:slug", linkClickHandler.Redirect)
+	r.POST("/external-links/:id/clicks", linkClickHandler.RecordClick)
+
+	// 公开集合页面和 JSON，受密码保护的页面通过 POST 提交密码
+	r.GET("/c/:slug", linkCollectionHandler.PublicPage)
+	r.POST("/c/:slug", linkCollectionHandler.PublicPage)
+	r.GET("/c/:slug/feed", linkCollectionHandler.PublicFeed)
 
-	// 注册路由
-	externalLinks := r.Group("/external-links")
+	// 注册路由，其余接口需要登录，普通用户只能访问自己、所在团队及未分配所有者的链接，未分配所有者的链接只读
+	externalLinks := r.Group("/external-links", linkAuth(p.auth), withLinkActor())
+	admin := externalLinks.Group("", adminOnly())
 	{
 		externalLinks.POST("", externalLinkHandler.CreateExternalLink)
 		externalLinks.GET("/:id", externalLinkHandler.GetExternalLink)
@@ -37,13 +135,82 @@ func (p *Plugin) Register(r *gin.RouterGroup) {
 		externalLinks.DELETE("/:id", externalLinkHandler.DeleteExternalLink)
 		externalLinks.GET("", externalLinkHandler.ListExternalLinks)
 		externalLinks.GET("/all", externalLinkHandler.GetAllExternalLinks)
+		externalLinks.GET("/stream", externalLinkHandler.StreamExternalLinks)
+		externalLinks.GET("/export", externalLinkHandler.ExportExternalLinks)
 		externalLinks.GET("/invalid", externalLinkHandler.GetInvalidExternalLinks)
 		externalLinks.DELETE("/batch", externalLinkHandler.BatchDeleteExternalLinks)
 		externalLinks.DELETE("/invalid/batch", externalLinkHandler.BatchDeleteInvalidExternalLinks)
-		externalLinks.POST("/batch-check", externalLinkHandler.BatchCheckExternalLinks)
 		externalLinks.GET("/statistics", externalLinkHandler.GetExternalStatistics)
 		externalLinks.GET("/trends", externalLinkHandler.GetExternalTrends)
-		externalLinks.POST("/:id/clicks", externalLinkHandler.IncrementClicks)
+		externalLinks.POST("/transfer", externalLinkHandler.TransferLinkOwnership)
+		externalLinks.GET("/:id/clicks/analytics", linkClickHandler.GetLinkClickAnalytics)
+		externalLinks.GET("/clicks/analytics", linkClickHandler.GetClickAnalytics)
+		externalLinks.GET("/:id/checks", externalLinkHandler.ListLinkChecks)
+		externalLinks.GET("/:id/uptime", externalLinkHandler.GetLinkUptime)
+		externalLinks.PUT("/:id/assertions", externalLinkHandler.SetLinkAssertions)
+		externalLinks.POST("/:id/metadata/refresh", externalLinkHandler.RefreshLinkMetadata)
+		externalLinks.POST("/:id/canonicalize", externalLinkHandler.CanonicalizeExternalLink)
+		externalLinks.POST("/canonicalize", externalLinkHandler.BatchCanonicalizeExternalLinks)
+		externalLinks.GET("/tags", externalLinkHandler.ListTags)
+		admin.POST("/tags/merge", externalLinkHandler.MergeTags)
+		admin.PUT("/tags/:tag", externalLinkHandler.RenameTag)
+		admin.DELETE("/tags/:tag", externalLinkHandler.DeleteTag)
+		externalLinks.GET("/duplicates", externalLinkHandler.FindDuplicateLinks)
+		admin.POST("/duplicates/merge", externalLinkHandler.MergeDuplicateLinks)
+		externalLinks.GET("/assertions/categories", externalLinkHandler.ListCategoryAssertions)
+		admin.PUT("/assertions/categories/:category", externalLinkHandler.SaveCategoryAssertions)
+		admin.DELETE("/assertions/categories/:category", externalLinkHandler.DeleteCategoryAssertions)
+		externalLinks.GET("/monitor/status", func(c *gin.Context) {
+			c.JSON(http.StatusOK, p.scheduler.Status())
+		})
+		admin.GET("/proxies", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"data": p.service.ProxyStats()})
+		})
+
+		// 异步批量检测任务
+		externalLinks.POST("/check-jobs", linkCheckJobHandler.CreateJob)
+		externalLinks.POST("/batch-check", linkCheckJobHandler.CreateJob) // 兼容旧接口，同样返回检测任务
+		externalLinks.GET("/check-jobs", linkCheckJobHandler.ListJobs)
+		externalLinks.GET("/check-jobs/:jobId", linkCheckJobHandler.GetJob)
+		externalLinks.GET("/check-jobs/:jobId/results", linkCheckJobHandler.ListJobResults)
+		externalLinks.GET("/check-jobs/:jobId/events", linkCheckJobHandler.StreamJobEvents)
+		externalLinks.POST("/check-jobs/:jobId/cancel", linkCheckJobHandler.CancelJob)
+
+		// 链接集合
+		externalLinks.GET("/collections", linkCollectionHandler.ListCollections)
+		externalLinks.POST("/collections", linkCollectionHandler.CreateCollection)
+		externalLinks.GET("/collections/:collectionId", linkCollectionHandler.GetCollection)
+		externalLinks.PUT("/collections/:collectionId", linkCollectionHandler.UpdateCollection)
+		externalLinks.DELETE("/collections/:collectionId", linkCollectionHandler.DeleteCollection)
+		externalLinks.GET("/collections/:collectionId/links", linkCollectionHandler.GetCollectionLinks)
+		externalLinks.POST("/collections/:collectionId/links", linkCollectionHandler.AddCollectionLinks)
+		externalLinks.DELETE("/collections/:collectionId/links/:linkId", linkCollectionHandler.RemoveCollectionLink)
+
+		// 链接告警
+		admin.GET("/alerts/events", linkAlertHandler.ListEvents)
+		admin.GET("/alerts/digests", linkAlertHandler.ListDigests)
+		admin.POST("/alerts/test", linkAlertHandler.SendTestAlert)
+
+		// 批量导入
+		externalLinks.POST("/import", linkImportHandler.ImportExternalLinks)
+		externalLinks.GET("/import-jobs", linkImportHandler.ListImportJobs)
+		externalLinks.GET("/import-jobs/:jobId", linkImportHandler.GetImportJob)
+		externalLinks.GET("/import-jobs/:jobId/errors", linkImportHandler.ListImportJobErrors)
+
+		// 站点爬取，完成后发现的链接交给批量检测任务
+		externalLinks.POST("/crawl-jobs", linkCrawlHandler.CreateJob)
+		externalLinks.GET("/crawl-jobs", linkCrawlHandler.ListJobs)
+		externalLinks.GET("/crawl-jobs/:jobId", linkCrawlHandler.GetJob)
+		externalLinks.GET("/crawl-jobs/:jobId/pages", linkCrawlHandler.ListJobPages)
+		externalLinks.POST("/crawl-jobs/:jobId/cancel", linkCrawlHandler.CancelJob)
+
+		// 域名检测策略
+		externalLinks.GET("/domain-policies", domainPolicyHandler.ListPolicies)
+		admin.POST("/domain-policies", domainPolicyHandler.CreatePolicy)
+		externalLinks.GET("/domain-policies/preview", domainPolicyHandler.PreviewPolicy)
+		externalLinks.GET("/domain-policies/:policyId", domainPolicyHandler.GetPolicy)
+		admin.PUT("/domain-policies/:policyId", domainPolicyHandler.UpdatePolicy)
+		admin.DELETE("/domain-policies/:policyId", domainPolicyHandler.DeletePolicy)
 	}
 }
 
@@ -59,6 +226,49 @@ func (p *Plugin) GetInfo() map[string]interface{} {
 			"/api/external-links/:id",
 			"/api/external-links/statistics",
 			"/api/external-links/trends",
+			"/api/external-links/transfer",
+			"/api/external-links/:id/checks",
+			"/api/external-links/:id/clicks",
+			"/api/external-links/:id/clicks/analytics",
+			"/api/external-links/clicks/analytics",
+			"/api/go/:slug",
+			"/api/c/:slug",
+			"/api/c/:slug/feed",
+			"/api/external-links/collections",
+			"/api/external-links/collections/:collectionId",
+			"/api/external-links/collections/:collectionId/links",
+			"/api/external-links/collections/:collectionId/links/:linkId",
+			"/api/external-links/:id/uptime",
+			"/api/external-links/:id/assertions",
+			"/api/external-links/:id/metadata/refresh",
+			"/api/external-links/:id/canonicalize",
+			"/api/external-links/canonicalize",
+			"/api/external-links/tags",
+			"/api/external-links/tags/merge",
+			"/api/external-links/tags/:tag",
+			"/api/external-links/duplicates",
+			"/api/external-links/duplicates/merge",
+			"/api/external-links/assertions/categories",
+			"/api/external-links/monitor/status",
+			"/api/external-links/proxies",
+			"/api/external-links/check-jobs",
+			"/api/external-links/batch-check",
+			"/api/external-links/check-jobs/:jobId",
+			"/api/external-links/stream",
+			"/api/external-links/alerts/events",
+			"/api/external-links/alerts/digests",
+			"/api/external-links/alerts/test",
+			"/api/external-links/export",
+			"/api/external-links/import",
+			"/api/external-links/import-jobs",
+			"/api/external-links/import-jobs/:jobId",
+			"/api/external-links/crawl-jobs",
+			"/api/external-links/crawl-jobs/:jobId",
+			"/api/external-links/crawl-jobs/:jobId/pages",
+			"/api/external-links/crawl-jobs/:jobId/cancel",
+			"/api/external-links/domain-policies",
+			"/api/external-links/domain-policies/preview",
+			"/api/external-links/domain-policies/:policyId",
 		},
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,24 @@
+package external_links
+
+import (
+	"time"
+
+	"vite-pluginend/internal/services"
+)
+
+// LoadPolitenessConfig 从环境变量读取礼貌检测模式配置
+// LINK_CHECK_POLITE 是否启用，LINK_CHECK_USER_AGENT 检测使用的 User-Agent，LINK_ROBOTS_CACHE_TTL robots.txt 缓存时长，
+// LINK_CHECK_HOST_CONCURRENCY 同一主机的并发请求数，LINK_CHECK_MAX_CRAWL_DELAY Crawl-delay 上限
+func LoadPolitenessConfig(env services.PluginEnv) services.LinkPolitenessConfig {
+	userAgent := env("LINK_CHECK_USER_AGENT")
+	if userAgent == "" {
+		userAgent = "vite-pluginend-linkchecker/1.0"
+	}
+	return services.LinkPolitenessConfig{
+		Enabled:         envBool(env, "LINK_CHECK_POLITE", false),
+		UserAgent:       userAgent,
+		RobotsCacheTTL:  envDuration(env, "LINK_ROBOTS_CACHE_TTL", 24*time.Hour),
+		HostConcurrency: envInt(env, "LINK_CHECK_HOST_CONCURRENCY", 2),
+		MaxCrawlDelay:   envDuration(env, "LINK_CHECK_MAX_CRAWL_DELAY", time.Minute),
+	}
+}
@@ -0,0 +1,301 @@
+package external_links
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/internal/services"
+	"vite-pluginend/pkg/lock"
+	"vite-pluginend/pkg/logger"
+)
+
+// SchedulerConfig 后台巡检配置
+type SchedulerConfig struct {
+	Enabled      bool          // LINK_MONITOR_ENABLED
+	Interval     time.Duration // LINK_MONITOR_INTERVAL，巡检轮询间隔
+	StaleAfter   time.Duration // LINK_MONITOR_STALE_AFTER，超过该时间未检测的链接需要重新检测
+	BatchSize    int           // LINK_MONITOR_BATCH_SIZE，每轮最多检测的链接数
+	Concurrency  int           // LINK_MONITOR_CONCURRENCY，每个实例的并发数
+	HostInterval time.Duration // LINK_MONITOR_HOST_INTERVAL，同一主机两次检测的最小间隔（跨实例生效）
+	LeaseTTL     time.Duration // 单个链接检测锁的租约时长，检测期间每隔 LeaseTTL/3 续期一次
+}
+
+// LoadSchedulerConfig 从环境变量读取巡检配置
+func LoadSchedulerConfig(env services.PluginEnv) SchedulerConfig {
+	return SchedulerConfig{
+		Enabled:      envBool(env, "LINK_MONITOR_ENABLED", false),
+		Interval:     envDuration(env, "LINK_MONITOR_INTERVAL", time.Minute),
+		StaleAfter:   envDuration(env, "LINK_MONITOR_STALE_AFTER", 24*time.Hour),
+		BatchSize:    envInt(env, "LINK_MONITOR_BATCH_SIZE", 20),
+		Concurrency:  envInt(env, "LINK_MONITOR_CONCURRENCY", 3),
+		HostInterval: envDuration(env, "LINK_MONITOR_HOST_INTERVAL", 5*time.Second),
+		LeaseTTL:     2 * time.Minute,
+	}
+}
+
+// Scheduler 外链后台巡检调度器
+// 检测状态保存在链接文档和 link_checks 集合中，重启后按 last_checked_at 继续
+// 多副本部署时通过 link_check_locks 中的租约保证同一链接不会被重复检测
+type Scheduler struct {
+	config  SchedulerConfig
+	service *services.ExternalLinkService
+	locker  *lock.MongoLock
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status models.LinkMonitorStatus
+}
+
+// NewScheduler 创建巡检调度器
+func NewScheduler(config SchedulerConfig, service *services.ExternalLinkService, locker *lock.MongoLock) *Scheduler {
+	if config.BatchSize < 1 {
+		config.BatchSize = 20
+	}
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.LeaseTTL <= 0 {
+		config.LeaseTTL = 2 * time.Minute
+	}
+
+	return &Scheduler{
+		config:  config,
+		service: service,
+		locker:  locker,
+		status: models.LinkMonitorStatus{
+			Enabled:      config.Enabled,
+			InstanceID:   locker.Owner(),
+			Interval:     config.Interval.String(),
+			StaleAfter:   config.StaleAfter.String(),
+			BatchSize:    config.BatchSize,
+			Concurrency:  config.Concurrency,
+			HostInterval: config.HostInterval.String(),
+		},
+	}
+}
+
+// Start 启动后台巡检
+func (s *Scheduler) Start(ctx context.Context) {
+	if !s.config.Enabled {
+		logger.Info("外链后台巡检未启用")
+		return
+	}
+
+	if err := s.locker.EnsureIndexes(ctx); err != nil {
+		logger.Warn("创建巡检锁索引失败", zap.Error(err))
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	s.mu.Lock()
+	s.status.Running = true
+	s.mu.Unlock()
+
+	go s.loop(ctx)
+	logger.Info("外链后台巡检已启动", zap.String("instance", s.locker.Owner()), zap.Duration("interval", s.config.Interval))
+}
+
+// Stop 停止后台巡检并等待当前一轮结束
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+
+	s.mu.Lock()
+	s.status.Running = false
+	s.mu.Unlock()
+}
+
+// Status 获取巡检状态
+func (s *Scheduler) Status() models.LinkMonitorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce 执行一轮巡检
+func (s *Scheduler) runOnce(ctx context.Context) {
+	staleBefore := time.Now().Add(-s.config.StaleAfter)
+	links, err := s.service.FindLinksDueForCheck(ctx, staleBefore, s.config.BatchSize)
+	if err != nil {
+		logger.Error("获取待巡检链接失败", zap.Error(err))
+		return
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		checked int
+		skipped int
+	)
+	semaphore := make(chan struct{}, s.config.Concurrency)
+
+	for _, link := range links {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(l models.ExternalLink) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			ok := s.checkOne(ctx, l, staleBefore)
+
+			mu.Lock()
+			if ok {
+				checked++
+			} else {
+				skipped++
+			}
+			mu.Unlock()
+		}(link)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	s.mu.Lock()
+	s.status.LastRunAt = &now
+	s.status.LastRunChecked = checked
+	s.status.LastRunSkipped = skipped
+	s.status.TotalChecked += int64(checked)
+	s.mu.Unlock()
+
+	if checked > 0 || skipped > 0 {
+		logger.Info("外链巡检完成", zap.Int("checked", checked), zap.Int("skipped", skipped))
+	}
+}
+
+// checkOne 获取链接锁、确认仍需检测后再获取主机限速令牌，返回是否实际执行了检测
+func (s *Scheduler) checkOne(ctx context.Context, link models.ExternalLink, staleBefore time.Time) bool {
+	lockKey := "link:" + link.ID.Hex()
+	ok, err := s.locker.TryAcquire(ctx, lockKey, s.config.LeaseTTL)
+	if err != nil {
+		logger.Error("获取链接检测锁失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	// 检测耗时可能超过租约（重试、代理切换），持有期间持续续期，续期失败时放弃本次检测
+	ctx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.keepLeaseAlive(ctx, cancel, lockKey)
+	}()
+	defer func() {
+		cancel()
+		<-renewed
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelRelease()
+		if err := s.locker.Release(releaseCtx, lockKey); err != nil {
+			logger.Warn("释放链接检测锁失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		}
+	}()
+
+	due, err := s.service.IsLinkDueForCheck(ctx, link.ID, staleBefore)
+	if err != nil || !due {
+		return false
+	}
+
+	// 主机令牌不续期也不主动释放，到期后自动失效，从而限制所有实例（包括本实例）对同一主机的访问频率
+	if s.config.HostInterval > 0 {
+		host := link.URL
+		if parsed, err := url.Parse(link.URL); err == nil && parsed.Hostname() != "" {
+			host = parsed.Hostname()
+		}
+		ok, err := s.locker.TryAcquireToken(ctx, "host:"+host, s.config.HostInterval)
+		if err != nil {
+			logger.Error("获取主机限速令牌失败", zap.String("host", host), zap.Error(err))
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	s.service.CheckLink(ctx, link, models.LinkCheckSourceScheduler)
+	return true
+}
+
+// keepLeaseAlive 定期续期链接检测锁，直到 ctx 结束；锁已被其他实例抢占时调用 lost
+func (s *Scheduler) keepLeaseAlive(ctx context.Context, lost context.CancelFunc, lockKey string) {
+	ticker := time.NewTicker(s.config.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := s.locker.TryAcquire(ctx, lockKey, s.config.LeaseTTL)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("续期链接检测锁失败", zap.String("lock", lockKey), zap.Error(err))
+			}
+			continue
+		}
+		if !ok {
+			logger.Warn("链接检测锁已被其他实例持有，放弃本次检测", zap.String("lock", lockKey))
+			lost()
+			return
+		}
+	}
+}
+
+func envBool(env services.PluginEnv, name string, fallback bool) bool {
+	if value, err := strconv.ParseBool(env(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envInt(env services.PluginEnv, name string, fallback int) int {
+	if value, err := strconv.Atoi(env(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(env services.PluginEnv, name string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(env(name)); err == nil {
+		return value
+	}
+	return fallback
+}
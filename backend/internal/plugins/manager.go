@@ -1,9 +1,12 @@
 package plugins
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 	"vite-pluginend/internal/plugins/external_links"
+	"vite-pluginend/internal/services"
 	"vite-pluginend/pkg/cache"
 )
 
@@ -13,19 +16,25 @@ type Plugin interface {
 	GetInfo() map[string]interface{}
 }
 
+// BackgroundPlugin 带后台任务的插件，可选实现
+type BackgroundPlugin interface {
+	Start(ctx context.Context)
+	Stop()
+}
+
 // Manager 插件管理器
 type Manager struct {
 	plugins map[string]Plugin
 }
 
-// NewManager 创建插件管理器实例
-func NewManager(db *mongo.Database, cache cache.Cache) *Manager {
+// NewManager 创建插件管理器实例，内置插件从 settings 中读取各自的配置
+func NewManager(db *mongo.Database, cache cache.Cache, settings *services.PluginSettingService) *Manager {
 	manager := &Manager{
 		plugins: make(map[string]Plugin),
 	}
 
 	// 注册内置插件
-	manager.RegisterPlugin("external-links", external_links.NewPlugin(db, cache))
+	manager.RegisterPlugin("external-links", external_links.NewPlugin(db, cache, settings.Env(external_links.SettingsKey)))
 
 	return manager
 }
@@ -53,6 +62,24 @@ func (m *Manager) RegisterRoutes(r *gin.RouterGroup) {
 	}
 }
 
+// Start 启动所有插件的后台任务
+func (m *Manager) Start(ctx context.Context) {
+	for _, plugin := range m.plugins {
+		if bg, ok := plugin.(BackgroundPlugin); ok {
+			bg.Start(ctx)
+		}
+	}
+}
+
+// Stop 停止所有插件的后台任务
+func (m *Manager) Stop() {
+	for _, plugin := range m.plugins {
+		if bg, ok := plugin.(BackgroundPlugin); ok {
+			bg.Stop()
+		}
+	}
+}
+
 // GetPluginsInfo 获取所有插件信息
 func (m *Manager) GetPluginsInfo() map[string]map[string]interface{} {
 	info := make(map[string]map[string]interface{})
@@ -60,4 +87,4 @@ func (m *Manager) GetPluginsInfo() map[string]map[string]interface{} {
 		info[name] = plugin.GetInfo()
 	}
 	return info
-} 
\ No newline at end of file
+}
@@ -0,0 +1,407 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// maxAssertionBodyBytes 内容校验时最多读取的响应字节数
+	maxAssertionBodyBytes = 2 << 20
+	// soft404Similarity 页面与不存在路径的探测页相似度超过该值时判定为软404
+	soft404Similarity = 0.9
+	// similarityShingleRunes 比较页面相似度时每个片段的字符数
+	similarityShingleRunes = 5
+	// maxSimilarityRunes 比较页面相似度时最多使用的可见字符数
+	maxSimilarityRunes = 20000
+)
+
+var (
+	titlePattern  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	scriptPattern = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	tagPattern    = regexp.MustCompile(`(?s)<[^>]+>`)
+)
+
+// pageContent 内容校验时抓取到的页面
+type pageContent struct {
+	StatusCode  int
+	FinalURL    string
+	ContentType string
+	Body        []byte
+	Title       string
+}
+
+// SetLinkAssertions 设置单个链接的内容校验规则，传入空规则表示清除
+func (s *ExternalLinkService) SetLinkAssertions(ctx context.Context, id string, assertion *models.ContentAssertion) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.NewError("无效的外链ID", http.StatusBadRequest)
+	}
+
+	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	if assertion.IsEmpty() {
+		update["$unset"] = bson.M{"assertions": ""}
+	} else {
+		if err := validateContentAssertion(assertion); err != nil {
+			return err
+		}
+		update["$set"].(bson.M)["assertions"] = assertion
+	}
+
+	result, err := s.db.Collection("external_links").UpdateOne(ctx, writableFilter(ctx, bson.M{"_id": objectID}), update)
+	if err != nil {
+		logger.Error("保存链接内容校验规则失败", zap.String("id", id), zap.Error(err))
+		return errors.NewError("保存内容校验规则失败", http.StatusInternalServerError)
+	}
+	if result.MatchedCount == 0 {
+		return notWritableError(ctx, s.db, objectID)
+	}
+
+	return nil
+}
+
+// EnsureAssertionIndexes 创建分类内容校验规则索引，每个分类只有一条规则
+func (s *ExternalLinkService) EnsureAssertionIndexes(ctx context.Context) error {
+	_, err := s.db.Collection("link_category_assertions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "category", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.Error("创建分类内容校验索引失败", zap.Error(err))
+	}
+	return err
+}
+
+// ListCategoryAssertions 获取全部分类级别的内容校验规则
+func (s *ExternalLinkService) ListCategoryAssertions(ctx context.Context) ([]models.CategoryAssertion, error) {
+	cursor, err := s.db.Collection("link_category_assertions").Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "category", Value: 1}}))
+	if err != nil {
+		logger.Error("获取分类内容校验规则失败", zap.Error(err))
+		return nil, errors.NewError("获取分类内容校验规则失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	items := []models.CategoryAssertion{}
+	if err := cursor.All(ctx, &items); err != nil {
+		logger.Error("解析分类内容校验规则失败", zap.Error(err))
+		return nil, errors.NewError("解析分类内容校验规则失败", http.StatusInternalServerError)
+	}
+
+	return items, nil
+}
+
+// SaveCategoryAssertions 保存分类级别的内容校验规则
+func (s *ExternalLinkService) SaveCategoryAssertions(ctx context.Context, category string, assertion models.ContentAssertion) (*models.CategoryAssertion, error) {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return nil, errors.NewError("分类不能为空", http.StatusBadRequest)
+	}
+	if assertion.IsEmpty() {
+		return nil, errors.NewError("内容校验规则不能为空", http.StatusBadRequest)
+	}
+	if err := validateContentAssertion(&assertion); err != nil {
+		return nil, err
+	}
+
+	var saved models.CategoryAssertion
+	err := s.db.Collection("link_category_assertions").FindOneAndUpdate(ctx,
+		bson.M{"category": category},
+		bson.M{"$set": bson.M{"assertions": assertion, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		logger.Error("保存分类内容校验规则失败", zap.String("category", category), zap.Error(err))
+		return nil, errors.NewError("保存分类内容校验规则失败", http.StatusInternalServerError)
+	}
+
+	return &saved, nil
+}
+
+// DeleteCategoryAssertions 删除分类级别的内容校验规则
+func (s *ExternalLinkService) DeleteCategoryAssertions(ctx context.Context, category string) error {
+	result, err := s.db.Collection("link_category_assertions").DeleteOne(ctx, bson.M{"category": category})
+	if err != nil {
+		logger.Error("删除分类内容校验规则失败", zap.String("category", category), zap.Error(err))
+		return errors.NewError("删除分类内容校验规则失败", http.StatusInternalServerError)
+	}
+	if result.DeletedCount == 0 {
+		return errors.NewError("分类内容校验规则不存在", http.StatusNotFound)
+	}
+
+	return nil
+}
+
+// resolveAssertions 获取链接生效的内容校验规则，链接自身的规则优先于分类规则
+func (s *ExternalLinkService) resolveAssertions(ctx context.Context, link models.ExternalLink) *models.ContentAssertion {
+	if !link.Assertions.IsEmpty() {
+		return link.Assertions
+	}
+	if link.Category == "" {
+		return nil
+	}
+
+	var item models.CategoryAssertion
+	err := s.db.Collection("link_category_assertions").FindOne(ctx, bson.M{"category": link.Category}).Decode(&item)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Warn("获取分类内容校验规则失败", zap.String("category", link.Category), zap.Error(err))
+		}
+		return nil
+	}
+
+	return &item.Assertions
+}
+
+// verifyContent 对状态码正常的链接执行内容校验，失败时将结果标记为不可用
+// 检测请求已读到页面内容时直接使用，否则再单独请求一次页面
+func (s *ExternalLinkService) verifyContent(ctx context.Context, assertion *models.ContentAssertion, link models.ExternalLink, policy models.DomainPolicy, outcome LinkCheckOutcome, result *models.LinkCheckResult) {
+	if assertion.IsEmpty() {
+		return
+	}
+
+	var page *pageContent
+	if outcome.Page != nil {
+		page = newPageContent(outcome.StatusCode, outcome.Page.URL.String(), outcome.Page.ContentType, outcome.Page.Body)
+	} else {
+		fetched, err := s.fetchPage(ctx, outcome.Client, link.URL, policy)
+		if err != nil {
+			result.IsValid = false
+			result.Message = ""
+			result.ErrorMessage = "内容校验请求失败: " + s.formatNetworkError(err)
+			result.ErrorClass = classifyCheckError(err)
+			return
+		}
+		page = fetched
+	}
+
+	if !policy.IsExpectedStatus(page.StatusCode) {
+		result.IsValid = false
+		result.Message = ""
+		result.ErrorMessage = fmt.Sprintf("内容校验请求返回异常状态码: %d", page.StatusCode)
+		result.StatusCode = page.StatusCode
+		result.ErrorClass = models.LinkErrorUnexpectedStatus
+		return
+	}
+
+	failed, detail := evaluateContentAssertion(assertion, page)
+	if failed == "" && assertion.DetectSoft404 {
+		failed, detail = s.detectSoft404(ctx, outcome.Client, link.URL, policy, page)
+	}
+	if failed == "" {
+		return
+	}
+
+	logger.Info("链接内容校验失败", zap.String("url", link.URL), zap.String("assertion", failed), zap.String("detail", detail))
+	result.IsValid = false
+	result.Message = ""
+	result.ErrorMessage = detail
+	result.FailedAssertion = failed
+	result.ErrorClass = models.LinkErrorAssertionFailed
+	if failed == models.AssertionSoft404 {
+		result.ErrorClass = models.LinkErrorSoft404
+	}
+}
+
+// fetchPage 以 GET 方式获取页面内容，由传输层负责解压
+func (s *ExternalLinkService) fetchPage(ctx context.Context, client *http.Client, rawURL string, policy models.DomainPolicy) (*pageContent, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.checkers.UserAgent())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	applyPolicyHeaders(req, policy)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssertionBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return newPageContent(resp.StatusCode, resp.Request.URL.String(), resp.Header.Get("Content-Type"), body), nil
+}
+
+// newPageContent 整理页面内容并提取标题
+func newPageContent(statusCode int, finalURL, contentType string, body []byte) *pageContent {
+	page := &pageContent{
+		StatusCode:  statusCode,
+		FinalURL:    finalURL,
+		ContentType: contentType,
+		Body:        body,
+	}
+	if match := titlePattern.FindSubmatch(body); match != nil {
+		page.Title = strings.TrimSpace(html.UnescapeString(string(match[1])))
+	}
+	return page
+}
+
+// detectSoft404 请求同一主机下一个随机的不存在路径，若返回内容与当前页面几乎一致则判定为软404
+func (s *ExternalLinkService) detectSoft404(ctx context.Context, client *http.Client, rawURL string, policy models.DomainPolicy, page *pageContent) (string, string) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Path == "" || parsed.Path == "/" {
+		// 站点首页不存在软404的问题
+		return "", ""
+	}
+
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return "", ""
+	}
+	probeURL := url.URL{
+		Scheme: parsed.Scheme,
+		Host:   parsed.Host,
+		Path:   "/" + hex.EncodeToString(token) + "-link-check-not-found",
+	}
+
+	if err := s.policies.WaitTurn(ctx, rawURL, policy); err != nil {
+		return "", ""
+	}
+	probe, err := s.fetchPage(ctx, client, probeURL.String(), policy)
+	if err != nil {
+		logger.Warn("软404探测请求失败", zap.String("url", probeURL.String()), zap.Error(err))
+		return "", ""
+	}
+
+	// 不存在的路径返回了错误状态码，说明站点能正确返回404
+	if probe.StatusCode < 200 || probe.StatusCode >= 300 {
+		return "", ""
+	}
+
+	if page.FinalURL == probe.FinalURL && page.FinalURL != rawURL {
+		return models.AssertionSoft404, fmt.Sprintf("软404: 页面与不存在的路径跳转到相同地址 %s", page.FinalURL)
+	}
+
+	// 404 页面常会显示请求的路径，比较前去掉两次请求各自的路径
+	similarity := textSimilarity(page.Body, probe.Body, parsed.Path, probeURL.Path)
+	if similarity >= soft404Similarity {
+		return models.AssertionSoft404, fmt.Sprintf("软404: 页面与不存在路径的返回内容相似度为 %.0f%%", similarity*100)
+	}
+
+	return "", ""
+}
+
+// evaluateContentAssertion 依次校验各项规则，返回第一个失败项和说明
+func evaluateContentAssertion(assertion *models.ContentAssertion, page *pageContent) (string, string) {
+	if assertion.ContentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+		if !strings.EqualFold(mediaType, assertion.ContentType) {
+			return models.AssertionContentType, fmt.Sprintf("内容类型不符: 期望 %s，实际 %s", assertion.ContentType, page.ContentType)
+		}
+	}
+
+	if assertion.MinBodyBytes > 0 && len(page.Body) < assertion.MinBodyBytes {
+		return models.AssertionMinBodyBytes, fmt.Sprintf("页面内容过短: %d 字节，至少需要 %d 字节", len(page.Body), assertion.MinBodyBytes)
+	}
+
+	if assertion.TitlePattern != "" {
+		// 保存时已校验过正则，这里不会失败
+		pattern, _ := regexp.Compile(assertion.TitlePattern)
+		if pattern != nil && !pattern.MatchString(page.Title) {
+			return models.AssertionTitlePattern, fmt.Sprintf("页面标题不匹配: %q", page.Title)
+		}
+	}
+
+	body := strings.ToLower(string(page.Body))
+	for _, text := range assertion.MustContain {
+		if !strings.Contains(body, strings.ToLower(text)) {
+			return models.AssertionMustContain, fmt.Sprintf("页面缺少必需内容: %q", text)
+		}
+	}
+	for _, text := range assertion.MustNotContain {
+		if strings.Contains(body, strings.ToLower(text)) {
+			return models.AssertionMustNotContain, fmt.Sprintf("页面包含禁止内容: %q", text)
+		}
+	}
+
+	return "", ""
+}
+
+// validateContentAssertion 校验内容规则配置
+func validateContentAssertion(assertion *models.ContentAssertion) error {
+	if assertion.MinBodyBytes < 0 {
+		return errors.NewError("最小内容长度不能为负数", http.StatusBadRequest)
+	}
+	if assertion.TitlePattern != "" {
+		if _, err := regexp.Compile(assertion.TitlePattern); err != nil {
+			return errors.NewError("无效的标题正则表达式", http.StatusBadRequest)
+		}
+	}
+	assertion.ContentType = strings.ToLower(strings.TrimSpace(assertion.ContentType))
+	return nil
+}
+
+// textSimilarity 计算两个页面可见文本的字符片段 Jaccard 相似度，ignore 中的文本不参与比较
+// 按字符而不是按空格切分，没有空格分词的中文页面也能正确比较
+func textSimilarity(a, b []byte, ignore ...string) float64 {
+	shinglesA := pageShingles(a, ignore)
+	shinglesB := pageShingles(b, ignore)
+	if len(shinglesA) == 0 && len(shinglesB) == 0 {
+		return 1
+	}
+
+	intersection := 0
+	for shingle := range shinglesA {
+		if shinglesB[shingle] {
+			intersection++
+		}
+	}
+	union := len(shinglesA) + len(shinglesB) - intersection
+	return float64(intersection) / float64(union)
+}
+
+// pageShingles 将页面可见文本合并空白后切成连续 similarityShingleRunes 个字符的片段
+// 只取前 maxSimilarityRunes 个字符，文本短于一个片段时整体作为一个片段
+func pageShingles(body []byte, ignore []string) map[string]bool {
+	text := scriptPattern.ReplaceAllString(string(body), " ")
+	text = tagPattern.ReplaceAllString(text, " ")
+	text = strings.ToLower(html.UnescapeString(text))
+	for _, value := range ignore {
+		if value != "" {
+			text = strings.ReplaceAll(text, strings.ToLower(value), " ")
+		}
+	}
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) > maxSimilarityRunes {
+		runes = runes[:maxSimilarityRunes]
+	}
+
+	shingles := make(map[string]bool)
+	if len(runes) == 0 {
+		return shingles
+	}
+	if len(runes) < similarityShingleRunes {
+		shingles[string(runes)] = true
+		return shingles
+	}
+	for i := 0; i+similarityShingleRunes <= len(runes); i++ {
+		shingles[string(runes[i:i+similarityShingleRunes])] = true
+	}
+	return shingles
+}
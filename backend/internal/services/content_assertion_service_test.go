@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTextSimilarity(t *testing.T) {
+	sections := []string{
+		"<a>首页</a>", "<a>产品介绍</a>", "<a>解决方案</a>", "<a>价格方案</a>", "<a>客户案例</a>",
+		"<a>开发者文档</a>", "<a>接口参考</a>", "<a>更新日志</a>", "<a>常见问题</a>", "<a>社区论坛</a>",
+		"<a>关于我们</a>", "<a>加入我们</a>", "<a>联系我们</a>", "<a>隐私政策</a>", "<a>服务条款</a>",
+		"<p>版权所有 © 示例科技有限公司，保留所有权利。</p>",
+	}
+	for i := 1; i <= 40; i++ {
+		sections = append(sections, fmt.Sprintf("<a>帮助中心第%d篇：常见问题解答</a>", i))
+	}
+	notFound := func(path string) string {
+		return "<html><head><title>页面不存在</title><script>var p = '" + path + "';</script></head>" +
+			"<body><h1>抱歉，您访问的页面不存在或已被删除</h1><p>请检查地址" + path + "是否正确，或返回首页继续浏览。" +
+			"</p><nav>" + strings.Join(sections, "") + "</nav></body></html>"
+	}
+	tests := []struct {
+		name    string
+		a, b    string
+		similar bool
+	}{
+		{"same page", "<p>Hello   World</p>", "<div>hello world</div>", true},
+		{"both empty", "<script>x()</script>", "<style>p{}</style>", true},
+		{"chinese not found pages with different paths", notFound("/docs/guide"), notFound("/3fa9c0d1-link-check-not-found"), true},
+		{"chinese article vs not found page", "<p>本文介绍如何配置外链检测的域名策略，包括超时、请求头和允许的请求方式。</p>", notFound("/x"), false},
+		{"different english pages", "<p>The quick brown fox jumps over the lazy dog</p>", "<p>Pricing plans for teams of every size</p>", false},
+	}
+	for _, tt := range tests {
+		got := textSimilarity([]byte(tt.a), []byte(tt.b), "/docs/guide", "/3fa9c0d1-link-check-not-found")
+		if (got >= soft404Similarity) != tt.similar {
+			t.Errorf("%s: similarity = %.2f, want similar=%v", tt.name, got, tt.similar)
+		}
+	}
+}
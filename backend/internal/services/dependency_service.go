@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -14,16 +17,22 @@ import (
 	"go.uber.org/zap"
 
 	"vite-pluginend/internal/models"
+	customerrors "vite-pluginend/pkg/errors"
 	"vite-pluginend/pkg/logger"
 )
 
+// maskedValue 敏感值的统一掩码
+const maskedValue = "********"
+
 type DependencyService struct {
-	mongoClient *mongo.Client
+	mongoClient    *mongo.Client
+	settingService *PluginSettingService
 }
 
-func NewDependencyService(mongoClient *mongo.Client) *DependencyService {
+func NewDependencyService(mongoClient *mongo.Client, settingService *PluginSettingService) *DependencyService {
 	return &DependencyService{
-		mongoClient: mongoClient,
+		mongoClient:    mongoClient,
+		settingService: settingService,
 	}
 }
 
@@ -93,7 +102,7 @@ func (s *DependencyService) CheckPluginDependencies(ctx context.Context, pluginK
 
 	// 检查环境变量
 	if len(dependencies.Environment) > 0 {
-		envStatuses := s.checkEnvironmentVariables(dependencies.Environment)
+		envStatuses := s.checkEnvironmentVariables(ctx, pluginKey, dependencies.Environment)
 		result.Environment = envStatuses
 
 		for _, status := range envStatuses {
@@ -101,6 +110,13 @@ func (s *DependencyService) CheckPluginDependencies(ctx context.Context, pluginK
 				result.OverallStatus = "error"
 				result.CanInstall = false
 				result.RequiresSetup = true
+			} else if status.Status == "invalid" {
+				if status.Requirement.Required {
+					result.OverallStatus = "error"
+					result.CanInstall = false
+				} else if result.OverallStatus != "error" {
+					result.OverallStatus = "warning"
+				}
 			}
 		}
 	}
@@ -306,7 +322,8 @@ func (s *DependencyService) checkServiceConnection(host string, port int) bool {
 }
 
 // checkEnvironmentVariables 检查环境变量
-func (s *DependencyService) checkEnvironmentVariables(requirements []models.EnvironmentVariable) []models.EnvironmentStatus {
+// 取值顺序：进程环境变量 > 插件配置存储 > 默认值
+func (s *DependencyService) checkEnvironmentVariables(ctx context.Context, pluginKey string, requirements []models.EnvironmentVariable) []models.EnvironmentStatus {
 	var statuses []models.EnvironmentStatus
 
 	for _, req := range requirements {
@@ -315,22 +332,30 @@ func (s *DependencyService) checkEnvironmentVariables(requirements []models.Envi
 			Status:      "missing",
 			Message:     "环境变量未设置",
 		}
+		if req.Secret && req.Default != "" {
+			status.Requirement.Default = maskedValue
+		}
 
-		value := os.Getenv(req.Name)
-		if value != "" {
-			status.Status = "set"
-			status.Current = value
+		value, source := s.resolveEnvironmentValue(ctx, pluginKey, req)
+		switch source {
+		case "env":
 			status.Message = "环境变量已设置"
+		case "settings":
+			status.Message = "使用插件配置"
+		case "default":
+			status.Message = "使用默认值"
+		}
 
-			// 验证类型
-			if err := s.validateEnvironmentVariableType(value, req.Type); err != nil {
+		if source != "" {
+			status.Status = "set"
+			status.Source = source
+			status.Current, status.Masked = maskEnvironmentValue(value, req)
+
+			// 验证类型与规则
+			if err := validateEnvironmentValue(value, req); err != nil {
 				status.Status = "invalid"
-				status.Message = fmt.Sprintf("环境变量类型无效: %v", err)
+				status.Message = fmt.Sprintf("环境变量值无效: %v", err)
 			}
-		} else if req.Default != "" {
-			status.Status = "set"
-			status.Current = req.Default
-			status.Message = "使用默认值"
 		}
 
 		statuses = append(statuses, status)
@@ -339,23 +364,198 @@ func (s *DependencyService) checkEnvironmentVariables(requirements []models.Envi
 	return statuses
 }
 
-// validateEnvironmentVariableType 验证环境变量类型
-func (s *DependencyService) validateEnvironmentVariableType(value, expectedType string) error {
-	switch expectedType {
+// resolveEnvironmentValue 解析环境变量的实际取值及来源
+func (s *DependencyService) resolveEnvironmentValue(ctx context.Context, pluginKey string, req models.EnvironmentVariable) (string, string) {
+	if value := os.Getenv(req.Name); value != "" {
+		return value, "env"
+	}
+
+	if s.settingService != nil {
+		setting, err := s.settingService.GetSetting(ctx, pluginKey, req.Name)
+		if err != nil {
+			logger.Error("读取插件配置失败", zap.String("plugin", pluginKey), zap.String("name", req.Name), zap.Error(err))
+		} else if setting != nil && setting.Value != "" {
+			return setting.Value, "settings"
+		}
+	}
+
+	if req.Default != "" {
+		return req.Default, "default"
+	}
+
+	return "", ""
+}
+
+// maskEnvironmentValue 返回可对外展示的值，敏感值始终掩码，URL 中的密码会被隐藏
+func maskEnvironmentValue(value string, req models.EnvironmentVariable) (string, bool) {
+	if req.Secret {
+		return maskedValue, true
+	}
+
+	if req.Type == "url" {
+		if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+			if _, hasPassword := parsed.User.Password(); hasPassword {
+				return parsed.Redacted(), true
+			}
+		}
+	}
+
+	return value, false
+}
+
+// validateEnvironmentValue 按类型和校验规则验证环境变量值
+func validateEnvironmentValue(value string, req models.EnvironmentVariable) error {
+	rules := req.Validation
+	if rules == nil {
+		rules = &models.EnvironmentValidation{}
+	}
+
+	// number 为参与 min/max 比较的数值
+	var number float64
+	hasNumber := false
+
+	switch req.Type {
 	case "int":
-		_, err := strconv.Atoi(value)
-		return err
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("不是有效的整数")
+		}
+		number, hasNumber = float64(n), true
+	case "float":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("不是有效的数字")
+		}
+		number, hasNumber = n, true
 	case "bool":
-		_, err := strconv.ParseBool(value)
-		return err
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("不是有效的布尔值")
+		}
+	case "port":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("端口必须是 1-65535 之间的整数")
+		}
+		number, hasNumber = float64(n), true
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("不是有效的时长，例如 30s、5m")
+		}
+		number, hasNumber = d.Seconds(), true
 	case "url":
-		if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
-			return fmt.Errorf("无效的URL格式")
+		if err := validateURLValue(value, rules.AllowedSchemes); err != nil {
+			return err
+		}
+	case "enum":
+		if len(rules.Enum) == 0 {
+			return fmt.Errorf("未配置可选值")
+		}
+	case "", "string":
+		number, hasNumber = float64(len(value)), true
+	default:
+		return fmt.Errorf("不支持的类型: %s", req.Type)
+	}
+
+	if len(rules.Enum) > 0 {
+		matched := false
+		for _, option := range rules.Enum {
+			if value == option {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("取值必须是以下之一: %s", strings.Join(rules.Enum, ", "))
+		}
+	}
+
+	if rules.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + rules.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("校验规则中的正则表达式无效")
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("取值不符合格式要求")
 		}
 	}
+
+	if hasNumber {
+		if rules.Min != nil && number < *rules.Min {
+			return fmt.Errorf("取值不能小于 %v", *rules.Min)
+		}
+		if rules.Max != nil && number > *rules.Max {
+			return fmt.Errorf("取值不能大于 %v", *rules.Max)
+		}
+	}
+
 	return nil
 }
 
+// validateURLValue 校验URL格式及协议
+func validateURLValue(value string, allowedSchemes []string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("无效的URL格式")
+	}
+
+	if len(allowedSchemes) == 0 {
+		allowedSchemes = []string{"http", "https"}
+	}
+	for _, scheme := range allowedSchemes {
+		if strings.EqualFold(parsed.Scheme, scheme) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("URL协议必须是以下之一: %s", strings.Join(allowedSchemes, ", "))
+}
+
+// GetPluginSettings 获取插件环境变量配置状态（敏感值已掩码）
+func (s *DependencyService) GetPluginSettings(ctx context.Context, pluginKey string, requirements []models.EnvironmentVariable) []models.EnvironmentStatus {
+	return s.checkEnvironmentVariables(ctx, pluginKey, requirements)
+}
+
+// SavePluginSettings 校验并保存插件配置，只接受依赖配置中声明过的变量
+func (s *DependencyService) SavePluginSettings(ctx context.Context, pluginKey string, requirements []models.EnvironmentVariable, values map[string]string) error {
+	if s.settingService == nil {
+		return customerrors.NewError("插件配置存储不可用", http.StatusServiceUnavailable)
+	}
+
+	declared := make(map[string]models.EnvironmentVariable, len(requirements))
+	for _, req := range requirements {
+		declared[req.Name] = req
+	}
+
+	// 先全部校验，避免部分写入
+	for name, value := range values {
+		req, ok := declared[name]
+		if !ok {
+			return customerrors.NewError(fmt.Sprintf("插件未声明变量: %s", name), http.StatusBadRequest)
+		}
+		if err := validateEnvironmentValue(value, req); err != nil {
+			return customerrors.NewError(fmt.Sprintf("变量 %s 的值无效: %v", name, err), http.StatusBadRequest)
+		}
+	}
+
+	for name, value := range values {
+		if err := s.settingService.SaveSetting(ctx, pluginKey, name, value, declared[name].Secret); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Plugin settings saved", zap.String("plugin", pluginKey), zap.Int("count", len(values)))
+	return nil
+}
+
+// DeletePluginSetting 删除插件配置项
+func (s *DependencyService) DeletePluginSetting(ctx context.Context, pluginKey, name string) error {
+	if s.settingService == nil {
+		return customerrors.NewError("插件配置存储不可用", http.StatusServiceUnavailable)
+	}
+	return s.settingService.DeleteSetting(ctx, pluginKey, name)
+}
+
 // generateSuggestions 生成建议
 func (s *DependencyService) generateSuggestions(result *models.DependencyCheckResult) []string {
 	var suggestions []string
@@ -366,7 +566,9 @@ func (s *DependencyService) generateSuggestions(result *models.DependencyCheckRe
 
 	for _, env := range result.Environment {
 		if env.Status == "missing" && env.Requirement.Required {
-			suggestions = append(suggestions, fmt.Sprintf("请设置环境变量: %s", env.Requirement.Name))
+			suggestions = append(suggestions, fmt.Sprintf("请设置环境变量 %s，或通过插件配置接口提供该值", env.Requirement.Name))
+		} else if env.Status == "invalid" {
+			suggestions = append(suggestions, fmt.Sprintf("请修正环境变量: %s", env.Requirement.Name))
 		}
 	}
 
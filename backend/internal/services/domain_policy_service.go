@@ -0,0 +1,567 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// defaultCheckTimeout 未匹配任何策略时的检测超时时间
+	defaultCheckTimeout = 18 * time.Second
+	// domainPolicyCacheTTL 策略在内存中的缓存时长，多实例部署时修改最迟在该时间后生效
+	domainPolicyCacheTTL = 30 * time.Second
+	// maxPolicyTimeoutSeconds 策略允许配置的最大超时时间
+	maxPolicyTimeoutSeconds = 300
+	// rateLimitSweepSize 频率限制记录的主机数超过该值时清理已过期的记录
+	rateLimitSweepSize = 1024
+)
+
+// DomainPolicyService 域名检测策略服务
+type DomainPolicyService struct {
+	db *mongo.Database
+
+	mu       sync.RWMutex
+	policies []models.DomainPolicy
+	loadedAt time.Time
+
+	limitMu  sync.Mutex
+	nextSlot map[string]time.Time
+}
+
+// NewDomainPolicyService 创建域名检测策略服务
+func NewDomainPolicyService(db *mongo.Database) *DomainPolicyService {
+	return &DomainPolicyService{
+		db:       db,
+		nextSlot: make(map[string]time.Time),
+	}
+}
+
+func (s *DomainPolicyService) collection() *mongo.Collection {
+	return s.db.Collection("link_domain_policies")
+}
+
+// EnsureDefaults 创建索引，集合为空时写入内置的默认策略
+func (s *DomainPolicyService) EnsureDefaults(ctx context.Context) error {
+	_, err := s.collection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "pattern", Value: 1}, {Key: "match_type", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	count, err := s.collection().EstimatedDocumentCount(ctx)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	now := time.Now()
+	docs := make([]interface{}, 0)
+	for _, policy := range defaultDomainPolicies() {
+		policy.Enabled = true
+		policy.CreatedAt = now
+		policy.UpdatedAt = now
+		docs = append(docs, policy)
+	}
+	if _, err := s.collection().InsertMany(ctx, docs); err != nil {
+		return err
+	}
+
+	logger.Info("已写入默认域名检测策略", zap.Int("count", len(docs)))
+	s.invalidate()
+	return nil
+}
+
+// ListPolicies 获取全部域名策略
+func (s *DomainPolicyService) ListPolicies(ctx context.Context) ([]models.DomainPolicy, error) {
+	cursor, err := s.collection().Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "pattern", Value: 1}}))
+	if err != nil {
+		logger.Error("获取域名策略列表失败", zap.Error(err))
+		return nil, errors.NewError("获取域名策略列表失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	policies := []models.DomainPolicy{}
+	if err := cursor.All(ctx, &policies); err != nil {
+		logger.Error("解析域名策略列表失败", zap.Error(err))
+		return nil, errors.NewError("解析域名策略列表失败", http.StatusInternalServerError)
+	}
+
+	return policies, nil
+}
+
+// GetPolicy 获取单个域名策略
+func (s *DomainPolicyService) GetPolicy(ctx context.Context, id string) (*models.DomainPolicy, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的策略ID", http.StatusBadRequest)
+	}
+
+	var policy models.DomainPolicy
+	if err := s.collection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&policy); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("域名策略不存在", http.StatusNotFound)
+		}
+		logger.Error("获取域名策略失败", zap.String("id", id), zap.Error(err))
+		return nil, errors.NewError("获取域名策略失败", http.StatusInternalServerError)
+	}
+
+	return &policy, nil
+}
+
+// CreatePolicy 创建域名策略
+func (s *DomainPolicyService) CreatePolicy(ctx context.Context, req models.DomainPolicyRequest) (*models.DomainPolicy, error) {
+	policy, err := buildDomainPolicy(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+
+	result, err := s.collection().InsertOne(ctx, policy)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.NewError("相同的域名策略已存在", http.StatusConflict)
+		}
+		logger.Error("创建域名策略失败", zap.String("pattern", policy.Pattern), zap.Error(err))
+		return nil, errors.NewError("创建域名策略失败", http.StatusInternalServerError)
+	}
+	policy.ID = result.InsertedID.(primitive.ObjectID)
+
+	s.invalidate()
+	return policy, nil
+}
+
+// UpdatePolicy 更新域名策略
+func (s *DomainPolicyService) UpdatePolicy(ctx context.Context, id string, req models.DomainPolicyRequest) (*models.DomainPolicy, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的策略ID", http.StatusBadRequest)
+	}
+
+	policy, err := buildDomainPolicy(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated models.DomainPolicy
+	err = s.collection().FindOneAndUpdate(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{
+			"pattern":               policy.Pattern,
+			"match_type":            policy.MatchType,
+			"description":           policy.Description,
+			"enabled":               policy.Enabled,
+			"timeout_seconds":       policy.TimeoutSeconds,
+			"allowed_methods":       policy.AllowedMethods,
+			"headers":               policy.Headers,
+			"expected_status_codes": policy.ExpectedStatusCodes,
+			"reset_is_healthy":      policy.ResetIsHealthy,
+			"error_is_healthy":      policy.ErrorIsHealthy,
+			"healthy_message":       policy.HealthyMessage,
+			"rate_limit_per_minute": policy.RateLimitPerMinute,
+			"check_profile":         policy.CheckProfile,
+			"proxy":                 policy.Proxy,
+			"updated_at":            time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("域名策略不存在", http.StatusNotFound)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.NewError("相同的域名策略已存在", http.StatusConflict)
+		}
+		logger.Error("更新域名策略失败", zap.String("id", id), zap.Error(err))
+		return nil, errors.NewError("更新域名策略失败", http.StatusInternalServerError)
+	}
+
+	s.invalidate()
+	return &updated, nil
+}
+
+// DeletePolicy 删除域名策略
+func (s *DomainPolicyService) DeletePolicy(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.NewError("无效的策略ID", http.StatusBadRequest)
+	}
+
+	result, err := s.collection().DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		logger.Error("删除域名策略失败", zap.String("id", id), zap.Error(err))
+		return errors.NewError("删除域名策略失败", http.StatusInternalServerError)
+	}
+	if result.DeletedCount == 0 {
+		return errors.NewError("域名策略不存在", http.StatusNotFound)
+	}
+
+	s.invalidate()
+	return nil
+}
+
+// Preview 预览某个URL实际生效的域名策略
+func (s *DomainPolicyService) Preview(ctx context.Context, rawURL string) (*models.DomainPolicyPreview, error) {
+	host := policyHost(rawURL)
+	if host == "" {
+		return nil, errors.NewError("无效的URL", http.StatusBadRequest)
+	}
+
+	candidates := []models.DomainPolicy{}
+	for _, policy := range s.enabledPolicies(ctx) {
+		if matchDomainPolicy(host, policy) {
+			candidates = append(candidates, policy)
+		}
+	}
+	sortBySpecificity(candidates)
+
+	preview := &models.DomainPolicyPreview{
+		URL:        rawURL,
+		Host:       host,
+		Candidates: candidates,
+	}
+	if len(candidates) > 0 {
+		preview.Matched = true
+		preview.Policy = &candidates[0]
+		preview.Effective = effectivePolicy(&candidates[0])
+	} else {
+		preview.Effective = effectivePolicy(nil)
+	}
+
+	return preview, nil
+}
+
+// Resolve 返回URL实际生效的策略，未匹配时返回默认策略
+func (s *DomainPolicyService) Resolve(ctx context.Context, rawURL string) models.DomainPolicy {
+	host := policyHost(rawURL)
+	if host == "" {
+		return effectivePolicy(nil)
+	}
+
+	var best *models.DomainPolicy
+	policies := s.enabledPolicies(ctx)
+	for i := range policies {
+		if !matchDomainPolicy(host, policies[i]) {
+			continue
+		}
+		if best == nil || moreSpecific(policies[i], *best) {
+			best = &policies[i]
+		}
+	}
+
+	return effectivePolicy(best)
+}
+
+// WaitTurn 按策略的频率限制等待同一主机的下一个检测时间片
+func (s *DomainPolicyService) WaitTurn(ctx context.Context, rawURL string, policy models.DomainPolicy) error {
+	if policy.RateLimitPerMinute <= 0 {
+		return nil
+	}
+	host := policyHost(rawURL)
+	interval := time.Minute / time.Duration(policy.RateLimitPerMinute)
+
+	s.limitMu.Lock()
+	now := time.Now()
+	slot, ok := s.nextSlot[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	s.nextSlot[host] = slot.Add(interval)
+	if !ok && len(s.nextSlot) > rateLimitSweepSize {
+		s.sweepSlotsLocked(now)
+	}
+	s.limitMu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// sweepSlotsLocked 删除时间片已过去的主机，这些主机的下一次请求不需要等待，调用方需持有 limitMu
+func (s *DomainPolicyService) sweepSlotsLocked(now time.Time) {
+	for host, slot := range s.nextSlot {
+		if !slot.After(now) {
+			delete(s.nextSlot, host)
+		}
+	}
+}
+
+// enabledPolicies 获取已启用的策略，带短时内存缓存
+func (s *DomainPolicyService) enabledPolicies(ctx context.Context) []models.DomainPolicy {
+	s.mu.RLock()
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < domainPolicyCacheTTL {
+		policies := s.policies
+		s.mu.RUnlock()
+		return policies
+	}
+	s.mu.RUnlock()
+
+	policies := []models.DomainPolicy{}
+	cursor, err := s.collection().Find(ctx, bson.M{"enabled": true})
+	if err == nil {
+		err = cursor.All(ctx, &policies)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// 加载失败时继续使用上一次的策略，避免数据库抖动导致检测结果突变
+		logger.Warn("加载域名策略失败", zap.Error(err))
+		return s.policies
+	}
+	s.policies = policies
+	s.loadedAt = time.Now()
+	return policies
+}
+
+func (s *DomainPolicyService) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// buildDomainPolicy 校验请求并生成策略
+func buildDomainPolicy(req models.DomainPolicyRequest) (*models.DomainPolicy, error) {
+	pattern := strings.ToLower(strings.TrimSpace(req.Pattern))
+	pattern = strings.TrimSuffix(pattern, ".")
+	if pattern == "" {
+		return nil, errors.NewError("域名不能为空", http.StatusBadRequest)
+	}
+
+	matchType := req.MatchType
+	if matchType == "" {
+		matchType = models.DomainMatchSuffix
+	}
+	switch matchType {
+	case models.DomainMatchExact, models.DomainMatchSuffix:
+		if strings.ContainsAny(pattern, "*?[]/:") {
+			return nil, errors.NewError("精确匹配和后缀匹配的域名不能包含通配符或路径", http.StatusBadRequest)
+		}
+	case models.DomainMatchWildcard:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.NewError("无效的通配符表达式", http.StatusBadRequest)
+		}
+	default:
+		return nil, errors.NewError("无效的匹配方式，可选值: exact, suffix, wildcard", http.StatusBadRequest)
+	}
+
+	if req.TimeoutSeconds < 0 || req.TimeoutSeconds > maxPolicyTimeoutSeconds {
+		return nil, errors.NewError("超时时间必须在0到300秒之间", http.StatusBadRequest)
+	}
+	if req.RateLimitPerMinute < 0 {
+		return nil, errors.NewError("频率限制不能为负数", http.StatusBadRequest)
+	}
+
+	if !validCheckProfile(req.CheckProfile) {
+		return nil, errors.NewError("无效的检测器配置，可选值: head_get, get, browser", http.StatusBadRequest)
+	}
+	proxy := strings.TrimSpace(req.Proxy)
+	if err := validateProxySelector(proxy); err != nil {
+		return nil, err
+	}
+
+	methods := make([]string, 0, len(req.AllowedMethods))
+	for _, method := range req.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method != http.MethodHead && method != http.MethodGet {
+			return nil, errors.NewError("检测方法只支持 HEAD 和 GET", http.StatusBadRequest)
+		}
+		methods = append(methods, method)
+	}
+
+	for _, code := range req.ExpectedStatusCodes {
+		if code < 100 || code > 599 {
+			return nil, errors.NewError("无效的期望状态码", http.StatusBadRequest)
+		}
+	}
+
+	for name := range req.Headers {
+		if strings.TrimSpace(name) == "" {
+			return nil, errors.NewError("请求头名称不能为空", http.StatusBadRequest)
+		}
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	return &models.DomainPolicy{
+		Pattern:             pattern,
+		MatchType:           matchType,
+		IncludeWWW:          matchType == models.DomainMatchExact && req.IncludeWWW,
+		Description:         req.Description,
+		Enabled:             enabled,
+		TimeoutSeconds:      req.TimeoutSeconds,
+		AllowedMethods:      methods,
+		Headers:             req.Headers,
+		ExpectedStatusCodes: req.ExpectedStatusCodes,
+		ResetIsHealthy:      req.ResetIsHealthy,
+		ErrorIsHealthy:      req.ErrorIsHealthy,
+		HealthyMessage:      req.HealthyMessage,
+		RateLimitPerMinute:  req.RateLimitPerMinute,
+		CheckProfile:        req.CheckProfile,
+		Proxy:               proxy,
+	}, nil
+}
+
+// effectivePolicy 用默认值补全策略中未配置的字段
+func effectivePolicy(policy *models.DomainPolicy) models.DomainPolicy {
+	effective := models.DomainPolicy{
+		MatchType:      models.DomainMatchWildcard,
+		Pattern:        "*",
+		Enabled:        true,
+		ResetIsHealthy: true,
+	}
+	if policy != nil {
+		effective = *policy
+	}
+
+	if effective.TimeoutSeconds <= 0 {
+		effective.TimeoutSeconds = int(defaultCheckTimeout / time.Second)
+	}
+	if len(effective.AllowedMethods) == 0 {
+		effective.AllowedMethods = []string{http.MethodHead, http.MethodGet}
+	}
+	return effective
+}
+
+// policyHost 解析URL中的主机名
+func policyHost(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+}
+
+// matchDomainPolicy 判断主机名是否匹配策略
+func matchDomainPolicy(host string, policy models.DomainPolicy) bool {
+	switch policy.MatchType {
+	case models.DomainMatchExact:
+		return host == policy.Pattern || (policy.IncludeWWW && host == "www."+policy.Pattern)
+	case models.DomainMatchSuffix:
+		return host == policy.Pattern || strings.HasSuffix(host, "."+policy.Pattern)
+	case models.DomainMatchWildcard:
+		matched, _ := path.Match(policy.Pattern, host)
+		return matched
+	}
+	return false
+}
+
+// moreSpecific 多条策略同时匹配时，精确匹配优先，其次是更长的后缀，最后是通配符中固定字符更多的
+func moreSpecific(a, b models.DomainPolicy) bool {
+	rank := func(p models.DomainPolicy) int {
+		switch p.MatchType {
+		case models.DomainMatchExact:
+			return 2
+		case models.DomainMatchSuffix:
+			return 1
+		}
+		return 0
+	}
+	if rank(a) != rank(b) {
+		return rank(a) > rank(b)
+	}
+
+	literalA := len(strings.Trim(a.Pattern, "*?"))
+	literalB := len(strings.Trim(b.Pattern, "*?"))
+	if literalA != literalB {
+		return literalA > literalB
+	}
+	return a.Pattern < b.Pattern
+}
+
+func sortBySpecificity(policies []models.DomainPolicy) {
+	sort.SliceStable(policies, func(i, j int) bool {
+		return moreSpecific(policies[i], policies[j])
+	})
+}
+
+// defaultDomainPolicies 内置默认策略，首次启动时写入数据库，之后通过接口维护
+func defaultDomainPolicies() []models.DomainPolicy {
+	const restricted = "网站可用 - 该网站对自动化检测有限制，但网站本身正常运行"
+	googleMessage := "网站可用 - Google 服务对自动化检测有限制，但网站本身正常运行"
+
+	policy := func(pattern string, timeout int, errorIsHealthy bool, message string) models.DomainPolicy {
+		if errorIsHealthy && message == "" {
+			message = restricted
+		}
+		return models.DomainPolicy{
+			Pattern:        pattern,
+			MatchType:      models.DomainMatchSuffix,
+			TimeoutSeconds: timeout,
+			ResetIsHealthy: true,
+			ErrorIsHealthy: errorIsHealthy,
+			HealthyMessage: message,
+		}
+	}
+
+	return []models.DomainPolicy{
+		// Google 系列服务
+		policy("trends.google.com", 60, true, "网站可用 - Google Trends 对自动化检测有限制，但网站本身正常运行"),
+		policy("console.cloud.google.com", 35, true, googleMessage),
+		policy("analytics.google.com", 30, true, googleMessage),
+		policy("youtube.com", 25, true, ""),
+		policy("google.com", 25, false, ""),
+
+		// 社交媒体
+		policy("facebook.com", 20, true, ""),
+		policy("linkedin.com", 20, true, ""),
+		policy("twitter.com", 20, true, ""),
+		policy("x.com", 20, true, ""),
+		policy("instagram.com", 20, true, ""),
+
+		// 电商网站
+		policy("amazon.com", 25, true, ""),
+		policy("ebay.com", 20, true, ""),
+		policy("simonandschuster.com", 25, true, "网站可用 - Simon & Schuster 对自动化检测有限制，但网站本身正常运行"),
+		policy("barnes.com", 20, true, ""),
+		policy("alibaba.com", 20, true, ""),
+		policy("thevineking.com", 0, true, "网站可用 - The Vineking 有反爬虫保护机制，但网站本身正常运行"),
+
+		// 新闻媒体
+		policy("cnn.com", 20, true, ""),
+		policy("bbc.com", 20, true, ""),
+		policy("reuters.com", 20, true, ""),
+		policy("wsj.com", 20, true, ""),
+
+		// 技术网站
+		policy("github.com", 15, false, ""),
+		policy("stackoverflow.com", 15, false, ""),
+		policy("medium.com", 15, false, ""),
+
+		// 流媒体和其他大型网站
+		policy("netflix.com", 20, true, ""),
+		policy("spotify.com", 20, true, ""),
+		policy("dropbox.com", 15, false, ""),
+	}
+}
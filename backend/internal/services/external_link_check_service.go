@@ -0,0 +1,585 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// defaultCheckRetention 原始检测记录默认保留时长
+	defaultCheckRetention = 30 * 24 * time.Hour
+	// defaultRollupRetention 按天汇总数据默认保留时长
+	defaultRollupRetention = 365 * 24 * time.Hour
+)
+
+// EnsureCheckIndexes 创建检测记录集合及索引
+// retention 为原始检测记录保留时长，rollupRetention 为按天汇总数据保留时长，不足一秒时使用默认值（TTL 为 0 会立即删除数据）
+func (s *ExternalLinkService) EnsureCheckIndexes(ctx context.Context, retention, rollupRetention time.Duration) error {
+	if retention < time.Second {
+		logger.Warn("检测记录保留时长无效，使用默认值", zap.Duration("retention", retention), zap.Duration("default", defaultCheckRetention))
+		retention = defaultCheckRetention
+	}
+	if rollupRetention < time.Second {
+		logger.Warn("检测汇总保留时长无效，使用默认值", zap.Duration("retention", rollupRetention), zap.Duration("default", defaultRollupRetention))
+		rollupRetention = defaultRollupRetention
+	}
+
+	if err := s.ensureLinkChecksCollection(ctx, retention); err != nil {
+		return err
+	}
+
+	_, err := s.db.Collection("link_checks").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "link_id", Value: 1}, {Key: "checked_at", Value: -1}}},
+		{Keys: bson.D{{Key: "checked_at", Value: -1}}},
+	})
+	if err != nil {
+		logger.Error("创建检测记录索引失败", zap.Error(err))
+		return err
+	}
+
+	_, err = s.db.Collection("external_links").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "last_checked_at", Value: 1}},
+	})
+	if err != nil {
+		logger.Error("创建外链检测时间索引失败", zap.Error(err))
+		return err
+	}
+
+	_, err = s.db.Collection("link_check_daily").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "link_id", Value: 1}, {Key: "day", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "day", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(rollupRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		logger.Error("创建检测汇总索引失败", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ensureLinkChecksCollection 优先创建时序集合；MongoDB 低于 5.0 或集合已存在时退化为普通集合加 TTL 索引
+func (s *ExternalLinkService) ensureLinkChecksCollection(ctx context.Context, retention time.Duration) error {
+	specs, err := s.db.ListCollectionSpecifications(ctx, bson.M{"name": "link_checks"})
+	if err != nil {
+		logger.Error("查询检测记录集合失败", zap.Error(err))
+		return err
+	}
+
+	if len(specs) == 0 {
+		opts := options.CreateCollection().
+			SetTimeSeriesOptions(options.TimeSeries().
+				SetTimeField("checked_at").
+				SetMetaField("link_id").
+				SetGranularity("minutes")).
+			SetExpireAfterSeconds(int64(retention.Seconds()))
+		createErr := s.db.CreateCollection(ctx, "link_checks", opts)
+		if createErr == nil {
+			return nil
+		}
+		logger.Warn("创建时序集合失败，使用普通集合", zap.Error(createErr))
+	} else if specs[0].Type == "timeseries" {
+		return nil
+	}
+
+	_, err = s.db.Collection("link_checks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "checked_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+	})
+	if err != nil {
+		logger.Error("创建检测记录过期索引失败", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// CheckLink 检测单个链接并保存结果，ctx 已取消时只返回结果
+func (s *ExternalLinkService) CheckLink(ctx context.Context, link models.ExternalLink, source string) models.LinkCheckResult {
+	result, page := s.checkLinkAvailability(ctx, link)
+	// 检测中途被取消（实例退出或巡检锁被抢占）时结果不可信，不写入
+	if ctx.Err() != nil {
+		return result
+	}
+	s.recordCheckResult(link, result, source)
+	s.enrichMetadata(ctx, link, result, page)
+	return result
+}
+
+// recordCheckResult 更新链接的检测状态并写入检测记录
+// 使用独立的上下文写库，避免网络请求超时影响数据库操作
+func (s *ExternalLinkService) recordCheckResult(link models.ExternalLink, result models.LinkCheckResult, source string) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 未检测时只记录检测时间和原因，保留上次的可用状态，也不写入检测记录
+	if result.Skipped {
+		_, err := s.db.Collection("external_links").UpdateOne(dbCtx, bson.M{"_id": link.ID}, bson.M{"$set": bson.M{
+			"skip_reason":     result.SkipReason,
+			"last_checked_at": result.CheckedAt,
+			"updated_at":      time.Now(),
+		}})
+		if err != nil {
+			logger.Error("更新链接检测结果失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		}
+		return
+	}
+
+	update := bson.M{
+		"is_valid":         result.IsValid,
+		"last_check_error": result.ErrorMessage,
+		"last_checked_at":  result.CheckedAt,
+		"updated_at":       time.Now(),
+	}
+	if result.TLS != nil {
+		update["tls"] = result.TLS
+	}
+	if result.DNS != nil {
+		update["dns"] = result.DNS
+	}
+	unset := bson.M{"skip_reason": ""}
+	changes := bson.M{"$set": update, "$unset": unset}
+	// 失败原因按分类保存，重试用尽仍失败时才会到这里
+	if result.ErrorClass != "" && !result.IsValid {
+		update["last_error_code"] = result.ErrorClass
+	} else {
+		unset["last_error_code"] = ""
+	}
+	// 永久重定向到其他地址时记录规范地址，等待人工确认后改写；请求成功且不再跳转时清除
+	if result.PermanentRedirect {
+		update["canonical_url"] = result.CanonicalURL
+	} else if result.StatusCode > 0 {
+		unset["canonical_url"] = ""
+	}
+	// 记录连续失败次数，用于判断是否需要告警
+	if result.IsValid {
+		update["consecutive_failures"] = 0
+	} else {
+		changes["$inc"] = bson.M{"consecutive_failures": 1}
+	}
+	var state struct {
+		ConsecutiveFailures int    `bson:"consecutive_failures"`
+		AlertState          string `bson:"alert_state"`
+	}
+	err := s.db.Collection("external_links").FindOneAndUpdate(
+		dbCtx,
+		bson.M{"_id": link.ID},
+		changes,
+		options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"consecutive_failures": 1, "alert_state": 1}),
+	).Decode(&state)
+	if err != nil {
+		logger.Error("更新链接检测结果失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+	} else if s.alerts != nil {
+		s.alerts.observe(link, result, state.ConsecutiveFailures, state.AlertState)
+	}
+
+	check := models.LinkCheck{
+		LinkID:       link.ID,
+		URL:          link.URL,
+		IsValid:      result.IsValid,
+		Message:      result.Message,
+		ErrorMessage: result.ErrorMessage,
+		Source:       source,
+		CheckedAt:    result.CheckedAt,
+		StatusCode:   result.StatusCode,
+		LatencyMs:    result.LatencyMs,
+		FinalURL:     result.FinalURL,
+		ErrorClass:   result.ErrorClass,
+		Profile:      result.Profile,
+		Attempts:     result.Attempts,
+		Proxy:        result.Proxy,
+		DNS:          result.DNS,
+
+		FailedAssertion:   result.FailedAssertion,
+		RedirectChain:     result.RedirectChain,
+		PermanentRedirect: result.PermanentRedirect,
+		CanonicalURL:      result.CanonicalURL,
+	}
+	if _, err := s.db.Collection("link_checks").InsertOne(dbCtx, check); err != nil {
+		logger.Error("保存检测记录失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+	}
+}
+
+// FindLinksDueForCheck 获取需要巡检的链接
+// 按陈旧程度和点击量综合排序：score = 距上次检测秒数 * (1 + ln(clicks + 1))
+func (s *ExternalLinkService) FindLinksDueForCheck(ctx context.Context, staleBefore time.Time, limit int) ([]models.ExternalLink, error) {
+	now := time.Now()
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"is_active": true,
+			"$or": []bson.M{
+				{"last_checked_at": bson.M{"$exists": false}},
+				{"last_checked_at": bson.M{"$lt": staleBefore}},
+			},
+		}},
+		{"$addFields": bson.M{
+			"_check_score": bson.M{"$multiply": []interface{}{
+				bson.M{"$divide": []interface{}{
+					bson.M{"$subtract": []interface{}{now, bson.M{"$ifNull": []interface{}{"$last_checked_at", time.Unix(0, 0)}}}},
+					1000,
+				}},
+				bson.M{"$add": []interface{}{1, bson.M{"$ln": bson.M{"$add": []interface{}{bson.M{"$max": []interface{}{"$clicks", 0}}, 1}}}}},
+			}},
+		}},
+		{"$sort": bson.D{{Key: "_check_score", Value: -1}, {Key: "_id", Value: 1}}},
+		{"$limit": limit},
+		{"$project": bson.M{"_check_score": 0}},
+	}
+
+	cursor, err := s.db.Collection("external_links").Aggregate(ctx, pipeline)
+	if err != nil {
+		logger.Error("获取待巡检链接失败", zap.Error(err))
+		return nil, errors.NewError("获取待巡检链接失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	var links []models.ExternalLink
+	if err := cursor.All(ctx, &links); err != nil {
+		logger.Error("解析待巡检链接失败", zap.Error(err))
+		return nil, errors.NewError("解析待巡检链接失败", http.StatusInternalServerError)
+	}
+
+	return links, nil
+}
+
+// IsLinkDueForCheck 重新读取链接，确认在获取锁期间没有被其他实例检测过
+func (s *ExternalLinkService) IsLinkDueForCheck(ctx context.Context, id primitive.ObjectID, staleBefore time.Time) (bool, error) {
+	var link models.ExternalLink
+	err := s.db.Collection("external_links").FindOne(ctx, bson.M{"_id": id},
+		options.FindOne().SetProjection(bson.M{"last_checked_at": 1, "is_active": 1})).Decode(&link)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !link.IsActive {
+		return false, nil
+	}
+	return link.LastCheckedAt == nil || link.LastCheckedAt.Before(staleBefore), nil
+}
+
+// ListLinkChecks 获取链接的检测记录
+func (s *ExternalLinkService) ListLinkChecks(ctx context.Context, id string, page, perPage int) (*models.LinkCheckListResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	if err := requireVisibleLink(ctx, s.db, objectID); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"link_id": objectID}
+	total, err := s.db.Collection("link_checks").CountDocuments(ctx, filter)
+	if err != nil {
+		logger.Error("获取检测记录总数失败", zap.Error(err))
+		return nil, errors.NewError("获取检测记录失败", http.StatusInternalServerError)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "checked_at", Value: -1}}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+	cursor, err := s.db.Collection("link_checks").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Error("获取检测记录失败", zap.Error(err))
+		return nil, errors.NewError("获取检测记录失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	checks := []models.LinkCheck{}
+	if err := cursor.All(ctx, &checks); err != nil {
+		logger.Error("解析检测记录失败", zap.Error(err))
+		return nil, errors.NewError("解析检测记录失败", http.StatusInternalServerError)
+	}
+
+	response := &models.LinkCheckListResponse{Data: checks}
+	response.Meta.Total = int(total)
+	response.Meta.PerPage = perPage
+	response.Meta.CurrentPage = page
+	response.Meta.LastPage = (int(total) + perPage - 1) / perPage
+
+	return response, nil
+}
+
+// RollupLinkChecks 将 until 之前尚未汇总的原始检测记录按天（UTC）汇总到 link_check_daily
+// 汇总进度保存在 link_check_rollup_state 中，重复执行是幂等的
+func (s *ExternalLinkService) RollupLinkChecks(ctx context.Context, until time.Time) error {
+	until = until.UTC().Truncate(24 * time.Hour)
+
+	var state struct {
+		RolledUntil time.Time `bson:"rolled_until"`
+	}
+	err := s.db.Collection("link_check_rollup_state").FindOne(ctx, bson.M{"_id": "daily"}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		logger.Error("读取检测汇总进度失败", zap.Error(err))
+		return err
+	}
+	if !state.RolledUntil.Before(until) {
+		return nil
+	}
+
+	match := bson.M{"checked_at": bson.M{"$lt": until}}
+	if !state.RolledUntil.IsZero() {
+		match["checked_at"] = bson.M{"$gte": state.RolledUntil, "$lt": until}
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"link_id": "$link_id",
+				"day": bson.M{"$dateFromParts": bson.M{
+					"year":  bson.M{"$year": "$checked_at"},
+					"month": bson.M{"$month": "$checked_at"},
+					"day":   bson.M{"$dayOfMonth": "$checked_at"},
+				}},
+			},
+			"checks": bson.M{"$sum": 1},
+			"up":     bson.M{"$sum": bson.M{"$cond": []interface{}{"$is_valid", 1, 0}}},
+			"latency_sum_ms": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$latency_ms", 0}}, "$latency_ms", 0,
+			}}},
+			"latency_checks": bson.M{"$sum": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$latency_ms", 0}}, 1, 0,
+			}}},
+			"latency_min_ms": bson.M{"$min": bson.M{"$cond": []interface{}{
+				bson.M{"$gt": []interface{}{"$latency_ms", 0}}, "$latency_ms", nil,
+			}}},
+			"latency_max_ms": bson.M{"$max": "$latency_ms"},
+		}},
+		{"$project": bson.M{
+			"_id":            0,
+			"link_id":        "$_id.link_id",
+			"day":            "$_id.day",
+			"checks":         1,
+			"up":             1,
+			"latency_sum_ms": 1,
+			"latency_checks": 1,
+			"latency_min_ms": 1,
+			"latency_max_ms": 1,
+		}},
+		{"$merge": bson.M{
+			"into":           "link_check_daily",
+			"on":             []string{"link_id", "day"},
+			"whenMatched":    "replace",
+			"whenNotMatched": "insert",
+		}},
+	}
+
+	cursor, err := s.db.Collection("link_checks").Aggregate(ctx, pipeline)
+	if err != nil {
+		logger.Error("汇总检测记录失败", zap.Error(err))
+		return err
+	}
+	cursor.Close(ctx)
+
+	_, err = s.db.Collection("link_check_rollup_state").UpdateOne(ctx,
+		bson.M{"_id": "daily"},
+		bson.M{"$set": bson.M{"rolled_until": until, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		logger.Error("保存检测汇总进度失败", zap.Error(err))
+		return err
+	}
+
+	logger.Info("检测记录汇总完成", zap.Time("until", until))
+	return nil
+}
+
+// GetLinkUptime 计算链接在 [from, to] 内的可用率、平均响应时间和故障区间
+// 原始记录已过期的部分使用按天汇总数据，故障区间只基于原始记录计算
+func (s *ExternalLinkService) GetLinkUptime(ctx context.Context, id string, from, to time.Time) (*models.LinkUptimeReport, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+	}
+	if !from.Before(to) {
+		return nil, errors.NewError("开始时间必须早于结束时间", http.StatusBadRequest)
+	}
+	if err := requireVisibleLink(ctx, s.db, objectID); err != nil {
+		return nil, err
+	}
+
+	report := &models.LinkUptimeReport{
+		LinkID:    id,
+		From:      from,
+		To:        to,
+		Incidents: []models.LinkIncident{},
+	}
+	var latencySum int64
+	var latencyChecks int
+
+	addLatency := func(sum int64, checks int, min, max int64) {
+		if checks == 0 {
+			return
+		}
+		latencySum += sum
+		latencyChecks += checks
+		if report.MinLatencyMs == 0 || (min > 0 && min < report.MinLatencyMs) {
+			report.MinLatencyMs = min
+		}
+		if max > report.MaxLatencyMs {
+			report.MaxLatencyMs = max
+		}
+	}
+
+	// 原始记录覆盖的起点
+	rawStart := to
+	var earliest models.LinkCheck
+	err = s.db.Collection("link_checks").FindOne(ctx, bson.M{"link_id": objectID},
+		options.FindOne().SetSort(bson.D{{Key: "checked_at", Value: 1}}).SetProjection(bson.M{"checked_at": 1})).Decode(&earliest)
+	if err == nil {
+		rawStart = earliest.CheckedAt
+	} else if err != mongo.ErrNoDocuments {
+		logger.Error("获取检测记录失败", zap.Error(err))
+		return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+	}
+
+	// 原始记录之前的整天使用汇总数据
+	if from.Before(rawStart) {
+		dayFrom := from.UTC().Truncate(24 * time.Hour)
+		dayTo := rawStart.UTC().Truncate(24 * time.Hour)
+		if dayFrom.Before(dayTo) {
+			cursor, err := s.db.Collection("link_check_daily").Find(ctx, bson.M{
+				"link_id": objectID,
+				"day":     bson.M{"$gte": dayFrom, "$lt": dayTo},
+			})
+			if err != nil {
+				logger.Error("获取检测汇总失败", zap.Error(err))
+				return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+			}
+			var days []models.LinkCheckDaily
+			if err := cursor.All(ctx, &days); err != nil {
+				logger.Error("解析检测汇总失败", zap.Error(err))
+				return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+			}
+			for _, day := range days {
+				report.Checks += day.Checks
+				report.Up += day.Up
+				addLatency(day.LatencySumMs, day.LatencyChecks, day.LatencyMinMs, day.LatencyMaxMs)
+			}
+			if len(days) > 0 {
+				rollupFrom := from
+				report.RollupFrom = &rollupFrom
+			}
+		}
+	}
+
+	// 原始记录：逐条扫描计算故障区间
+	rangeStart := from
+	if rawStart.After(rangeStart) {
+		rangeStart = rawStart
+	}
+	cursor, err := s.db.Collection("link_checks").Find(ctx,
+		bson.M{"link_id": objectID, "checked_at": bson.M{"$gte": rangeStart, "$lte": to}},
+		options.Find().SetSort(bson.D{{Key: "checked_at", Value: 1}}))
+	if err != nil {
+		logger.Error("获取检测记录失败", zap.Error(err))
+		return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	var open *models.LinkIncident
+	for cursor.Next(ctx) {
+		var check models.LinkCheck
+		if err := cursor.Decode(&check); err != nil {
+			logger.Error("解析检测记录失败", zap.Error(err))
+			return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+		}
+
+		report.Checks++
+		if check.LatencyMs > 0 {
+			addLatency(check.LatencyMs, 1, check.LatencyMs, check.LatencyMs)
+		}
+
+		if check.IsValid {
+			report.Up++
+			if open != nil {
+				end := check.CheckedAt
+				open.End = &end
+				open.DurationMs = end.Sub(open.Start).Milliseconds()
+				report.DowntimeMs += open.DurationMs
+				report.Incidents = append(report.Incidents, *open)
+				open = nil
+			}
+			continue
+		}
+
+		if open == nil {
+			open = &models.LinkIncident{Start: check.CheckedAt, ErrorClass: check.ErrorClass}
+		}
+		open.Checks++
+		open.LastError = check.ErrorMessage
+	}
+	if err := cursor.Err(); err != nil {
+		logger.Error("读取检测记录失败", zap.Error(err))
+		return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+	}
+
+	// 区间结束时仍未恢复的故障：只有区间包含当前时间且最近一次检测仍然失败才算持续中
+	// 否则故障在区间内只统计到区间结束，区间之后的部分不计入
+	if open != nil {
+		now := time.Now()
+		end := to
+		if now.Before(end) {
+			end = now
+		}
+		open.DurationMs = end.Sub(open.Start).Milliseconds()
+		report.DowntimeMs += open.DurationMs
+
+		ongoing := false
+		if !to.Before(now) {
+			var latest models.LinkCheck
+			err := s.db.Collection("link_checks").FindOne(ctx, bson.M{"link_id": objectID},
+				options.FindOne().SetSort(bson.D{{Key: "checked_at", Value: -1}}).SetProjection(bson.M{"is_valid": 1})).Decode(&latest)
+			if err != nil && err != mongo.ErrNoDocuments {
+				logger.Error("获取最近检测记录失败", zap.Error(err))
+				return nil, errors.NewError("获取可用率失败", http.StatusInternalServerError)
+			}
+			ongoing = err == nil && !latest.IsValid
+		}
+		if ongoing {
+			report.OngoingOutage = true
+		} else {
+			open.End = &end
+		}
+		report.Incidents = append(report.Incidents, *open)
+	}
+
+	report.Down = report.Checks - report.Up
+	if report.Checks > 0 {
+		report.UptimePercent = float64(report.Up) * 100 / float64(report.Checks)
+	}
+	if latencyChecks > 0 {
+		report.MeanLatencyMs = float64(latencySum) / float64(latencyChecks)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// 总数统计方式
+const (
+	CountExact  = "exact"
+	CountApprox = "approx"
+	CountNone   = "none"
+)
+
+const (
+	// maxLinkPageSize 单页最多返回的链接数
+	maxLinkPageSize = 1000
+	// approxCountLimit 近似统计时最多计数的文档数，超过后只返回下限
+	approxCountLimit = 10000
+	// linkStreamBatchSize 流式读取时每批从数据库取回的文档数
+	linkStreamBatchSize = 500
+)
+
+// linkCursor 游标分页的位置，记录上一页最后一条记录的排序字段值
+type linkCursor struct {
+	Sort   string        `bson:"s"`
+	Values []interface{} `bson:"v"`
+}
+
+// sortSignature 排序的字符串表示，用于校验游标与本次排序一致
+func sortSignature(sort bson.D) string {
+	parts := make([]string, 0, len(sort))
+	for _, key := range sort {
+		parts = append(parts, fmt.Sprintf("%s:%v", key.Key, key.Value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeLinkCursor 根据一页中最后一条记录生成下一页的游标
+func encodeLinkCursor(sort bson.D, last bson.Raw) (string, error) {
+	cursor := linkCursor{Sort: sortSignature(sort), Values: make([]interface{}, len(sort))}
+	for i, key := range sort {
+		value, err := last.LookupErr(key.Key)
+		if err != nil {
+			// 缺失字段按 null 处理，与 MongoDB 的排序规则一致
+			continue
+		}
+		cursor.Values[i] = value
+	}
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeLinkCursor 解析游标，排序与生成游标时不一致时返回错误
+func decodeLinkCursor(token string, sort bson.D) ([]interface{}, error) {
+	invalid := errors.NewError("无效的游标", http.StatusBadRequest)
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor linkCursor
+	if err := bson.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(sort) {
+		return nil, invalid
+	}
+	if cursor.Sort != sortSignature(sort) {
+		return nil, errors.NewError("游标与当前排序不一致，请从第一页重新获取", http.StatusBadRequest)
+	}
+	return cursor.Values, nil
+}
+
+// keysetFilter 生成排在游标位置之后的记录的查询条件
+// 对排序键 k1..kn，匹配 k1 之后，或 k1 相等且 k2 之后，依此类推
+func keysetFilter(sort bson.D, values []interface{}) bson.M {
+	or := bson.A{}
+	for i, key := range sort {
+		after := keysetAfter(key.Key, values[i], key.Value.(int))
+		if after == nil {
+			continue
+		}
+		condition := bson.M{}
+		for j := 0; j < i; j++ {
+			condition[sort[j].Key] = values[j]
+		}
+		for k, v := range after {
+			condition[k] = v
+		}
+		or = append(or, condition)
+	}
+	return bson.M{"$or": or}
+}
+
+// keysetAfter 单个字段排在 value 之后的条件，没有任何值能排在之后时返回 nil
+// MongoDB 排序时 null 和缺失字段最小，而 $gt/$lt 不会跨类型比较，需要单独处理
+func keysetAfter(key string, value interface{}, order int) bson.M {
+	if order > 0 {
+		if value == nil {
+			return bson.M{key: bson.M{"$ne": nil}}
+		}
+		return bson.M{key: bson.M{"$gt": value}}
+	}
+	if value == nil {
+		return nil
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{key: bson.M{"$lt": value}},
+		bson.M{key: nil},
+	}}
+}
+
+// andFilter 返回附加了条件的新查询条件，不修改原条件
+func andFilter(filter, condition bson.M) bson.M {
+	result := make(bson.M, len(filter)+1)
+	for k, v := range filter {
+		result[k] = v
+	}
+	and := bson.A{}
+	if existing, ok := filter["$and"].(bson.A); ok {
+		and = append(and, existing...)
+	}
+	result["$and"] = append(and, condition)
+	return result
+}
+
+// countMode 校验统计方式，未指定时使用默认值
+func countMode(mode, fallback string) (string, error) {
+	switch mode {
+	case "":
+		return fallback, nil
+	case CountExact, CountApprox, CountNone:
+		return mode, nil
+	}
+	return "", errors.NewError(fmt.Sprintf("无效的统计方式 %q，可选值: exact, approx, none", mode), http.StatusBadRequest)
+}
+
+// countLinks 按统计方式计算符合条件的链接数，返回数量和是否为近似值
+func (s *ExternalLinkService) countLinks(ctx context.Context, filter bson.M, mode string) (int64, bool, error) {
+	collection := s.db.Collection("external_links")
+	switch mode {
+	case CountNone:
+		return 0, false, nil
+	case CountApprox:
+		if len(filter) == 0 {
+			total, err := collection.EstimatedDocumentCount(ctx)
+			return total, true, err
+		}
+		total, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(approxCountLimit))
+		return total, total >= approxCountLimit, err
+	}
+	total, err := collection.CountDocuments(ctx, filter)
+	return total, false, err
+}
+
+// listExternalLinksByCursor 游标分页获取外链列表
+// 按排序字段加 _id 定位，翻页开销与页码无关；不支持按相关度排序
+func (s *ExternalLinkService) listExternalLinksByCursor(ctx context.Context, query models.ExternalLinkQuery, filter bson.M) (*models.ExternalLinkResponse, error) {
+	if query.SortField == SortRelevance {
+		return nil, errors.NewError("游标分页不支持按相关度排序", http.StatusBadRequest)
+	}
+	sort, err := linkSort(query, false)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := countMode(query.Count, CountNone)
+	if err != nil {
+		return nil, err
+	}
+
+	perPage := query.PerPage
+	if perPage < 1 {
+		perPage = 10
+	}
+	if perPage > maxLinkPageSize {
+		perPage = maxLinkPageSize
+	}
+
+	pageFilter := filter
+	if *query.Cursor != "" {
+		values, err := decodeLinkCursor(*query.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		pageFilter = andFilter(filter, keysetFilter(sort, values))
+	}
+
+	// 多取一条用于判断是否还有下一页
+	cursor, err := s.db.Collection("external_links").Find(ctx, pageFilter,
+		options.Find().SetSort(sort).SetLimit(int64(perPage+1)))
+	if err != nil {
+		logger.Error("获取外链列表失败", zap.Error(err))
+		return nil, errors.NewError("获取外链列表失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	response := &models.ExternalLinkResponse{Data: make([]models.ExternalLink, 0, perPage)}
+	var last bson.Raw
+	for cursor.Next(ctx) {
+		if len(response.Data) == perPage {
+			response.Meta.HasMore = true
+			break
+		}
+		var link models.ExternalLink
+		if err := cursor.Decode(&link); err != nil {
+			logger.Error("解析外链列表失败", zap.Error(err))
+			return nil, errors.NewError("解析外链列表失败", http.StatusInternalServerError)
+		}
+		response.Data = append(response.Data, link)
+		last = append(last[:0], cursor.Current...)
+	}
+	if err := cursor.Err(); err != nil {
+		logger.Error("获取外链列表失败", zap.Error(err))
+		return nil, errors.NewError("获取外链列表失败", http.StatusInternalServerError)
+	}
+
+	if response.Meta.HasMore {
+		if response.Meta.NextCursor, err = encodeLinkCursor(sort, last); err != nil {
+			logger.Error("生成分页游标失败", zap.Error(err))
+			return nil, errors.NewError("获取外链列表失败", http.StatusInternalServerError)
+		}
+	}
+
+	total, approx, err := s.countLinks(ctx, filter, mode)
+	if err != nil {
+		logger.Error("获取外链总数失败", zap.Error(err))
+		return nil, errors.NewError("获取外链总数失败", http.StatusInternalServerError)
+	}
+	response.Meta.Total = int(total)
+	response.Meta.TotalApproximate = approx
+	response.Meta.PerPage = perPage
+
+	// 分面描述整个结果集，只在第一页统计
+	if *query.Cursor == "" {
+		if response.Facets, err = s.getLinkFacets(ctx, filter); err != nil {
+			logger.Warn("统计外链分面失败", zap.Error(err))
+		}
+	}
+
+	return response, nil
+}
+
+// StreamExternalLinks 按查询条件逐条读取外链并回调，回调返回错误时停止
+// 回调中直接写出响应，写入阻塞时不会继续从数据库读取，内存中最多保留一批文档
+func (s *ExternalLinkService) StreamExternalLinks(ctx context.Context, query models.ExternalLinkQuery, fn func(models.ExternalLink) error) error {
+	filter, err := buildLinkFilter(ctx, query)
+	if err != nil {
+		return err
+	}
+	_, textSearch := filter["$text"]
+	sort, err := linkSort(query, textSearch)
+	if err != nil {
+		return err
+	}
+	findOptions := options.Find().SetSort(sort).SetBatchSize(linkStreamBatchSize)
+	if textSearch {
+		findOptions.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Error("读取外链失败", zap.Error(err))
+		return errors.NewError("读取外链失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var link models.ExternalLink
+		if err := cursor.Decode(&link); err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestKeysetAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		order int
+		want  bson.M
+	}{
+		{"asc value", 10, 1, bson.M{"clicks": bson.M{"$gt": 10}}},
+		{"asc null", nil, 1, bson.M{"clicks": bson.M{"$ne": nil}}},
+		{"desc value", 10, -1, bson.M{"$or": bson.A{
+			bson.M{"clicks": bson.M{"$lt": 10}},
+			bson.M{"clicks": nil},
+		}}},
+		{"desc null", nil, -1, nil},
+	}
+	for _, tt := range tests {
+		if got := keysetAfter("clicks", tt.value, tt.order); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keysetAfter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	sort := bson.D{{Key: "clicks", Value: -1}, {Key: "_id", Value: 1}}
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   bson.M
+	}{
+		{
+			name:   "both set",
+			values: []interface{}{5, "b"},
+			want: bson.M{"$or": bson.A{
+				bson.M{"$or": bson.A{bson.M{"clicks": bson.M{"$lt": 5}}, bson.M{"clicks": nil}}},
+				bson.M{"clicks": 5, "_id": bson.M{"$gt": "b"}},
+			}},
+		},
+		{
+			// 降序时 null 排在最后，只剩下同为 null 且 _id 更大的记录
+			name:   "desc null skips the first key",
+			values: []interface{}{nil, "b"},
+			want: bson.M{"$or": bson.A{
+				bson.M{"clicks": nil, "_id": bson.M{"$gt": "b"}},
+			}},
+		},
+		{
+			name:   "asc null on the tie breaker",
+			values: []interface{}{5, nil},
+			want: bson.M{"$or": bson.A{
+				bson.M{"$or": bson.A{bson.M{"clicks": bson.M{"$lt": 5}}, bson.M{"clicks": nil}}},
+				bson.M{"clicks": 5, "_id": bson.M{"$ne": nil}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		if got := keysetFilter(sort, tt.values); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keysetFilter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLinkCursorRoundTrip(t *testing.T) {
+	sort := bson.D{{Key: "clicks", Value: -1}, {Key: "_id", Value: 1}}
+	last, err := bson.Marshal(bson.M{"_id": "b", "title": "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := encodeLinkCursor(sort, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := decodeLinkCursor(token, sort)
+	if err != nil {
+		t.Fatalf("decodeLinkCursor: %v", err)
+	}
+	if values[0] != nil || values[1] != "b" {
+		t.Fatalf("values = %v, want [nil b] with the missing field as null", values)
+	}
+
+	if _, err := decodeLinkCursor(token, bson.D{{Key: "clicks", Value: 1}, {Key: "_id", Value: 1}}); err == nil {
+		t.Fatal("cursor should be rejected when the sort changes")
+	}
+	if _, err := decodeLinkCursor("not-a-cursor", sort); err == nil {
+		t.Fatal("garbage cursor should be rejected")
+	}
+}
@@ -0,0 +1,519 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/db"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// URLHistoryReasonMerged 合并重复链接时记录被合并的地址
+const URLHistoryReasonMerged = "merged_duplicate"
+
+// trackingParams 规范化时去掉的跟踪参数
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+	"spm":     true,
+	"ref_src": true,
+}
+
+// trackingParamPrefixes 以这些前缀开头的参数同样视为跟踪参数
+var trackingParamPrefixes = []string{"utm_", "pk_", "mtm_", "hsa_"}
+
+// DuplicateLinkError 链接与已有链接重复，Existing 为已存在的链接
+type DuplicateLinkError struct {
+	Existing *models.ExternalLink
+}
+
+// Error 实现 error 接口
+func (e *DuplicateLinkError) Error() string {
+	return "链接已存在"
+}
+
+// NormalizeURL 生成用于判重的规范化地址
+// 主机名转小写并转换为 punycode，去掉默认端口、片段、末尾斜杠和跟踪参数，其余参数按名称排序；
+// 协议不参与比较，结果形如 example.com/path?a=1，http 与 https 视为同一链接，缺少协议时按 http 处理
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("链接地址为空")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("不支持的协议: %s", u.Scheme)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", fmt.Errorf("缺少主机名")
+	}
+	if host, err = idna.Punycode.ToASCII(host); err != nil {
+		return "", fmt.Errorf("无效的主机名: %w", err)
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	p := u.EscapedPath()
+	if p != "" {
+		p = path.Clean(p)
+	}
+	p = strings.TrimSuffix(p, "/")
+
+	query := u.RawQuery
+	if values, err := url.ParseQuery(u.RawQuery); err == nil {
+		for key := range values {
+			if isTrackingParam(key) {
+				values.Del(key)
+			}
+		}
+		query = values.Encode()
+	}
+
+	normalized := host + p
+	if query != "" {
+		normalized += "?" + query
+	}
+	return normalized, nil
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if trackingParams[key] {
+		return true
+	}
+	for _, prefix := range trackingParamPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// looseDuplicateKey 近似重复的分组键：在规范化地址基础上忽略 www 前缀和全部查询参数
+func looseDuplicateKey(normalized string) string {
+	if i := strings.IndexByte(normalized, '?'); i >= 0 {
+		normalized = normalized[:i]
+	}
+	return strings.TrimPrefix(normalized, "www.")
+}
+
+// EnsureLinkIndexes 回填历史链接的规范化地址，并建立规范化地址、短链标识、标签、优先级和过期时间索引
+// 历史数据中存在重复时唯一索引会创建失败，此时退化为普通索引，合并重复链接后重启即可建立唯一索引
+func (s *ExternalLinkService) EnsureLinkIndexes(ctx context.Context) error {
+	collection := s.db.Collection("external_links")
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"normalized_url": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"url": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var (
+		writes   []mongo.WriteModel
+		backfill int
+	)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID  primitive.ObjectID `bson:"_id"`
+			URL string             `bson:"url"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		normalized, err := NormalizeURL(doc.URL)
+		if err != nil {
+			logger.Warn("链接地址无法规范化", zap.String("id", doc.ID.Hex()), zap.String("url", doc.URL), zap.Error(err))
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"normalized_url": normalized}}))
+		backfill++
+		if len(writes) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if backfill > 0 {
+		logger.Info("已回填链接规范化地址", zap.Int("count", backfill))
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "normalized_url", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"normalized_url": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		logger.Warn("创建规范化地址唯一索引失败，可能存在重复链接，请先合并", zap.Error(err))
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "normalized_url", Value: 1}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+		},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "priority", Value: -1}}},
+		{Keys: bson.D{{Key: "owner", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.CreateTextIndex(ctx, collection, textSearchFields...)
+}
+
+// findDuplicateLink 查找规范化地址或原始地址相同的其他链接，不存在时返回 nil
+func (s *ExternalLinkService) findDuplicateLink(ctx context.Context, rawURL, normalized string, exclude primitive.ObjectID) (*models.ExternalLink, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"normalized_url": normalized},
+		bson.M{"url": rawURL},
+	}}
+	if !exclude.IsZero() {
+		filter["_id"] = bson.M{"$ne": exclude}
+	}
+
+	var existing models.ExternalLink
+	err := s.db.Collection("external_links").FindOne(ctx, filter).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		logger.Error("查询重复链接失败", zap.Error(err))
+		return nil, errors.NewError("查询重复链接失败", http.StatusInternalServerError)
+	}
+	return &existing, nil
+}
+
+// duplicateKeyError 将写入时的唯一索引冲突转换为 DuplicateLinkError，其他错误原样返回
+func (s *ExternalLinkService) duplicateKeyError(ctx context.Context, err error, rawURL, normalized string, exclude primitive.ObjectID) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	existing, findErr := s.findDuplicateLink(ctx, rawURL, normalized, exclude)
+	if findErr != nil || existing == nil {
+		return errors.NewError("链接已存在", http.StatusConflict)
+	}
+	return duplicateLinkError(ctx, existing)
+}
+
+// duplicateLinkError 生成重复链接错误，已有链接不在调用者访问范围内时不返回其内容
+func duplicateLinkError(ctx context.Context, existing *models.ExternalLink) error {
+	if !linkVisible(ctx, existing) {
+		return errors.NewError("链接已存在", http.StatusConflict)
+	}
+	return &DuplicateLinkError{Existing: existing}
+}
+
+// FindDuplicateGroups 查找重复链接并分组，mode 为 exact 时按规范化地址分组，loose 时额外忽略 www 前缀和查询参数
+func (s *ExternalLinkService) FindDuplicateGroups(ctx context.Context, mode string) ([]models.DuplicateGroup, error) {
+	if mode == "" {
+		mode = models.DuplicateModeExact
+	}
+	if mode != models.DuplicateModeExact && mode != models.DuplicateModeLoose {
+		return nil, errors.NewError("无效的分组方式，可选值: exact, loose", http.StatusBadRequest)
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx, scopedFilter(ctx, bson.M{}), options.Find().SetProjection(bson.M{
+		"url": 1, "normalized_url": 1, "category": 1, "clicks": 1,
+		"is_valid": 1, "is_active": 1, "created_at": 1,
+	}))
+	if err != nil {
+		logger.Error("查询外链失败", zap.Error(err))
+		return nil, errors.NewError("查询重复链接失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	groups := make(map[string]*models.DuplicateGroup)
+	for cursor.Next(ctx) {
+		var link models.DuplicateLink
+		if err := cursor.Decode(&link); err != nil {
+			continue
+		}
+		key := link.NormalizedURL
+		if key == "" {
+			if key, err = NormalizeURL(link.URL); err != nil {
+				continue
+			}
+		}
+		if mode == models.DuplicateModeLoose {
+			key = looseDuplicateKey(key)
+		}
+
+		group, ok := groups[key]
+		if !ok {
+			group = &models.DuplicateGroup{Key: key}
+			groups[key] = group
+		}
+		group.Links = append(group.Links, link)
+		group.Count++
+		group.TotalClicks += link.Clicks
+	}
+	if err := cursor.Err(); err != nil {
+		logger.Error("读取外链失败", zap.Error(err))
+		return nil, errors.NewError("查询重复链接失败", http.StatusInternalServerError)
+	}
+
+	result := []models.DuplicateGroup{}
+	for _, group := range groups {
+		if group.Count < 2 {
+			continue
+		}
+		sort.Slice(group.Links, func(i, j int) bool {
+			a, b := group.Links[i], group.Links[j]
+			if a.Clicks != b.Clicks {
+				return a.Clicks > b.Clicks
+			}
+			return a.CreatedAt.Before(b.CreatedAt)
+		})
+		group.SuggestedKeepID = group.Links[0].ID.Hex()
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalClicks != result[j].TotalClicks {
+			return result[i].TotalClicks > result[j].TotalClicks
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	return result, nil
+}
+
+// MergeDuplicates 将重复链接合并到保留的链接：先累加点击数、把被合并的地址写入 url_history 并转移关联记录，再删除重复链接
+// 只允许合并近似重复（忽略 www 前缀和查询参数后相同）的链接
+func (s *ExternalLinkService) MergeDuplicates(ctx context.Context, req models.DuplicateMergeRequest) (*models.DuplicateMergeResult, error) {
+	keep, err := s.GetExternalLink(ctx, req.KeepID)
+	if err != nil {
+		return nil, err
+	}
+	keepKey, err := NormalizeURL(keep.URL)
+	if err != nil {
+		return nil, errors.NewError("保留链接的地址无效", http.StatusBadRequest)
+	}
+
+	objectIDs := make([]primitive.ObjectID, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+		}
+		if objectID != keep.ID {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	if len(objectIDs) == 0 {
+		return nil, errors.NewError("请选择要合并的链接", http.StatusBadRequest)
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx, scopedFilter(ctx, bson.M{"_id": bson.M{"$in": objectIDs}}))
+	if err != nil {
+		logger.Error("查询待合并链接失败", zap.Error(err))
+		return nil, errors.NewError("查询待合并链接失败", http.StatusInternalServerError)
+	}
+	var duplicates []models.ExternalLink
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		logger.Error("解析待合并链接失败", zap.Error(err))
+		return nil, errors.NewError("查询待合并链接失败", http.StatusInternalServerError)
+	}
+	if len(duplicates) != len(objectIDs) {
+		return nil, errors.NewError("部分待合并链接不存在", http.StatusNotFound)
+	}
+
+	for _, link := range duplicates {
+		key, err := NormalizeURL(link.URL)
+		if err != nil || looseDuplicateKey(key) != looseDuplicateKey(keepKey) {
+			return nil, errors.NewError(fmt.Sprintf("链接 %s 与保留链接不重复，不能合并", link.URL), http.StatusBadRequest)
+		}
+	}
+
+	// 先把点击数累加到保留链接再删除重复链接，中途失败时重新合并不会丢失点击数
+	// 累加时要求 url_history 中还没有该链接，重复执行或并发合并时不会重复计数
+	collection := s.db.Collection("external_links")
+	now := time.Now()
+	clicks := 0
+	for _, link := range duplicates {
+		mergedID := link.ID
+		result, err := collection.UpdateOne(ctx,
+			bson.M{"_id": keep.ID, "url_history.merged_id": bson.M{"$ne": link.ID}},
+			bson.M{
+				"$inc": bson.M{"clicks": link.Clicks},
+				"$set": bson.M{"updated_at": now},
+				"$push": bson.M{"url_history": models.URLHistoryEntry{
+					URL:        link.URL,
+					ReplacedAt: now,
+					Reason:     URLHistoryReasonMerged,
+					MergedID:   &mergedID,
+				}},
+			},
+		)
+		if err != nil {
+			logger.Error("更新保留链接失败", zap.String("id", keep.ID.Hex()), zap.Error(err))
+			return nil, errors.NewError("合并重复链接失败", http.StatusInternalServerError)
+		}
+		if result.MatchedCount > 0 {
+			clicks += link.Clicks
+		} else if n, err := collection.CountDocuments(ctx, bson.M{"_id": keep.ID}); err != nil || n == 0 {
+			// 保留链接已被删除，不能再删除重复链接
+			return nil, errors.NewError("保留链接不存在", http.StatusNotFound)
+		}
+
+		if err := s.moveLinkReferences(ctx, link.ID, keep.ID); err != nil {
+			logger.Error("转移重复链接的关联记录失败", zap.String("id", link.ID.Hex()), zap.Error(err))
+			return nil, errors.NewError("合并重复链接失败", http.StatusInternalServerError)
+		}
+		if _, err := collection.DeleteOne(ctx, bson.M{"_id": link.ID}); err != nil {
+			logger.Error("删除重复链接失败", zap.String("id", link.ID.Hex()), zap.Error(err))
+			return nil, errors.NewError("合并重复链接失败", http.StatusInternalServerError)
+		}
+	}
+
+	var updated models.ExternalLink
+	if err := collection.FindOne(ctx, bson.M{"_id": keep.ID}).Decode(&updated); err != nil {
+		logger.Error("获取保留链接失败", zap.String("id", keep.ID.Hex()), zap.Error(err))
+		return nil, errors.NewError("合并重复链接失败", http.StatusInternalServerError)
+	}
+
+	logger.Info("重复链接合并完成",
+		zap.String("keep_id", keep.ID.Hex()),
+		zap.Int("merged", len(duplicates)),
+		zap.Int("clicks", clicks))
+	return &models.DuplicateMergeResult{Link: updated, Merged: len(duplicates), ClicksAdded: clicks}, nil
+}
+
+// moveLinkReferences 将关联到被合并链接的记录改为关联到保留链接，重复执行是幂等的
+func (s *ExternalLinkService) moveLinkReferences(ctx context.Context, from, to primitive.ObjectID) error {
+	// 点击事件为时序集合时 link_id 是 metaField，可以整体改写
+	if _, err := s.db.Collection("link_click_events").UpdateMany(ctx,
+		bson.M{"link_id": from},
+		bson.M{"$set": bson.M{"link_id": to}},
+	); err != nil {
+		return fmt.Errorf("转移点击事件失败: %w", err)
+	}
+
+	if _, err := s.db.Collection("link_checks").UpdateMany(ctx,
+		bson.M{"link_id": from},
+		bson.M{"$set": bson.M{"link_id": to}},
+	); err != nil {
+		return fmt.Errorf("转移检测记录失败: %w", err)
+	}
+	if err := s.mergeDailyChecks(ctx, from, to); err != nil {
+		return err
+	}
+
+	// 集合中原有的位置改为保留链接，集合已包含保留链接时直接移除，更新 updated_at 使并发编辑重新读取
+	collections := s.db.Collection("link_collections")
+	now := time.Now()
+	if _, err := collections.UpdateMany(ctx,
+		bson.M{"link_ids": bson.M{"$eq": from, "$ne": to}},
+		bson.M{"$set": bson.M{"link_ids.$[merged]": to, "updated_at": now}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"merged": from}}}),
+	); err != nil {
+		return fmt.Errorf("转移集合中的链接失败: %w", err)
+	}
+	if _, err := collections.UpdateMany(ctx,
+		bson.M{"link_ids": from},
+		bson.M{"$pull": bson.M{"link_ids": from}, "$set": bson.M{"updated_at": now}},
+	); err != nil {
+		return fmt.Errorf("移除集合中的重复链接失败: %w", err)
+	}
+	return nil
+}
+
+// mergeDailyChecks 将被合并链接的每日检测汇总累加到保留链接同一天的汇总中
+// (link_id, day) 唯一，不能直接改写 link_id；逐天累加后立即删除，重新合并时已处理的天不会再次累加
+func (s *ExternalLinkService) mergeDailyChecks(ctx context.Context, from, to primitive.ObjectID) error {
+	daily := s.db.Collection("link_check_daily")
+	cursor, err := daily.Find(ctx, bson.M{"link_id": from})
+	if err != nil {
+		return fmt.Errorf("获取检测汇总失败: %w", err)
+	}
+	var days []models.LinkCheckDaily
+	if err := cursor.All(ctx, &days); err != nil {
+		return fmt.Errorf("解析检测汇总失败: %w", err)
+	}
+
+	for _, day := range days {
+		update := bson.M{"$inc": bson.M{
+			"checks":         day.Checks,
+			"up":             day.Up,
+			"latency_sum_ms": day.LatencySumMs,
+			"latency_checks": day.LatencyChecks,
+		}}
+		if day.LatencyChecks > 0 {
+			update["$min"] = bson.M{"latency_min_ms": day.LatencyMinMs}
+			update["$max"] = bson.M{"latency_max_ms": day.LatencyMaxMs}
+		}
+		if _, err := daily.UpdateOne(ctx, bson.M{"link_id": to, "day": day.Day}, update, options.Update().SetUpsert(true)); err != nil {
+			return fmt.Errorf("累加检测汇总失败: %w", err)
+		}
+		if _, err := daily.DeleteOne(ctx, bson.M{"link_id": from, "day": day.Day}); err != nil {
+			return fmt.Errorf("删除检测汇总失败: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://Example.COM/Path/", "example.com/Path"},
+		{"http://example.com", "example.com"},
+		{"example.com/a", "example.com/a"},
+		{"  https://example.com./a  ", "example.com/a"},
+		{"https://example.com:443/a", "example.com/a"},
+		{"http://example.com:80/a", "example.com/a"},
+		{"https://example.com:80/a", "example.com:80/a"},
+		{"http://example.com:8080/a", "example.com:8080/a"},
+		{"https://example.com/a/./b/../c/", "example.com/a/c"},
+		{"https://example.com/a#section", "example.com/a"},
+		{"https://example.com/a?b=2&a=1", "example.com/a?a=1&b=2"},
+		{"https://example.com/a?utm_source=x&UTM_Medium=y&gclid=1&fbclid=2&id=7", "example.com/a?id=7"},
+		{"https://example.com/a?pk_campaign=x&hsa_ad=1", "example.com/a"},
+		{"https://bücher.example/", "xn--bcher-kva.example"},
+		{"http://[2001:DB8::1]:8080/", "[2001:db8::1]:8080"},
+		{"https://example.com/a%20b", "example.com/a%20b"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.raw)
+		if err != nil {
+			t.Errorf("NormalizeURL(%q) error: %v", tt.raw, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeURLRejectsInvalidInput(t *testing.T) {
+	for _, raw := range []string{"", "   ", "ftp://example.com/file", "http://", "http://exa mple.com"} {
+		if got, err := NormalizeURL(raw); err == nil {
+			t.Errorf("NormalizeURL(%q) = %q, want an error", raw, got)
+		}
+	}
+}
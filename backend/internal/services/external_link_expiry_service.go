@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// DeactivateExpiredLinks 停用已过期但仍处于启用状态的链接，返回停用数量
+func (s *ExternalLinkService) DeactivateExpiredLinks(ctx context.Context, now time.Time) (int64, error) {
+	result, err := s.db.Collection("external_links").UpdateMany(ctx,
+		bson.M{"expires_at": bson.M{"$lte": now}, "is_active": true},
+		bson.M{"$set": bson.M{"is_active": false, "updated_at": now}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if result.ModifiedCount > 0 {
+		logger.Info("已停用过期链接", zap.Int64("count", result.ModifiedCount))
+	}
+	return result.ModifiedCount, nil
+}
+
+// normalizeLinkFields 校验并转换更新请求中的标签、优先级和过期时间
+// 更新请求直接由 JSON 解码为 bson.M，需要转换为与模型一致的类型；过期时间为 null 时加入 unset 清除
+func normalizeLinkFields(update, unset bson.M) error {
+	if value, ok := update["tags"]; ok {
+		var raw []string
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				tag, ok := item.(string)
+				if !ok {
+					return errors.NewError("标签必须是字符串", http.StatusBadRequest)
+				}
+				raw = append(raw, tag)
+			}
+		case string:
+			raw = splitTags(v)
+		default:
+			return errors.NewError("无效的标签", http.StatusBadRequest)
+		}
+		tags, err := normalizeTags(raw)
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			delete(update, "tags")
+			unset["tags"] = ""
+		} else {
+			update["tags"] = tags
+		}
+	}
+
+	if value, ok := update["priority"]; ok {
+		number, ok := value.(float64)
+		if !ok || number != float64(int(number)) {
+			return errors.NewError("优先级必须是整数", http.StatusBadRequest)
+		}
+		update["priority"] = int(number)
+	}
+
+	if value, ok := update["expires_at"]; ok {
+		switch v := value.(type) {
+		case nil:
+			delete(update, "expires_at")
+			unset["expires_at"] = ""
+		case string:
+			expiresAt, err := parseExpiresAt(v)
+			if err != nil {
+				return err
+			}
+			update["expires_at"] = expiresAt
+		default:
+			return errors.NewError("无效的过期时间", http.StatusBadRequest)
+		}
+	}
+
+	if value, ok := update["check_profile"]; ok {
+		profile, ok := value.(string)
+		if !ok || !validCheckProfile(profile) {
+			return errors.NewError("无效的检测器配置，可选值: head_get, get, browser", http.StatusBadRequest)
+		}
+		if profile == "" {
+			delete(update, "check_profile")
+			unset["check_profile"] = ""
+		}
+	}
+
+	return nil
+}
+
+// parseExpiresAt 解析 RFC3339 格式的过期时间，必须晚于当前时间
+func parseExpiresAt(raw string) (time.Time, error) {
+	expiresAt, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, errors.NewError(fmt.Sprintf("无效的过期时间 %q，请使用 RFC3339 格式", raw), http.StatusBadRequest)
+	}
+	if !expiresAt.After(time.Now()) {
+		return time.Time{}, errors.NewError("过期时间必须晚于当前时间", http.StatusBadRequest)
+	}
+	return expiresAt, nil
+}
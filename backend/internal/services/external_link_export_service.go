@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+)
+
+// linkExporter 按格式逐条写出链接
+type linkExporter interface {
+	begin() error
+	write(link models.ExternalLink) error
+	end() error
+}
+
+// ExportExternalLinks 按查询条件流式导出外链，分页参数会被忽略
+// 返回错误时若尚未写出任何内容，调用方可以正常返回错误响应
+func (s *ExternalLinkService) ExportExternalLinks(ctx context.Context, query models.ExternalLinkQuery, format string, w io.Writer) error {
+	filter, err := buildLinkFilter(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var exporter linkExporter
+	sort := bson.D{{Key: "created_at", Value: -1}}
+	switch format {
+	case models.LinkFormatCSV:
+		exporter = &csvLinkExporter{writer: csv.NewWriter(w)}
+	case models.LinkFormatJSONL:
+		exporter = &jsonlLinkExporter{encoder: json.NewEncoder(w)}
+	case models.LinkFormatBookmarks:
+		// 书签按分类分组输出，需要先按分类排序
+		exporter = &bookmarkLinkExporter{w: w}
+		sort = bson.D{{Key: "category", Value: 1}, {Key: "created_at", Value: -1}}
+	default:
+		return errors.NewError("不支持的导出格式，可选值: csv, jsonl, bookmarks", http.StatusBadRequest)
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return errors.NewError("导出外链失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	if err := exporter.begin(); err != nil {
+		return err
+	}
+	for cursor.Next(ctx) {
+		var link models.ExternalLink
+		if err := cursor.Decode(&link); err != nil {
+			return err
+		}
+		if err := exporter.write(link); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return exporter.end()
+}
+
+// LinkExportContentType 导出格式对应的 Content-Type 和文件扩展名
+func LinkExportContentType(format string) (string, string) {
+	switch format {
+	case models.LinkFormatCSV:
+		return "text/csv; charset=utf-8", "csv"
+	case models.LinkFormatJSONL:
+		return "application/x-ndjson", "jsonl"
+	case models.LinkFormatBookmarks:
+		return "text/html; charset=utf-8", "html"
+	}
+	return "", ""
+}
+
+type csvLinkExporter struct {
+	writer *csv.Writer
+}
+
+func (e *csvLinkExporter) begin() error {
+	return e.writer.Write([]string{"id", "url", "category", "tags", "priority", "expires_at", "clicks", "is_valid", "is_active", "created_at"})
+}
+
+func (e *csvLinkExporter) write(link models.ExternalLink) error {
+	expiresAt := ""
+	if link.ExpiresAt != nil {
+		expiresAt = link.ExpiresAt.Format(time.RFC3339)
+	}
+	return e.writer.Write([]string{
+		link.ID.Hex(),
+		csvCell(link.URL),
+		csvCell(link.Category),
+		csvCell(strings.Join(link.Tags, ",")),
+		strconv.Itoa(link.Priority),
+		expiresAt,
+		strconv.Itoa(link.Clicks),
+		strconv.FormatBool(link.IsValid),
+		strconv.FormatBool(link.IsActive),
+		link.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// csvFormulaPrefixes 表格软件会当作公式执行的单元格开头
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell 在可能被当作公式的文本前加单引号，避免打开导出文件时执行用户填写的内容
+// 导入时 csvUncell 会去掉该前缀
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvUncell 去掉 csvCell 加上的单引号前缀
+func csvUncell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func (e *csvLinkExporter) end() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type jsonlLinkExporter struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonlLinkExporter) begin() error { return nil }
+
+func (e *jsonlLinkExporter) write(link models.ExternalLink) error {
+	return e.encoder.Encode(link)
+}
+
+func (e *jsonlLinkExporter) end() error { return nil }
+
+// bookmarkLinkExporter 输出浏览器可导入的 Netscape 书签格式，分类作为文件夹
+type bookmarkLinkExporter struct {
+	w        io.Writer
+	category string
+	open     bool
+}
+
+func (e *bookmarkLinkExporter) begin() error {
+	_, err := io.WriteString(e.w, "<!DOCTYPE NETSCAPE-Bookmark-file-1>\n"+
+		"<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=UTF-8\">\n"+
+		"<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+	return err
+}
+
+func (e *bookmarkLinkExporter) write(link models.ExternalLink) error {
+	if !e.open || link.Category != e.category {
+		if e.open {
+			if _, err := io.WriteString(e.w, "    </DL><p>\n"); err != nil {
+				return err
+			}
+		}
+		name := link.Category
+		if name == "" {
+			name = "未分类"
+		}
+		if _, err := fmt.Fprintf(e.w, "    <DT><H3>%s</H3>\n    <DL><p>\n", html.EscapeString(name)); err != nil {
+			return err
+		}
+		e.category = link.Category
+		e.open = true
+	}
+
+	tags := ""
+	if len(link.Tags) > 0 {
+		tags = fmt.Sprintf(" TAGS=\"%s\"", html.EscapeString(strings.Join(link.Tags, ",")))
+	}
+	_, err := fmt.Fprintf(e.w, "        <DT><A HREF=\"%s\" ADD_DATE=\"%d\"%s>%s</A>\n",
+		html.EscapeString(link.URL), link.CreatedAt.Unix(), tags, html.EscapeString(link.URL))
+	return err
+}
+
+func (e *bookmarkLinkExporter) end() error {
+	if e.open {
+		if _, err := io.WriteString(e.w, "    </DL><p>\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(e.w, "</DL><p>\n")
+	return err
+}
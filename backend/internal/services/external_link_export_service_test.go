@@ -0,0 +1,29 @@
+package services
+
+import "testing"
+
+func TestCSVCellEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"https://example.com", "https://example.com"},
+		{"", ""},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1", "'+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"'quoted", "'quoted"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		got := csvCell(tt.value)
+		if got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if back := csvUncell(got); back != tt.value {
+			t.Errorf("csvUncell(%q) = %q, want %q", got, back, tt.value)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// defaultMetadataMaxBytes 提取元数据时默认最多读取的 HTML 字节数，元数据通常都在 <head> 中
+	defaultMetadataMaxBytes = 512 << 10
+	// maxFaviconBytes 缓存站点图标的最大字节数
+	maxFaviconBytes = 256 << 10
+	// maxMetadataTextLength 标题和描述保留的最大字符数
+	maxMetadataTextLength = 500
+)
+
+// faviconExtensions 站点图标的 Content-Type 与缓存文件扩展名
+var faviconExtensions = map[string]string{
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	"image/png":                ".png",
+	"image/gif":                ".gif",
+	"image/jpeg":               ".jpg",
+	"image/webp":               ".webp",
+	"image/svg+xml":            ".svg",
+}
+
+// LinkMetadataConfig 页面元数据提取配置
+type LinkMetadataConfig struct {
+	Enabled       bool          // 检测流程中是否提取元数据
+	RefreshAfter  time.Duration // 元数据超过该时长后在下次检测时重新提取
+	MaxBytes      int64         // 最多读取的 HTML 字节数
+	CacheFavicons bool          // 是否通过上传服务缓存站点图标
+}
+
+// ConfigureMetadata 设置元数据提取配置，uploads 为 nil 时不缓存站点图标
+func (s *ExternalLinkService) ConfigureMetadata(cfg LinkMetadataConfig, uploads *UploadService) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultMetadataMaxBytes
+	}
+	s.metadata = cfg
+	s.uploads = uploads
+}
+
+// RefreshLinkMetadata 立即重新提取链接的页面元数据，不受后台提取开关和刷新间隔限制
+func (s *ExternalLinkService) RefreshLinkMetadata(ctx context.Context, id string) (*models.LinkMetadata, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+	}
+
+	var link models.ExternalLink
+	if err := s.db.Collection("external_links").FindOne(ctx, writableFilter(ctx, bson.M{"_id": objectID})).Decode(&link); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, notWritableError(ctx, s.db, objectID)
+		}
+		logger.Error("获取外链失败", zap.Error(err))
+		return nil, errors.NewError("获取外链失败", http.StatusInternalServerError)
+	}
+
+	metadata, err := s.refreshMetadata(ctx, link)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.NewError("提取页面元数据已取消", http.StatusRequestTimeout)
+		}
+		return nil, errors.NewError("提取页面元数据失败: "+err.Error(), http.StatusBadGateway)
+	}
+	return metadata, nil
+}
+
+// metadataDue 检测时是否需要提取元数据：已启用且链接还没有元数据或已超过刷新间隔
+func (s *ExternalLinkService) metadataDue(link models.ExternalLink) bool {
+	if !s.metadata.Enabled {
+		return false
+	}
+	return link.Metadata == nil || time.Since(link.Metadata.FetchedAt) >= s.metadata.RefreshAfter
+}
+
+// enrichMetadata 检测通过且元数据已过期时，从检测请求读到的页面内容中提取元数据，不再单独请求页面
+// 没有页面内容（如域名策略不允许 GET）或内容不是 HTML 时跳过，失败只记录在链接上
+func (s *ExternalLinkService) enrichMetadata(ctx context.Context, link models.ExternalLink, result models.LinkCheckResult, page *checkedPage) {
+	if !result.IsValid || page == nil || !isHTMLContent(page.ContentType) || ctx.Err() != nil || !s.metadataDue(link) {
+		return
+	}
+	// 内容校验可能读取了更多内容，元数据仍只使用开头的部分
+	body := page.Body
+	if limit := s.metadataMaxBytes(); int64(len(body)) > limit {
+		body = body[:limit]
+	}
+	policy := s.policies.Resolve(ctx, link.URL)
+	metadata, err := pageMetadata(bytes.NewReader(body), page.ContentType, page.URL)
+	if _, err := s.saveMetadata(ctx, s.metadataClient(policy), link, metadata, err); err != nil {
+		logger.Warn("提取页面元数据失败", zap.String("url", link.URL), zap.Error(err))
+	}
+}
+
+// refreshMetadata 抓取页面并保存元数据
+func (s *ExternalLinkService) refreshMetadata(ctx context.Context, link models.ExternalLink) (*models.LinkMetadata, error) {
+	policy := s.policies.Resolve(ctx, link.URL)
+	if err := s.policies.WaitTurn(ctx, link.URL, policy); err != nil {
+		return nil, err
+	}
+	client := s.metadataClient(policy)
+	metadata, err := s.fetchMetadata(ctx, client, link.URL, policy)
+	return s.saveMetadata(ctx, client, link, metadata, err)
+}
+
+// metadataClient 抓取页面和站点图标使用的客户端，与检测使用同样的代理和礼貌模式
+func (s *ExternalLinkService) metadataClient(policy models.DomainPolicy) *http.Client {
+	return &http.Client{
+		Timeout:   policy.Timeout(),
+		Transport: s.checkers.Transport(policy.Proxy),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("重定向次数过多")
+			}
+			return nil
+		},
+	}
+}
+
+// saveMetadata 保存提取到的元数据，fetchErr 不为空时保留之前提取到的内容，只更新失败原因和时间，避免每次检测都重试
+func (s *ExternalLinkService) saveMetadata(ctx context.Context, client *http.Client, link models.ExternalLink, metadata *models.LinkMetadata, err error) (*models.LinkMetadata, error) {
+	collection := s.db.Collection("external_links")
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, updateErr := collection.UpdateOne(dbCtx, bson.M{"_id": link.ID}, bson.M{"$set": bson.M{
+			"metadata.error":      err.Error(),
+			"metadata.fetched_at": time.Now(),
+		}})
+		if updateErr != nil {
+			logger.Error("保存页面元数据失败", zap.String("link_id", link.ID.Hex()), zap.Error(updateErr))
+		}
+		return nil, err
+	}
+
+	if s.metadata.CacheFavicons && s.uploads != nil && metadata.FaviconURL != "" {
+		metadata.FaviconFile = s.cacheFavicon(ctx, client, metadata.FaviconURL)
+	}
+	metadata.FetchedAt = time.Now()
+
+	// 标题为空或仍是上次提取的标题时才覆盖，保留人工填写的标题
+	changes := bson.M{}
+	set := bson.M{"metadata": metadata}
+	if link.Title == "" || (link.Metadata != nil && link.Title == link.Metadata.Title) {
+		if metadata.Title != "" {
+			set["title"] = metadata.Title
+		} else if link.Title != "" {
+			changes["$unset"] = bson.M{"title": ""}
+		}
+	}
+	changes["$set"] = set
+
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := collection.UpdateOne(dbCtx, bson.M{"_id": link.ID}, changes); err != nil {
+		logger.Error("保存页面元数据失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		return nil, stderrors.New("保存页面元数据失败")
+	}
+	return metadata, nil
+}
+
+// fetchMetadata 以 GET 方式请求页面，只解析限定长度内的 HTML
+func (s *ExternalLinkService) fetchMetadata(ctx context.Context, client *http.Client, rawURL string, policy models.DomainPolicy) (*models.LinkMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.checkers.UserAgent())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	applyPolicyHeaders(req, policy)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, stderrors.New(s.formatNetworkError(err))
+	}
+	defer resp.Body.Close()
+
+	if !policy.IsExpectedStatus(resp.StatusCode) {
+		return nil, fmt.Errorf("页面返回状态码 %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("不是 HTML 页面: %s", mediaType)
+	}
+
+	return pageMetadata(io.LimitReader(resp.Body, s.metadataMaxBytes()), contentType, resp.Request.URL)
+}
+
+// metadataMaxBytes 提取元数据最多读取的 HTML 字节数
+func (s *ExternalLinkService) metadataMaxBytes() int64 {
+	if s.metadata.MaxBytes <= 0 {
+		return defaultMetadataMaxBytes
+	}
+	return s.metadata.MaxBytes
+}
+
+// pageMetadata 按响应头和 <meta charset> 转换为 UTF-8 后提取元数据，兼容 GBK 等编码的页面
+func pageMetadata(r io.Reader, contentType string, base *url.URL) (*models.LinkMetadata, error) {
+	body, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return extractPageMetadata(body, base), nil
+}
+
+// isHTMLContent 响应是否是 HTML 页面，没有 Content-Type 时按 HTML 处理
+func isHTMLContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err != nil || mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// extractPageMetadata 流式解析 HTML，读到 <body> 或 </head> 时停止
+func extractPageMetadata(r io.Reader, base *url.URL) *models.LinkMetadata {
+	metadata := &models.LinkMetadata{}
+	var (
+		title, ogTitle, ogDescription string
+		icon, touchIcon               string
+		inTitle, titleDone            bool
+	)
+
+	z := html.NewTokenizer(r)
+parse:
+	for {
+		tokenType := z.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			// 读完或达到长度限制
+			break parse
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle, titleDone = false, true
+			case "head":
+				break parse
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := tokenAttrs(z, hasAttr)
+			switch string(name) {
+			case "body":
+				break parse
+			case "html":
+				metadata.Language = strings.TrimSpace(attrs["lang"])
+			case "base":
+				if resolved := resolveMetadataURL(base, attrs["href"]); resolved != "" {
+					base, _ = url.Parse(resolved)
+				}
+			case "title":
+				inTitle = tokenType == html.StartTagToken && !titleDone
+			case "meta":
+				content := strings.TrimSpace(attrs["content"])
+				metaName := strings.ToLower(attrs["name"])
+				property := strings.ToLower(attrs["property"])
+				switch {
+				case metaName == "description":
+					if metadata.Description == "" {
+						metadata.Description = content
+					}
+				case property == "og:title" || metaName == "og:title":
+					ogTitle = content
+				case property == "og:description" || metaName == "og:description":
+					ogDescription = content
+				case property == "og:image" || property == "og:image:url" || property == "og:image:secure_url" ||
+					metaName == "twitter:image" || metaName == "twitter:image:src":
+					if metadata.ImageURL == "" {
+						metadata.ImageURL = resolveMetadataURL(base, content)
+					}
+				case strings.EqualFold(attrs["http-equiv"], "content-language"):
+					if metadata.Language == "" {
+						metadata.Language = strings.TrimSpace(strings.Split(content, ",")[0])
+					}
+				}
+			case "link":
+				href := attrs["href"]
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					switch rel {
+					case "canonical":
+						if metadata.CanonicalURL == "" {
+							metadata.CanonicalURL = resolveMetadataURL(base, href)
+						}
+					case "icon":
+						if icon == "" {
+							icon = resolveMetadataURL(base, href)
+						}
+					case "apple-touch-icon", "apple-touch-icon-precomposed":
+						if touchIcon == "" {
+							touchIcon = resolveMetadataURL(base, href)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if title == "" {
+		title = ogTitle
+	}
+	metadata.Title = cleanMetadataText(title)
+	if metadata.Description == "" {
+		metadata.Description = ogDescription
+	}
+	metadata.Description = cleanMetadataText(metadata.Description)
+
+	switch {
+	case icon != "":
+		metadata.FaviconURL = icon
+	case touchIcon != "":
+		metadata.FaviconURL = touchIcon
+	case base != nil:
+		// 页面没有声明图标时使用站点根目录的默认图标
+		metadata.FaviconURL = resolveMetadataURL(base, "/favicon.ico")
+	}
+	return metadata
+}
+
+// tokenAttrs 读取当前标签的属性，属性名统一为小写，重复属性以第一个为准
+func tokenAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := map[string]string{}
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+		name := strings.ToLower(string(key))
+		if _, ok := attrs[name]; !ok {
+			attrs[name] = string(value)
+		}
+	}
+	return attrs
+}
+
+// resolveMetadataURL 将页面中的相对地址解析为绝对地址，只保留 http 和 https 地址
+func resolveMetadataURL(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || base == nil {
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	resolved.Fragment = ""
+	return resolved.String()
+}
+
+// cleanMetadataText 合并空白并截断过长的文本
+func cleanMetadataText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > maxMetadataTextLength {
+		text = string([]rune(text)[:maxMetadataTextLength]) + "…"
+	}
+	return text
+}
+
+// cacheFavicon 下载站点图标并通过上传服务保存，返回本地文件名，失败时返回空字符串
+// 文件名由图标地址的哈希生成，同一站点的多个链接共用一个文件
+func (s *ExternalLinkService) cacheFavicon(ctx context.Context, client *http.Client, faviconURL string) string {
+	policy := s.policies.Resolve(ctx, faviconURL)
+	if err := s.policies.WaitTurn(ctx, faviconURL, policy); err != nil {
+		return ""
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", faviconURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", s.checkers.UserAgent())
+	req.Header.Set("Accept", "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5")
+	applyPolicyHeaders(req, policy)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Warn("下载站点图标失败", zap.String("url", faviconURL), zap.Error(err))
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("下载站点图标失败", zap.String("url", faviconURL), zap.Int("status", resp.StatusCode))
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext, ok := faviconExtensions[mediaType]
+	if !ok {
+		// 部分站点以 application/octet-stream 等类型返回图标，按地址的扩展名判断
+		ext = strings.ToLower(path.Ext(resp.Request.URL.Path))
+		if ext == ".jpeg" {
+			ext = ".jpg"
+		}
+		known := false
+		for _, candidate := range faviconExtensions {
+			known = known || candidate == ext
+		}
+		if !known || strings.HasPrefix(mediaType, "text/") {
+			logger.Warn("站点图标类型不受支持", zap.String("url", faviconURL), zap.String("content_type", mediaType))
+			return ""
+		}
+	}
+
+	sum := sha256.Sum256([]byte(faviconURL))
+	filename := "favicon-" + hex.EncodeToString(sum[:8]) + ext
+	if err := s.uploads.SaveData(ctx, filename, resp.Body, maxFaviconBytes); err != nil {
+		logger.Warn("缓存站点图标失败", zap.String("url", faviconURL), zap.Error(err))
+		return ""
+	}
+	return filename
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+type linkActorKey struct{}
+
+// WithLinkActor 将调用者保存到上下文，服务据此限定可访问的链接
+// 上下文中没有调用者时（后台任务、未启用认证）不做限制
+func WithLinkActor(ctx context.Context, actor *models.LinkActor) context.Context {
+	return context.WithValue(ctx, linkActorKey{}, actor)
+}
+
+// LinkActorFrom 读取上下文中的调用者，不存在时返回 nil
+func LinkActorFrom(ctx context.Context) *models.LinkActor {
+	actor, _ := ctx.Value(linkActorKey{}).(*models.LinkActor)
+	return actor
+}
+
+// restrictedActor 返回需要限定范围的调用者，管理员和没有调用者时返回 nil
+func restrictedActor(ctx context.Context) *models.LinkActor {
+	actor := LinkActorFrom(ctx)
+	if actor == nil || actor.IsAdmin() {
+		return nil
+	}
+	return actor
+}
+
+// linkScope 调用者可查看的链接条件：本人或所在团队的链接，以及未分配所有者的共享链接
+func linkScope(ctx context.Context) bson.M {
+	actor := restrictedActor(ctx)
+	if actor == nil {
+		return nil
+	}
+	return ownerScope(actor.OwnerKeys())
+}
+
+// ownerScope 限定为指定所有者或未分配所有者的链接，后台任务按创建时保存的所有者执行
+func ownerScope(owners []string) bson.M {
+	values := bson.A{nil}
+	for _, owner := range owners {
+		values = append(values, owner)
+	}
+	return bson.M{"owner": bson.M{"$in": values}}
+}
+
+// scopedFilter 在查询条件上附加调用者的访问范围
+func scopedFilter(ctx context.Context, filter bson.M) bson.M {
+	scope := linkScope(ctx)
+	if scope == nil {
+		return filter
+	}
+	return andFilter(filter, scope)
+}
+
+// writableFilter 在修改和删除条件上附加调用者可修改的范围
+// 未分配所有者的共享链接对普通用户只读，只有管理员可以修改、删除或转移
+func writableFilter(ctx context.Context, filter bson.M) bson.M {
+	actor := restrictedActor(ctx)
+	if actor == nil {
+		return filter
+	}
+	return mergeFilter(filter, bson.M{"owner": bson.M{"$in": actor.OwnerKeys()}})
+}
+
+// notWritableError 修改或删除没有匹配到链接时的错误，链接可见但不可修改时返回 403
+func notWritableError(ctx context.Context, db *mongo.Database, id primitive.ObjectID) error {
+	if restrictedActor(ctx) != nil {
+		count, err := db.Collection("external_links").CountDocuments(ctx, scopedFilter(ctx, bson.M{"_id": id}), options.Count().SetLimit(1))
+		if err == nil && count > 0 {
+			return errors.NewError("未分配所有者的共享链接只有管理员可以修改", http.StatusForbidden)
+		}
+	}
+	return errors.NewError("外链不存在", http.StatusNotFound)
+}
+
+// mergeFilter 合并两个查询条件，base 为空时直接返回 condition
+func mergeFilter(base, condition bson.M) bson.M {
+	if len(base) == 0 {
+		return condition
+	}
+	return andFilter(base, condition)
+}
+
+// ownerStatisticsFilter 统计的基础条件：调用者的访问范围，以及 owner 参数指定的所有者
+func ownerStatisticsFilter(ctx context.Context, owner string) (bson.M, error) {
+	filter, err := resolveOwnerFilter(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	return scopedFilter(ctx, filter), nil
+}
+
+// jobScope 普通用户只能访问自己创建的检测和导入任务
+func jobScope(ctx context.Context, filter bson.M) bson.M {
+	if actor := restrictedActor(ctx); actor != nil {
+		filter["created_by"] = actor.UserID
+	}
+	return filter
+}
+
+// linkVisible 链接是否在调用者的访问范围内
+func linkVisible(ctx context.Context, link *models.ExternalLink) bool {
+	actor := restrictedActor(ctx)
+	return actor == nil || link.Owner == "" || actor.Owns(link.Owner)
+}
+
+// resolveOwnerFilter 解析 owner 查询参数，me 表示调用者本人，none 表示未分配所有者
+// 普通用户只能筛选自己可见的所有者
+func resolveOwnerFilter(ctx context.Context, owner string) (bson.M, error) {
+	switch owner {
+	case "":
+		return nil, nil
+	case models.LinkOwnerMe:
+		actor := LinkActorFrom(ctx)
+		if actor == nil {
+			return nil, errors.NewError("未登录时不能按 me 筛选", http.StatusBadRequest)
+		}
+		return bson.M{"owner": actor.OwnerKey()}, nil
+	case models.LinkOwnerNone:
+		return bson.M{"owner": nil}, nil
+	}
+	if _, _, ok := models.ParseLinkOwner(owner); !ok {
+		return nil, errors.NewError("无效的所有者，格式为 user:<ID> 或 team:<名称>", http.StatusBadRequest)
+	}
+	if actor := restrictedActor(ctx); actor != nil && !actor.Owns(owner) {
+		return nil, errors.NewError("无权查看该所有者的链接", http.StatusForbidden)
+	}
+	return bson.M{"owner": owner}, nil
+}
+
+// requireVisibleLink 确认链接存在且在调用者的访问范围内，用于查询链接的检测记录、点击等附属数据
+func requireVisibleLink(ctx context.Context, db *mongo.Database, id primitive.ObjectID) error {
+	if restrictedActor(ctx) == nil {
+		return nil
+	}
+	count, err := db.Collection("external_links").CountDocuments(ctx, scopedFilter(ctx, bson.M{"_id": id}), options.Count().SetLimit(1))
+	if err != nil {
+		logger.Error("获取外链失败", zap.Error(err))
+		return errors.NewError("获取外链失败", http.StatusInternalServerError)
+	}
+	if count == 0 {
+		return errors.NewError("外链不存在", http.StatusNotFound)
+	}
+	return nil
+}
+
+// visibleLinkIDs 返回调用者可访问的链接ID，不需要限定范围时 ok 为 false
+func visibleLinkIDs(ctx context.Context, db *mongo.Database) (ids []primitive.ObjectID, ok bool, err error) {
+	if restrictedActor(ctx) == nil {
+		return nil, false, nil
+	}
+	cursor, err := db.Collection("external_links").Find(ctx, scopedFilter(ctx, bson.M{}), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		logger.Error("获取外链失败", zap.Error(err))
+		return nil, true, errors.NewError("获取外链失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	ids = []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, true, errors.NewError("获取外链失败", http.StatusInternalServerError)
+		}
+		ids = append(ids, doc.ID)
+	}
+	if err := cursor.Err(); err != nil {
+		logger.Error("获取外链失败", zap.Error(err))
+		return nil, true, errors.NewError("获取外链失败", http.StatusInternalServerError)
+	}
+	return ids, true, nil
+}
+
+// validateOwnerTarget 校验链接能否分配给该所有者
+// 管理员可以分配给任意用户或团队，普通用户只能分配给存在的用户或自己所在的团队
+func (s *ExternalLinkService) validateOwnerTarget(ctx context.Context, owner string) error {
+	kind, id, ok := models.ParseLinkOwner(owner)
+	if !ok {
+		return errors.NewError("无效的所有者，格式为 user:<ID> 或 team:<名称>", http.StatusBadRequest)
+	}
+	actor := restrictedActor(ctx)
+	if kind == models.LinkOwnerTeam {
+		if actor != nil && !actor.Owns(owner) {
+			return errors.NewError("只能分配给自己所在的团队", http.StatusForbidden)
+		}
+		return nil
+	}
+
+	userID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.NewError("无效的用户ID", http.StatusBadRequest)
+	}
+	count, err := s.db.Collection("users").CountDocuments(ctx, bson.M{"_id": userID})
+	if err != nil {
+		logger.Error("查询用户失败", zap.Error(err))
+		return errors.NewError("查询用户失败", http.StatusInternalServerError)
+	}
+	if count == 0 {
+		return errors.NewError("用户不存在", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// assignCreator 为新建链接设置所有者和创建人，未指定所有者时归调用者本人
+func (s *ExternalLinkService) assignCreator(ctx context.Context, link *models.ExternalLink) error {
+	actor := LinkActorFrom(ctx)
+	if actor == nil {
+		// 后台任务或未启用认证时保留请求中的所有者
+		if link.Owner != "" {
+			return s.validateOwnerTarget(ctx, link.Owner)
+		}
+		return nil
+	}
+	link.CreatedBy = actor.UserID
+	link.UpdatedBy = actor.UserID
+	if link.Owner == "" {
+		link.Owner = actor.OwnerKey()
+		return nil
+	}
+	if !actor.IsAdmin() && !actor.Owns(link.Owner) {
+		return errors.NewError("只能创建属于自己或所在团队的链接", http.StatusForbidden)
+	}
+	return s.validateOwnerTarget(ctx, link.Owner)
+}
+
+// TransferLinkOwnership 批量转移链接所有权
+// 普通用户只能转移本人或所在团队的链接，未分配所有者的共享链接只有管理员可以转移
+func (s *ExternalLinkService) TransferLinkOwnership(ctx context.Context, req models.LinkTransferRequest) (*models.LinkTransferResult, error) {
+	if (len(req.IDs) == 0) == (req.From == "") {
+		return nil, errors.NewError("请指定要转移的链接ID或原所有者", http.StatusBadRequest)
+	}
+	actor := restrictedActor(ctx)
+	if actor != nil && req.From == models.LinkOwnerNone {
+		return nil, errors.NewError("只有管理员可以转移未分配所有者的链接", http.StatusForbidden)
+	}
+	if err := s.validateOwnerTarget(ctx, req.To); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{}
+	if len(req.IDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			objectID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return nil, errors.NewError("无效的外链ID: "+id, http.StatusBadRequest)
+			}
+			ids = append(ids, objectID)
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	} else {
+		ownerFilter, err := resolveOwnerFilter(ctx, req.From)
+		if err != nil {
+			return nil, err
+		}
+		filter = ownerFilter
+	}
+	filter = writableFilter(ctx, filter)
+
+	set := bson.M{"owner": req.To, "updated_at": time.Now()}
+	if caller := LinkActorFrom(ctx); caller != nil {
+		set["updated_by"] = caller.UserID
+	}
+	result, err := s.db.Collection("external_links").UpdateMany(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		logger.Error("转移链接所有权失败", zap.Error(err))
+		return nil, errors.NewError("转移链接所有权失败", http.StatusInternalServerError)
+	}
+
+	logger.Info("转移链接所有权", zap.String("to", req.To), zap.Int64("updated", result.ModifiedCount))
+	return &models.LinkTransferResult{Matched: result.MatchedCount, Updated: result.ModifiedCount}, nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"vite-pluginend/internal/models"
+)
+
+func TestWritableFilterExcludesUnownedLinksForUsers(t *testing.T) {
+	user := WithLinkActor(context.Background(), &models.LinkActor{UserID: "u1", Role: models.RoleUser, Teams: []string{"ops"}})
+	admin := WithLinkActor(context.Background(), &models.LinkActor{UserID: "a1", Role: models.RoleAdmin})
+	base := bson.M{"is_valid": false}
+
+	want := bson.M{"is_valid": false, "$and": bson.A{bson.M{"owner": bson.M{"$in": []string{"user:u1", "team:ops"}}}}}
+	if got := writableFilter(user, base); !reflect.DeepEqual(got, want) {
+		t.Fatalf("user filter = %v, want %v", got, want)
+	}
+	// 查看范围仍包含未分配所有者的链接
+	if got := scopedFilter(user, base); !reflect.DeepEqual(got["$and"], bson.A{bson.M{"owner": bson.M{"$in": bson.A{nil, "user:u1", "team:ops"}}}}) {
+		t.Fatalf("user scope = %v, want unowned links to stay visible", got)
+	}
+	for name, ctx := range map[string]context.Context{"admin": admin, "background": context.Background()} {
+		if got := writableFilter(ctx, base); !reflect.DeepEqual(got, base) {
+			t.Fatalf("%s filter = %v, want no restriction", name, got)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// URLHistoryReasonCanonical 因永久重定向改写链接地址
+const URLHistoryReasonCanonical = "canonical_redirect"
+
+// redirectRecorder 包装 Transport，记录每一跳的状态码、Location 和耗时
+type redirectRecorder struct {
+	next http.RoundTripper
+
+	mu   sync.Mutex
+	list []models.RedirectHop
+}
+
+func newRedirectRecorder(next http.RoundTripper) *redirectRecorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &redirectRecorder{next: next}
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (r *redirectRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	r.mu.Lock()
+	r.list = append(r.list, models.RedirectHop{
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Location:   resp.Header.Get("Location"),
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// reset 清空记录，用于同一次检测中更换请求方式重试
+func (r *redirectRecorder) reset() {
+	r.mu.Lock()
+	r.list = nil
+	r.mu.Unlock()
+}
+
+// hops 返回当前记录的重定向链（只包含 3xx 跳转）
+func (r *redirectRecorder) hops() []models.RedirectHop {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	chain := make([]models.RedirectHop, 0, len(r.list))
+	for _, hop := range r.list {
+		if hop.StatusCode >= 300 && hop.StatusCode < 400 && hop.Location != "" {
+			chain = append(chain, hop)
+		}
+	}
+	return chain
+}
+
+// applyRedirectChain 记录重定向链，并判断链接是否永久重定向到了其他主机或路径
+func applyRedirectChain(result *models.LinkCheckResult, rawURL string, chain []models.RedirectHop) {
+	if len(chain) == 0 {
+		return
+	}
+	result.RedirectChain = chain
+
+	// 只沿着连续的永久重定向（301/308）确定规范地址，遇到临时重定向即停止
+	target := ""
+	for _, hop := range chain {
+		if hop.StatusCode != http.StatusMovedPermanently && hop.StatusCode != http.StatusPermanentRedirect {
+			break
+		}
+		base, err := url.Parse(hop.URL)
+		if err != nil {
+			break
+		}
+		next, err := base.Parse(hop.Location)
+		if err != nil {
+			break
+		}
+		target = next.String()
+	}
+
+	if target != "" && !sameHostAndPath(rawURL, target) {
+		result.PermanentRedirect = true
+		result.CanonicalURL = target
+	}
+}
+
+// sameHostAndPath 比较两个地址的主机和路径，忽略协议、www 前缀和末尾斜杠
+func sameHostAndPath(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+
+	hostA := strings.TrimPrefix(strings.ToLower(ua.Hostname()), "www.")
+	hostB := strings.TrimPrefix(strings.ToLower(ub.Hostname()), "www.")
+	pathA := strings.TrimSuffix(ua.EscapedPath(), "/")
+	pathB := strings.TrimSuffix(ub.EscapedPath(), "/")
+
+	return hostA == hostB && pathA == pathB
+}
+
+// RewriteToCanonical 将链接地址改写为检测到的永久重定向目标，原地址保存在 url_history 中
+func (s *ExternalLinkService) RewriteToCanonical(ctx context.Context, req models.CanonicalRewriteRequest) (*models.CanonicalRewriteResult, error) {
+	filter := bson.M{"canonical_url": bson.M{"$exists": true, "$ne": ""}}
+	if !req.All {
+		if len(req.IDs) == 0 {
+			return nil, errors.NewError("请选择要改写的链接", http.StatusBadRequest)
+		}
+		objectIDs := make([]primitive.ObjectID, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			objectID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+			}
+			objectIDs = append(objectIDs, objectID)
+		}
+		filter["_id"] = bson.M{"$in": objectIDs}
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx, writableFilter(ctx, filter))
+	if err != nil {
+		logger.Error("查询待改写链接失败", zap.Error(err))
+		return nil, errors.NewError("查询待改写链接失败", http.StatusInternalServerError)
+	}
+	var links []models.ExternalLink
+	if err := cursor.All(ctx, &links); err != nil {
+		logger.Error("解析待改写链接失败", zap.Error(err))
+		return nil, errors.NewError("解析待改写链接失败", http.StatusInternalServerError)
+	}
+
+	result := &models.CanonicalRewriteResult{Links: []models.ExternalLink{}}
+	for _, link := range links {
+		updated, err := s.rewriteLinkURL(ctx, link)
+		var dupErr *DuplicateLinkError
+		if stderrors.As(err, &dupErr) {
+			// 目标地址已作为其他链接存在，保留原地址，交由重复链接合并处理
+			result.Conflicts = append(result.Conflicts, link.ID.Hex())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if updated != nil {
+			result.Updated++
+			result.Links = append(result.Links, *updated)
+		}
+	}
+
+	logger.Info("链接地址改写完成", zap.Int("updated", result.Updated), zap.Int("conflicts", len(result.Conflicts)))
+	return result, nil
+}
+
+// rewriteLinkURL 以原地址和规范地址作为条件更新，避免与并发修改冲突
+// 目标地址与其他链接重复时返回 DuplicateLinkError
+func (s *ExternalLinkService) rewriteLinkURL(ctx context.Context, link models.ExternalLink) (*models.ExternalLink, error) {
+	normalized, err := NormalizeURL(link.CanonicalURL)
+	if err != nil {
+		return nil, nil
+	}
+	existing, err := s.findDuplicateLink(ctx, link.CanonicalURL, normalized, link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, duplicateLinkError(ctx, existing)
+	}
+
+	now := time.Now()
+	var updated models.ExternalLink
+	err = s.db.Collection("external_links").FindOneAndUpdate(ctx,
+		bson.M{"_id": link.ID, "url": link.URL, "canonical_url": link.CanonicalURL},
+		bson.M{
+			"$set":   bson.M{"url": link.CanonicalURL, "normalized_url": normalized, "updated_at": now},
+			"$unset": bson.M{"canonical_url": ""},
+			"$push": bson.M{"url_history": models.URLHistoryEntry{
+				URL:        link.URL,
+				ReplacedAt: now,
+				Reason:     URLHistoryReasonCanonical,
+			}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, s.duplicateKeyError(ctx, err, link.CanonicalURL, normalized, link.ID)
+		}
+		logger.Error("改写链接地址失败", zap.String("id", link.ID.Hex()), zap.Error(err))
+		return nil, errors.NewError("改写链接地址失败", http.StatusInternalServerError)
+	}
+
+	return &updated, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+)
+
+// SortRelevance 按搜索相关度排序，只在指定关键词时有效
+const SortRelevance = "relevance"
+
+// maxFacetValues 每个分面最多返回的取值数
+const maxFacetValues = 20
+
+// linkSortFields 允许排序的字段，键为请求中的 sort_field
+var linkSortFields = map[string]string{
+	"created_at":      "created_at",
+	"updated_at":      "updated_at",
+	"url":             "url",
+	"title":           "title",
+	"category":        "category",
+	"clicks":          "clicks",
+	"priority":        "priority",
+	"is_valid":        "is_valid",
+	"is_active":       "is_active",
+	"expires_at":      "expires_at",
+	"last_checked_at": "last_checked_at",
+	"last_clicked_at": "last_clicked_at",
+}
+
+// textSearchFields 关键词匹配的字段，也是文本索引的字段
+var textSearchFields = []string{"url", "title", "description", "tags"}
+
+// keywordFilter 生成关键词查询条件
+// 默认使用文本索引；文本索引不会切分中文，关键词包含中文时改为转义后的子串匹配
+func keywordFilter(keyword string) bson.M {
+	if !containsHan(keyword) {
+		return bson.M{"$text": bson.M{"$search": keyword}}
+	}
+
+	pattern := regexp.QuoteMeta(keyword)
+	or := make(bson.A, 0, len(textSearchFields))
+	for _, field := range textSearchFields {
+		or = append(or, bson.M{field: bson.M{"$regex": pattern, "$options": "i"}})
+	}
+	return bson.M{"$or": or}
+}
+
+// containsHan 判断字符串是否包含汉字
+func containsHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkSort 根据查询参数生成排序，字段必须在白名单内
+// textSearch 表示本次使用了文本索引，此时默认按相关度排序
+func linkSort(query models.ExternalLinkQuery, textSearch bool) (bson.D, error) {
+	order := 1
+	switch query.SortOrder {
+	case "", "asc":
+	case "desc":
+		order = -1
+	default:
+		return nil, errors.NewError(fmt.Sprintf("无效的排序方向 %q", query.SortOrder), http.StatusBadRequest)
+	}
+
+	field := query.SortField
+	if field == "" {
+		switch {
+		case textSearch:
+			field = SortRelevance
+		case query.Popular:
+			return bson.D{{Key: "clicks", Value: -1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}, nil
+		default:
+			return bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}, nil
+		}
+	}
+
+	if field == SortRelevance {
+		if !textSearch {
+			return nil, errors.NewError("按相关度排序需要指定关键词", http.StatusBadRequest)
+		}
+		return bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: -1}}, nil
+	}
+
+	key, ok := linkSortFields[field]
+	if !ok {
+		return nil, errors.NewError(fmt.Sprintf("不支持按 %q 排序", field), http.StatusBadRequest)
+	}
+	// 追加 _id 保证相同取值时分页顺序稳定
+	return bson.D{{Key: key, Value: order}, {Key: "_id", Value: order}}, nil
+}
+
+// getLinkFacets 统计筛选结果按分类、标签、可用性和主机的分布
+func (s *ExternalLinkService) getLinkFacets(ctx context.Context, filter bson.M) (*models.LinkFacets, error) {
+	top := func(stages ...bson.D) bson.A {
+		pipeline := bson.A{}
+		for _, stage := range stages {
+			pipeline = append(pipeline, stage)
+		}
+		return append(pipeline,
+			bson.D{{Key: "$sortByCount", Value: "$value"}},
+			bson.D{{Key: "$limit", Value: maxFacetValues}},
+		)
+	}
+	project := func(value interface{}) bson.D {
+		return bson.D{{Key: "$project", Value: bson.M{"value": value}}}
+	}
+
+	// 规范化地址形如 host/path?query，取第一个 / 或 ? 之前的部分作为主机
+	host := bson.M{"$arrayElemAt": bson.A{
+		bson.M{"$split": bson.A{
+			bson.M{"$arrayElemAt": bson.A{
+				bson.M{"$split": bson.A{bson.M{"$ifNull": bson.A{"$normalized_url", ""}}, "?"}}, 0,
+			}},
+			"/",
+		}}, 0,
+	}}
+
+	cursor, err := s.db.Collection("external_links").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"categories": top(
+				bson.D{{Key: "$match", Value: bson.M{"category": bson.M{"$nin": bson.A{nil, ""}}}}},
+				project("$category"),
+			),
+			"tags": top(
+				bson.D{{Key: "$unwind", Value: "$tags"}},
+				project("$tags"),
+			),
+			"validity": top(
+				project(bson.M{"$cond": bson.A{
+					bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$skip_reason", ""}}, ""}}, "not_checked",
+					bson.M{"$cond": bson.A{"$is_valid", "valid", "invalid"}},
+				}}),
+			),
+			"hosts": top(
+				project(host),
+				bson.D{{Key: "$match", Value: bson.M{"value": bson.M{"$ne": ""}}}},
+			),
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	facets := &models.LinkFacets{}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(facets); err != nil {
+			return nil, err
+		}
+	}
+	return facets, cursor.Err()
+}
@@ -2,12 +2,14 @@ package services
 
 import (
 	"context"
+	"crypto/tls"
+	stderrors "errors"
 	"fmt"
-	"math/rand"
 	"net"
 	"net/http"
-	"net/url"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -24,20 +26,82 @@ import (
 
 // ExternalLinkService 外链服务
 type ExternalLinkService struct {
-	db    *mongo.Database
-	cache cache.Cache
+	db       *mongo.Database
+	cache    cache.Cache
+	policies *DomainPolicyService
+	metadata LinkMetadataConfig
+	uploads  *UploadService
+	polite   *politeness // 礼貌模式，未启用时为 nil
+	alerts   *LinkAlertService
+	checkers *LinkCheckers
 }
 
 // NewExternalLinkService 创建外链服务实例
-func NewExternalLinkService(db *mongo.Database, cache cache.Cache) *ExternalLinkService {
-	return &ExternalLinkService{
-		db:    db,
-		cache: cache,
+func NewExternalLinkService(db *mongo.Database, cache cache.Cache, policies *DomainPolicyService) *ExternalLinkService {
+	s := &ExternalLinkService{
+		db:       db,
+		cache:    cache,
+		policies: policies,
+	}
+	s.ConfigureCheckers(LinkCheckerConfig{UserDelay: true})
+	return s
+}
+
+// ConfigureCheckers 按配置重新创建检测策略，礼貌模式对所有策略的传输层生效
+func (s *ExternalLinkService) ConfigureCheckers(cfg LinkCheckerConfig) {
+	checkers := NewLinkCheckers(cfg)
+	checkers.wrap = s.politeTransport
+	s.checkers = checkers
+	if s.polite != nil {
+		s.polite.client.Transport = checkers.proxyTransport("")
 	}
 }
 
+// ProxyStats 返回出站代理的健康状态和使用统计
+func (s *ExternalLinkService) ProxyStats() []models.LinkProxyStats {
+	return s.checkers.proxies.stats()
+}
+
 // CreateExternalLink 创建外链
 func (s *ExternalLinkService) CreateExternalLink(ctx context.Context, link *models.ExternalLink) error {
+	if link.Assertions.IsEmpty() {
+		link.Assertions = nil
+	} else if err := validateContentAssertion(link.Assertions); err != nil {
+		return err
+	}
+
+	normalized, err := NormalizeURL(link.URL)
+	if err != nil {
+		return errors.NewError("无效的链接地址", http.StatusBadRequest)
+	}
+	link.NormalizedURL = normalized
+	link.Score = 0
+	if err := s.validateSlug(ctx, link.Slug, primitive.NilObjectID); err != nil {
+		return err
+	}
+	if link.Tags, err = normalizeTags(link.Tags); err != nil {
+		return err
+	}
+	if len(link.Tags) == 0 {
+		link.Tags = nil
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return errors.NewError("过期时间必须晚于当前时间", http.StatusBadRequest)
+	}
+	if !validCheckProfile(link.CheckProfile) {
+		return errors.NewError("无效的检测器配置，可选值: head_get, get, browser", http.StatusBadRequest)
+	}
+	if err := s.assignCreator(ctx, link); err != nil {
+		return err
+	}
+	existing, err := s.findDuplicateLink(ctx, link.URL, normalized, primitive.NilObjectID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return duplicateLinkError(ctx, existing)
+	}
+
 	link.CreatedAt = time.Now()
 	link.UpdatedAt = time.Now()
 	link.Clicks = 0
@@ -47,6 +111,9 @@ func (s *ExternalLinkService) CreateExternalLink(ctx context.Context, link *mode
 
 	result, err := s.db.Collection("external_links").InsertOne(ctx, link)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return s.duplicateKeyError(ctx, err, link.URL, normalized, primitive.NilObjectID)
+		}
 		logger.Error("创建外链失败", zap.Error(err))
 		return errors.NewError("创建外链失败", http.StatusInternalServerError)
 	}
@@ -63,7 +130,7 @@ func (s *ExternalLinkService) GetExternalLink(ctx context.Context, id string) (*
 	}
 
 	var link models.ExternalLink
-	err = s.db.Collection("external_links").FindOne(ctx, bson.M{"_id": objectID}).Decode(&link)
+	err = s.db.Collection("external_links").FindOne(ctx, scopedFilter(ctx, bson.M{"_id": objectID})).Decode(&link)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, errors.NewError("外链不存在", http.StatusNotFound)
@@ -82,24 +149,97 @@ func (s *ExternalLinkService) UpdateExternalLink(ctx context.Context, id string,
 		return errors.NewError("无效的外链ID", http.StatusBadRequest)
 	}
 
+	// 规范化地址只能由链接地址推导，所有者只能通过转移接口修改
+	for _, field := range []string{"normalized_url", "owner", "created_by", "updated_by", "created_at"} {
+		delete(update, field)
+	}
+	unset := bson.M{}
+	var rawURL, normalized string
+	if value, ok := update["url"]; ok {
+		rawURL, _ = value.(string)
+		if normalized, err = NormalizeURL(rawURL); err != nil {
+			return errors.NewError("无效的链接地址", http.StatusBadRequest)
+		}
+		existing, err := s.findDuplicateLink(ctx, rawURL, normalized, objectID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return duplicateLinkError(ctx, existing)
+		}
+		update["normalized_url"] = normalized
+	}
+	if value, ok := update["slug"]; ok {
+		slug, _ := value.(string)
+		if err := s.validateSlug(ctx, slug, objectID); err != nil {
+			return err
+		}
+		if slug == "" {
+			// 清除短链标识，避免空字符串占用唯一索引
+			delete(update, "slug")
+			unset["slug"] = ""
+		}
+	}
+	if err := normalizeLinkFields(update, unset); err != nil {
+		return err
+	}
+
 	update["updated_at"] = time.Now()
+	if actor := LinkActorFrom(ctx); actor != nil {
+		update["updated_by"] = actor.UserID
+	}
+	changes := bson.M{"$set": update}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
 	result, err := s.db.Collection("external_links").UpdateOne(
 		ctx,
-		bson.M{"_id": objectID},
-		bson.M{"$set": update},
+		writableFilter(ctx, bson.M{"_id": objectID}),
+		changes,
 	)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return s.duplicateKeyError(ctx, err, rawURL, normalized, objectID)
+		}
 		logger.Error("更新外链失败", zap.Error(err))
 		return errors.NewError("更新外链失败", http.StatusInternalServerError)
 	}
 
 	if result.MatchedCount == 0 {
-		return errors.NewError("外链不存在", http.StatusNotFound)
+		return notWritableError(ctx, s.db, objectID)
 	}
 
 	return nil
 }
 
+// slugPattern 短链标识只允许字母、数字、下划线和连字符
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// validateSlug 校验短链标识格式及是否已被其他链接使用，空标识表示不设置
+func (s *ExternalLinkService) validateSlug(ctx context.Context, slug string, exclude primitive.ObjectID) error {
+	if slug == "" {
+		return nil
+	}
+	// 与链接ID格式相同的标识会与按ID跳转冲突
+	if !slugPattern.MatchString(slug) || primitive.IsValidObjectID(slug) {
+		return errors.NewError("无效的短链标识，只允许 1-64 位字母、数字、下划线和连字符", http.StatusBadRequest)
+	}
+
+	filter := bson.M{"slug": slug}
+	if !exclude.IsZero() {
+		filter["_id"] = bson.M{"$ne": exclude}
+	}
+	count, err := s.db.Collection("external_links").CountDocuments(ctx, filter)
+	if err != nil {
+		logger.Error("查询短链标识失败", zap.Error(err))
+		return errors.NewError("查询短链标识失败", http.StatusInternalServerError)
+	}
+	if count > 0 {
+		return errors.NewError("短链标识已被使用", http.StatusConflict)
+	}
+	return nil
+}
+
 // DeleteExternalLink 删除外链
 func (s *ExternalLinkService) DeleteExternalLink(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -107,14 +247,14 @@ func (s *ExternalLinkService) DeleteExternalLink(ctx context.Context, id string)
 		return errors.NewError("无效的外链ID", http.StatusBadRequest)
 	}
 
-	result, err := s.db.Collection("external_links").DeleteOne(ctx, bson.M{"_id": objectID})
+	result, err := s.db.Collection("external_links").DeleteOne(ctx, writableFilter(ctx, bson.M{"_id": objectID}))
 	if err != nil {
 		logger.Error("删除外链失败", zap.Error(err))
 		return errors.NewError("删除外链失败", http.StatusInternalServerError)
 	}
 
 	if result.DeletedCount == 0 {
-		return errors.NewError("外链不存在", http.StatusNotFound)
+		return notWritableError(ctx, s.db, objectID)
 	}
 
 	return nil
@@ -122,26 +262,16 @@ func (s *ExternalLinkService) DeleteExternalLink(ctx context.Context, id string)
 
 // ListExternalLinks 获取外链列表
 func (s *ExternalLinkService) ListExternalLinks(ctx context.Context, query models.ExternalLinkQuery) (*models.ExternalLinkResponse, error) {
-	filter := bson.M{}
-
-	// 应用查询条件
-	if query.Keyword != "" {
-		filter["url"] = bson.M{"$regex": query.Keyword, "$options": "i"}
-	}
-	if query.Category != "" {
-		filter["category"] = query.Category
-	}
-	if query.Status != "" {
-		filter["status"] = query.Status == "active"
-	}
-	if query.IsValid != nil {
-		filter["is_valid"] = *query.IsValid
+	filter, err := buildLinkFilter(ctx, query)
+	if err != nil {
+		return nil, err
 	}
-	if query.MinClicks > 0 {
-		filter["clicks"] = bson.M{"$gte": query.MinClicks}
+	if query.Cursor != nil {
+		return s.listExternalLinksByCursor(ctx, query, filter)
 	}
-	if query.OnlyValid {
-		filter["is_valid"] = true
+	mode, err := countMode(query.Count, CountExact)
+	if err != nil {
+		return nil, err
 	}
 
 	// 设置分页
@@ -153,23 +283,25 @@ func (s *ExternalLinkService) ListExternalLinks(ctx context.Context, query model
 	if perPage < 1 {
 		perPage = 10
 	}
+	if perPage > maxLinkPageSize {
+		perPage = maxLinkPageSize
+	}
 	skip := int64((page - 1) * perPage)
 	limit := int64(perPage)
 
 	// 设置排序
-	findOptions := options.Find().SetSkip(skip).SetLimit(limit)
-	if query.SortField != "" {
-		order := 1
-		if query.SortOrder == "desc" {
-			order = -1
-		}
-		findOptions.SetSort(bson.D{{Key: query.SortField, Value: order}})
-	} else {
-		findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	_, textSearch := filter["$text"]
+	sort, err := linkSort(query, textSearch)
+	if err != nil {
+		return nil, err
+	}
+	findOptions := options.Find().SetSkip(skip).SetLimit(limit).SetSort(sort)
+	if textSearch {
+		findOptions.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}})
 	}
 
 	// 获取总数
-	total, err := s.db.Collection("external_links").CountDocuments(ctx, filter)
+	total, approx, err := s.countLinks(ctx, filter, mode)
 	if err != nil {
 		logger.Error("获取外链总数失败", zap.Error(err))
 		return nil, errors.NewError("获取外链总数失败", http.StatusInternalServerError)
@@ -189,11 +321,19 @@ func (s *ExternalLinkService) ListExternalLinks(ctx context.Context, query model
 		return nil, errors.NewError("解析外链列表失败", http.StatusInternalServerError)
 	}
 
+	// 分面统计失败不影响列表本身
+	facets, err := s.getLinkFacets(ctx, filter)
+	if err != nil {
+		logger.Warn("统计外链分面失败", zap.Error(err))
+	}
+
 	// 构建响应
 	response := &models.ExternalLinkResponse{
-		Data: links,
+		Data:   links,
+		Facets: facets,
 	}
 	response.Meta.Total = int(total)
+	response.Meta.TotalApproximate = approx
 	response.Meta.PerPage = perPage
 	response.Meta.CurrentPage = page
 	response.Meta.LastPage = (int(total) + perPage - 1) / perPage
@@ -201,18 +341,115 @@ func (s *ExternalLinkService) ListExternalLinks(ctx context.Context, query model
 	return response, nil
 }
 
-// GetExternalStatistics 获取外链统计信息
-func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*models.ExternalStatistics, error) {
+// buildLinkFilter 根据查询参数生成外链查询条件，列表和导出共用，结果限定在调用者可访问的范围内
+func buildLinkFilter(ctx context.Context, query models.ExternalLinkQuery) (bson.M, error) {
+	filter := bson.M{}
+
+	// 应用查询条件
+	if keyword := strings.TrimSpace(query.Keyword); keyword != "" {
+		condition := keywordFilter(keyword)
+		if text, ok := condition["$text"]; ok {
+			filter["$text"] = text
+		} else {
+			// 放在 $and 中，避免与其他条件的 $or 冲突
+			filter["$and"] = bson.A{condition}
+		}
+	}
+	if query.Category != "" {
+		filter["category"] = query.Category
+	}
+	if query.Status != "" {
+		filter["status"] = query.Status == "active"
+	}
+	if query.IsValid != nil {
+		filter["is_valid"] = *query.IsValid
+	}
+	if query.MinClicks > 0 {
+		filter["clicks"] = bson.M{"$gte": query.MinClicks}
+	}
+	if query.Popular {
+		clicks := bson.M{"$gt": 0}
+		if query.MinClicks > 0 {
+			clicks = bson.M{"$gte": query.MinClicks}
+		}
+		filter["clicks"] = clicks
+	}
+	if tags := splitTags(query.Tags); len(tags) > 0 {
+		normalized, err := normalizeTags(tags)
+		if err != nil {
+			return nil, err
+		}
+		filter["tags"] = bson.M{"$all": normalized}
+	}
+	if query.MinPriority != nil || query.MaxPriority != nil {
+		priority := bson.M{}
+		if query.MinPriority != nil {
+			priority["$gte"] = *query.MinPriority
+		}
+		if query.MaxPriority != nil {
+			priority["$lte"] = *query.MaxPriority
+		}
+		filter["priority"] = priority
+	}
+	now := time.Now()
+	if query.Expired != nil {
+		if *query.Expired {
+			filter["expires_at"] = bson.M{"$lte": now}
+		} else {
+			// 同时匹配未设置过期时间的链接
+			filter["expires_at"] = bson.M{"$not": bson.M{"$lte": now}}
+		}
+	}
+	if query.ExpiringDays > 0 {
+		filter["expires_at"] = bson.M{"$gt": now, "$lte": now.AddDate(0, 0, query.ExpiringDays)}
+	}
+	if query.OnlyValid {
+		filter["is_valid"] = true
+	}
+	if query.Redirected {
+		filter["canonical_url"] = bson.M{"$exists": true, "$ne": ""}
+	}
+	if query.TLSIssue != "" {
+		days := query.TLSDays
+		if days <= 0 {
+			days = tlsExpiryWarnDays()
+		}
+		tlsFilter, err := tlsIssueFilter(query.TLSIssue, days)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range tlsFilter {
+			filter[key] = value
+		}
+	}
+	ownerFilter, err := resolveOwnerFilter(ctx, query.Owner)
+	if err != nil {
+		return nil, err
+	}
+	if ownerFilter != nil {
+		filter = andFilter(filter, ownerFilter)
+	}
+
+	return scopedFilter(ctx, filter), nil
+}
+
+// GetExternalStatistics 获取外链统计信息，限定在调用者可访问的范围内，owner 不为空时只统计该所有者的链接
+func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context, owner string) (*models.ExternalStatistics, error) {
 	log := logger.NewLogger() // 获取一个新的 logger 实例
 	log.Info("GetExternalStatistics: 开始获取统计信息")
+	base, err := ownerStatisticsFilter(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
 	stats := &models.ExternalStatistics{
 		Categories: make(map[string]int),
 		Tags:       make(map[string]int),
+		Priorities: make(map[int]int),
 	}
 
 	// 获取总数
 	log.Info("GetExternalStatistics: 准备获取总链接数")
-	total, err := s.db.Collection("external_links").CountDocuments(ctx, bson.M{})
+	total, err := s.db.Collection("external_links").CountDocuments(ctx, base)
 	if err != nil {
 		log.Error("GetExternalStatistics: 获取总链接数失败", zap.Error(err))
 		return nil, errors.NewError("获取外链总数失败", http.StatusInternalServerError)
@@ -222,7 +459,7 @@ func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*model
 
 	// 获取活跃链接数
 	log.Info("GetExternalStatistics: 准备获取活跃链接数")
-	active, err := s.db.Collection("external_links").CountDocuments(ctx, bson.M{"is_active": true})
+	active, err := s.db.Collection("external_links").CountDocuments(ctx, mergeFilter(base, bson.M{"is_active": true}))
 	if err != nil {
 		log.Error("GetExternalStatistics: 获取活跃链接数失败", zap.Error(err))
 		return nil, errors.NewError("获取活跃链接数失败", http.StatusInternalServerError)
@@ -232,7 +469,8 @@ func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*model
 
 	// 获取过期链接数
 	log.Info("GetExternalStatistics: 准备获取过期链接数")
-	expired, err := s.db.Collection("external_links").CountDocuments(ctx, bson.M{"is_valid": false})
+	now := time.Now()
+	expired, err := s.db.Collection("external_links").CountDocuments(ctx, mergeFilter(base, bson.M{"expires_at": bson.M{"$lte": now}}))
 	if err != nil {
 		log.Error("GetExternalStatistics: 获取过期链接数失败", zap.Error(err))
 		return nil, errors.NewError("获取过期链接数失败", http.StatusInternalServerError)
@@ -240,9 +478,17 @@ func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*model
 	log.Info("GetExternalStatistics: 过期链接数", zap.Int64("expired", expired))
 	stats.ExpiredLinks = int(expired)
 
+	// 获取7天内即将过期的链接数
+	expiring, err := s.db.Collection("external_links").CountDocuments(ctx, mergeFilter(base, bson.M{"expires_at": bson.M{"$gt": now, "$lte": now.AddDate(0, 0, 7)}}))
+	if err != nil {
+		log.Error("GetExternalStatistics: 获取即将过期链接数失败", zap.Error(err))
+		return nil, errors.NewError("获取即将过期链接数失败", http.StatusInternalServerError)
+	}
+	stats.ExpiringLinks = int(expiring)
+
 	// 获取无效链接数
 	log.Info("GetExternalStatistics: 准备获取无效链接数")
-	invalid, err := s.db.Collection("external_links").CountDocuments(ctx, bson.M{"status": false})
+	invalid, err := s.db.Collection("external_links").CountDocuments(ctx, mergeFilter(base, bson.M{"status": false}))
 	if err != nil {
 		log.Error("GetExternalStatistics: 获取无效链接数失败", zap.Error(err))
 		return nil, errors.NewError("获取无效链接数失败", http.StatusInternalServerError)
@@ -253,6 +499,7 @@ func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*model
 	// 获取总点击量
 	log.Info("GetExternalStatistics: 准备获取总点击量")
 	pipeline := []bson.M{
+		{"$match": base},
 		{"$group": bson.M{
 			"_id":   nil,
 			"total": bson.M{"$sum": "$clicks"},
@@ -303,6 +550,7 @@ func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*model
 	// 获取分类统计
 	log.Info("GetExternalStatistics: 准备获取分类统计")
 	pipeline = []bson.M{
+		{"$match": base},
 		{"$group": bson.M{
 			"_id":   "$category",
 			"count": bson.M{"$sum": 1},
@@ -351,104 +599,47 @@ func (s *ExternalLinkService) GetExternalStatistics(ctx context.Context) (*model
 		}
 	}
 
-	log.Info("GetExternalStatistics: 完成获取统计信息", zap.Any("finalStats", stats))
-	return stats, nil
-}
-
-// GetExternalTrends 获取外链趋势数据
-func (s *ExternalLinkService) GetExternalTrends(ctx context.Context, period string, limit int) ([]models.ExternalTrend, error) {
-	var startDate time.Time
-	now := time.Now()
-
-	switch period {
-	case "day":
-		startDate = now.AddDate(0, 0, -limit)
-	case "week":
-		startDate = now.AddDate(0, 0, -limit*7)
-	case "month":
-		startDate = now.AddDate(0, -limit, 0)
-	default:
-		return nil, errors.NewError("无效的时间周期", http.StatusBadRequest)
+	// 获取标签统计
+	tags, err := s.listTags(ctx, base)
+	if err != nil {
+		log.Error("GetExternalStatistics: 获取标签统计失败", zap.Error(err))
+		return nil, err
 	}
-
-	pipeline := []bson.M{
-		{"$match": bson.M{
-			"created_at": bson.M{"$gte": startDate},
-		}},
-		{"$group": bson.M{
-			"_id": bson.M{
-				"$dateToString": bson.M{
-					"format": "%Y-%m-%d",
-					"date":   "$created_at",
-				},
-			},
-			"new_links":    bson.M{"$sum": 1},
-			"total_clicks": bson.M{"$sum": "$clicks"},
-			"active_links": bson.M{
-				"$sum": bson.M{
-					"$cond": []interface{}{"$is_active", 1, 0},
-				},
-			},
-		}},
-		{"$sort": bson.M{"_id": 1}},
+	for _, tag := range tags {
+		stats.Tags[tag.Name] = tag.Count
 	}
 
-	cursor, err := s.db.Collection("external_links").Aggregate(ctx, pipeline)
+	// 获取优先级分布
+	cursor, err = s.db.Collection("external_links").Aggregate(ctx, []bson.M{
+		{"$match": base},
+		{"$group": bson.M{"_id": bson.M{"$ifNull": bson.A{"$priority", 0}}, "count": bson.M{"$sum": 1}}},
+	})
 	if err != nil {
-		logger.Error("获取趋势数据失败", zap.Error(err))
-		return nil, errors.NewError("获取趋势数据失败", http.StatusInternalServerError)
+		log.Error("GetExternalStatistics: 获取优先级分布失败", zap.Error(err))
+		return nil, errors.NewError("获取优先级分布失败", http.StatusInternalServerError)
 	}
-	defer cursor.Close(ctx)
-
-	var trends []bson.M
-	if err := cursor.All(ctx, &trends); err != nil {
-		logger.Error("解析趋势数据失败", zap.Error(err))
-		return nil, errors.NewError("解析趋势数据失败", http.StatusInternalServerError)
+	var priorities []struct {
+		Priority int `bson:"_id"`
+		Count    int `bson:"count"`
 	}
-
-	result := make([]models.ExternalTrend, len(trends))
-	for i, trend := range trends {
-		result[i] = models.ExternalTrend{
-			Date:        trend["_id"].(string),
-			NewLinks:    int(trend["new_links"].(int64)),
-			TotalClicks: int(trend["total_clicks"].(int64)),
-			ActiveLinks: int(trend["active_links"].(int64)),
-		}
+	if err := cursor.All(ctx, &priorities); err != nil {
+		log.Error("GetExternalStatistics: 解析优先级分布失败", zap.Error(err))
+		return nil, errors.NewError("获取优先级分布失败", http.StatusInternalServerError)
 	}
-
-	return result, nil
-}
-
-// IncrementClicks 增加点击量
-func (s *ExternalLinkService) IncrementClicks(ctx context.Context, id string) error {
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return errors.NewError("无效的外链ID", http.StatusBadRequest)
-	}
-
-	update := bson.M{
-		"$inc": bson.M{"clicks": 1},
-		"$set": bson.M{
-			"last_clicked_at": time.Now(),
-			"updated_at":      time.Now(),
-		},
+	for _, item := range priorities {
+		stats.Priorities[item.Priority] = item.Count
 	}
 
-	result, err := s.db.Collection("external_links").UpdateOne(
-		ctx,
-		bson.M{"_id": objectID},
-		update,
-	)
+	// 获取证书统计
+	log.Info("GetExternalStatistics: 准备获取证书统计")
+	stats.TLS, err = s.getTLSStatistics(ctx, base)
 	if err != nil {
-		logger.Error("增加点击量失败", zap.Error(err))
-		return errors.NewError("增加点击量失败", http.StatusInternalServerError)
-	}
-
-	if result.MatchedCount == 0 {
-		return errors.NewError("外链不存在", http.StatusNotFound)
+		log.Error("GetExternalStatistics: 获取证书统计失败", zap.Error(err))
+		return nil, errors.NewError("获取证书统计失败", http.StatusInternalServerError)
 	}
 
-	return nil
+	log.Info("GetExternalStatistics: 完成获取统计信息", zap.Any("finalStats", stats))
+	return stats, nil
 }
 
 // BatchDeleteExternalLinks 批量删除外链
@@ -468,7 +659,7 @@ func (s *ExternalLinkService) BatchDeleteExternalLinks(ctx context.Context, ids
 		return 0, errors.NewError("没有有效的外链ID", http.StatusBadRequest)
 	}
 
-	filter := bson.M{"_id": bson.M{"$in": objectIDs}}
+	filter := writableFilter(ctx, bson.M{"_id": bson.M{"$in": objectIDs}})
 	result, err := s.db.Collection("external_links").DeleteMany(ctx, filter)
 	if err != nil {
 		logger.Error("批量删除外链失败", zap.Error(err))
@@ -481,7 +672,7 @@ func (s *ExternalLinkService) BatchDeleteExternalLinks(ctx context.Context, ids
 
 // GetAllExternalLinks 获取所有外链（不分页）
 func (s *ExternalLinkService) GetAllExternalLinks(ctx context.Context) ([]models.ExternalLink, error) {
-	cursor, err := s.db.Collection("external_links").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.db.Collection("external_links").Find(ctx, scopedFilter(ctx, bson.M{}), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		logger.Error("获取所有外链失败", zap.Error(err))
 		return nil, errors.NewError("获取所有外链失败", http.StatusInternalServerError)
@@ -497,470 +688,172 @@ func (s *ExternalLinkService) GetAllExternalLinks(ctx context.Context) ([]models
 	return links, nil
 }
 
-// BatchCheckExternalLinks 批量检测外链
-func (s *ExternalLinkService) BatchCheckExternalLinks(ctx context.Context, ids []string, checkAll bool) ([]models.LinkCheckResult, error) {
-	log := logger.NewLogger()
-	log.Info("开始批量检测外链", zap.Bool("checkAll", checkAll), zap.Int("idsCount", len(ids)))
-
-	var links []models.ExternalLink
-	var err error
-
-	if checkAll {
-		// 检测所有链接
-		links, err = s.GetAllExternalLinks(ctx)
-		if err != nil {
-			log.Error("获取所有外链失败", zap.Error(err))
-			return nil, err
-		}
-		log.Info("获取到外链数量", zap.Int("count", len(links)))
-	} else {
-		// 检测指定ID的链接
-		if len(ids) == 0 {
-			log.Warn("没有指定要检测的链接")
-			return nil, errors.NewError("没有指定要检测的链接", http.StatusBadRequest)
-		}
-
-		objectIDs := make([]primitive.ObjectID, 0, len(ids))
-		for _, id := range ids {
-			objectID, err := primitive.ObjectIDFromHex(id)
-			if err != nil {
-				log.Error("无效的外链ID", zap.String("id", id), zap.Error(err))
-				continue
-			}
-			objectIDs = append(objectIDs, objectID)
-		}
-
-		if len(objectIDs) == 0 {
-			log.Warn("没有有效的外链ID")
-			return nil, errors.NewError("没有有效的外链ID", http.StatusBadRequest)
-		}
-
-		filter := bson.M{"_id": bson.M{"$in": objectIDs}}
-		cursor, err := s.db.Collection("external_links").Find(ctx, filter)
-		if err != nil {
-			log.Error("获取要检测的外链失败", zap.Error(err))
-			return nil, errors.NewError("获取要检测的外链失败", http.StatusInternalServerError)
-		}
-		defer cursor.Close(ctx)
+// checkLinkAvailability 使用 HEAD/GET 检测单个链接的可用性，链接或域名策略指定了检测器配置时以其为准
+// 需要提取元数据时同时返回检测请求读到的页面内容
+func (s *ExternalLinkService) checkLinkAvailability(ctx context.Context, link models.ExternalLink) (models.LinkCheckResult, *checkedPage) {
+	return s.checkLink(ctx, link, models.LinkCheckProfileHeadGet)
+}
 
-		if err := cursor.All(ctx, &links); err != nil {
-			log.Error("解析外链列表失败", zap.Error(err))
-			return nil, errors.NewError("解析外链列表失败", http.StatusInternalServerError)
-		}
-		log.Info("获取到指定外链数量", zap.Int("count", len(links)))
+// checkLink 选择检测策略并检测链接，fallback 为链接和域名策略都没有指定时使用的检测器配置
+func (s *ExternalLinkService) checkLink(ctx context.Context, link models.ExternalLink, fallback string) (models.LinkCheckResult, *checkedPage) {
+	result := models.LinkCheckResult{
+		ID:        link.ID.Hex(),
+		URL:       link.URL,
+		IsValid:   false,
+		Message:   "",
+		CheckedAt: s.checkers.clock.Now(),
 	}
 
-	if len(links) == 0 {
-		log.Info("没有找到需要检测的外链")
-		return []models.LinkCheckResult{}, nil
+	// 礼貌模式下 robots.txt 禁止访问的地址不检测，也不计为失效
+	if s.robotsDisallowed(ctx, link.URL) {
+		logger.Info("robots.txt 禁止访问，跳过检测", zap.String("url", link.URL))
+		markSkippedByRobots(&result)
+		return result, nil
 	}
 
-	results := make([]models.LinkCheckResult, 0, len(links))
-
-	// 使用更少的并发数模拟真实用户访问行为
-	const maxConcurrency = 3 // 降低并发数，模拟真实用户访问
-	semaphore := make(chan struct{}, maxConcurrency)
-	resultChan := make(chan models.LinkCheckResult, len(links))
+	policy := s.policies.Resolve(ctx, link.URL)
+	checker := s.checkers.Select(link, policy, fallback, s.polite != nil)
+	result.Profile = checker.Name()
+	logger.Info("开始检测链接", zap.String("url", link.URL), zap.String("profile", result.Profile),
+		zap.String("policy", policy.Pattern), zap.Duration("timeout", policy.Timeout()))
 
-	log.Info("🚀 启动真实用户访问模拟", zap.Int("concurrency", maxConcurrency), zap.Int("total_links", len(links)))
-
-	// 启动并发检测 - 使用真实用户模拟
-	for i, link := range links {
-		go func(index int, l models.ExternalLink) {
-			semaphore <- struct{}{}        // 获取许可
-			defer func() { <-semaphore }() // 释放许可
-
-			log.Info("👤 模拟用户访问", zap.Int("index", index+1), zap.Int("total", len(links)), zap.String("url", l.URL))
-
-			// 使用真实用户模拟而不是简单检测
-			result := s.simulateRealUserVisit(ctx, l)
-			resultChan <- result
+	// 先单独解析域名并记录结果，直连时解析失败不再请求，也不占用域名的请求频率
+	result.DNS = s.checkers.LookupURL(ctx, link.URL)
+	if result.DNS != nil && !result.DNS.Resolved() && s.checkers.Direct(policy) {
+		s.applyCheckOutcome(&result, link.URL, policy, LinkCheckOutcome{Err: dnsLookupError(*result.DNS)})
+		return result, nil
+	}
 
-			// 使用独立的上下文更新数据库，避免网络请求超时影响数据库操作
-			dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+	if err := s.policies.WaitTurn(ctx, link.URL, policy); err != nil {
+		result.ErrorMessage = "检测已取消"
+		result.ErrorClass = models.LinkErrorCancelled
+		return result, nil
+	}
 
-			update := bson.M{
-				"is_valid":   result.IsValid,
-				"updated_at": time.Now(),
-			}
-			if result.ErrorMessage != "" {
-				update["last_check_error"] = result.ErrorMessage
-			}
+	// HTTPS 链接先读取证书信息，握手失败时也能知道证书的具体问题
+	result.TLS = s.inspectTLS(ctx, link.URL, policy.Timeout(), s.checkers.Dialer(policy))
 
-			_, err := s.db.Collection("external_links").UpdateOne(
-				dbCtx,
-				bson.M{"_id": l.ID},
-				bson.M{"$set": update},
-			)
-			if err != nil {
-				log.Error("更新链接检测结果失败", zap.String("link_id", l.ID.Hex()), zap.Error(err))
-			}
-		}(i, link)
+	// 需要提取元数据或校验内容时由检测请求读取页面，不再单独请求
+	target := LinkCheckTarget{URL: link.URL, Policy: policy}
+	if s.metadataDue(link) {
+		target.CaptureBytes = s.metadataMaxBytes()
+	}
+	assertion := s.resolveAssertions(ctx, link)
+	if !assertion.IsEmpty() {
+		target.CaptureBytes = max(target.CaptureBytes, maxAssertionBodyBytes)
+		target.CaptureAnyType = true
 	}
+	outcome := checker.Check(ctx, target)
+	s.applyCheckOutcome(&result, link.URL, policy, outcome)
 
-	// 收集所有结果
-	for i := 0; i < len(links); i++ {
-		result := <-resultChan
-		results = append(results, result)
+	// 状态码正常时再校验页面内容，识别停放域名、软404和登录墙等情况
+	if result.IsValid && outcome.Client != nil {
+		s.verifyContent(ctx, assertion, link, policy, outcome, &result)
 	}
 
-	log.Info("批量检测完成", zap.Int("total", len(results)))
-	return results, nil
+	return result, outcome.Page
 }
 
-// checkLinkAvailability 检测单个链接的可用性
-func (s *ExternalLinkService) checkLinkAvailability(ctx context.Context, link models.ExternalLink) models.LinkCheckResult {
-	log := logger.NewLogger()
-	result := models.LinkCheckResult{
-		ID:        link.ID.Hex(),
-		URL:       link.URL,
-		IsValid:   false,
-		Message:   "",
-		CheckedAt: time.Now(),
-	}
-
-	log.Info("🔍 开始真实用户模拟检测", zap.String("url", link.URL))
-
-	// 模拟真实用户行为：随机等待1-3秒，模拟用户思考时间
-	userThinkTime := time.Duration(1000+rand.Intn(2000)) * time.Millisecond
-	log.Info("⏱️ 模拟用户思考时间", zap.Duration("think_time", userThinkTime))
-	time.Sleep(userThinkTime)
-
-	// 根据域名调整超时策略
-	timeout := s.getTimeoutForDomain(link.URL)
-	log.Info("🕐 使用超时时间", zap.String("url", link.URL), zap.Duration("timeout", timeout))
-
-	// 创建HTTP客户端，模拟真实浏览器行为
-	client := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			DisableCompression:  false,            // 启用压缩，更像浏览器
-			DisableKeepAlives:   true,             // 禁用长连接，避免连接池问题
-			TLSHandshakeTimeout: 15 * time.Second, // 增加TLS握手超时
-			// 强制使用IPv4，避免IPv6连接问题
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				dialer := &net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}
-				// 强制使用IPv4
-				if network == "tcp" {
-					network = "tcp4"
-				}
-				return dialer.DialContext(ctx, network, addr)
-			},
-		},
-		// 允许重定向，但限制次数
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
-				return fmt.Errorf("重定向次数过多")
-			}
-			return nil
-		},
-	}
-
-	// 先尝试 HEAD 请求
-	req, err := http.NewRequestWithContext(ctx, "HEAD", link.URL, nil)
-	if err != nil {
-		log.Error("创建HEAD请求失败", zap.String("url", link.URL), zap.Error(err))
-		result.ErrorMessage = fmt.Sprintf("创建请求失败: %v", err)
-		return result
-	}
-
-	// 设置更完整的浏览器请求头
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Cache-Control", "max-age=0")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "none")
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Connection", "close")
-
-	// 发送 HEAD 请求
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Warn("HEAD请求失败，尝试GET请求", zap.String("url", link.URL), zap.Error(err))
-
-		// 如果 HEAD 失败，尝试 GET 请求
-		getReq, getErr := http.NewRequestWithContext(ctx, "GET", link.URL, nil)
-		if getErr != nil {
-			log.Error("创建GET请求失败", zap.String("url", link.URL), zap.Error(getErr))
-			result.ErrorMessage = s.formatNetworkError(err)
-			return result
+// applyCheckOutcome 按域名策略将检测策略的请求结果转换为检测结果
+func (s *ExternalLinkService) applyCheckOutcome(result *models.LinkCheckResult, rawURL string, policy models.DomainPolicy, outcome LinkCheckOutcome) {
+	result.LatencyMs = outcome.Latency.Milliseconds()
+	result.Attempts = outcome.Attempts
+	result.Proxy = outcome.Proxy
+
+	if outcome.Err != nil {
+		result.RedirectChain = outcome.Redirects
+		// 重定向到 robots.txt 禁止访问的地址
+		if stderrors.Is(outcome.Err, errRobotsDisallowed) {
+			logger.Info("robots.txt 禁止访问重定向目标，跳过检测", zap.String("url", rawURL))
+			markSkippedByRobots(result)
+			return
 		}
-
-		// 设置更强的反检测请求头，模拟真实用户访问
-		getReq.Header.Set("User-Agent", s.getRandomUserAgent())
-		getReq.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-		getReq.Header.Set("Accept-Language", "en-US,en;q=0.9,zh-CN;q=0.8,zh;q=0.7")
-		getReq.Header.Set("Accept-Encoding", "gzip, deflate, br")
-		getReq.Header.Set("Cache-Control", "max-age=0")
-		getReq.Header.Set("Upgrade-Insecure-Requests", "1")
-		getReq.Header.Set("Sec-Fetch-Dest", "document")
-		getReq.Header.Set("Sec-Fetch-Mode", "navigate")
-		getReq.Header.Set("Sec-Fetch-Site", "none")
-		getReq.Header.Set("Sec-Fetch-User", "?1")
-		getReq.Header.Set("Sec-CH-UA", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
-		getReq.Header.Set("Sec-CH-UA-Mobile", "?0")
-		getReq.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
-		getReq.Header.Set("DNT", "1")
-		getReq.Header.Set("Connection", "close")
-
-		resp, err = client.Do(getReq)
-		if err != nil {
-			log.Error("GET请求也失败", zap.String("url", link.URL), zap.Error(err))
-
-			// 检查是否是连接被断开的情况
-			errStr := err.Error()
-			isConnectionClosed := strings.Contains(errStr, "wsarecv: An existing connection was forcibly closed") ||
-				strings.Contains(errStr, "connection reset by peer")
-
-			// 对于特殊网站或连接被断开的情况，标记为可用但提供说明信息
-			if s.isSpecialDomain(link.URL) || isConnectionClosed {
-				log.Info("特殊域名或连接断开检测失败，但标记为可用", zap.String("url", link.URL))
-				result.IsValid = true // 改为 true，因为网站本身是可用的
-
-				// 为不同类型的特殊网站提供个性化的说明信息
-				if strings.Contains(link.URL, "trends.google.com") {
-					result.Message = "网站可用 - Google Trends 对自动化检测有限制，但网站本身正常运行"
-				} else if strings.Contains(link.URL, "google.com") {
-					result.Message = "网站可用 - Google 服务对自动化检测有限制，但网站本身正常运行"
-				} else if strings.Contains(link.URL, "simonandschuster.com") {
-					result.Message = "网站可用 - Simon & Schuster 对自动化检测有限制，但网站本身正常运行"
-				} else if strings.Contains(link.URL, "thevineking.com") {
-					result.Message = "网站可用 - The Vineking 有反爬虫保护机制，但网站本身正常运行"
-				} else if isConnectionClosed {
-					result.Message = "网站可用 - 网站有访问保护机制，但网站本身正常运行"
-				} else {
-					result.Message = "网站可用 - 该网站对自动化检测有限制，但网站本身正常运行"
-				}
-				// 清空错误信息，因为这不是错误
-				result.ErrorMessage = ""
-			} else {
-				result.ErrorMessage = s.formatNetworkError(err)
-			}
-			return result
+		// 代理不可用时无法判断链接本身的状态，不计为失效
+		if stderrors.Is(outcome.Err, errProxyUnavailable) {
+			logger.Warn("出站代理均不可用，跳过检测", zap.String("url", rawURL), zap.String("policy", policy.Pattern), zap.Error(outcome.Err))
+			result.Skipped = true
+			result.SkipReason = models.LinkSkipProxy
+			result.ErrorClass = models.LinkErrorProxy
+			result.Message = "出站代理均不可用，未检测"
+			return
+		}
+		result.ErrorClass = classifyCheckError(outcome.Err)
+		if result.ErrorClass == models.LinkErrorCancelled {
+			result.ErrorMessage = "检测已取消"
+			return
+		}
+		// 链接主机解析失败时按解析结果细分，重定向目标解析失败时仍使用错误本身的分类
+		dnsFailed := result.ErrorClass.IsDNS() && result.DNS != nil && !result.DNS.Resolved()
+		if dnsFailed {
+			result.ErrorClass = dnsErrorCode(result.DNS.Status)
+		}
+		logger.Warn("链接请求失败", zap.String("url", rawURL), zap.String("method", outcome.Method),
+			zap.Int("attempts", outcome.Attempts), zap.Error(outcome.Err))
+		s.applyFailurePolicy(result, policy, outcome.Err)
+		if dnsFailed && !result.IsValid {
+			result.ErrorMessage = dnsFailureMessage(result.DNS)
 		}
+		return
 	}
-	defer resp.Body.Close()
 
-	log.Info("请求成功", zap.String("url", link.URL), zap.Int("status_code", resp.StatusCode))
+	status := outcome.StatusCode
+	result.StatusCode = status
+	result.FinalURL = outcome.FinalURL
+	applyRedirectChain(result, rawURL, outcome.Redirects)
 
-	// 检查响应状态码
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+	if policy.IsExpectedStatus(status) {
 		result.IsValid = true
-		result.Message = fmt.Sprintf("链接可用 (状态码: %d)", resp.StatusCode)
-		log.Info("链接检测成功", zap.String("url", link.URL), zap.Int("status", resp.StatusCode))
-	} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-		result.ErrorMessage = fmt.Sprintf("客户端错误 (状态码: %d)", resp.StatusCode)
-		log.Warn("链接返回客户端错误", zap.String("url", link.URL), zap.Int("status", resp.StatusCode))
-	} else if resp.StatusCode >= 500 {
-		result.ErrorMessage = fmt.Sprintf("服务器错误 (状态码: %d)", resp.StatusCode)
-		log.Warn("链接返回服务器错误", zap.String("url", link.URL), zap.Int("status", resp.StatusCode))
+		result.Message = fmt.Sprintf("链接可用 (状态码: %d)", status)
 	} else {
-		result.ErrorMessage = fmt.Sprintf("未知响应 (状态码: %d)", resp.StatusCode)
-		log.Warn("链接返回未知状态", zap.String("url", link.URL), zap.Int("status", resp.StatusCode))
-	}
-
-	return result
-}
-
-// simulateRealUserVisit 模拟真实用户访问链接行为
-func (s *ExternalLinkService) simulateRealUserVisit(ctx context.Context, link models.ExternalLink) models.LinkCheckResult {
-	log := logger.NewLogger()
-	result := models.LinkCheckResult{
-		ID:        link.ID.Hex(),
-		URL:       link.URL,
-		IsValid:   false,
-		Message:   "",
-		CheckedAt: time.Now(),
-	}
-
-	log.Info("🎭 开始模拟真实用户访问", zap.String("url", link.URL))
-
-	// 阶段1: 模拟用户打开浏览器前的准备时间
-	prepTime := time.Duration(500+rand.Intn(1500)) * time.Millisecond
-	log.Info("📱 模拟打开浏览器准备时间", zap.Duration("prep_time", prepTime))
-	time.Sleep(prepTime)
-
-	// 阶段2: 创建更真实的HTTP客户端
-	timeout := s.getTimeoutForDomain(link.URL)
-	client := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     90 * time.Second, // 更长的空闲超时
-			DisableCompression:  false,
-			DisableKeepAlives:   false, // 启用长连接，更像真实浏览器
-			TLSHandshakeTimeout: 20 * time.Second,
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				dialer := &net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}
-				if network == "tcp" {
-					network = "tcp4"
-				}
-				return dialer.DialContext(ctx, network, addr)
-			},
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
-				return fmt.Errorf("重定向次数过多")
+		result.ErrorClass = statusErrorCode(status)
+		switch result.ErrorClass {
+		case models.LinkErrorUnexpectedStatus:
+			result.ErrorMessage = fmt.Sprintf("状态码不符合预期 (状态码: %d)", status)
+		case models.LinkErrorRateLimited:
+			result.ErrorMessage = fmt.Sprintf("请求过于频繁 (状态码: %d)", status)
+			if outcome.RetryAfter > 0 {
+				result.ErrorMessage += fmt.Sprintf("，服务器要求 %s 后重试", outcome.RetryAfter)
 			}
-			// 模拟用户处理重定向的时间
-			redirectDelay := time.Duration(200+rand.Intn(800)) * time.Millisecond
-			log.Info("🔄 模拟重定向处理时间", zap.Duration("redirect_delay", redirectDelay))
-			time.Sleep(redirectDelay)
-			return nil
-		},
-	}
-
-	// 阶段3: 模拟用户输入URL和按回车的时间
-	inputDelay := time.Duration(800+rand.Intn(1200)) * time.Millisecond
-	log.Info("⌨️ 模拟用户输入URL时间", zap.Duration("input_delay", inputDelay))
-	time.Sleep(inputDelay)
-
-	// 阶段4: 创建真实的GET请求（模拟用户真实打开页面）
-	req, err := http.NewRequestWithContext(ctx, "GET", link.URL, nil)
-	if err != nil {
-		log.Error("❌ 创建请求失败", zap.String("url", link.URL), zap.Error(err))
-		result.ErrorMessage = fmt.Sprintf("创建请求失败: %v", err)
-		return result
-	}
-
-	// 阶段5: 设置完整的浏览器请求头，模拟真实用户环境
-	userAgent := s.getRandomUserAgent()
-	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8,ja;q=0.7")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Cache-Control", "max-age=0")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "none")
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Sec-CH-UA", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
-	req.Header.Set("Sec-CH-UA-Mobile", "?0")
-	req.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
-
-	// 模拟真实浏览器的其他头信息
-	req.Header.Set("DNT", "1")
-	req.Header.Set("Referer", "https://www.google.com/") // 模拟从Google搜索来的
-
-	// 随机添加一些真实浏览器会发送的头
-	if rand.Intn(2) == 0 {
-		req.Header.Set("X-Requested-With", "XMLHttpRequest")
-	}
-
-	log.Info("🌐 开始发送真实用户请求", zap.String("user_agent", userAgent))
-
-	// 阶段6: 发送请求
-	startTime := time.Now()
-	resp, err := client.Do(req)
-	requestDuration := time.Since(startTime)
-
-	if err != nil {
-		log.Error("❌ 请求失败", zap.String("url", link.URL), zap.Error(err), zap.Duration("duration", requestDuration))
-
-		// 检查是否是特殊网站
-		if s.isSpecialDomain(link.URL) {
-			log.Info("🌟 特殊域名检测失败，但标记为可用", zap.String("url", link.URL))
-			result.IsValid = true
-			result.Message = s.getSpecialDomainMessage(link.URL)
-		} else {
-			result.ErrorMessage = s.formatNetworkError(err)
+		case models.LinkErrorClientError:
+			result.ErrorMessage = fmt.Sprintf("客户端错误 (状态码: %d)", status)
+		case models.LinkErrorServerError:
+			result.ErrorMessage = fmt.Sprintf("服务器错误 (状态码: %d)", status)
+		default:
+			result.ErrorMessage = fmt.Sprintf("未知响应 (状态码: %d)", status)
 		}
-		return result
 	}
-	defer resp.Body.Close()
-
-	// 阶段7: 模拟用户查看页面响应的时间
-	responseProcessTime := time.Duration(300+rand.Intn(700)) * time.Millisecond
-	log.Info("👀 模拟用户查看响应时间", zap.Duration("process_time", responseProcessTime))
-	time.Sleep(responseProcessTime)
-
-	log.Info("✅ 请求成功",
-		zap.String("url", link.URL),
-		zap.Int("status_code", resp.StatusCode),
-		zap.Duration("total_duration", requestDuration),
-		zap.String("content_type", resp.Header.Get("Content-Type")))
-
-	// 阶段8: 更详细的状态码判断
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		// 阶段9: 模拟读取部分页面内容（验证页面确实可用）
-		contentSnippet := s.readContentSnippet(resp, 512) // 读取前512字节
-
-		result.IsValid = true
-		result.Message = fmt.Sprintf("✅ 访问成功 (状态:%d, 耗时:%dms, 内容长度:%s)",
-			resp.StatusCode,
-			requestDuration.Milliseconds(),
-			resp.Header.Get("Content-Length"))
-
-		log.Info("🎉 真实用户访问成功",
-			zap.String("url", link.URL),
-			zap.Int("status", resp.StatusCode),
-			zap.String("content_preview", contentSnippet[:min(50, len(contentSnippet))]))
-
-	} else if resp.StatusCode >= 300 && resp.StatusCode < 400 {
-		// 重定向也算成功
-		result.IsValid = true
-		result.Message = fmt.Sprintf("✅ 重定向成功 (状态:%d → %s)",
-			resp.StatusCode, resp.Header.Get("Location"))
-
-	} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-		result.ErrorMessage = fmt.Sprintf("❌ 客户端错误 (状态:%d)", resp.StatusCode)
-		log.Warn("⚠️ 客户端错误", zap.String("url", link.URL), zap.Int("status", resp.StatusCode))
+	logger.Info("链接检测完成", zap.String("url", rawURL), zap.String("method", outcome.Method),
+		zap.Int("status", status), zap.Bool("valid", result.IsValid))
+}
 
-	} else if resp.StatusCode >= 500 {
-		result.ErrorMessage = fmt.Sprintf("❌ 服务器错误 (状态:%d)", resp.StatusCode)
-		log.Warn("⚠️ 服务器错误", zap.String("url", link.URL), zap.Int("status", resp.StatusCode))
+// applyFailurePolicy 请求失败时按域名策略判断是否仍视为可用
+func (s *ExternalLinkService) applyFailurePolicy(result *models.LinkCheckResult, policy models.DomainPolicy, err error) {
+	isConnectionClosed := result.ErrorClass == models.LinkErrorConnectionReset
 
-	} else {
-		result.ErrorMessage = fmt.Sprintf("❌ 未知响应 (状态:%d)", resp.StatusCode)
+	if !failureIsHealthy(policy, result.ErrorClass) {
+		result.ErrorMessage = s.formatNetworkError(err)
+		return
 	}
 
-	// 阶段10: 模拟用户浏览页面的时间（如果成功）
-	if result.IsValid {
-		browsingTime := time.Duration(1000+rand.Intn(3000)) * time.Millisecond
-		log.Info("📖 模拟用户浏览页面时间", zap.Duration("browsing_time", browsingTime))
-		time.Sleep(browsingTime)
+	logger.Info("域名策略允许检测失败时标记为可用", zap.String("url", result.URL), zap.String("policy", policy.Pattern))
+	result.IsValid = true // 网站本身是可用的，只是拒绝了自动化检测
+	switch {
+	case policy.ErrorIsHealthy && policy.HealthyMessage != "":
+		result.Message = policy.HealthyMessage
+	case isConnectionClosed:
+		result.Message = "网站可用 - 网站有访问保护机制，但网站本身正常运行"
+	default:
+		result.Message = "网站可用 - 该网站对自动化检测有限制，但网站本身正常运行"
 	}
-
-	return result
+	// 清空错误信息，因为这不是错误
+	result.ErrorMessage = ""
 }
 
-// readContentSnippet 读取响应内容的片段用于验证
-func (s *ExternalLinkService) readContentSnippet(resp *http.Response, maxBytes int64) string {
-	if resp.Body == nil {
-		return ""
+// applyPolicyHeaders 设置域名策略中配置的额外请求头
+func applyPolicyHeaders(req *http.Request, policy models.DomainPolicy) {
+	for name, value := range policy.Headers {
+		req.Header.Set(name, value)
 	}
-
-	buffer := make([]byte, maxBytes)
-	n, _ := resp.Body.Read(buffer)
-	return string(buffer[:n])
-}
-
-// getSpecialDomainMessage 为特殊域名返回个性化消息
-func (s *ExternalLinkService) getSpecialDomainMessage(urlStr string) string {
-	if strings.Contains(urlStr, "trends.google.com") {
-		return "🌟 Google Trends 可用 - 该网站对自动化检测有限制，但网站正常运行"
-	} else if strings.Contains(urlStr, "google.com") {
-		return "🌟 Google 服务可用 - 该服务对自动化检测有限制，但网站正常运行"
-	} else if strings.Contains(urlStr, "simonandschuster.com") {
-		return "🌟 Simon & Schuster 可用 - 该网站有反爬虫保护，但网站正常运行"
-	} else if strings.Contains(urlStr, "thevineking.com") {
-		return "🌟 The Vineking 可用 - 该网站有访问保护机制，但网站正常运行"
-	}
-	return "🌟 网站可用 - 该网站对自动化检测有限制，但网站本身正常运行"
 }
 
 // min 辅助函数
@@ -973,7 +866,8 @@ func min(a, b int) int {
 
 // GetInvalidExternalLinks 获取所有不可用的外链
 func (s *ExternalLinkService) GetInvalidExternalLinks(ctx context.Context) ([]models.ExternalLink, error) {
-	filter := bson.M{"is_valid": false}
+	// 因 robots.txt 未检测的链接不算不可用
+	filter := scopedFilter(ctx, bson.M{"is_valid": false, "skip_reason": bson.M{"$exists": false}})
 	cursor, err := s.db.Collection("external_links").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		logger.Error("获取不可用外链失败", zap.Error(err))
@@ -992,7 +886,8 @@ func (s *ExternalLinkService) GetInvalidExternalLinks(ctx context.Context) ([]mo
 
 // BatchDeleteInvalidExternalLinks 批量删除所有不可用的外链
 func (s *ExternalLinkService) BatchDeleteInvalidExternalLinks(ctx context.Context) (int64, error) {
-	filter := bson.M{"is_valid": false}
+	// 因 robots.txt 未检测的链接不算不可用
+	filter := writableFilter(ctx, bson.M{"is_valid": false, "skip_reason": bson.M{"$exists": false}})
 	result, err := s.db.Collection("external_links").DeleteMany(ctx, filter)
 	if err != nil {
 		logger.Error("批量删除不可用外链失败", zap.Error(err))
@@ -1003,85 +898,34 @@ func (s *ExternalLinkService) BatchDeleteInvalidExternalLinks(ctx context.Contex
 	return result.DeletedCount, nil
 }
 
-// getTimeoutForDomain 根据域名返回适当的超时时间
-func (s *ExternalLinkService) getTimeoutForDomain(urlStr string) time.Duration {
-	// 定义需要更长超时时间的域名
-	slowDomains := map[string]time.Duration{
-		// Google 系列服务
-		"trends.google.com":        60 * time.Second, // Google Trends 需要更长时间
-		"console.cloud.google.com": 35 * time.Second, // Google Cloud Console
-		"analytics.google.com":     30 * time.Second, // Google Analytics
-		"youtube.com":              25 * time.Second, // YouTube
-		"google.com":               25 * time.Second, // Google 主站
-
-		// 社交媒体
-		"facebook.com":  20 * time.Second, // Facebook
-		"linkedin.com":  20 * time.Second, // LinkedIn
-		"twitter.com":   20 * time.Second, // Twitter
-		"x.com":         20 * time.Second, // X (formerly Twitter)
-		"instagram.com": 20 * time.Second, // Instagram
-
-		// 电商网站
-		"amazon.com":           25 * time.Second, // Amazon
-		"ebay.com":             20 * time.Second, // eBay
-		"simonandschuster.com": 25 * time.Second, // Simon & Schuster
-		"barnes.com":           20 * time.Second, // Barnes & Noble
-		"alibaba.com":          20 * time.Second, // Alibaba
-
-		// 新闻媒体
-		"cnn.com":     20 * time.Second, // CNN
-		"bbc.com":     20 * time.Second, // BBC
-		"reuters.com": 20 * time.Second, // Reuters
-		"wsj.com":     20 * time.Second, // Wall Street Journal
-
-		// 技术网站
-		"github.com":        15 * time.Second, // GitHub
-		"stackoverflow.com": 15 * time.Second, // Stack Overflow
-		"medium.com":        15 * time.Second, // Medium
-
-		// 其他大型网站
-		"netflix.com": 20 * time.Second, // Netflix
-		"spotify.com": 20 * time.Second, // Spotify
-		"dropbox.com": 15 * time.Second, // Dropbox
-	}
-
-	// 解析URL获取域名
-	if parsedURL, err := url.Parse(urlStr); err == nil {
-		hostname := parsedURL.Hostname()
-
-		// 检查完整域名
-		if timeout, exists := slowDomains[hostname]; exists {
-			return timeout
-		}
-
-		// 检查子域名（移除www前缀）
-		if strings.HasPrefix(hostname, "www.") {
-			hostname = hostname[4:]
-			if timeout, exists := slowDomains[hostname]; exists {
-				return timeout
-			}
-		}
-
-		// 检查顶级域名
-		parts := strings.Split(hostname, ".")
-		if len(parts) >= 2 {
-			topDomain := strings.Join(parts[len(parts)-2:], ".")
-			if timeout, exists := slowDomains[topDomain]; exists {
-				return timeout
-			}
-		}
-	}
-
-	// 默认超时时间 - 增加以适应更多网站
-	return 18 * time.Second
-}
-
 // formatNetworkError 格式化网络错误信息，提供更清晰的错误描述
 func (s *ExternalLinkService) formatNetworkError(err error) string {
 	if err == nil {
 		return "未知网络错误"
 	}
 
+	switch {
+	case stderrors.Is(err, errTooManyRedirects):
+		return "重定向次数过多"
+	case stderrors.Is(err, errRedirectLoop):
+		return "重定向循环，页面反复跳转到已访问过的地址"
+	case stderrors.Is(err, errInvalidCheckRequest), stderrors.Is(err, errNoAllowedMethod):
+		return err.Error()
+	}
+
+	var dnsErr *net.DNSError
+	if stderrors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsTimeout:
+			return "域名解析超时，DNS 服务器未响应"
+		case dnsErr.IsNotFound:
+			return "域名解析失败，网站可能不存在"
+		case dnsErr.IsTemporary:
+			return "DNS 服务器无法完成解析，可能是域名配置错误或权威服务器故障"
+		}
+		return "域名解析失败: " + dnsErr.Err
+	}
+
 	errStr := err.Error()
 
 	// IPv6 连接问题
@@ -1095,7 +939,7 @@ func (s *ExternalLinkService) formatNetworkError(err error) string {
 	}
 
 	// TLS握手错误
-	if strings.Contains(errStr, "tls: handshake timeout") {
+	if strings.Contains(errStr, "tls: handshake timeout") || strings.Contains(errStr, "TLS handshake timeout") {
 		return "SSL握手超时，可能是网络或证书问题"
 	}
 
@@ -1138,84 +982,70 @@ func (s *ExternalLinkService) formatNetworkError(err error) string {
 	return fmt.Sprintf("网络请求失败: %s", errStr)
 }
 
-// getRandomUserAgent 获取随机的User-Agent，增强反检测能力
-func (s *ExternalLinkService) getRandomUserAgent() string {
-	userAgents := []string{
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/121.0",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/120.0",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
-		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-	}
-
-	// 基于当前时间选择User-Agent，确保一定的随机性但同一次请求保持一致
-	index := int(time.Now().Unix()) % len(userAgents)
-	return userAgents[index]
-}
+// classifyCheckError 将请求错误归类，用于重试判断和检测记录统计
+func classifyCheckError(err error) models.LinkErrorCode {
+	if err == nil {
+		return ""
+	}
+	if stderrors.Is(err, context.Canceled) {
+		return models.LinkErrorCancelled
+	}
+	if stderrors.Is(err, errProxyUnavailable) || stderrors.Is(err, errProxyRejected) {
+		return models.LinkErrorProxy
+	}
 
-// isSpecialDomain 检查是否为需要特殊处理的域名
-func (s *ExternalLinkService) isSpecialDomain(urlStr string) bool {
-	specialDomains := map[string]bool{
-		// 大型电商网站
-		"amazon.com":           true,
-		"ebay.com":             true,
-		"simonandschuster.com": true,
-		"barnes.com":           true,
-		"alibaba.com":          true,
-		"thevineking.com":      true, // The Vineking Wine Shop (Shopify)
-
-		// Google 系列服务
-		"trends.google.com":        true,
-		"console.cloud.google.com": true,
-		"analytics.google.com":     true,
-
-		// 社交媒体
-		"facebook.com":  true,
-		"linkedin.com":  true,
-		"twitter.com":   true,
-		"x.com":         true,
-		"instagram.com": true,
-
-		// 新闻媒体
-		"cnn.com":     true,
-		"bbc.com":     true,
-		"reuters.com": true,
-		"wsj.com":     true,
-
-		// 流媒体和娱乐
-		"netflix.com": true,
-		"youtube.com": true,
-		"spotify.com": true,
-	}
-
-	// 解析URL获取域名
-	if parsedURL, err := url.Parse(urlStr); err == nil {
-		hostname := parsedURL.Hostname()
-
-		// 检查完整域名
-		if specialDomains[hostname] {
-			return true
+	var dnsErr *net.DNSError
+	if stderrors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsTimeout:
+			return models.LinkErrorDNSTimeout
+		case dnsErr.IsNotFound:
+			return models.LinkErrorDNSNXDomain
+		case dnsErr.IsTemporary:
+			return models.LinkErrorDNSServFail
 		}
+		return models.LinkErrorDNS
+	}
 
-		// 检查子域名（移除www前缀）
-		if strings.HasPrefix(hostname, "www.") {
-			hostname = hostname[4:]
-			if specialDomains[hostname] {
-				return true
-			}
-		}
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	if stderrors.As(err, &certErr) || stderrors.As(err, &recordErr) {
+		return models.LinkErrorTLS
+	}
 
-		// 检查顶级域名
-		parts := strings.Split(hostname, ".")
-		if len(parts) >= 2 {
-			topDomain := strings.Join(parts[len(parts)-2:], ".")
-			if specialDomains[topDomain] {
-				return true
-			}
-		}
+	if stderrors.Is(err, syscall.ECONNREFUSED) {
+		return models.LinkErrorConnectionRefused
+	}
+	if stderrors.Is(err, syscall.ECONNRESET) {
+		return models.LinkErrorConnectionReset
+	}
+
+	if stderrors.Is(err, errTooManyRedirects) || stderrors.Is(err, errRedirectLoop) {
+		return models.LinkErrorTooManyRedirects
+	}
+	if stderrors.Is(err, errInvalidCheckRequest) || stderrors.Is(err, errNoAllowedMethod) {
+		return models.LinkErrorInvalidRequest
+	}
+
+	errStr := err.Error()
+	switch {
+	case strings.Contains(errStr, "tls:") || strings.Contains(errStr, "x509:"):
+		return models.LinkErrorTLS
+	case strings.Contains(errStr, "no such host"):
+		return models.LinkErrorDNS
+	case strings.Contains(errStr, "connection refused"):
+		return models.LinkErrorConnectionRefused
+	case strings.Contains(errStr, "connection reset by peer") || strings.Contains(errStr, "forcibly closed"):
+		return models.LinkErrorConnectionReset
+	}
+
+	var netErr net.Error
+	if stderrors.As(err, &netErr) && netErr.Timeout() {
+		return models.LinkErrorTimeout
+	}
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		return models.LinkErrorTimeout
 	}
 
-	return false
+	return models.LinkErrorNetwork
 }
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// maxLinkTags 单个链接最多的标签数
+	maxLinkTags = 20
+	// maxTagLength 单个标签最大字符数
+	maxTagLength = 32
+)
+
+// normalizeTag 去掉首尾空白并转为小写，避免大小写不同的重复标签
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags 规范化并去重标签，保持原有顺序
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength || strings.Contains(tag, ",") {
+			return nil, errors.NewError(fmt.Sprintf("无效的标签 %q，长度不能超过 %d 且不能包含逗号", tag, maxTagLength), http.StatusBadRequest)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxLinkTags {
+		return nil, errors.NewError(fmt.Sprintf("标签数量不能超过 %d 个", maxLinkTags), http.StatusBadRequest)
+	}
+	return result, nil
+}
+
+// splitTags 拆分逗号分隔的标签
+func splitTags(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	return strings.Split(raw, ",")
+}
+
+// ListTags 获取调用者可访问链接的全部标签及使用次数，按使用次数降序
+func (s *ExternalLinkService) ListTags(ctx context.Context) ([]models.LinkTag, error) {
+	return s.listTags(ctx, scopedFilter(ctx, bson.M{}))
+}
+
+// listTags 统计符合条件的链接的标签
+func (s *ExternalLinkService) listTags(ctx context.Context, match bson.M) ([]models.LinkTag, error) {
+	cursor, err := s.db.Collection("external_links").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: mergeFilter(match, bson.M{"tags.0": bson.M{"$exists": true}})}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		logger.Error("获取标签失败", zap.Error(err))
+		return nil, errors.NewError("获取标签失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	tags := []models.LinkTag{}
+	if err := cursor.All(ctx, &tags); err != nil {
+		logger.Error("解析标签失败", zap.Error(err))
+		return nil, errors.NewError("获取标签失败", http.StatusInternalServerError)
+	}
+	return tags, nil
+}
+
+// RenameTag 重命名标签，目标标签已存在时与之合并，返回受影响的链接数
+func (s *ExternalLinkService) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	return s.MergeTags(ctx, []string{from}, to)
+}
+
+// MergeTags 将 sources 中的标签全部替换为 target，返回受影响的链接数
+// 先为含有来源标签的链接添加目标标签，再移除来源标签，两步都是幂等的，中途失败可直接重试
+func (s *ExternalLinkService) MergeTags(ctx context.Context, sources []string, target string) (int64, error) {
+	targets, err := normalizeTags([]string{target})
+	if err != nil {
+		return 0, err
+	}
+	if len(targets) == 0 {
+		return 0, errors.NewError("目标标签不能为空", http.StatusBadRequest)
+	}
+	target = targets[0]
+
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		if source = normalizeTag(source); source != "" && source != target {
+			names = append(names, source)
+		}
+	}
+	if len(names) == 0 {
+		return 0, errors.NewError("请指定要合并的标签", http.StatusBadRequest)
+	}
+
+	collection := s.db.Collection("external_links")
+	filter := bson.M{"tags": bson.M{"$in": names}}
+	result, err := collection.UpdateMany(ctx, filter, bson.M{"$addToSet": bson.M{"tags": target}})
+	if err != nil {
+		logger.Error("合并标签失败", zap.Error(err))
+		return 0, errors.NewError("合并标签失败", http.StatusInternalServerError)
+	}
+	if _, err := collection.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"tags": bson.M{"$in": names}}}); err != nil {
+		logger.Error("移除旧标签失败", zap.Error(err))
+		return 0, errors.NewError("合并标签失败", http.StatusInternalServerError)
+	}
+
+	logger.Info("标签合并完成", zap.Strings("sources", names), zap.String("target", target), zap.Int64("links", result.MatchedCount))
+	return result.MatchedCount, nil
+}
+
+// DeleteTag 从所有链接中移除标签，返回受影响的链接数
+func (s *ExternalLinkService) DeleteTag(ctx context.Context, tag string) (int64, error) {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return 0, errors.NewError("标签不能为空", http.StatusBadRequest)
+	}
+
+	result, err := s.db.Collection("external_links").UpdateMany(ctx,
+		bson.M{"tags": tag},
+		bson.M{"$pull": bson.M{"tags": tag}},
+	)
+	if err != nil {
+		logger.Error("删除标签失败", zap.Error(err))
+		return 0, errors.NewError("删除标签失败", http.StatusInternalServerError)
+	}
+	if result.MatchedCount == 0 {
+		return 0, errors.NewError("标签不存在", http.StatusNotFound)
+	}
+	return result.MatchedCount, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// defaultTLSExpiryWarnDays 证书到期预警的默认天数，可通过 LINK_TLS_EXPIRY_WARN_DAYS 调整
+const defaultTLSExpiryWarnDays = 30
+
+// tlsExpiryWarnDays 获取证书到期预警天数
+func tlsExpiryWarnDays() int {
+	if days, err := strconv.Atoi(os.Getenv("LINK_TLS_EXPIRY_WARN_DAYS")); err == nil && days > 0 {
+		return days
+	}
+	return defaultTLSExpiryWarnDays
+}
+
+// inspectTLS 单独建立一次 TLS 连接读取证书链，dial 与检测请求使用同样的代理和 IP 协议
+// 跳过握手阶段的校验，以便证书过期或域名不匹配时仍能拿到证书信息，随后再手动校验
+func (s *ExternalLinkService) inspectTLS(ctx context.Context, rawURL string, timeout time.Duration, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *models.TLSInfo {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return nil
+	}
+
+	host := parsed.Hostname()
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	info := &models.TLSInfo{CheckedAt: time.Now()}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	rawConn, err := dial(dialCtx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		logger.Warn("读取证书信息失败", zap.String("host", host), zap.Error(err))
+		info.Error = s.formatNetworkError(err)
+		return info
+	}
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true, // 证书在下面手动校验
+		MinVersion:         tls.VersionTLS10,
+	})
+	defer conn.Close()
+	if err := conn.HandshakeContext(dialCtx); err != nil {
+		logger.Warn("读取证书信息失败", zap.String("host", host), zap.Error(err))
+		info.Error = s.formatNetworkError(err)
+		return info
+	}
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		info.Error = "服务器未返回证书"
+		return info
+	}
+
+	leaf := state.PeerCertificates[0]
+	info.Subject = leaf.Subject.CommonName
+	info.Issuer = leaf.Issuer.CommonName
+	if info.Issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		info.Issuer = leaf.Issuer.Organization[0]
+	}
+	info.SANs = leaf.DNSNames
+	info.NotBefore = leaf.NotBefore
+	info.NotAfter = leaf.NotAfter
+	info.Version = tls.VersionName(state.Version)
+	info.WeakProtocol = state.Version < tls.VersionTLS12
+
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, models.TLSCertificate{
+			Subject:  cert.Subject.CommonName,
+			Issuer:   cert.Issuer.CommonName,
+			NotAfter: cert.NotAfter,
+		})
+	}
+
+	now := time.Now()
+	info.DaysRemaining = int(leaf.NotAfter.Sub(now).Hours() / 24)
+	info.Expired = now.After(leaf.NotAfter)
+	info.ExpiringSoon = !info.Expired && leaf.NotAfter.Before(now.AddDate(0, 0, tlsExpiryWarnDays()))
+	info.HostnameMismatch = leaf.VerifyHostname(host) != nil
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	info.Trusted = err == nil
+	if err != nil {
+		info.VerifyError = err.Error()
+	}
+
+	return info
+}
+
+// tlsIssueFilter 生成证书问题的查询条件，days 为到期预警天数
+func tlsIssueFilter(issue string, days int) (bson.M, error) {
+	now := time.Now()
+	expiring := bson.M{"tls.not_after": bson.M{"$gte": now, "$lt": now.AddDate(0, 0, days)}}
+	expired := bson.M{"tls.not_after": bson.M{"$lt": now}}
+	mismatch := bson.M{"tls.hostname_mismatch": true}
+	weak := bson.M{"tls.weak_protocol": true}
+	untrusted := bson.M{"tls.trusted": false, "tls.not_after": bson.M{"$exists": true}}
+
+	switch issue {
+	case models.TLSIssueExpiring:
+		return expiring, nil
+	case models.TLSIssueExpired:
+		return expired, nil
+	case models.TLSIssueHostnameMismatch:
+		return mismatch, nil
+	case models.TLSIssueWeakProtocol:
+		return weak, nil
+	case models.TLSIssueUntrusted:
+		return untrusted, nil
+	case models.TLSIssueAny:
+		return bson.M{"$or": []bson.M{expiring, expired, mismatch, weak, untrusted}}, nil
+	}
+	return nil, errors.NewError("无效的证书问题类型", http.StatusBadRequest)
+}
+
+// getTLSStatistics 统计证书状态，到期预警按当前时间实时计算
+func (s *ExternalLinkService) getTLSStatistics(ctx context.Context, match bson.M) (models.TLSStatistics, error) {
+	days := tlsExpiryWarnDays()
+	now := time.Now()
+	stats := models.TLSStatistics{WindowDays: days}
+
+	countIf := func(cond interface{}) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": []interface{}{cond, 1, 0}}}
+	}
+	pipeline := []bson.M{
+		{"$match": mergeFilter(match, bson.M{"tls.not_after": bson.M{"$exists": true}})},
+		{"$group": bson.M{
+			"_id":       nil,
+			"monitored": bson.M{"$sum": 1},
+			"expiring_soon": countIf(bson.M{"$and": []interface{}{
+				bson.M{"$gte": []interface{}{"$tls.not_after", now}},
+				bson.M{"$lt": []interface{}{"$tls.not_after", now.AddDate(0, 0, days)}},
+			}}),
+			"expired":           countIf(bson.M{"$lt": []interface{}{"$tls.not_after", now}}),
+			"hostname_mismatch": countIf(bson.M{"$eq": []interface{}{"$tls.hostname_mismatch", true}}),
+			"weak_protocol":     countIf(bson.M{"$eq": []interface{}{"$tls.weak_protocol", true}}),
+			"untrusted":         countIf(bson.M{"$eq": []interface{}{"$tls.trusted", false}}),
+		}},
+	}
+
+	cursor, err := s.db.Collection("external_links").Aggregate(ctx, pipeline)
+	if err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Monitored        int `bson:"monitored"`
+		ExpiringSoon     int `bson:"expiring_soon"`
+		Expired          int `bson:"expired"`
+		HostnameMismatch int `bson:"hostname_mismatch"`
+		WeakProtocol     int `bson:"weak_protocol"`
+		Untrusted        int `bson:"untrusted"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return stats, err
+	}
+	if len(rows) > 0 {
+		stats.Monitored = rows[0].Monitored
+		stats.ExpiringSoon = rows[0].ExpiringSoon
+		stats.Expired = rows[0].Expired
+		stats.HostnameMismatch = rows[0].HostnameMismatch
+		stats.WeakProtocol = rows[0].WeakProtocol
+		stats.Untrusted = rows[0].Untrusted
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// geoIPRange 一段 IP 地址区间，地址统一为 16 字节形式以便比较
+type geoIPRange struct {
+	start   net.IP
+	end     net.IP
+	country string
+}
+
+// GeoIPResolver 基于本地 CSV 文件的 IP 归属国家查询
+// 文件每行格式为 起始IP,结束IP,国家代码（如 DB-IP Lite 的 country 数据），IPv4 与 IPv6 可混合
+type GeoIPResolver struct {
+	ranges []geoIPRange
+}
+
+// LoadGeoIPFile 加载 GeoIP 文件，path 为空时返回不做任何解析的查询器
+func LoadGeoIPFile(path string) (*GeoIPResolver, error) {
+	resolver := &GeoIPResolver{}
+	if path == "" {
+		return resolver, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return resolver, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return resolver, fmt.Errorf("第 %d 行解析失败: %w", line, err)
+		}
+		if len(record) < 3 {
+			continue
+		}
+		start := net.ParseIP(strings.TrimSpace(record[0]))
+		end := net.ParseIP(strings.TrimSpace(record[1]))
+		if start == nil || end == nil {
+			// 跳过表头等无法解析的行
+			continue
+		}
+		resolver.ranges = append(resolver.ranges, geoIPRange{
+			start:   start.To16(),
+			end:     end.To16(),
+			country: strings.ToUpper(strings.TrimSpace(record[2])),
+		})
+	}
+
+	sort.Slice(resolver.ranges, func(i, j int) bool {
+		return bytes.Compare(resolver.ranges[i].start, resolver.ranges[j].start) < 0
+	})
+	return resolver, nil
+}
+
+// Size 已加载的地址区间数量
+func (r *GeoIPResolver) Size() int {
+	return len(r.ranges)
+}
+
+// Country 查询 IP 所属国家代码，未知时返回空字符串
+func (r *GeoIPResolver) Country(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || len(r.ranges) == 0 {
+		return ""
+	}
+	if parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsLinkLocalUnicast() {
+		return ""
+	}
+	addr := parsed.To16()
+
+	// 找到最后一个起始地址不大于 addr 的区间
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return bytes.Compare(r.ranges[i].start, addr) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(addr, r.ranges[i].end) > 0 {
+		return ""
+	}
+	return r.ranges[i].country
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// maxAlertBackoff 重试等待时间的上限
+	maxAlertBackoff = 5 * time.Minute
+	// alertUserAgent 发送 Webhook 使用的 User-Agent
+	alertUserAgent = "vite-pluginend-alerts/1.0"
+)
+
+// Webhook 请求头，签名为 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+const (
+	AlertHeaderDelivery  = "X-Link-Alert-Delivery"
+	AlertHeaderTimestamp = "X-Link-Alert-Timestamp"
+	AlertHeaderSignature = "X-Link-Alert-Signature"
+)
+
+// alertPayload Webhook 请求体
+type alertPayload struct {
+	ID         string                  `json:"id"`
+	Test       bool                    `json:"test,omitempty"`
+	Down       int                     `json:"down"`
+	Recovered  int                     `json:"recovered"`
+	Suppressed int                     `json:"suppressed"`
+	Events     []models.LinkAlertEvent `json:"events"`
+	CreatedAt  time.Time               `json:"created_at"`
+}
+
+// SignAlertPayload 计算 Webhook 签名，接收方用同样的方式校验
+func SignAlertPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable 可重试的发送错误，其余错误直接放弃
+type retryable struct{ err error }
+
+func (e retryable) Error() string { return e.err.Error() }
+
+// deliverWithRetry 按指数退避重试发送，返回尝试次数和最后一次错误
+func (s *LinkAlertService) deliverWithRetry(ctx context.Context, send func() error) (int, error) {
+	backoff := s.config.RetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = send()
+		if err == nil {
+			return attempt, nil
+		}
+		retry, ok := err.(retryable)
+		if !ok {
+			return attempt, err
+		}
+		err = retry.err
+		if attempt >= s.config.MaxAttempts {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > maxAlertBackoff {
+			backoff = maxAlertBackoff
+		}
+	}
+}
+
+// deliveryResult 生成发送结果记录
+func deliveryResult(channel, target string, attempts int, err error) models.LinkAlertDelivery {
+	delivery := models.LinkAlertDelivery{
+		Channel:  channel,
+		Target:   target,
+		Status:   models.LinkAlertDeliverySent,
+		Attempts: attempts,
+	}
+	if err != nil {
+		delivery.Status = models.LinkAlertDeliveryFailed
+		delivery.Error = err.Error()
+		logger.Warn("告警通知发送失败", zap.String("channel", channel), zap.String("target", target), zap.Int("attempts", attempts), zap.Error(err))
+		return delivery
+	}
+	now := time.Now()
+	delivery.DeliveredAt = &now
+	return delivery
+}
+
+// sendWebhook 以 JSON 格式向 Webhook 发送摘要，网络错误、429 和 5xx 会重试
+func (s *LinkAlertService) sendWebhook(ctx context.Context, target string, digest *models.LinkAlertDigest) models.LinkAlertDelivery {
+	body, err := json.Marshal(alertPayload{
+		ID:         digest.ID.Hex(),
+		Test:       digest.Test,
+		Down:       digest.Down,
+		Recovered:  digest.Recovered,
+		Suppressed: digest.Suppressed,
+		Events:     digest.Events,
+		CreatedAt:  digest.CreatedAt,
+	})
+	if err != nil {
+		return deliveryResult(models.LinkAlertChannelWebhook, redactWebhookURL(target), 0, err)
+	}
+
+	attempts, err := s.deliverWithRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		// 每次重试重新签名，接收方可以拒绝时间戳过旧的请求
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", alertUserAgent)
+		req.Header.Set(AlertHeaderDelivery, digest.ID.Hex())
+		req.Header.Set(AlertHeaderTimestamp, timestamp)
+		if s.config.WebhookSecret != "" {
+			req.Header.Set(AlertHeaderSignature, SignAlertPayload(s.config.WebhookSecret, timestamp, body))
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return retryable{err}
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("Webhook 返回状态码 %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return retryable{err}
+		}
+		return err
+	})
+	return deliveryResult(models.LinkAlertChannelWebhook, redactWebhookURL(target), attempts, err)
+}
+
+// redactWebhookURL 去掉地址中的用户信息和查询参数，避免在发送记录中暴露令牌
+func redactWebhookURL(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "invalid-url"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// sendEmail 通过 SMTP 发送纯文本摘要邮件，连接失败和 4xx 临时错误会重试
+func (s *LinkAlertService) sendEmail(ctx context.Context, digest *models.LinkAlertDigest) models.LinkAlertDelivery {
+	cfg := s.config.SMTP
+	message := buildAlertEmail(cfg.From, cfg.To, digest)
+	attempts, err := s.deliverWithRetry(ctx, func() error {
+		return sendSMTP(cfg, message)
+	})
+	return deliveryResult(models.LinkAlertChannelEmail, strings.Join(cfg.To, ","), attempts, err)
+}
+
+// sendSMTP 发送一封邮件，端口为 465 时使用隐式 TLS，否则在服务器支持时升级 STARTTLS
+func sendSMTP(cfg SMTPConfig, message []byte) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: timeout}
+	if cfg.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return retryable{err}
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return retryable{err}
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && cfg.Port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return smtpError(err)
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return smtpError(err)
+		}
+	}
+	if err := client.Mail(cfg.From); err != nil {
+		return smtpError(err)
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return smtpError(err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return retryable{err}
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	return client.Quit()
+}
+
+// smtpError 4xx 响应表示临时失败可以重试，5xx 为永久失败
+func smtpError(err error) error {
+	var protoErr *textproto.Error
+	if stderrors.As(err, &protoErr) {
+		if protoErr.Code >= 400 && protoErr.Code < 500 {
+			return retryable{err}
+		}
+		return err
+	}
+	var netErr net.Error
+	if stderrors.As(err, &netErr) {
+		return retryable{err}
+	}
+	return err
+}
+
+// buildAlertEmail 生成邮件内容，标题按 RFC 2047 编码，正文使用 base64
+func buildAlertEmail(from string, to []string, digest *models.LinkAlertDigest) []byte {
+	subject := fmt.Sprintf("[外链告警] %d 个链接不可用，%d 个链接已恢复", digest.Down, digest.Recovered)
+	if digest.Test {
+		subject = "[外链告警] 测试通知"
+	}
+
+	var body strings.Builder
+	for _, event := range digest.Events {
+		if event.Type == models.LinkAlertDown {
+			fmt.Fprintf(&body, "[不可用] %s\n", event.URL)
+			fmt.Fprintf(&body, "  连续失败 %d 次", event.ConsecutiveFailures)
+			if event.StatusCode > 0 {
+				fmt.Fprintf(&body, "，状态码 %d", event.StatusCode)
+			}
+			if event.ErrorMessage != "" {
+				fmt.Fprintf(&body, "，%s", event.ErrorMessage)
+			}
+			body.WriteString("\n")
+		} else {
+			fmt.Fprintf(&body, "[已恢复] %s\n", event.URL)
+		}
+		if event.Title != "" {
+			fmt.Fprintf(&body, "  %s\n", event.Title)
+		}
+		fmt.Fprintf(&body, "  %s\n\n", event.OccurredAt.Format(time.RFC3339))
+	}
+	if digest.Suppressed > 0 {
+		fmt.Fprintf(&body, "另有 %d 个重复的状态变化已合并。\n", digest.Suppressed)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", digest.CreatedAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@link-alerts>\r\n", digest.ID.Hex())
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body.String()))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes()
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// LinkAlertConfig 链接告警配置
+type LinkAlertConfig struct {
+	Enabled          bool          // 是否记录状态变化事件并发送通知
+	FailureThreshold int           // 连续失败多少次后告警
+	DigestWindow     time.Duration // 摘要发送间隔，窗口内的事件合并为一次通知
+	MaxDigestEvents  int           // 单个摘要最多包含的事件数，超出的留到下一个窗口
+	Retention        time.Duration // 事件和摘要的保留时长
+
+	Webhooks       []string      // 接收通知的 Webhook 地址
+	WebhookSecret  string        // 签名密钥，为空时不签名
+	WebhookTimeout time.Duration // 单次请求超时时间
+	MaxAttempts    int           // 每个渠道最多尝试次数
+	RetryBackoff   time.Duration // 首次重试前的等待时间，之后每次翻倍
+
+	SMTP SMTPConfig
+}
+
+// SMTPConfig 邮件通知配置，Host 为空时不发送邮件
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	Timeout  time.Duration
+}
+
+// LinkAlertService 链接状态变化检测与告警通知服务
+type LinkAlertService struct {
+	db     *mongo.Database
+	config LinkAlertConfig
+	client *http.Client
+}
+
+// NewLinkAlertService 创建告警服务实例
+func NewLinkAlertService(db *mongo.Database, config LinkAlertConfig) *LinkAlertService {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 1
+	}
+	if config.DigestWindow <= 0 {
+		config.DigestWindow = time.Minute
+	}
+	if config.MaxDigestEvents < 1 {
+		config.MaxDigestEvents = 100
+	}
+	if config.Retention <= 0 {
+		config.Retention = 90 * 24 * time.Hour
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	if config.SMTP.Port == 0 {
+		config.SMTP.Port = 25
+	}
+	return &LinkAlertService{
+		db:     db,
+		config: config,
+		client: &http.Client{Timeout: config.WebhookTimeout},
+	}
+}
+
+// DigestWindow 摘要发送间隔
+func (s *LinkAlertService) DigestWindow() time.Duration {
+	return s.config.DigestWindow
+}
+
+// Enabled 是否启用告警
+func (s *LinkAlertService) Enabled() bool {
+	return s.config.Enabled
+}
+
+// EnsureIndexes 创建事件和摘要集合的索引，按保留时长自动清理
+func (s *LinkAlertService) EnsureIndexes(ctx context.Context) error {
+	ttl := int32(s.config.Retention.Seconds())
+	if _, err := s.db.Collection("link_alert_events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "digest_id", Value: 1}, {Key: "occurred_at", Value: 1}}},
+		{Keys: bson.D{{Key: "link_id", Value: 1}, {Key: "occurred_at", Value: -1}}},
+		{Keys: bson.D{{Key: "occurred_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(ttl)},
+	}); err != nil {
+		return err
+	}
+	_, err := s.db.Collection("link_alert_digests").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(ttl),
+	})
+	return err
+}
+
+// ConfigureAlerts 设置告警服务，检测结果写入后据此判断链接状态是否变化
+func (s *ExternalLinkService) ConfigureAlerts(alerts *LinkAlertService) {
+	s.alerts = alerts
+}
+
+// observe 根据本次检测后的连续失败次数和告警状态生成事件
+// 告警状态用条件更新切换，多个实例同时检测同一链接也只会产生一个事件
+func (s *LinkAlertService) observe(link models.ExternalLink, result models.LinkCheckResult, failures int, state string) {
+	if !s.config.Enabled {
+		return
+	}
+
+	var eventType string
+	var filter, update bson.M
+	switch {
+	case !result.IsValid && failures >= s.config.FailureThreshold && state != models.LinkAlertDown:
+		eventType = models.LinkAlertDown
+		filter = bson.M{"_id": link.ID, "alert_state": bson.M{"$ne": models.LinkAlertDown}}
+		update = bson.M{"$set": bson.M{"alert_state": models.LinkAlertDown}}
+	case result.IsValid && state == models.LinkAlertDown:
+		eventType = models.LinkAlertRecovered
+		filter = bson.M{"_id": link.ID, "alert_state": models.LinkAlertDown}
+		update = bson.M{"$unset": bson.M{"alert_state": ""}}
+	default:
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := s.db.Collection("external_links").UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.Error("更新链接告警状态失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		return
+	}
+	if res.ModifiedCount == 0 {
+		return
+	}
+
+	event := models.LinkAlertEvent{
+		LinkID:              link.ID,
+		URL:                 link.URL,
+		Title:               link.Title,
+		Type:                eventType,
+		ConsecutiveFailures: failures,
+		StatusCode:          result.StatusCode,
+		ErrorClass:          result.ErrorClass,
+		ErrorMessage:        result.ErrorMessage,
+		OccurredAt:          result.CheckedAt,
+	}
+	if _, err := s.db.Collection("link_alert_events").InsertOne(ctx, event); err != nil {
+		logger.Error("保存告警事件失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		return
+	}
+	logger.Info("链接状态变化", zap.String("url", link.URL), zap.String("type", eventType), zap.Int("failures", failures))
+}
+
+// DispatchDigest 将待发送的事件合并为一个摘要并发送，没有待发送事件时返回 nil
+// 所有渠道都发送失败时释放事件，留到下一个窗口重新发送
+// 调用方需保证同一时间只有一个实例在发送
+func (s *LinkAlertService) DispatchDigest(ctx context.Context) (*models.LinkAlertDigest, error) {
+	events := s.db.Collection("link_alert_events")
+	cursor, err := events.Find(ctx, bson.M{"digest_id": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "occurred_at", Value: 1}}).SetLimit(int64(s.config.MaxDigestEvents)))
+	if err != nil {
+		return nil, err
+	}
+	var pending []models.LinkAlertEvent
+	if err := cursor.All(ctx, &pending); err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	digest := newLinkAlertDigest(pending)
+	ids := make([]primitive.ObjectID, len(pending))
+	for i, event := range pending {
+		ids[i] = event.ID
+	}
+	// 先写入摘要并认领事件，发送过程中重启不会重复通知
+	if _, err := s.db.Collection("link_alert_digests").InsertOne(ctx, digest); err != nil {
+		return nil, err
+	}
+	if _, err := events.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"digest_id": digest.ID}}); err != nil {
+		return nil, err
+	}
+
+	s.deliverDigest(ctx, digest)
+	if deliveryFailed(digest.Deliveries) {
+		s.requeueDigest(digest)
+	}
+	return digest, nil
+}
+
+// deliveryFailed 是否所有渠道都发送失败，没有配置渠道时不算失败
+func deliveryFailed(deliveries []models.LinkAlertDelivery) bool {
+	for _, delivery := range deliveries {
+		if delivery.Status == models.LinkAlertDeliverySent {
+			return false
+		}
+	}
+	return len(deliveries) > 0
+}
+
+// requeueDigest 释放摘要认领的事件并标记摘要已退回
+// 部分渠道成功时不退回，避免已收到通知的渠道重复收到
+func (s *LinkAlertService) requeueDigest(digest *models.LinkAlertDigest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.db.Collection("link_alert_events").UpdateMany(ctx, bson.M{"digest_id": digest.ID},
+		bson.M{"$unset": bson.M{"digest_id": ""}}); err != nil {
+		logger.Error("退回告警事件失败", zap.String("digest_id", digest.ID.Hex()), zap.Error(err))
+		return
+	}
+	digest.Requeued = true
+	if _, err := s.db.Collection("link_alert_digests").UpdateOne(ctx, bson.M{"_id": digest.ID},
+		bson.M{"$set": bson.M{"requeued": true}}); err != nil {
+		logger.Error("保存告警摘要状态失败", zap.String("digest_id", digest.ID.Hex()), zap.Error(err))
+	}
+}
+
+// SendTestAlert 向所有渠道发送一条测试摘要，用于验证 Webhook 和邮件配置
+func (s *LinkAlertService) SendTestAlert(ctx context.Context) (*models.LinkAlertDigest, error) {
+	if len(s.config.Webhooks) == 0 && s.config.SMTP.Host == "" {
+		return nil, errors.NewError("未配置告警通知渠道", http.StatusBadRequest)
+	}
+	digest := newLinkAlertDigest([]models.LinkAlertEvent{{
+		ID:                  primitive.NewObjectID(),
+		URL:                 "https://example.com/",
+		Title:               "告警测试",
+		Type:                models.LinkAlertDown,
+		ConsecutiveFailures: s.config.FailureThreshold,
+		ErrorMessage:        "这是一条测试告警",
+		OccurredAt:          time.Now(),
+	}})
+	digest.Test = true
+	if _, err := s.db.Collection("link_alert_digests").InsertOne(ctx, digest); err != nil {
+		logger.Error("保存告警摘要失败", zap.Error(err))
+		return nil, errors.NewError("保存告警摘要失败", http.StatusInternalServerError)
+	}
+	s.deliverDigest(ctx, digest)
+	return digest, nil
+}
+
+// newLinkAlertDigest 合并事件，同一链接保留第一次和最后一次状态变化
+// 两者类型相同时中间的变化互相抵消，只保留最后一次；不同时两次都保留，不可用后又恢复的链接两次变化都会通知
+func newLinkAlertDigest(events []models.LinkAlertEvent) *models.LinkAlertDigest {
+	digest := &models.LinkAlertDigest{
+		ID:         primitive.NewObjectID(),
+		Events:     []models.LinkAlertEvent{},
+		Deliveries: []models.LinkAlertDelivery{},
+		CreatedAt:  time.Now(),
+	}
+	var order []primitive.ObjectID
+	first := make(map[primitive.ObjectID]models.LinkAlertEvent)
+	last := make(map[primitive.ObjectID]models.LinkAlertEvent)
+	counts := make(map[primitive.ObjectID]int)
+	for _, event := range events {
+		if _, ok := first[event.LinkID]; !ok {
+			first[event.LinkID] = event
+			order = append(order, event.LinkID)
+		}
+		last[event.LinkID] = event
+		counts[event.LinkID]++
+	}
+	for _, linkID := range order {
+		kept := 1
+		if counts[linkID] > 1 && first[linkID].Type != last[linkID].Type {
+			digest.Events = append(digest.Events, first[linkID])
+			kept++
+		}
+		digest.Events = append(digest.Events, last[linkID])
+		digest.Suppressed += counts[linkID] - kept
+	}
+	for _, event := range digest.Events {
+		if event.Type == models.LinkAlertDown {
+			digest.Down++
+		} else {
+			digest.Recovered++
+		}
+	}
+	return digest
+}
+
+// deliverDigest 向各渠道发送摘要并保存发送结果
+func (s *LinkAlertService) deliverDigest(ctx context.Context, digest *models.LinkAlertDigest) {
+	for _, target := range s.config.Webhooks {
+		digest.Deliveries = append(digest.Deliveries, s.sendWebhook(ctx, target, digest))
+	}
+	if s.config.SMTP.Host != "" && len(s.config.SMTP.To) > 0 {
+		digest.Deliveries = append(digest.Deliveries, s.sendEmail(ctx, digest))
+	}
+
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.db.Collection("link_alert_digests").UpdateOne(dbCtx, bson.M{"_id": digest.ID},
+		bson.M{"$set": bson.M{"deliveries": digest.Deliveries}}); err != nil {
+		logger.Error("保存告警发送结果失败", zap.String("digest_id", digest.ID.Hex()), zap.Error(err))
+	}
+}
+
+// ListEvents 获取最近的告警事件，pending 为 true 时只返回尚未发送的
+func (s *LinkAlertService) ListEvents(ctx context.Context, pending *bool, limit int) ([]models.LinkAlertEvent, error) {
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	filter := bson.M{}
+	if pending != nil {
+		filter["digest_id"] = bson.M{"$exists": !*pending}
+	}
+
+	cursor, err := s.db.Collection("link_alert_events").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "occurred_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		logger.Error("获取告警事件失败", zap.Error(err))
+		return nil, errors.NewError("获取告警事件失败", http.StatusInternalServerError)
+	}
+	events := []models.LinkAlertEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		logger.Error("解析告警事件失败", zap.Error(err))
+		return nil, errors.NewError("解析告警事件失败", http.StatusInternalServerError)
+	}
+	return events, nil
+}
+
+// ListDigests 获取最近发送的告警摘要及各渠道的发送结果
+func (s *LinkAlertService) ListDigests(ctx context.Context, limit int) ([]models.LinkAlertDigest, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	cursor, err := s.db.Collection("link_alert_digests").Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		logger.Error("获取告警摘要失败", zap.Error(err))
+		return nil, errors.NewError("获取告警摘要失败", http.StatusInternalServerError)
+	}
+	digests := []models.LinkAlertDigest{}
+	if err := cursor.All(ctx, &digests); err != nil {
+		logger.Error("解析告警摘要失败", zap.Error(err))
+		return nil, errors.NewError("解析告警摘要失败", http.StatusInternalServerError)
+	}
+	return digests, nil
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"vite-pluginend/internal/models"
+)
+
+func newTestAlertService(cfg LinkAlertConfig) *LinkAlertService {
+	cfg.MaxAttempts = 3
+	cfg.RetryBackoff = time.Millisecond
+	cfg.WebhookTimeout = 5 * time.Second
+	return NewLinkAlertService(nil, cfg)
+}
+
+func testDigest() *models.LinkAlertDigest {
+	return newLinkAlertDigest([]models.LinkAlertEvent{{
+		ID:         primitive.NewObjectID(),
+		LinkID:     primitive.NewObjectID(),
+		URL:        "https://example.com/",
+		Type:       models.LinkAlertDown,
+		OccurredAt: time.Now(),
+	}})
+}
+
+func TestNewLinkAlertDigestKeepsDownAndRecoveryPairs(t *testing.T) {
+	flapped, bounced, recovered := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(linkID primitive.ObjectID, eventType string, minute int) models.LinkAlertEvent {
+		return models.LinkAlertEvent{ID: primitive.NewObjectID(), LinkID: linkID, Type: eventType, OccurredAt: start.Add(time.Duration(minute) * time.Minute)}
+	}
+
+	digest := newLinkAlertDigest([]models.LinkAlertEvent{
+		event(flapped, models.LinkAlertDown, 0),
+		event(bounced, models.LinkAlertDown, 1),
+		event(flapped, models.LinkAlertRecovered, 2),
+		event(bounced, models.LinkAlertRecovered, 3),
+		event(recovered, models.LinkAlertRecovered, 4),
+		event(bounced, models.LinkAlertDown, 5),
+	})
+
+	names := map[primitive.ObjectID]string{flapped: "flapped", bounced: "bounced", recovered: "recovered"}
+	var got []string
+	for _, e := range digest.Events {
+		got = append(got, names[e.LinkID]+":"+e.Type)
+	}
+	want := []string{"flapped:down", "flapped:recovered", "bounced:down", "recovered:recovered"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	if bouncedEvent := digest.Events[2]; !bouncedEvent.OccurredAt.Equal(start.Add(5 * time.Minute)) {
+		t.Fatalf("bounced link kept event at %v, want the latest", bouncedEvent.OccurredAt)
+	}
+	if digest.Down != 2 || digest.Recovered != 2 || digest.Suppressed != 2 {
+		t.Fatalf("down/recovered/suppressed = %d/%d/%d, want 2/2/2", digest.Down, digest.Recovered, digest.Suppressed)
+	}
+}
+
+func TestSendWebhookRetriesServerErrorsAndSigns(t *testing.T) {
+	var attempts atomic.Int32
+	var signatureErr atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := SignAlertPayload("s3cret", r.Header.Get(AlertHeaderTimestamp), body)
+		if got := r.Header.Get(AlertHeaderSignature); got != want {
+			signatureErr.Store("signature = " + got + ", want " + want)
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s := newTestAlertService(LinkAlertConfig{WebhookSecret: "s3cret"})
+	delivery := s.sendWebhook(context.Background(), server.URL+"?token=secret", testDigest())
+
+	if msg := signatureErr.Load(); msg != nil {
+		t.Fatal(msg)
+	}
+	if delivery.Status != models.LinkAlertDeliverySent || delivery.Attempts != 2 {
+		t.Fatalf("delivery = %+v, want sent after 2 attempts", delivery)
+	}
+	if strings.Contains(delivery.Target, "token") {
+		t.Fatalf("target %q should not contain the query string", delivery.Target)
+	}
+}
+
+func TestSendWebhookDoesNotRetryClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s := newTestAlertService(LinkAlertConfig{})
+	delivery := s.sendWebhook(context.Background(), server.URL, testDigest())
+
+	if delivery.Status != models.LinkAlertDeliveryFailed || delivery.Attempts != 1 || attempts.Load() != 1 {
+		t.Fatalf("delivery = %+v after %d requests, want one failed attempt", delivery, attempts.Load())
+	}
+}
+
+// fakeSMTPServer 测试用 SMTP 服务器，MAIL 命令依次使用预设的响应，用完后返回 250
+type fakeSMTPServer struct {
+	ln          net.Listener
+	rcptReply   string
+	mu          sync.Mutex
+	mailReplies []string
+	messages    []string
+}
+
+func newFakeSMTPServer(t *testing.T, mailReplies ...string) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{ln: ln, rcptReply: "250 OK", mailReplies: mailReplies}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) config() SMTPConfig {
+	return SMTPConfig{Host: "127.0.0.1", Port: s.ln.Addr().(*net.TCPAddr).Port, From: "alerts@example.com", To: []string{"ops@example.com"}, Timeout: 5 * time.Second}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(strings.ToUpper(line), " ")
+		switch verb {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			s.mu.Lock()
+			reply := "250 OK"
+			if len(s.mailReplies) > 0 {
+				reply, s.mailReplies = s.mailReplies[0], s.mailReplies[1:]
+			}
+			s.mu.Unlock()
+			tp.PrintfLine("%s", reply)
+		case "RCPT":
+			tp.PrintfLine("%s", s.rcptReply)
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func TestSendEmailRetriesTemporaryFailures(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t, "451 try again later")
+	s := newTestAlertService(LinkAlertConfig{SMTP: smtpServer.config()})
+	digest := testDigest()
+
+	delivery := s.sendEmail(context.Background(), digest)
+
+	if delivery.Status != models.LinkAlertDeliverySent || delivery.Attempts != 2 {
+		t.Fatalf("delivery = %+v, want sent after 2 attempts", delivery)
+	}
+	messages := smtpServer.Messages()
+	if len(messages) != 1 || !strings.Contains(messages[0], "Message-ID: <"+digest.ID.Hex()+"@link-alerts>") {
+		t.Fatalf("messages = %q, want one message for the digest", messages)
+	}
+}
+
+func TestSendEmailGivesUpOnPermanentFailures(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t)
+	smtpServer.rcptReply = "550 no such user"
+	s := newTestAlertService(LinkAlertConfig{SMTP: smtpServer.config()})
+
+	delivery := s.sendEmail(context.Background(), testDigest())
+
+	if delivery.Status != models.LinkAlertDeliveryFailed || delivery.Attempts != 1 {
+		t.Fatalf("delivery = %+v, want one failed attempt", delivery)
+	}
+	if len(smtpServer.Messages()) != 0 {
+		t.Fatal("no message should be delivered")
+	}
+}
+
+func TestDeliveryFailedOnlyWhenEveryChannelFails(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer webhook.Close()
+	smtpServer := newFakeSMTPServer(t)
+	s := newTestAlertService(LinkAlertConfig{SMTP: smtpServer.config()})
+	digest := testDigest()
+
+	failed := s.sendWebhook(context.Background(), webhook.URL, digest)
+	sent := s.sendEmail(context.Background(), digest)
+
+	if deliveryFailed(nil) {
+		t.Fatal("a digest without channels should not be requeued")
+	}
+	if deliveryFailed([]models.LinkAlertDelivery{failed, sent}) {
+		t.Fatal("a digest delivered to one channel should not be requeued")
+	}
+	if !deliveryFailed([]models.LinkAlertDelivery{failed}) {
+		t.Fatal("a digest that failed on every channel should be requeued")
+	}
+}
@@ -0,0 +1,632 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/lock"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	linkCheckJobPageSize    = 100
+	linkCheckJobConcurrency = 3
+	linkCheckJobLockTTL     = time.Minute
+	linkCheckJobHeartbeat   = 10 * time.Second
+	linkCheckJobResumeEvery = time.Minute
+)
+
+// errJobLockLost 任务锁续约失败，任务已由其他实例接管
+var errJobLockLost = stderrors.New("检测任务锁已被其他实例接管")
+
+// LinkCheckJobService 异步批量检测任务服务
+// 任务和结果保存在 MongoDB 中，执行与 HTTP 请求解耦；
+// 实例重启或宕机后，其他实例会在锁过期后接管未完成的任务
+type LinkCheckJobService struct {
+	db          *mongo.Database
+	linkService *ExternalLinkService
+	locker      *lock.MongoLock
+
+	baseCtx context.Context
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[primitive.ObjectID]context.CancelFunc
+}
+
+// NewLinkCheckJobService 创建批量检测任务服务
+func NewLinkCheckJobService(db *mongo.Database, linkService *ExternalLinkService, locker *lock.MongoLock) *LinkCheckJobService {
+	return &LinkCheckJobService{
+		db:          db,
+		linkService: linkService,
+		locker:      locker,
+		baseCtx:     context.Background(),
+		running:     make(map[primitive.ObjectID]context.CancelFunc),
+	}
+}
+
+// Start 创建索引并定期恢复未完成的任务
+func (s *LinkCheckJobService) Start(ctx context.Context) {
+	s.baseCtx, s.stop = context.WithCancel(ctx)
+
+	_, err := s.db.Collection("link_check_job_results").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "job_id", Value: 1}, {Key: "link_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.Warn("创建检测任务结果索引失败", zap.Error(err))
+	}
+	if err := s.locker.EnsureIndexes(ctx); err != nil {
+		logger.Warn("创建检测任务锁索引失败", zap.Error(err))
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(linkCheckJobResumeEvery)
+		defer ticker.Stop()
+		for {
+			s.resumeJobs(s.baseCtx)
+			select {
+			case <-s.baseCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止所有任务，未完成的任务保持 running 状态以便之后恢复
+func (s *LinkCheckJobService) Stop() {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.wg.Wait()
+}
+
+// CreateJob 创建批量检测任务并立即在后台执行
+func (s *LinkCheckJobService) CreateJob(ctx context.Context, req models.LinkCheckJobRequest) (*models.LinkCheckJob, error) {
+	now := time.Now()
+	job := &models.LinkCheckJob{
+		Status:    models.LinkCheckJobPending,
+		CheckAll:  req.All,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if actor := LinkActorFrom(ctx); actor != nil {
+		job.CreatedBy = actor.UserID
+	}
+	if actor := restrictedActor(ctx); actor != nil {
+		job.Owners = actor.OwnerKeys()
+	}
+
+	if req.All {
+		total, err := s.db.Collection("external_links").CountDocuments(ctx, jobLinkFilter(job, bson.M{"created_at": bson.M{"$lte": now}}))
+		if err != nil {
+			logger.Error("统计外链数量失败", zap.Error(err))
+			return nil, errors.NewError("创建检测任务失败", http.StatusInternalServerError)
+		}
+		job.Total = int(total)
+	} else {
+		if len(req.IDs) == 0 {
+			return nil, errors.NewError("没有指定要检测的链接", http.StatusBadRequest)
+		}
+		seen := make(map[primitive.ObjectID]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			objectID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				logger.Warn("无效的外链ID", zap.String("id", id))
+				continue
+			}
+			if !seen[objectID] {
+				seen[objectID] = true
+				job.LinkIDs = append(job.LinkIDs, objectID)
+			}
+		}
+		if len(job.LinkIDs) == 0 {
+			return nil, errors.NewError("没有有效的外链ID", http.StatusBadRequest)
+		}
+		job.Total = len(job.LinkIDs)
+	}
+
+	if err := s.insertJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// CreateJobForLinks 为后台流程发现的链接创建检测任务，例如站点爬取
+// 后台流程没有请求上下文中的调用者，由调用方传入创建者及其访问范围
+func (s *LinkCheckJobService) CreateJobForLinks(ctx context.Context, linkIDs []primitive.ObjectID, createdBy string, owners []string) (*models.LinkCheckJob, error) {
+	if len(linkIDs) == 0 {
+		return nil, errors.NewError("没有指定要检测的链接", http.StatusBadRequest)
+	}
+
+	now := time.Now()
+	job := &models.LinkCheckJob{
+		Status:    models.LinkCheckJobPending,
+		LinkIDs:   linkIDs,
+		Owners:    owners,
+		CreatedBy: createdBy,
+		Total:     len(linkIDs),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.insertJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// insertJob 保存任务并立即在后台执行
+func (s *LinkCheckJobService) insertJob(ctx context.Context, job *models.LinkCheckJob) error {
+	result, err := s.db.Collection("link_check_jobs").InsertOne(ctx, job)
+	if err != nil {
+		logger.Error("创建检测任务失败", zap.Error(err))
+		return errors.NewError("创建检测任务失败", http.StatusInternalServerError)
+	}
+	job.ID = result.InsertedID.(primitive.ObjectID)
+
+	s.launch(job.ID)
+	return nil
+}
+
+// jobLinkFilter 将任务创建者的访问范围附加到链接查询条件
+func jobLinkFilter(job *models.LinkCheckJob, filter bson.M) bson.M {
+	if len(job.Owners) == 0 {
+		return filter
+	}
+	return andFilter(filter, ownerScope(job.Owners))
+}
+
+// GetJob 获取任务状态
+func (s *LinkCheckJobService) GetJob(ctx context.Context, id string) (*models.LinkCheckJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+	return s.loadJob(ctx, objectID)
+}
+
+// ListJobs 获取最近的任务
+func (s *LinkCheckJobService) ListJobs(ctx context.Context, limit int) ([]models.LinkCheckJob, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	cursor, err := s.db.Collection("link_check_jobs").Find(ctx, jobScope(ctx, bson.M{}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		logger.Error("获取检测任务列表失败", zap.Error(err))
+		return nil, errors.NewError("获取检测任务列表失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.LinkCheckJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		logger.Error("解析检测任务列表失败", zap.Error(err))
+		return nil, errors.NewError("解析检测任务列表失败", http.StatusInternalServerError)
+	}
+	for i := range jobs {
+		jobs[i].Percent = jobs[i].Progress()
+	}
+
+	return jobs, nil
+}
+
+// ListJobResults 分页获取任务结果，isValid 为空时返回全部
+func (s *LinkCheckJobService) ListJobResults(ctx context.Context, id string, isValid *bool, page, perPage int) (*models.LinkCheckJobResultResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 200 {
+		perPage = 50
+	}
+	if _, err := s.loadJob(ctx, objectID); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"job_id": objectID}
+	if isValid != nil {
+		filter["is_valid"] = *isValid
+	}
+
+	total, err := s.db.Collection("link_check_job_results").CountDocuments(ctx, filter)
+	if err != nil {
+		logger.Error("获取检测任务结果总数失败", zap.Error(err))
+		return nil, errors.NewError("获取检测任务结果失败", http.StatusInternalServerError)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "checked_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+	cursor, err := s.db.Collection("link_check_job_results").Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.Error("获取检测任务结果失败", zap.Error(err))
+		return nil, errors.NewError("获取检测任务结果失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.LinkCheckJobResult{}
+	if err := cursor.All(ctx, &results); err != nil {
+		logger.Error("解析检测任务结果失败", zap.Error(err))
+		return nil, errors.NewError("解析检测任务结果失败", http.StatusInternalServerError)
+	}
+
+	response := &models.LinkCheckJobResultResponse{Data: results}
+	response.Meta.Total = int(total)
+	response.Meta.PerPage = perPage
+	response.Meta.CurrentPage = page
+	response.Meta.LastPage = (int(total) + perPage - 1) / perPage
+
+	return response, nil
+}
+
+// CancelJob 取消任务
+// 未开始的任务直接标记为已取消；执行中的任务由持有者在下一次心跳时停止
+func (s *LinkCheckJobService) CancelJob(ctx context.Context, id string) (*models.LinkCheckJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+
+	now := time.Now()
+	result, err := s.db.Collection("link_check_jobs").UpdateOne(ctx,
+		jobScope(ctx, bson.M{"_id": objectID, "status": bson.M{"$in": []string{models.LinkCheckJobPending, models.LinkCheckJobRunning}}}),
+		bson.M{"$set": bson.M{"cancel_requested": true, "updated_at": now}},
+	)
+	if err != nil {
+		logger.Error("取消检测任务失败", zap.Error(err))
+		return nil, errors.NewError("取消检测任务失败", http.StatusInternalServerError)
+	}
+	if result.MatchedCount == 0 {
+		job, err := s.loadJob(ctx, objectID)
+		if err != nil {
+			return nil, err
+		}
+		return job, errors.NewError("任务已结束，无法取消", http.StatusConflict)
+	}
+
+	_, err = s.db.Collection("link_check_jobs").UpdateOne(ctx,
+		bson.M{"_id": objectID, "status": models.LinkCheckJobPending},
+		bson.M{"$set": bson.M{"status": models.LinkCheckJobCancelled, "finished_at": now}},
+	)
+	if err != nil {
+		logger.Error("取消检测任务失败", zap.Error(err))
+	}
+
+	s.mu.Lock()
+	if cancel, ok := s.running[objectID]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	return s.loadJob(ctx, objectID)
+}
+
+func (s *LinkCheckJobService) loadJob(ctx context.Context, id primitive.ObjectID) (*models.LinkCheckJob, error) {
+	var job models.LinkCheckJob
+	err := s.db.Collection("link_check_jobs").FindOne(ctx, jobScope(ctx, bson.M{"_id": id})).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("检测任务不存在", http.StatusNotFound)
+		}
+		logger.Error("获取检测任务失败", zap.Error(err))
+		return nil, errors.NewError("获取检测任务失败", http.StatusInternalServerError)
+	}
+	job.Percent = job.Progress()
+	return &job, nil
+}
+
+// resumeJobs 接管未完成且没有被其他实例持有的任务
+func (s *LinkCheckJobService) resumeJobs(ctx context.Context) {
+	cursor, err := s.db.Collection("link_check_jobs").Find(ctx,
+		bson.M{"status": bson.M{"$in": []string{models.LinkCheckJobPending, models.LinkCheckJobRunning}}},
+		options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("查询未完成检测任务失败", zap.Error(err))
+		}
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var jobs []models.LinkCheckJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		logger.Error("解析未完成检测任务失败", zap.Error(err))
+		return
+	}
+
+	for _, job := range jobs {
+		s.launch(job.ID)
+	}
+}
+
+// launch 在后台执行任务，本实例已在执行时忽略
+func (s *LinkCheckJobService) launch(id primitive.ObjectID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.running[id]; ok {
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(s.baseCtx)
+	s.running[id] = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, id)
+			s.mu.Unlock()
+			cancel()
+		}()
+		s.run(jobCtx, id)
+	}()
+}
+
+// run 执行任务，已完成结果的链接会被跳过，因此可以安全地重复执行
+func (s *LinkCheckJobService) run(ctx context.Context, id primitive.ObjectID) {
+	lockKey := "check-job:" + id.Hex()
+	ok, err := s.locker.TryAcquire(ctx, lockKey, linkCheckJobLockTTL)
+	if err != nil || !ok {
+		return
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.locker.Release(releaseCtx, lockKey)
+	}()
+
+	job, err := s.loadJob(ctx, id)
+	if err != nil || job.IsFinished() {
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go s.heartbeat(ctx, cancel, id, lockKey)
+
+	now := time.Now()
+	set := bson.M{"status": models.LinkCheckJobRunning, "worker": s.locker.Owner(), "updated_at": now}
+	if job.StartedAt == nil {
+		set["started_at"] = now
+	}
+	if _, err := s.db.Collection("link_check_jobs").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+		logger.Error("更新检测任务状态失败", zap.String("job_id", id.Hex()), zap.Error(err))
+		return
+	}
+	logger.Info("开始执行检测任务", zap.String("job_id", id.Hex()), zap.Int("total", job.Total), zap.Int("processed", job.Processed))
+
+	runErr := s.processLinks(ctx, job)
+
+	// 服务关闭导致的中断保持 running 状态，由下次启动或其他实例恢复
+	if s.baseCtx.Err() != nil {
+		logger.Info("服务关闭，检测任务将在之后恢复", zap.String("job_id", id.Hex()))
+		return
+	}
+	// 锁已被其他实例接管时任务仍在执行，不能修改任务状态
+	if stderrors.Is(context.Cause(ctx), errJobLockLost) {
+		logger.Warn("检测任务已由其他实例接管，停止执行", zap.String("job_id", id.Hex()))
+		return
+	}
+
+	finishCtx, finishCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer finishCancel()
+
+	latest, err := s.loadJob(finishCtx, id)
+	if err != nil {
+		return
+	}
+
+	finished := time.Now()
+	update := bson.M{"finished_at": finished, "updated_at": finished}
+	switch {
+	case latest.CancelRequested:
+		update["status"] = models.LinkCheckJobCancelled
+	case runErr != nil:
+		update["status"] = models.LinkCheckJobFailed
+		update["error"] = runErr.Error()
+	default:
+		update["status"] = models.LinkCheckJobCompleted
+		// 执行期间被删除的链接不会产生结果
+		if latest.Processed < latest.Total {
+			update["total"] = latest.Processed
+		}
+	}
+
+	if _, err := s.db.Collection("link_check_jobs").UpdateOne(finishCtx, bson.M{"_id": id}, bson.M{"$set": update}); err != nil {
+		logger.Error("更新检测任务状态失败", zap.String("job_id", id.Hex()), zap.Error(err))
+	}
+	logger.Info("检测任务结束", zap.String("job_id", id.Hex()), zap.Any("status", update["status"]))
+}
+
+// heartbeat 定期续约任务锁并检查取消标记，锁被其他实例接管时以 errJobLockLost 取消执行
+func (s *LinkCheckJobService) heartbeat(ctx context.Context, cancel context.CancelCauseFunc, id primitive.ObjectID, lockKey string) {
+	ticker := time.NewTicker(linkCheckJobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if ok, err := s.locker.TryAcquire(ctx, lockKey, linkCheckJobLockTTL); err == nil && !ok {
+			logger.Warn("检测任务锁已被其他实例接管", zap.String("job_id", id.Hex()))
+			cancel(errJobLockLost)
+			return
+		}
+
+		var job models.LinkCheckJob
+		err := s.db.Collection("link_check_jobs").FindOne(ctx, bson.M{"_id": id},
+			options.FindOne().SetProjection(bson.M{"cancel_requested": 1})).Decode(&job)
+		if err == nil && job.CancelRequested {
+			cancel(nil)
+			return
+		}
+	}
+}
+
+// processLinks 按 _id 顺序分页处理任务中的链接
+func (s *LinkCheckJobService) processLinks(ctx context.Context, job *models.LinkCheckJob) error {
+	lastID := primitive.NilObjectID
+
+	for ctx.Err() == nil {
+		filter := bson.M{"_id": bson.M{"$gt": lastID}}
+		if job.CheckAll {
+			filter["created_at"] = bson.M{"$lte": job.CreatedAt}
+		} else {
+			filter["_id"] = bson.M{"$gt": lastID, "$in": job.LinkIDs}
+		}
+
+		cursor, err := s.db.Collection("external_links").Find(ctx, jobLinkFilter(job, filter),
+			options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(linkCheckJobPageSize))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.Error("获取检测任务链接失败", zap.String("job_id", job.ID.Hex()), zap.Error(err))
+			return err
+		}
+		var links []models.ExternalLink
+		err = cursor.All(ctx, &links)
+		cursor.Close(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		lastID = links[len(links)-1].ID
+
+		pending, err := s.filterUnprocessed(ctx, job.ID, links)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, linkCheckJobConcurrency)
+		for _, link := range pending {
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(l models.ExternalLink) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				result, page := s.linkService.checkLinkAvailability(ctx, l)
+				// 被取消时正在进行的请求结果不可信，不写入
+				if ctx.Err() != nil {
+					return
+				}
+				s.linkService.recordCheckResult(l, result, models.LinkCheckSourceJob)
+				s.saveResult(job.ID, l, result)
+				s.linkService.enrichMetadata(ctx, l, result, page)
+			}(link)
+		}
+		wg.Wait()
+	}
+
+	return nil
+}
+
+// filterUnprocessed 过滤掉已经有结果的链接
+func (s *LinkCheckJobService) filterUnprocessed(ctx context.Context, jobID primitive.ObjectID, links []models.ExternalLink) ([]models.ExternalLink, error) {
+	ids := make([]primitive.ObjectID, len(links))
+	for i, link := range links {
+		ids[i] = link.ID
+	}
+
+	cursor, err := s.db.Collection("link_check_job_results").Find(ctx,
+		bson.M{"job_id": jobID, "link_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"link_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var done []models.LinkCheckJobResult
+	if err := cursor.All(ctx, &done); err != nil {
+		return nil, err
+	}
+
+	processed := make(map[primitive.ObjectID]bool, len(done))
+	for _, result := range done {
+		processed[result.LinkID] = true
+	}
+
+	pending := make([]models.ExternalLink, 0, len(links))
+	for _, link := range links {
+		if !processed[link.ID] {
+			pending = append(pending, link)
+		}
+	}
+	return pending, nil
+}
+
+// saveResult 保存单个结果并更新任务进度，重复结果由唯一索引拦截
+func (s *LinkCheckJobService) saveResult(jobID primitive.ObjectID, link models.ExternalLink, result models.LinkCheckResult) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.db.Collection("link_check_job_results").InsertOne(dbCtx, models.LinkCheckJobResult{
+		JobID:        jobID,
+		LinkID:       link.ID,
+		URL:          link.URL,
+		IsValid:      result.IsValid,
+		Skipped:      result.Skipped,
+		Message:      result.Message,
+		ErrorMessage: result.ErrorMessage,
+		ErrorClass:   result.ErrorClass,
+		FoundOn:      link.FoundOn,
+		CheckedAt:    result.CheckedAt,
+	})
+	if err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			logger.Error("保存检测任务结果失败", zap.String("job_id", jobID.Hex()), zap.Error(err))
+		}
+		return
+	}
+
+	inc := bson.M{"processed": 1}
+	if result.Skipped {
+		inc["skipped"] = 1
+	} else if result.IsValid {
+		inc["valid"] = 1
+	} else {
+		inc["invalid"] = 1
+	}
+	_, err = s.db.Collection("link_check_jobs").UpdateOne(dbCtx, bson.M{"_id": jobID},
+		bson.M{"$inc": inc, "$set": bson.M{"updated_at": time.Now()}})
+	if err != nil {
+		logger.Error("更新检测任务进度失败", zap.String("job_id", jobID.Hex()), zap.Error(err))
+	}
+}
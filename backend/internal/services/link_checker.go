@@ -0,0 +1,696 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// defaultMaxRedirects 单次检测最多跟随的重定向次数
+	defaultMaxRedirects = 10
+	// proxyProfileSuffix 经代理检测时追加在策略名称后的后缀
+	proxyProfileSuffix = "+proxy"
+)
+
+var (
+	// errTooManyRedirects 重定向次数超过上限
+	errTooManyRedirects = stderrors.New("重定向次数过多")
+	// errRedirectLoop 重定向回到了本次检测已经访问过的地址
+	errRedirectLoop = stderrors.New("重定向循环")
+	// errInvalidCheckRequest 链接地址无法构造请求
+	errInvalidCheckRequest = stderrors.New("创建请求失败")
+	// errNoAllowedMethod 域名策略不允许检测策略使用的任何请求方式
+	errNoAllowedMethod = stderrors.New("域名策略没有允许的检测方法")
+)
+
+// Clock 检测使用的时钟，替换后模拟用户的等待和耗时统计不再依赖真实时间
+type Clock interface {
+	Now() time.Time
+	// Sleep 等待指定时长，ctx 取消时提前返回 ctx 的错误
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// systemClock 使用系统时间的时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// LinkCheckerConfig 链接检测配置，所有检测策略共享同一个传输层
+type LinkCheckerConfig struct {
+	DialTimeout           time.Duration // 建立 TCP 连接的超时时间
+	TLSHandshakeTimeout   time.Duration // TLS 握手超时时间
+	ResponseHeaderTimeout time.Duration // 等待响应头的超时时间，0 表示只受域名策略的总超时限制
+	IdleConnTimeout       time.Duration // 空闲连接保留时长
+	MaxIdleConnsPerHost   int           // 每个主机保留的空闲连接数
+	MaxRedirects          int           // 最多跟随的重定向次数
+	UserDelay             bool          // 是否在请求前模拟用户操作的随机等待，礼貌模式下始终不等待
+
+	MaxAttempts    int           // 暂时性失败时的最多请求次数，1 表示不重试
+	RetryBaseDelay time.Duration // 第一次重试前的等待时间，之后每次翻倍并加入随机抖动
+	RetryMaxDelay  time.Duration // 重试等待时间的上限
+	MaxRetryAfter  time.Duration // 服务器要求的 Retry-After 超过该值时不再重试
+
+	IPFamily      string            // 直连和连接代理时使用的 IP 协议：ipv4、ipv6 或 dual，默认 ipv4
+	Proxies       []LinkProxyConfig // 出站代理池
+	DefaultProxy  string            // 域名策略未指定代理时的选择，取值同 DomainPolicy.Proxy，为空表示直连
+	ProxyCooldown time.Duration     // 代理连接失败后暂停使用的时长
+
+	Resolver       LinkResolver  // 直连时使用的域名解析器，为空时使用系统解析
+	DNSTimeout     time.Duration // 单次解析的超时时间
+	DNSCacheTTL    time.Duration // 解析成功时的最长缓存时间，记录的 TTL 更短时以 TTL 为准
+	DNSNegativeTTL time.Duration // 解析失败时的缓存时间
+
+	// Transport 和 Clock 为空时使用按上述配置创建的传输层和系统时钟，可替换为测试用的实现
+	Transport http.RoundTripper
+	Clock     Clock
+}
+
+// LinkCheckTarget 一次检测的目标，外层策略在调用内层策略前补充请求头或代理
+type LinkCheckTarget struct {
+	URL     string
+	Policy  models.DomainPolicy
+	Headers http.Header // 追加的请求头，域名策略中的请求头优先
+	Proxy   *url.URL    // 不为空时经该代理访问
+
+	// CaptureBytes 大于 0 时直接使用 GET 请求，并保留 HTML 响应开头的这些字节，用于提取元数据和内容校验
+	CaptureBytes int64
+	// CaptureAnyType 为 true 时不限于 HTML，任何类型的响应都保留，内容校验可能要求 JSON 等类型
+	CaptureAnyType bool
+}
+
+// LinkCheckOutcome 检测策略的请求结果，状态码判定和失败策略由 ExternalLinkService 处理
+type LinkCheckOutcome struct {
+	Method     string
+	StatusCode int
+	FinalURL   string
+	Latency    time.Duration
+	Proxy      string        // 经过的代理名称，直连时为空
+	RetryAfter time.Duration // 429/503 响应中 Retry-After 要求的等待时间
+	Attempts   int
+	Redirects  []models.RedirectHop
+	Err        error
+	Client     *http.Client // 发出请求的客户端，内容校验沿用同样的传输层和代理
+	Page       *checkedPage // 目标要求保留页面内容且 GET 响应是 HTML（或不限类型）时不为空
+}
+
+// checkedPage 检测时 GET 响应开头的页面内容
+type checkedPage struct {
+	URL         *url.URL // 重定向后的最终地址
+	ContentType string
+	Body        []byte
+}
+
+// LinkChecker 链接检测策略
+type LinkChecker interface {
+	// Name 策略名称，记录在检测结果的 profile 中
+	Name() string
+	Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome
+}
+
+// LinkCheckers 检测策略集合，按名称选择策略并组合浏览器请求头、代理和用户等待
+type LinkCheckers struct {
+	cfg       LinkCheckerConfig
+	dialer    *net.Dialer
+	transport http.RoundTripper
+	clock     Clock
+	proxies   *linkProxyPool
+	dns       *dnsCache
+	intn      func(n int) int
+	wrap      func(http.RoundTripper) http.RoundTripper // 礼貌模式等对传输层的包装
+	profiles  map[string]LinkChecker
+}
+
+// NewLinkCheckers 按配置创建检测策略集合
+func NewLinkCheckers(cfg LinkCheckerConfig) *LinkCheckers {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 30 * time.Second
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = 15 * time.Second
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = 90 * time.Second
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = 4
+	}
+	if cfg.MaxRedirects <= 0 {
+		cfg.MaxRedirects = defaultMaxRedirects
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = time.Second
+	}
+	if cfg.RetryMaxDelay < cfg.RetryBaseDelay {
+		cfg.RetryMaxDelay = 30 * time.Second
+	}
+	if cfg.MaxRetryAfter <= 0 {
+		cfg.MaxRetryAfter = 2 * time.Minute
+	}
+	switch cfg.IPFamily {
+	case LinkIPv4, LinkIPv6, LinkDual:
+	default:
+		if cfg.IPFamily != "" {
+			logger.Warn("无效的检测 IP 协议配置，使用 IPv4", zap.String("ip_family", cfg.IPFamily))
+		}
+		cfg.IPFamily = LinkIPv4
+	}
+
+	c := &LinkCheckers{
+		cfg: cfg,
+		dialer: &net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		},
+		transport: cfg.Transport,
+		clock:     cfg.Clock,
+		intn:      rand.Intn,
+	}
+	if c.transport == nil {
+		c.transport = c.newTransport()
+	}
+	if c.clock == nil {
+		c.clock = systemClock{}
+	}
+	c.proxies = newLinkProxyPool(cfg, c.clock)
+	if r, ok := cfg.Resolver.(transportResolver); ok {
+		cfg.Resolver = r.withTransport(c.resolverTransport())
+		c.cfg.Resolver = cfg.Resolver
+	}
+	c.dns = newDNSCache(cfg, c.clock)
+
+	headGet := &methodChecker{name: models.LinkCheckProfileHeadGet, methods: []string{http.MethodHead, http.MethodGet}, env: c}
+	getOnly := &methodChecker{name: models.LinkCheckProfileGet, methods: []string{http.MethodGet}, env: c}
+	c.profiles = map[string]LinkChecker{
+		models.LinkCheckProfileHeadGet: headGet,
+		models.LinkCheckProfileGet:     getOnly,
+		models.LinkCheckProfileBrowser: &browserChecker{next: getOnly, env: c},
+	}
+	return c
+}
+
+// newTransport 创建检测共享的传输层，代理地址从请求的 context 中读取
+func (c *LinkCheckers) newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:                  checkProxy,
+		OnProxyConnectResponse: onProxyConnectResponse,
+		DialContext:            c.dialContext,
+		MaxIdleConns:           100,
+		MaxIdleConnsPerHost:    c.cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:        c.cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:    c.cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout:  c.cfg.ResponseHeaderTimeout,
+	}
+}
+
+// checkProxyKey 请求 context 中代理地址的键
+type checkProxyKey struct{}
+
+// checkProxy 使用请求 context 中指定的代理，未指定时直连
+func checkProxy(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(checkProxyKey{}).(*url.URL); ok && proxy != nil {
+		return proxy, nil
+	}
+	return nil, nil
+}
+
+// proxyRoundTripper 为经过的请求指定代理
+type proxyRoundTripper struct {
+	next  http.RoundTripper
+	proxy *url.URL
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (p *proxyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return p.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), checkProxyKey{}, p.proxy)))
+}
+
+// Select 按链接、域名策略、默认策略的顺序选择检测策略
+// 需要代理时依次尝试选中的代理，暂时性失败时退避重试，礼貌模式下不模拟浏览器也不等待
+func (c *LinkCheckers) Select(link models.ExternalLink, policy models.DomainPolicy, fallback string, polite bool) LinkChecker {
+	name := link.CheckProfile
+	if name == "" {
+		name = policy.CheckProfile
+	}
+	if name == "" {
+		name = fallback
+	}
+	if polite && name == models.LinkCheckProfileBrowser {
+		name = models.LinkCheckProfileHeadGet
+	}
+
+	checker, ok := c.profiles[name]
+	if !ok {
+		checker = c.profiles[models.LinkCheckProfileHeadGet]
+	}
+	if route, err := c.proxies.route(policy.Proxy); route != nil || err != nil {
+		checker = &proxyChecker{next: checker, env: c, route: route, err: err}
+	}
+	if c.cfg.MaxAttempts > 1 {
+		checker = &retryChecker{next: checker, env: c}
+	}
+	if !polite && c.cfg.UserDelay {
+		checker = &delayChecker{next: checker, env: c}
+	}
+	return checker
+}
+
+// LookupURL 解析链接的主机，主机是 IP 地址或链接无效时返回 nil
+// 域名策略要求经代理访问时由代理解析，结果只用于诊断
+func (c *LinkCheckers) LookupURL(ctx context.Context, rawURL string) *models.DNSInfo {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" || net.ParseIP(parsed.Hostname()) != nil {
+		return nil
+	}
+	info := c.dns.lookup(ctx, parsed.Hostname())
+	return &info
+}
+
+// Direct 按域名策略检测时是否直连
+func (c *LinkCheckers) Direct(policy models.DomainPolicy) bool {
+	return c.proxies.direct(policy.Proxy)
+}
+
+// Dialer 读取证书等直接建立连接时使用的拨号函数，与检测请求使用同样的代理选择和 IP 协议
+// 连接代理失败时暂停该代理并切换到下一个
+func (c *LinkCheckers) Dialer(policy models.DomainPolicy) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	route, err := c.proxies.route(policy.Proxy)
+	if err != nil {
+		return func(context.Context, string, string) (net.Conn, error) {
+			return nil, err
+		}
+	}
+	if len(route) == 0 {
+		return c.dialContext
+	}
+	return func(ctx context.Context, _, addr string) (net.Conn, error) {
+		var lastErr error
+		for _, px := range route {
+			start := c.clock.Now()
+			conn, err := c.dialVia(ctx, px.url, addr)
+			failure := proxyFailure(LinkCheckOutcome{Err: err})
+			px.record(c.clock.Now(), c.clock.Now().Sub(start), failure, c.proxies.cooldown)
+			if failure == nil {
+				return conn, err
+			}
+
+			logger.Warn("出站代理不可用，切换到下一个代理", zap.String("proxy", px.name), zap.String("addr", addr), zap.Error(failure))
+			lastErr = failure
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, fmt.Errorf("%w: %v", errProxyUnavailable, lastErr)
+	}
+}
+
+// client 创建单次检测使用的客户端，recorder 记录每一跳重定向
+func (c *LinkCheckers) client(timeout time.Duration, proxy *url.URL) (*http.Client, *redirectRecorder) {
+	transport := c.transport
+	if proxy != nil {
+		transport = &proxyRoundTripper{next: transport, proxy: proxy}
+	}
+	if c.wrap != nil {
+		transport = c.wrap(transport)
+	}
+	recorder := newRedirectRecorder(transport)
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     recorder,
+		CheckRedirect: c.checkRedirect,
+	}, recorder
+}
+
+// checkRedirect 限制重定向次数，回到已访问过的地址时立即停止
+func (c *LinkCheckers) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= c.cfg.MaxRedirects {
+		return errTooManyRedirects
+	}
+	target := req.URL.String()
+	for _, prev := range via {
+		if prev.URL.String() == target {
+			return errRedirectLoop
+		}
+	}
+	return nil
+}
+
+// methodChecker 依次使用域名策略允许的请求方式检测
+// 请求失败或服务器不支持该请求方式（405/501）时换下一种方式
+type methodChecker struct {
+	name    string
+	methods []string
+	env     *LinkCheckers
+}
+
+func (m *methodChecker) Name() string {
+	return m.name
+}
+
+func (m *methodChecker) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	client, recorder := m.env.client(target.Policy.Timeout(), target.Proxy)
+	outcome := LinkCheckOutcome{Client: client}
+
+	// 需要页面内容时直接 GET，避免先 HEAD 再 GET 或检测后再请求一次页面
+	methods := m.methods
+	if target.CaptureBytes > 0 && target.Policy.AllowsMethod(http.MethodGet) {
+		methods = []string{http.MethodGet}
+	}
+
+	start := m.env.clock.Now()
+	for _, method := range methods {
+		if !target.Policy.AllowsMethod(method) {
+			continue
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, target.URL, nil)
+		if err != nil {
+			outcome.Err = fmt.Errorf("%w: %v", errInvalidCheckRequest, err)
+			return outcome
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+		for name, values := range target.Headers {
+			req.Header[name] = values
+		}
+		applyPolicyHeaders(req, target.Policy)
+
+		recorder.reset()
+		resp, err := client.Do(req)
+		outcome.Method = method
+		outcome.Latency = m.env.clock.Now().Sub(start)
+		outcome.Redirects = recorder.hops()
+		if err != nil {
+			outcome.Err = err
+			outcome.StatusCode = 0
+			// 被 robots.txt 禁止或检测已取消时换请求方式也没有意义
+			if stderrors.Is(err, errRobotsDisallowed) || ctx.Err() != nil {
+				return outcome
+			}
+			continue
+		}
+		outcome.Page = nil
+		if target.CaptureBytes > 0 && method == http.MethodGet && (target.CaptureAnyType || isHTMLContent(resp.Header.Get("Content-Type"))) {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, target.CaptureBytes))
+			outcome.Page = &checkedPage{URL: resp.Request.URL, ContentType: resp.Header.Get("Content-Type"), Body: body}
+		}
+		resp.Body.Close()
+
+		outcome.Err = nil
+		outcome.StatusCode = resp.StatusCode
+		outcome.FinalURL = resp.Request.URL.String()
+		outcome.RetryAfter = 0
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			outcome.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), m.env.clock.Now())
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			return outcome
+		}
+	}
+
+	if outcome.Method == "" {
+		outcome.Err = errNoAllowedMethod
+	}
+	return outcome
+}
+
+// browserChecker 设置完整的浏览器请求头后交给内层策略检测
+type browserChecker struct {
+	next LinkChecker
+	env  *LinkCheckers
+}
+
+func (b *browserChecker) Name() string {
+	return models.LinkCheckProfileBrowser
+}
+
+func (b *browserChecker) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	headers := http.Header{}
+	for name, values := range target.Headers {
+		headers[name] = values
+	}
+	headers.Set("User-Agent", b.env.UserAgent())
+	headers.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
+	headers.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8,ja;q=0.7")
+	headers.Set("Cache-Control", "max-age=0")
+	headers.Set("Upgrade-Insecure-Requests", "1")
+	headers.Set("Sec-Fetch-Dest", "document")
+	headers.Set("Sec-Fetch-Mode", "navigate")
+	headers.Set("Sec-Fetch-Site", "none")
+	headers.Set("Sec-Fetch-User", "?1")
+	headers.Set("Sec-CH-UA", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
+	headers.Set("Sec-CH-UA-Mobile", "?0")
+	headers.Set("Sec-CH-UA-Platform", `"Windows"`)
+	headers.Set("DNT", "1")
+	headers.Set("Referer", "https://www.google.com/") // 模拟从Google搜索来的
+	target.Headers = headers
+
+	return b.next.Check(ctx, target)
+}
+
+// delayChecker 检测前随机等待 1-3 秒，模拟用户思考时间
+type delayChecker struct {
+	next LinkChecker
+	env  *LinkCheckers
+}
+
+func (d *delayChecker) Name() string {
+	return d.next.Name()
+}
+
+func (d *delayChecker) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	delay := time.Duration(1000+d.env.intn(2000)) * time.Millisecond
+	if err := d.env.clock.Sleep(ctx, delay); err != nil {
+		return LinkCheckOutcome{Err: err}
+	}
+	return d.next.Check(ctx, target)
+}
+
+// retryChecker 暂时性失败时按指数退避加随机抖动重试，服务器返回 Retry-After 时按其要求等待
+// 域名策略将该失败视为可用时不重试
+type retryChecker struct {
+	next LinkChecker
+	env  *LinkCheckers
+}
+
+func (r *retryChecker) Name() string {
+	return r.next.Name()
+}
+
+func (r *retryChecker) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	cfg := r.env.cfg
+	for attempt := 1; ; attempt++ {
+		outcome := r.next.Check(ctx, target)
+		outcome.Attempts = attempt
+
+		code := outcomeErrorCode(outcome, target.Policy)
+		if !code.Transient() || (outcome.Err != nil && failureIsHealthy(target.Policy, code)) || attempt >= cfg.MaxAttempts {
+			return outcome
+		}
+
+		wait := r.backoff(attempt)
+		if outcome.RetryAfter > 0 {
+			if outcome.RetryAfter > cfg.MaxRetryAfter {
+				logger.Info("Retry-After 超过上限，不再重试", zap.String("url", target.URL), zap.Duration("retry_after", outcome.RetryAfter))
+				return outcome
+			}
+			wait = outcome.RetryAfter
+		}
+		logger.Info("链接检测暂时失败，等待后重试", zap.String("url", target.URL), zap.String("error_class", string(code)),
+			zap.Int("attempt", attempt), zap.Duration("wait", wait))
+		if err := r.env.clock.Sleep(ctx, wait); err != nil {
+			return outcome
+		}
+	}
+}
+
+// backoff 第 attempt 次失败后的等待时间，在指数退避值的一半到全部之间随机
+func (r *retryChecker) backoff(attempt int) time.Duration {
+	cfg := r.env.cfg
+	delay := cfg.RetryBaseDelay
+	for i := 1; i < attempt && delay < cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > cfg.RetryMaxDelay {
+		delay = cfg.RetryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(r.env.intn(int(half)+1))
+}
+
+// parseRetryAfter 解析 Retry-After，支持秒数和 HTTP 日期两种格式，无效或已过期时返回 0
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// outcomeErrorCode 请求结果对应的失败分类，状态码符合域名策略预期时返回空
+func outcomeErrorCode(outcome LinkCheckOutcome, policy models.DomainPolicy) models.LinkErrorCode {
+	if outcome.Err != nil {
+		return classifyCheckError(outcome.Err)
+	}
+	if policy.IsExpectedStatus(outcome.StatusCode) {
+		return ""
+	}
+	return statusErrorCode(outcome.StatusCode)
+}
+
+// statusErrorCode 按状态码分类失败原因
+func statusErrorCode(status int) models.LinkErrorCode {
+	switch {
+	case status >= 200 && status < 400:
+		return models.LinkErrorUnexpectedStatus
+	case status == http.StatusTooManyRequests:
+		return models.LinkErrorRateLimited
+	case status >= 400 && status < 500:
+		return models.LinkErrorClientError
+	case status >= 500:
+		return models.LinkErrorServerError
+	}
+	return models.LinkErrorUnknownStatus
+}
+
+// failureIsHealthy 域名策略是否将该请求失败视为网站可用
+func failureIsHealthy(policy models.DomainPolicy, code models.LinkErrorCode) bool {
+	return policy.ErrorIsHealthy || (code == models.LinkErrorConnectionReset && policy.ResetIsHealthy)
+}
+
+// proxyChecker 依次经 route 中的代理检测，代理本身不可用时记录失败并切换到下一个代理
+type proxyChecker struct {
+	next  LinkChecker
+	env   *LinkCheckers
+	route []*linkProxy
+	err   error // 选择代理失败的原因
+}
+
+func (p *proxyChecker) Name() string {
+	return p.next.Name() + proxyProfileSuffix
+}
+
+func (p *proxyChecker) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	if p.err != nil {
+		return LinkCheckOutcome{Err: p.err}
+	}
+
+	var lastErr error
+	for _, px := range p.route {
+		target.Proxy = px.url
+		start := p.env.clock.Now()
+		outcome := p.next.Check(ctx, target)
+		failure := proxyFailure(outcome)
+		px.record(p.env.clock.Now(), p.env.clock.Now().Sub(start), failure, p.env.proxies.cooldown)
+		if failure == nil {
+			outcome.Proxy = px.name
+			return outcome
+		}
+
+		logger.Warn("出站代理不可用，切换到下一个代理", zap.String("proxy", px.name), zap.String("url", target.URL), zap.Error(failure))
+		lastErr = failure
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return LinkCheckOutcome{Err: fmt.Errorf("%w: %v", errProxyUnavailable, lastErr)}
+}
+
+// UserAgent 随机选择一个浏览器 User-Agent，浏览器配置和获取页面内容、元数据、图标的请求共用
+func (c *LinkCheckers) UserAgent() string {
+	return browserUserAgents[c.intn(len(browserUserAgents))]
+}
+
+// browserUserAgents 浏览器配置随机使用的 User-Agent
+var browserUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/121.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/120.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+}
+
+// validCheckProfile 检测策略名称是否有效，空字符串表示使用默认策略
+func validCheckProfile(name string) bool {
+	switch name {
+	case "", models.LinkCheckProfileHeadGet, models.LinkCheckProfileGet, models.LinkCheckProfileBrowser:
+		return true
+	}
+	return false
+}
+
+// validateProxySelector 校验域名策略中的代理选择：direct、pool、region:<地区>、代理名称或代理地址
+func validateProxySelector(selector string) error {
+	switch {
+	case selector == "", selector == models.LinkProxyDirect, selector == models.LinkProxyPool:
+		return nil
+	case strings.Contains(selector, "://"):
+		return validateProxyURL(selector)
+	case strings.HasPrefix(selector, models.LinkProxyRegionPrefix):
+		if strings.TrimPrefix(selector, models.LinkProxyRegionPrefix) == "" {
+			return errors.NewError("代理地区不能为空", http.StatusBadRequest)
+		}
+		return nil
+	case strings.ContainsAny(selector, " \t,"):
+		return errors.NewError("无效的代理名称", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// validateProxyURL 校验代理地址，支持 http、https 和 socks5
+func validateProxyURL(raw string) error {
+	proxy, err := url.Parse(raw)
+	if err != nil || proxy.Host == "" {
+		return errors.NewError("无效的代理地址", http.StatusBadRequest)
+	}
+	switch strings.ToLower(proxy.Scheme) {
+	case "http", "https", "socks5":
+		return nil
+	}
+	return errors.NewError("代理地址只支持 http、https 和 socks5", http.StatusBadRequest)
+}
@@ -0,0 +1,709 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.NewLogger()
+	os.Exit(m.Run())
+}
+
+// fakeClock 测试用时钟，Sleep 只推进时间并记录等待时长
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.Advance(d)
+	f.mu.Lock()
+	f.sleeps = append(f.sleeps, d)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+func (f *fakeClock) Sleeps() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.sleeps...)
+}
+
+// newTestCheckers 使用假时钟创建检测策略集合，随机数固定取 0
+func newTestCheckers(t *testing.T, cfg LinkCheckerConfig) (*LinkCheckers, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	cfg.Clock = clock
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 1
+	}
+	c := NewLinkCheckers(cfg)
+	c.intn = func(int) int { return 0 }
+	return c, clock
+}
+
+// testPolicy 只有默认值的域名策略，连接重置不视为可用
+func testPolicy() models.DomainPolicy {
+	return effectivePolicy(&models.DomainPolicy{TimeoutSeconds: 5})
+}
+
+func check(checker LinkChecker, rawURL string) LinkCheckOutcome {
+	return checker.Check(context.Background(), LinkCheckTarget{URL: rawURL, Policy: testPolicy()})
+}
+
+func TestMethodCheckerFallsBackToGetOn405(t *testing.T) {
+	var methods []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{})
+	outcome := check(c.profiles[models.LinkCheckProfileHeadGet], server.URL)
+
+	if outcome.Err != nil || outcome.StatusCode != http.StatusOK || outcome.Method != http.MethodGet {
+		t.Fatalf("outcome = %+v, want GET 200", outcome)
+	}
+	if len(methods) != 2 || methods[0] != http.MethodHead || methods[1] != http.MethodGet {
+		t.Fatalf("methods = %v, want [HEAD GET]", methods)
+	}
+}
+
+func TestMethodCheckerConnectionReset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		// SO_LINGER 为 0 时关闭连接发送 RST
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}))
+	defer server.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{})
+	outcome := check(c.profiles[models.LinkCheckProfileGet], server.URL)
+
+	if code := classifyCheckError(outcome.Err); code != models.LinkErrorConnectionReset {
+		t.Fatalf("error class = %q (%v), want connection_reset", code, outcome.Err)
+	}
+}
+
+func TestMethodCheckerSlowTLSHandshake(t *testing.T) {
+	// 接受连接后不进行 TLS 握手
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{TLSHandshakeTimeout: 100 * time.Millisecond})
+	outcome := check(c.profiles[models.LinkCheckProfileGet], "https://"+listener.Addr().String()+"/")
+
+	if code := classifyCheckError(outcome.Err); code != models.LinkErrorTimeout {
+		t.Fatalf("error class = %q (%v), want timeout", code, outcome.Err)
+	}
+}
+
+func TestMethodCheckerRedirectLoop(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/b", http.StatusFound) })
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/a", http.StatusFound) })
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{})
+	outcome := check(c.profiles[models.LinkCheckProfileGet], server.URL+"/a")
+
+	if !stderrors.Is(outcome.Err, errRedirectLoop) {
+		t.Fatalf("err = %v, want redirect loop", outcome.Err)
+	}
+	if code := classifyCheckError(outcome.Err); code != models.LinkErrorTooManyRedirects {
+		t.Fatalf("error class = %q, want too_many_redirects", code)
+	}
+	if len(outcome.Redirects) != 2 {
+		t.Fatalf("redirects = %+v, want 2 hops", outcome.Redirects)
+	}
+}
+
+func TestBrowserCheckerSendsBrowserHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != browserUserAgents[0] || r.Header.Get("Sec-Fetch-Mode") != "navigate" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileBrowser, false)
+	outcome := check(checker, server.URL)
+
+	if checker.Name() != models.LinkCheckProfileBrowser || outcome.StatusCode != http.StatusOK {
+		t.Fatalf("profile = %s, outcome = %+v, want browser 200", checker.Name(), outcome)
+	}
+}
+
+func TestSelectPoliteModeUsesHeadGetWithoutDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	c, clock := newTestCheckers(t, LinkCheckerConfig{UserDelay: true})
+	polite := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileBrowser, true)
+	check(polite, server.URL)
+	if polite.Name() != models.LinkCheckProfileHeadGet || len(clock.Sleeps()) != 0 {
+		t.Fatalf("polite profile = %s, sleeps = %v, want head_get without delay", polite.Name(), clock.Sleeps())
+	}
+
+	delayed := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileGet, false)
+	check(delayed, server.URL)
+	if sleeps := clock.Sleeps(); len(sleeps) != 1 || sleeps[0] != time.Second {
+		t.Fatalf("sleeps = %v, want [1s]", sleeps)
+	}
+}
+
+func TestRetryCheckerHonoursRetryAfter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, clock := newTestCheckers(t, LinkCheckerConfig{MaxAttempts: 3})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileGet, true)
+	outcome := check(checker, server.URL)
+
+	if outcome.StatusCode != http.StatusOK || outcome.Attempts != 2 {
+		t.Fatalf("outcome = %+v, want 200 after 2 attempts", outcome)
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 1 || sleeps[0] != 30*time.Second {
+		t.Fatalf("sleeps = %v, want [30s]", sleeps)
+	}
+}
+
+func TestRetryCheckerGivesUpOnLongRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c, clock := newTestCheckers(t, LinkCheckerConfig{MaxAttempts: 3, MaxRetryAfter: time.Minute})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileGet, true)
+	outcome := check(checker, server.URL)
+
+	if outcome.StatusCode != http.StatusTooManyRequests || outcome.Attempts != 1 || outcome.RetryAfter != time.Hour {
+		t.Fatalf("outcome = %+v, want a single 429 with Retry-After 1h", outcome)
+	}
+	if len(clock.Sleeps()) != 0 {
+		t.Fatalf("sleeps = %v, want none", clock.Sleeps())
+	}
+}
+
+func TestRetryCheckerBacksOffOnServerErrors(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c, clock := newTestCheckers(t, LinkCheckerConfig{MaxAttempts: 3, RetryBaseDelay: time.Second, RetryMaxDelay: 10 * time.Second})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileGet, true)
+	outcome := check(checker, server.URL)
+
+	if outcome.Attempts != 3 || requests != 3 {
+		t.Fatalf("attempts = %d, requests = %d, want 3", outcome.Attempts, requests)
+	}
+	// 抖动取 0 时等待退避值的一半
+	sleeps := clock.Sleeps()
+	if len(sleeps) != 2 || sleeps[0] != 500*time.Millisecond || sleeps[1] != time.Second {
+		t.Fatalf("sleeps = %v, want [500ms 1s]", sleeps)
+	}
+}
+
+func TestRetryCheckerDoesNotRetryPermanentFailures(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c, clock := newTestCheckers(t, LinkCheckerConfig{MaxAttempts: 3})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileGet, true)
+	outcome := check(checker, server.URL)
+
+	if outcome.Attempts != 1 || requests != 1 || len(clock.Sleeps()) != 0 {
+		t.Fatalf("attempts = %d, requests = %d, sleeps = %v, want a single attempt", outcome.Attempts, requests, clock.Sleeps())
+	}
+}
+
+// scriptedChecker 依次返回预设结果的检测器，用完后重复最后一个
+type scriptedChecker struct {
+	outcomes []LinkCheckOutcome
+	calls    int
+}
+
+func (s *scriptedChecker) Name() string {
+	return "scripted"
+}
+
+func (s *scriptedChecker) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	outcome := s.outcomes[min(s.calls, len(s.outcomes)-1)]
+	s.calls++
+	return outcome
+}
+
+func TestRetryCheckerDelaySelection(t *testing.T) {
+	unavailable := LinkCheckOutcome{StatusCode: http.StatusServiceUnavailable}
+	ok := LinkCheckOutcome{StatusCode: http.StatusOK}
+	limited := func(d time.Duration) LinkCheckOutcome {
+		return LinkCheckOutcome{StatusCode: http.StatusTooManyRequests, RetryAfter: d}
+	}
+
+	tests := []struct {
+		name      string
+		outcomes  []LinkCheckOutcome
+		maxJitter bool
+		more      bool // 允许 6 次尝试，用于观察退避上限
+		policy    func(*models.DomainPolicy)
+		attempts  int
+		sleeps    []time.Duration
+	}{
+		{name: "backoff without jitter waits half", outcomes: []LinkCheckOutcome{unavailable}, attempts: 4,
+			sleeps: []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}},
+		{name: "backoff with full jitter waits the whole delay", outcomes: []LinkCheckOutcome{unavailable}, maxJitter: true, attempts: 4,
+			sleeps: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+		{name: "backoff is capped at the max delay", outcomes: []LinkCheckOutcome{unavailable, unavailable, unavailable, unavailable, unavailable, ok}, maxJitter: true, more: true, attempts: 6,
+			sleeps: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}},
+		{name: "retry-after replaces backoff", outcomes: []LinkCheckOutcome{limited(20 * time.Second), ok}, attempts: 2,
+			sleeps: []time.Duration{20 * time.Second}},
+		{name: "retry-after at the limit is honoured", outcomes: []LinkCheckOutcome{limited(time.Minute), ok}, attempts: 2,
+			sleeps: []time.Duration{time.Minute}},
+		{name: "retry-after over the limit gives up", outcomes: []LinkCheckOutcome{limited(time.Minute + time.Second)}, attempts: 1},
+		{name: "429 without retry-after backs off", outcomes: []LinkCheckOutcome{limited(0), ok}, attempts: 2,
+			sleeps: []time.Duration{500 * time.Millisecond}},
+		{name: "permanent failure is not retried", outcomes: []LinkCheckOutcome{{StatusCode: http.StatusNotFound}}, attempts: 1},
+		{name: "expected status is not retried", outcomes: []LinkCheckOutcome{unavailable}, attempts: 1,
+			policy: func(p *models.DomainPolicy) { p.ExpectedStatusCodes = []int{http.StatusServiceUnavailable} }},
+		{name: "healthy network errors are not retried", outcomes: []LinkCheckOutcome{{Err: context.DeadlineExceeded}}, attempts: 1,
+			policy: func(p *models.DomainPolicy) { p.ErrorIsHealthy = true }},
+	}
+	for _, tt := range tests {
+		maxAttempts := 4
+		if tt.more {
+			maxAttempts = 6
+		}
+		c, clock := newTestCheckers(t, LinkCheckerConfig{
+			MaxAttempts:    maxAttempts,
+			RetryBaseDelay: time.Second,
+			RetryMaxDelay:  5 * time.Second,
+			MaxRetryAfter:  time.Minute,
+		})
+		if tt.maxJitter {
+			c.intn = func(n int) int { return n - 1 }
+		}
+		policy := testPolicy()
+		if tt.policy != nil {
+			tt.policy(&policy)
+		}
+
+		checker := &retryChecker{next: &scriptedChecker{outcomes: tt.outcomes}, env: c}
+		outcome := checker.Check(context.Background(), LinkCheckTarget{URL: "http://example.com", Policy: policy})
+		if outcome.Attempts != tt.attempts {
+			t.Errorf("%s: attempts = %d, want %d", tt.name, outcome.Attempts, tt.attempts)
+		}
+		if sleeps := clock.Sleeps(); !reflect.DeepEqual(sleeps, tt.sleeps) {
+			t.Errorf("%s: sleeps = %v, want %v", tt.name, sleeps, tt.sleeps)
+		}
+	}
+}
+
+// newForwardProxy 只转发普通 HTTP 请求的代理
+func newForwardProxy() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+}
+
+func TestProxyCheckerFailsOverToNextProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	good := newForwardProxy()
+	defer good.Close()
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	c, clock := newTestCheckers(t, LinkCheckerConfig{
+		ProxyCooldown: time.Minute,
+		Proxies: []LinkProxyConfig{
+			{Name: "dead", URL: deadURL, Region: "eu"},
+			{Name: "good", URL: good.URL, Region: "eu"},
+		},
+	})
+	policy := testPolicy()
+	policy.Proxy = "region:eu"
+	checker := c.Select(models.ExternalLink{}, policy, models.LinkCheckProfileGet, true)
+	outcome := checker.Check(context.Background(), LinkCheckTarget{URL: server.URL, Policy: policy})
+
+	if outcome.Err != nil || outcome.StatusCode != http.StatusOK || outcome.Proxy != "good" {
+		t.Fatalf("outcome = %+v, want 200 through good", outcome)
+	}
+	if checker.Name() != models.LinkCheckProfileGet+proxyProfileSuffix {
+		t.Fatalf("profile = %s", checker.Name())
+	}
+
+	stats := c.proxies.stats()
+	if stats[0].Name != "dead" || stats[0].Healthy || stats[0].Failures != 1 {
+		t.Fatalf("dead proxy stats = %+v, want one failure and paused", stats[0])
+	}
+	if stats[1].Name != "good" || !stats[1].Healthy || stats[1].Requests != 1 {
+		t.Fatalf("good proxy stats = %+v", stats[1])
+	}
+
+	// 暂停结束后重新参与轮询
+	clock.Advance(2 * time.Minute)
+	if !c.proxies.stats()[0].Healthy {
+		t.Fatal("dead proxy still paused after cooldown")
+	}
+}
+
+func TestProxyCheckerReportsUnavailableWhenAllProxiesFail(t *testing.T) {
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{Proxies: []LinkProxyConfig{{Name: "dead", URL: deadURL}}})
+	policy := testPolicy()
+	policy.Proxy = "dead"
+	checker := c.Select(models.ExternalLink{}, policy, models.LinkCheckProfileGet, true)
+	outcome := checker.Check(context.Background(), LinkCheckTarget{URL: "http://example.invalid/", Policy: policy})
+
+	if !stderrors.Is(outcome.Err, errProxyUnavailable) || classifyCheckError(outcome.Err) != models.LinkErrorProxy {
+		t.Fatalf("err = %v, want proxy unavailable", outcome.Err)
+	}
+
+	policy.Proxy = "region:nowhere"
+	outcome = c.Select(models.ExternalLink{}, policy, models.LinkCheckProfileGet, true).
+		Check(context.Background(), LinkCheckTarget{URL: "http://example.invalid/", Policy: policy})
+	if !stderrors.Is(outcome.Err, errProxyUnavailable) {
+		t.Fatalf("err = %v, want proxy unavailable for unknown region", outcome.Err)
+	}
+}
+
+func TestTransportUsesDefaultProxyAndFailsOver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	good := newForwardProxy()
+	defer good.Close()
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{
+		DefaultProxy: models.LinkProxyPool,
+		Proxies: []LinkProxyConfig{
+			{Name: "dead", URL: deadURL},
+			{Name: "good", URL: good.URL},
+		},
+	})
+	client := &http.Client{Transport: c.Transport("")}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+
+	stats := c.proxies.stats()
+	if stats[0].Healthy || stats[0].Failures != 1 || stats[1].Requests != 1 {
+		t.Fatalf("proxy stats = %+v, want dead paused and good used", stats)
+	}
+}
+
+// proxyScript 按经过的代理返回预设结果并记录尝试顺序，没有预设的代理返回 200
+type proxyScript struct {
+	outcomes map[string]LinkCheckOutcome
+	tried    []string
+}
+
+func (s *proxyScript) Name() string {
+	return "scripted"
+}
+
+func (s *proxyScript) Check(ctx context.Context, target LinkCheckTarget) LinkCheckOutcome {
+	name := target.Proxy.Hostname()
+	s.tried = append(s.tried, name)
+	if outcome, ok := s.outcomes[name]; ok {
+		return outcome
+	}
+	return LinkCheckOutcome{StatusCode: http.StatusOK}
+}
+
+func TestProxyCheckerFailover(t *testing.T) {
+	refused := LinkCheckOutcome{Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: stderrors.New("connection refused")}}
+	authRequired := LinkCheckOutcome{StatusCode: http.StatusProxyAuthRequired}
+	targetDown := LinkCheckOutcome{Err: &net.OpError{Op: "dial", Net: "tcp", Err: stderrors.New("connection refused")}}
+
+	tests := []struct {
+		name        string
+		selector    string
+		paused      []string
+		outcomes    map[string]LinkCheckOutcome
+		tried       []string
+		proxy       string // 为空表示所有代理都不可用
+		pausedAfter []string
+	}{
+		{name: "first proxy answers", selector: models.LinkProxyPool,
+			tried: []string{"a"}, proxy: "a"},
+		{name: "unreachable proxy fails over", selector: models.LinkProxyPool,
+			outcomes: map[string]LinkCheckOutcome{"a": refused},
+			tried:    []string{"a", "b"}, proxy: "b", pausedAfter: []string{"a"}},
+		{name: "proxy auth failure fails over", selector: models.LinkProxyPool,
+			outcomes: map[string]LinkCheckOutcome{"a": authRequired, "b": authRequired},
+			tried:    []string{"a", "b", "c"}, proxy: "c", pausedAfter: []string{"a", "b"}},
+		{name: "target errors do not fail over", selector: models.LinkProxyPool,
+			outcomes: map[string]LinkCheckOutcome{"a": targetDown},
+			tried:    []string{"a"}, proxy: "a"},
+		{name: "paused proxies are tried last", selector: models.LinkProxyPool, paused: []string{"a"},
+			tried: []string{"b"}, proxy: "b", pausedAfter: []string{"a"}},
+		{name: "region only uses its proxies", selector: models.LinkProxyRegionPrefix + "eu",
+			outcomes: map[string]LinkCheckOutcome{"a": refused, "b": refused},
+			tried:    []string{"a", "b"}, pausedAfter: []string{"a", "b"}},
+		{name: "all paused are still tried", selector: models.LinkProxyRegionPrefix + "eu", paused: []string{"a", "b"},
+			tried: []string{"a"}, proxy: "a", pausedAfter: []string{"b"}},
+	}
+	for _, tt := range tests {
+		c, _ := newTestCheckers(t, LinkCheckerConfig{
+			ProxyCooldown: time.Minute,
+			Proxies: []LinkProxyConfig{
+				{Name: "a", Region: "eu", URL: "http://a:3128"},
+				{Name: "b", Region: "eu", URL: "http://b:3128"},
+				{Name: "c", Region: "us", URL: "http://c:3128"},
+			},
+		})
+		now := c.clock.Now()
+		for i, name := range tt.paused {
+			// 先暂停的代理先恢复
+			c.proxies.byName[name].record(now.Add(time.Duration(i)*time.Second), 0, errProxyRejected, time.Minute)
+		}
+		route, err := c.proxies.route(tt.selector)
+		if err != nil {
+			t.Fatalf("%s: route: %v", tt.name, err)
+		}
+
+		script := &proxyScript{outcomes: tt.outcomes}
+		outcome := (&proxyChecker{next: script, env: c, route: route}).Check(context.Background(), LinkCheckTarget{URL: "http://example.com", Policy: testPolicy()})
+
+		if !reflect.DeepEqual(script.tried, tt.tried) {
+			t.Errorf("%s: tried %v, want %v", tt.name, script.tried, tt.tried)
+		}
+		if tt.proxy == "" {
+			if !stderrors.Is(outcome.Err, errProxyUnavailable) {
+				t.Errorf("%s: err = %v, want proxy unavailable", tt.name, outcome.Err)
+			}
+		} else if outcome.Proxy != tt.proxy {
+			t.Errorf("%s: proxy = %q, want %q", tt.name, outcome.Proxy, tt.proxy)
+		}
+
+		var paused []string
+		for _, stats := range c.proxies.stats() {
+			if !stats.Healthy {
+				paused = append(paused, stats.Name)
+			}
+		}
+		if !reflect.DeepEqual(paused, tt.pausedAfter) {
+			t.Errorf("%s: paused %v, want %v", tt.name, paused, tt.pausedAfter)
+		}
+	}
+}
+
+// newConnectProxy 只处理 CONNECT 请求的代理
+func newConnectProxy() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(upstream, buf)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+}
+
+func TestDialerFailsOverToNextProxy(t *testing.T) {
+	target, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			// 像 TLS 服务器一样等客户端先发送数据
+			io.Copy(conn, io.LimitReader(conn, 5))
+			conn.Close()
+		}
+	}()
+	good := newConnectProxy()
+	defer good.Close()
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "http://" + dead.Addr().String()
+	dead.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{
+		Proxies: []LinkProxyConfig{
+			{Name: "dead", URL: deadURL},
+			{Name: "good", URL: good.URL},
+		},
+	})
+	policy := testPolicy()
+	policy.Proxy = models.LinkProxyPool
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := c.Dialer(policy)(ctx, "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Write([]byte("hello"))
+	echo := make([]byte, 5)
+	io.ReadFull(conn, echo)
+	conn.Close()
+
+	if string(echo) != "hello" {
+		t.Fatalf("echo = %q", echo)
+	}
+	stats := c.proxies.stats()
+	if stats[0].Healthy || stats[0].Failures != 1 || stats[1].Requests != 1 {
+		t.Fatalf("proxy stats = %+v, want dead paused and good used", stats)
+	}
+}
+
+func TestMethodCheckerCapturesPageWithSingleGet(t *testing.T) {
+	var methods []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><head><title>Example</title></head><body>"+strings.Repeat("x", 4096)+"</body></html>")
+	}))
+	defer server.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileHeadGet, true)
+	outcome := checker.Check(context.Background(), LinkCheckTarget{URL: server.URL, Policy: testPolicy(), CaptureBytes: 1024})
+
+	if outcome.Err != nil || len(methods) != 1 || methods[0] != http.MethodGet {
+		t.Fatalf("err = %v, methods = %v, want a single GET", outcome.Err, methods)
+	}
+	if outcome.Page == nil || len(outcome.Page.Body) != 1024 {
+		t.Fatalf("page = %+v, want 1024 captured bytes", outcome.Page)
+	}
+	metadata, err := pageMetadata(bytes.NewReader(outcome.Page.Body), outcome.Page.ContentType, outcome.Page.URL)
+	if err != nil || metadata.Title != "Example" {
+		t.Fatalf("metadata = %+v, err = %v", metadata, err)
+	}
+}
+
+func TestMethodCheckerCapturesNonHTMLOnlyWhenAsked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"status":"ok"}`)
+	}))
+	defer server.Close()
+
+	c, _ := newTestCheckers(t, LinkCheckerConfig{})
+	checker := c.Select(models.ExternalLink{}, testPolicy(), models.LinkCheckProfileHeadGet, true)
+
+	outcome := checker.Check(context.Background(), LinkCheckTarget{URL: server.URL, Policy: testPolicy(), CaptureBytes: 1024})
+	if outcome.Page != nil {
+		t.Fatalf("page = %+v, want nothing captured for JSON by default", outcome.Page)
+	}
+	outcome = checker.Check(context.Background(), LinkCheckTarget{URL: server.URL, Policy: testPolicy(), CaptureBytes: 1024, CaptureAnyType: true})
+	if outcome.Page == nil || string(outcome.Page.Body) != `{"status":"ok"}` {
+		t.Fatalf("page = %+v, want the JSON body", outcome.Page)
+	}
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// 点击分析的时间粒度
+const (
+	ClickIntervalHour = "hour"
+	ClickIntervalDay  = "day"
+)
+
+// maxReferrerLength 来源地址最多保存的长度
+const maxReferrerLength = 1024
+
+// botUserAgentPattern 识别爬虫、预览抓取和命令行工具
+var botUserAgentPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|fetch|scan|monitor|preview|headless|phantom|lighthouse|curl|wget|python|java/|go-http-client|okhttp|axios|node-fetch|libwww|httpclient|facebookexternalhit|embedly|quora link|whatsapp|telegram|slack|discord`)
+
+// LinkClickConfig 点击统计配置
+type LinkClickConfig struct {
+	Retention   time.Duration // 点击事件保留时长
+	DedupWindow time.Duration // 同一访客重复点击的去重窗口，为 0 时不去重
+	IPSalt      string        // IP 哈希盐值，为空时每次启动随机生成
+	GeoIPFile   string        // 本地 GeoIP 文件路径，为空时不记录国家
+}
+
+// LinkClickService 点击事件记录与分析服务
+type LinkClickService struct {
+	db     *mongo.Database
+	config LinkClickConfig
+	geo    *GeoIPResolver
+}
+
+// NewLinkClickService 创建点击统计服务实例
+func NewLinkClickService(db *mongo.Database, config LinkClickConfig) *LinkClickService {
+	if config.IPSalt == "" {
+		salt := make([]byte, 16)
+		_, _ = rand.Read(salt)
+		config.IPSalt = hex.EncodeToString(salt)
+		logger.Warn("未配置 IP 哈希盐值，重启后访客去重和独立访客统计将重新计算")
+	}
+
+	geo, err := LoadGeoIPFile(config.GeoIPFile)
+	if err != nil {
+		logger.Warn("加载 GeoIP 文件失败", zap.String("path", config.GeoIPFile), zap.Error(err))
+	} else if geo.Size() > 0 {
+		logger.Info("已加载 GeoIP 文件", zap.String("path", config.GeoIPFile), zap.Int("ranges", geo.Size()))
+	}
+
+	return &LinkClickService{
+		db:     db,
+		config: config,
+		geo:    geo,
+	}
+}
+
+// Start 创建点击事件集合及索引
+func (s *LinkClickService) Start(ctx context.Context) {
+	if err := s.ensureCollections(ctx); err != nil {
+		logger.Warn("创建点击事件索引失败", zap.Error(err))
+	}
+}
+
+func (s *LinkClickService) ensureCollections(ctx context.Context) error {
+	specs, err := s.db.ListCollectionSpecifications(ctx, bson.M{"name": "link_click_events"})
+	if err != nil {
+		return err
+	}
+
+	timeSeries := len(specs) > 0 && specs[0].Type == "timeseries"
+	if len(specs) == 0 {
+		opts := options.CreateCollection().
+			SetTimeSeriesOptions(options.TimeSeries().
+				SetTimeField("clicked_at").
+				SetMetaField("link_id").
+				SetGranularity("seconds")).
+			SetExpireAfterSeconds(int64(s.config.Retention.Seconds()))
+		if createErr := s.db.CreateCollection(ctx, "link_click_events", opts); createErr == nil {
+			timeSeries = true
+		} else {
+			logger.Warn("创建点击事件时序集合失败，使用普通集合", zap.Error(createErr))
+		}
+	}
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "link_id", Value: 1}, {Key: "clicked_at", Value: -1}}},
+	}
+	if !timeSeries {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "clicked_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(s.config.Retention.Seconds())),
+		})
+	}
+	if _, err := s.db.Collection("link_click_events").Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	if s.config.DedupWindow > 0 {
+		_, err = s.db.Collection("link_click_dedup").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "last_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(s.config.DedupWindow.Seconds())),
+		})
+	}
+	return err
+}
+
+// ResolveLink 按链接ID或短链标识查找可跳转的链接
+func (s *LinkClickService) ResolveLink(ctx context.Context, slug string) (*models.ExternalLink, error) {
+	filter := bson.M{"slug": slug}
+	if objectID, err := primitive.ObjectIDFromHex(slug); err == nil {
+		filter = bson.M{"_id": objectID}
+	}
+
+	var link models.ExternalLink
+	err := s.db.Collection("external_links").FindOne(ctx, filter).Decode(&link)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("外链不存在", http.StatusNotFound)
+		}
+		logger.Error("查询跳转链接失败", zap.Error(err))
+		return nil, errors.NewError("查询外链失败", http.StatusInternalServerError)
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return nil, errors.NewError("外链已过期", http.StatusGone)
+	}
+	if !link.IsActive {
+		return nil, errors.NewError("外链已停用", http.StatusNotFound)
+	}
+
+	return &link, nil
+}
+
+// RecordClick 记录一次点击并累加点击数
+// 爬虫和去重窗口内的重复点击不计入，返回值表示是否计入
+// 使用独立的上下文写库，避免客户端断开影响记录
+func (s *LinkClickService) RecordClick(link *models.ExternalLink, click models.ClickContext) bool {
+	device := classifyUserAgent(click.UserAgent)
+	if device == models.DeviceBot {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	ipHash := s.hashIP(click.IP)
+	if !s.firstClickInWindow(ctx, link.ID, ipHash, now) {
+		return false
+	}
+
+	event := models.LinkClickEvent{
+		LinkID:    link.ID,
+		ClickedAt: now,
+		Source:    click.Source,
+		Device:    device,
+		Country:   s.geo.Country(click.IP),
+		IPHash:    ipHash,
+	}
+	// 集合标识来自查询参数，格式不合法时不记录
+	if click.Collection != "" && slugPattern.MatchString(click.Collection) {
+		event.Collection = click.Collection
+	}
+	if click.Referrer != "" {
+		event.Referrer = click.Referrer
+		if len(event.Referrer) > maxReferrerLength {
+			event.Referrer = event.Referrer[:maxReferrerLength]
+		}
+		if parsed, err := url.Parse(click.Referrer); err == nil {
+			event.ReferrerHost = strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+		}
+	}
+
+	if _, err := s.db.Collection("link_click_events").InsertOne(ctx, event); err != nil {
+		logger.Error("保存点击事件失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+		return false
+	}
+
+	_, err := s.db.Collection("external_links").UpdateOne(ctx,
+		bson.M{"_id": link.ID},
+		bson.M{
+			"$inc": bson.M{"clicks": 1},
+			"$set": bson.M{"last_clicked_at": now},
+		},
+	)
+	if err != nil {
+		logger.Error("增加点击量失败", zap.String("link_id", link.ID.Hex()), zap.Error(err))
+	}
+	return true
+}
+
+// firstClickInWindow 判断访客是否在去重窗口外首次点击
+// 以条件 upsert 实现：窗口内已有记录时条件不匹配，插入同 _id 文档触发唯一键冲突，多实例下同样可靠
+func (s *LinkClickService) firstClickInWindow(ctx context.Context, linkID primitive.ObjectID, ipHash string, now time.Time) bool {
+	if s.config.DedupWindow <= 0 {
+		return true
+	}
+
+	_, err := s.db.Collection("link_click_dedup").UpdateOne(ctx,
+		bson.M{"_id": linkID.Hex() + ":" + ipHash, "last_at": bson.M{"$lt": now.Add(-s.config.DedupWindow)}},
+		bson.M{"$set": bson.M{"last_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		if !mongo.IsDuplicateKeyError(err) {
+			logger.Warn("点击去重失败", zap.Error(err))
+		}
+		return false
+	}
+	return true
+}
+
+// hashIP 对访客 IP 加盐哈希，只保存哈希值
+func (s *LinkClickService) hashIP(ip string) string {
+	sum := sha256.Sum256([]byte(s.config.IPSalt + "|" + ip))
+	return hex.EncodeToString(sum[:16])
+}
+
+// classifyUserAgent 根据 User-Agent 粗略判断访问设备，空 User-Agent 视为爬虫
+func classifyUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "" || botUserAgentPattern.MatchString(ua):
+		return models.DeviceBot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return models.DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return models.DeviceMobile
+	case strings.Contains(ua, "windows") || strings.Contains(ua, "macintosh") ||
+		strings.Contains(ua, "x11") || strings.Contains(ua, "cros"):
+		return models.DeviceDesktop
+	}
+	return models.DeviceOther
+}
+
+// GetClickAnalytics 按点击事件统计时间范围内的点击，linkID 为空时统计全部链接并返回点击排行
+func (s *LinkClickService) GetClickAnalytics(ctx context.Context, linkID string, from, to time.Time, interval string) (*models.ClickAnalytics, error) {
+	if !to.After(from) {
+		return nil, errors.NewError("结束时间必须晚于开始时间", http.StatusBadRequest)
+	}
+
+	var bucketFormat string
+	switch interval {
+	case "", ClickIntervalDay:
+		interval = ClickIntervalDay
+		bucketFormat = "%Y-%m-%dT00:00:00Z"
+	case ClickIntervalHour:
+		bucketFormat = "%Y-%m-%dT%H:00:00Z"
+	default:
+		return nil, errors.NewError("无效的统计粒度，可选值: hour, day", http.StatusBadRequest)
+	}
+
+	match := bson.M{"clicked_at": bson.M{"$gte": from, "$lt": to}}
+	if linkID != "" {
+		objectID, err := primitive.ObjectIDFromHex(linkID)
+		if err != nil {
+			return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+		}
+		if err := requireVisibleLink(ctx, s.db, objectID); err != nil {
+			return nil, err
+		}
+		match["link_id"] = objectID
+	} else {
+		ids, scoped, err := visibleLinkIDs(ctx, s.db)
+		if err != nil {
+			return nil, err
+		}
+		if scoped {
+			match["link_id"] = bson.M{"$in": ids}
+		}
+	}
+
+	topN := func(field string, limit int) bson.A {
+		return bson.A{
+			bson.M{"$group": bson.M{"_id": bson.M{"$ifNull": bson.A{field, ""}}, "clicks": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "clicks", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$limit": limit},
+		}
+	}
+	facet := bson.M{
+		"totals": bson.A{
+			bson.M{"$group": bson.M{"_id": nil, "clicks": bson.M{"$sum": 1}, "visitors": bson.M{"$addToSet": "$ip_hash"}}},
+			bson.M{"$project": bson.M{"clicks": 1, "unique": bson.M{"$size": "$visitors"}}},
+		},
+		"series": bson.A{
+			bson.M{"$group": bson.M{
+				"_id": bson.M{"$dateFromString": bson.M{"dateString": bson.M{
+					"$dateToString": bson.M{"format": bucketFormat, "date": "$clicked_at"},
+				}}},
+				"clicks":   bson.M{"$sum": 1},
+				"visitors": bson.M{"$addToSet": "$ip_hash"},
+			}},
+			bson.M{"$project": bson.M{"clicks": 1, "unique": bson.M{"$size": "$visitors"}}},
+			bson.M{"$sort": bson.M{"_id": 1}},
+		},
+		"referrers": topN("$referrer_host", 20),
+		"countries": topN("$country", 50),
+		"devices":   topN("$device", 10),
+		"collections": append(bson.A{
+			bson.M{"$match": bson.M{"collection": bson.M{"$exists": true}}},
+		}, topN("$collection", 20)...),
+	}
+	if linkID == "" {
+		facet["top_links"] = bson.A{
+			bson.M{"$group": bson.M{"_id": "$link_id", "clicks": bson.M{"$sum": 1}, "visitors": bson.M{"$addToSet": "$ip_hash"}}},
+			bson.M{"$sort": bson.M{"clicks": -1}},
+			bson.M{"$limit": 20},
+			bson.M{"$lookup": bson.M{"from": "external_links", "localField": "_id", "foreignField": "_id", "as": "link"}},
+			bson.M{"$project": bson.M{
+				"clicks": 1,
+				"unique": bson.M{"$size": "$visitors"},
+				"url":    bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$link.url", 0}}, ""}},
+			}},
+		}
+	}
+
+	cursor, err := s.db.Collection("link_click_events").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: facet}},
+	})
+	if err != nil {
+		logger.Error("统计点击事件失败", zap.Error(err))
+		return nil, errors.NewError("统计点击事件失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Totals []struct {
+			Clicks int `bson:"clicks"`
+			Unique int `bson:"unique"`
+		} `bson:"totals"`
+		Series      []models.ClickBucket      `bson:"series"`
+		Referrers   []models.ClickDimension   `bson:"referrers"`
+		Countries   []models.ClickDimension   `bson:"countries"`
+		Devices     []models.ClickDimension   `bson:"devices"`
+		Collections []models.ClickDimension   `bson:"collections"`
+		TopLinks    []models.LinkClickSummary `bson:"top_links"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		logger.Error("解析点击统计失败", zap.Error(err))
+		return nil, errors.NewError("统计点击事件失败", http.StatusInternalServerError)
+	}
+
+	analytics := &models.ClickAnalytics{
+		From:        from,
+		To:          to,
+		Interval:    interval,
+		Series:      []models.ClickBucket{},
+		Referrers:   []models.ClickDimension{},
+		Countries:   []models.ClickDimension{},
+		Devices:     []models.ClickDimension{},
+		Collections: []models.ClickDimension{},
+	}
+	if len(results) > 0 {
+		r := results[0]
+		if len(r.Totals) > 0 {
+			analytics.Clicks = r.Totals[0].Clicks
+			analytics.Unique = r.Totals[0].Unique
+		}
+		analytics.Series = append(analytics.Series, r.Series...)
+		analytics.Referrers = append(analytics.Referrers, r.Referrers...)
+		analytics.Countries = append(analytics.Countries, r.Countries...)
+		analytics.Devices = append(analytics.Devices, r.Devices...)
+		analytics.Collections = append(analytics.Collections, r.Collections...)
+		analytics.TopLinks = r.TopLinks
+	}
+
+	return analytics, nil
+}
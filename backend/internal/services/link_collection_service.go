@@ -0,0 +1,532 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+	"vite-pluginend/pkg/utils"
+)
+
+const (
+	// maxCollectionLinks 单个集合最多包含的链接数
+	maxCollectionLinks = 500
+	// maxCollectionNameLength 集合名称的最大长度
+	maxCollectionNameLength = 100
+	// maxCollectionDescriptionLength 集合描述的最大长度
+	maxCollectionDescriptionLength = 2000
+	// maxPasswordFailures 同一来源在窗口内对同一集合允许输错密码的次数
+	maxPasswordFailures = 5
+	// passwordFailureWindow 密码错误次数的统计窗口，达到上限后需等窗口结束才能再试
+	passwordFailureWindow = 15 * time.Minute
+)
+
+// LinkCollectionService 链接集合服务
+// 集合的访问范围与链接相同：普通用户只能管理本人、所在团队及未分配所有者的集合
+type LinkCollectionService struct {
+	db *mongo.Database
+}
+
+// passwordFailures 同一来源对同一集合的密码错误记录
+// 记录保存在数据库中，多个实例共享同一计数，窗口结束后由过期索引清理
+type passwordFailures struct {
+	Key     string    `bson:"_id"`
+	Count   int       `bson:"count"`
+	ResetAt time.Time `bson:"reset_at"`
+}
+
+// wait 返回还需等待多久才能再次尝试密码，未达到错误次数上限或窗口已结束时返回 0
+func (f *passwordFailures) wait(now time.Time) time.Duration {
+	if f.Count < maxPasswordFailures || !now.Before(f.ResetAt) {
+		return 0
+	}
+	return f.ResetAt.Sub(now)
+}
+
+// NewLinkCollectionService 创建链接集合服务
+func NewLinkCollectionService(db *mongo.Database) *LinkCollectionService {
+	return &LinkCollectionService{db: db}
+}
+
+func (s *LinkCollectionService) collection() *mongo.Collection {
+	return s.db.Collection("link_collections")
+}
+
+func (s *LinkCollectionService) failureCollection() *mongo.Collection {
+	return s.db.Collection("link_collection_password_failures")
+}
+
+// EnsureIndexes 创建集合索引
+func (s *LinkCollectionService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "owner", Value: 1}}},
+		{Keys: bson.D{{Key: "link_ids", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.failureCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "reset_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// ListCollections 获取调用者可访问的集合，按更新时间降序
+func (s *LinkCollectionService) ListCollections(ctx context.Context) ([]models.LinkCollection, error) {
+	cursor, err := s.collection().Find(ctx, scopedFilter(ctx, bson.M{}),
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		logger.Error("获取链接集合列表失败", zap.Error(err))
+		return nil, errors.NewError("获取链接集合列表失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	collections := []models.LinkCollection{}
+	if err := cursor.All(ctx, &collections); err != nil {
+		logger.Error("解析链接集合列表失败", zap.Error(err))
+		return nil, errors.NewError("解析链接集合列表失败", http.StatusInternalServerError)
+	}
+	for i := range collections {
+		collections[i].HasPassword = collections[i].PasswordHash != ""
+	}
+	return collections, nil
+}
+
+// GetCollection 获取单个集合
+func (s *LinkCollectionService) GetCollection(ctx context.Context, id string) (*models.LinkCollection, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的集合ID", http.StatusBadRequest)
+	}
+
+	var collection models.LinkCollection
+	if err := s.collection().FindOne(ctx, scopedFilter(ctx, bson.M{"_id": objectID})).Decode(&collection); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("链接集合不存在", http.StatusNotFound)
+		}
+		logger.Error("获取链接集合失败", zap.String("id", id), zap.Error(err))
+		return nil, errors.NewError("获取链接集合失败", http.StatusInternalServerError)
+	}
+	collection.HasPassword = collection.PasswordHash != ""
+	return &collection, nil
+}
+
+// GetCollectionLinks 按集合中的顺序返回链接，已删除或调用者无权访问的链接不返回
+func (s *LinkCollectionService) GetCollectionLinks(ctx context.Context, id string) ([]models.ExternalLink, error) {
+	collection, err := s.GetCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.loadOrderedLinks(ctx, collection.LinkIDs, scopedFilter(ctx, bson.M{}))
+}
+
+// CreateCollection 创建集合，名称和标识必填，所有者为调用者本人
+func (s *LinkCollectionService) CreateCollection(ctx context.Context, req models.LinkCollectionRequest) (*models.LinkCollection, error) {
+	if req.Name == nil || req.Slug == nil {
+		return nil, errors.NewError("集合名称和标识不能为空", http.StatusBadRequest)
+	}
+
+	now := time.Now()
+	collection := &models.LinkCollection{
+		LinkIDs:   []primitive.ObjectID{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if actor := LinkActorFrom(ctx); actor != nil {
+		collection.Owner = actor.OwnerKey()
+		collection.CreatedBy = actor.UserID
+		collection.UpdatedBy = actor.UserID
+	}
+	if err := s.applyRequest(ctx, collection, req); err != nil {
+		return nil, err
+	}
+
+	result, err := s.collection().InsertOne(ctx, collection)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.NewError("集合标识已存在", http.StatusConflict)
+		}
+		logger.Error("创建链接集合失败", zap.Error(err))
+		return nil, errors.NewError("创建链接集合失败", http.StatusInternalServerError)
+	}
+	collection.ID = result.InsertedID.(primitive.ObjectID)
+	collection.HasPassword = collection.PasswordHash != ""
+
+	logger.Info("创建链接集合", zap.String("id", collection.ID.Hex()), zap.String("slug", collection.Slug))
+	return collection, nil
+}
+
+// UpdateCollection 更新集合，只修改请求中出现的字段
+func (s *LinkCollectionService) UpdateCollection(ctx context.Context, id string, req models.LinkCollectionRequest) (*models.LinkCollection, error) {
+	collection, err := s.GetCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRequest(ctx, collection, req); err != nil {
+		return nil, err
+	}
+	return s.saveCollection(ctx, collection)
+}
+
+// DeleteCollection 删除集合，集合中的链接不受影响
+func (s *LinkCollectionService) DeleteCollection(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.NewError("无效的集合ID", http.StatusBadRequest)
+	}
+
+	result, err := s.collection().DeleteOne(ctx, scopedFilter(ctx, bson.M{"_id": objectID}))
+	if err != nil {
+		logger.Error("删除链接集合失败", zap.String("id", id), zap.Error(err))
+		return errors.NewError("删除链接集合失败", http.StatusInternalServerError)
+	}
+	if result.DeletedCount == 0 {
+		return errors.NewError("链接集合不存在", http.StatusNotFound)
+	}
+	return nil
+}
+
+// AddLinks 向集合插入链接，已在集合中的链接保持原位置
+func (s *LinkCollectionService) AddLinks(ctx context.Context, id string, req models.LinkCollectionItemsRequest) (*models.LinkCollection, error) {
+	collection, err := s.GetCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.validateLinkIDs(ctx, req.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[primitive.ObjectID]bool, len(collection.LinkIDs))
+	for _, linkID := range collection.LinkIDs {
+		existing[linkID] = true
+	}
+	added := make([]primitive.ObjectID, 0, len(ids))
+	for _, linkID := range ids {
+		if !existing[linkID] {
+			added = append(added, linkID)
+		}
+	}
+
+	position := len(collection.LinkIDs)
+	if req.Position != nil {
+		if *req.Position < 0 || *req.Position > len(collection.LinkIDs) {
+			return nil, errors.NewError(fmt.Sprintf("插入位置必须在 0 到 %d 之间", len(collection.LinkIDs)), http.StatusBadRequest)
+		}
+		position = *req.Position
+	}
+	if len(collection.LinkIDs)+len(added) > maxCollectionLinks {
+		return nil, errors.NewError(fmt.Sprintf("集合最多包含 %d 个链接", maxCollectionLinks), http.StatusBadRequest)
+	}
+
+	linkIDs := make([]primitive.ObjectID, 0, len(collection.LinkIDs)+len(added))
+	linkIDs = append(linkIDs, collection.LinkIDs[:position]...)
+	linkIDs = append(linkIDs, added...)
+	linkIDs = append(linkIDs, collection.LinkIDs[position:]...)
+	collection.LinkIDs = linkIDs
+	return s.saveCollection(ctx, collection)
+}
+
+// RemoveLink 从集合中移除链接
+func (s *LinkCollectionService) RemoveLink(ctx context.Context, id, linkID string) (*models.LinkCollection, error) {
+	linkObjectID, err := primitive.ObjectIDFromHex(linkID)
+	if err != nil {
+		return nil, errors.NewError("无效的外链ID", http.StatusBadRequest)
+	}
+	collection, err := s.GetCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	linkIDs := make([]primitive.ObjectID, 0, len(collection.LinkIDs))
+	for _, existing := range collection.LinkIDs {
+		if existing != linkObjectID {
+			linkIDs = append(linkIDs, existing)
+		}
+	}
+	if len(linkIDs) == len(collection.LinkIDs) {
+		return nil, errors.NewError("链接不在集合中", http.StatusNotFound)
+	}
+	collection.LinkIDs = linkIDs
+	return s.saveCollection(ctx, collection)
+}
+
+// saveCollection 以读取时的更新时间作为条件保存集合，期间被其他请求修改时返回冲突
+func (s *LinkCollectionService) saveCollection(ctx context.Context, collection *models.LinkCollection) (*models.LinkCollection, error) {
+	readAt := collection.UpdatedAt
+	collection.UpdatedAt = time.Now()
+	if actor := LinkActorFrom(ctx); actor != nil {
+		collection.UpdatedBy = actor.UserID
+	}
+
+	result, err := s.collection().ReplaceOne(ctx, bson.M{"_id": collection.ID, "updated_at": readAt}, collection)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.NewError("集合标识已存在", http.StatusConflict)
+		}
+		logger.Error("保存链接集合失败", zap.String("id", collection.ID.Hex()), zap.Error(err))
+		return nil, errors.NewError("保存链接集合失败", http.StatusInternalServerError)
+	}
+	if result.MatchedCount == 0 {
+		return nil, errors.NewError("集合已被修改，请刷新后重试", http.StatusConflict)
+	}
+	collection.HasPassword = collection.PasswordHash != ""
+	return collection, nil
+}
+
+// applyRequest 校验请求并写入集合字段
+func (s *LinkCollectionService) applyRequest(ctx context.Context, collection *models.LinkCollection, req models.LinkCollectionRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxCollectionNameLength {
+			return errors.NewError(fmt.Sprintf("集合名称不能为空且不能超过 %d 个字符", maxCollectionNameLength), http.StatusBadRequest)
+		}
+		collection.Name = name
+	}
+	if req.Slug != nil {
+		slug := strings.TrimSpace(*req.Slug)
+		if !slugPattern.MatchString(slug) {
+			return errors.NewError("集合标识只能包含字母、数字、下划线和连字符，且不超过64个字符", http.StatusBadRequest)
+		}
+		collection.Slug = slug
+	}
+	if req.Description != nil {
+		if utf8.RuneCountInString(*req.Description) > maxCollectionDescriptionLength {
+			return errors.NewError(fmt.Sprintf("集合描述不能超过 %d 个字符", maxCollectionDescriptionLength), http.StatusBadRequest)
+		}
+		collection.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Public != nil {
+		collection.Public = *req.Public
+	}
+	if req.Password != nil {
+		if *req.Password == "" {
+			collection.PasswordHash = ""
+		} else {
+			hash, err := utils.HashPassword(*req.Password)
+			if err != nil {
+				logger.Error("集合密码加密失败", zap.Error(err))
+				return errors.NewError("集合密码加密失败", http.StatusInternalServerError)
+			}
+			collection.PasswordHash = hash
+		}
+	}
+	if req.LinkIDs != nil {
+		ids, err := s.validateLinkIDs(ctx, *req.LinkIDs)
+		if err != nil {
+			return err
+		}
+		if len(ids) > maxCollectionLinks {
+			return errors.NewError(fmt.Sprintf("集合最多包含 %d 个链接", maxCollectionLinks), http.StatusBadRequest)
+		}
+		collection.LinkIDs = ids
+	}
+	return nil
+}
+
+// validateLinkIDs 解析链接ID并去重，保持原有顺序；所有链接都必须存在且在调用者的访问范围内
+func (s *LinkCollectionService) validateLinkIDs(ctx context.Context, rawIDs []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(rawIDs))
+	seen := make(map[primitive.ObjectID]bool, len(rawIDs))
+	for _, id := range rawIDs {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, errors.NewError("无效的外链ID: "+id, http.StatusBadRequest)
+		}
+		if !seen[objectID] {
+			seen[objectID] = true
+			ids = append(ids, objectID)
+		}
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	if len(ids) > maxCollectionLinks {
+		return nil, errors.NewError(fmt.Sprintf("集合最多包含 %d 个链接", maxCollectionLinks), http.StatusBadRequest)
+	}
+
+	count, err := s.db.Collection("external_links").CountDocuments(ctx, scopedFilter(ctx, bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		logger.Error("校验集合链接失败", zap.Error(err))
+		return nil, errors.NewError("校验集合链接失败", http.StatusInternalServerError)
+	}
+	if int(count) != len(ids) {
+		return nil, errors.NewError("部分链接不存在", http.StatusBadRequest)
+	}
+	return ids, nil
+}
+
+// loadOrderedLinks 读取链接并按 ids 的顺序排列，不存在或不符合 filter 的链接被忽略
+func (s *LinkCollectionService) loadOrderedLinks(ctx context.Context, ids []primitive.ObjectID, filter bson.M) ([]models.ExternalLink, error) {
+	links := []models.ExternalLink{}
+	if len(ids) == 0 {
+		return links, nil
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx, mergeFilter(filter, bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		logger.Error("获取集合链接失败", zap.Error(err))
+		return nil, errors.NewError("获取集合链接失败", http.StatusInternalServerError)
+	}
+	var found []models.ExternalLink
+	if err := cursor.All(ctx, &found); err != nil {
+		logger.Error("解析集合链接失败", zap.Error(err))
+		return nil, errors.NewError("获取集合链接失败", http.StatusInternalServerError)
+	}
+
+	byID := make(map[primitive.ObjectID]models.ExternalLink, len(found))
+	for _, link := range found {
+		byID[link.ID] = link
+	}
+	for _, id := range ids {
+		if link, ok := byID[id]; ok {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// GetPublicCollection 获取公开集合的内容，只包含启用且未过期的链接
+// 设置了密码的集合需要提供密码，未提供时返回 401「需要访问密码」，错误时返回 401「访问密码错误」
+// 同一 clientIP 对同一集合输错密码次数过多时返回 429，窗口结束前不再校验密码
+// redirectBase 为跳转接口的地址前缀，链接地址形如 {redirectBase}/go/{slug}?collection={集合标识}
+func (s *LinkCollectionService) GetPublicCollection(ctx context.Context, slug, password, clientIP, redirectBase string) (*models.PublicLinkCollection, error) {
+	var collection models.LinkCollection
+	err := s.collection().FindOne(ctx, bson.M{"slug": slug, "public": true}).Decode(&collection)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("链接集合不存在", http.StatusNotFound)
+		}
+		logger.Error("获取公开集合失败", zap.String("slug", slug), zap.Error(err))
+		return nil, errors.NewError("获取链接集合失败", http.StatusInternalServerError)
+	}
+	if collection.PasswordHash != "" {
+		if password == "" {
+			return nil, errors.NewError("需要访问密码", http.StatusUnauthorized)
+		}
+		key := slug + "|" + clientIP
+		if wait := s.passwordBlocked(ctx, key, time.Now()); wait > 0 {
+			return nil, errors.NewError(fmt.Sprintf("密码错误次数过多，请 %d 分钟后再试", int(wait.Minutes())+1), http.StatusTooManyRequests)
+		}
+		if !utils.CheckPasswordHash(password, collection.PasswordHash) {
+			s.recordPasswordFailure(ctx, key, time.Now())
+			logger.Warn("公开集合访问密码错误", zap.String("slug", slug), zap.String("ip", clientIP))
+			return nil, errors.NewError("访问密码错误", http.StatusUnauthorized)
+		}
+		s.clearPasswordFailures(ctx, key)
+	}
+
+	now := time.Now()
+	links, err := s.loadOrderedLinks(ctx, collection.LinkIDs, bson.M{
+		"is_active":  true,
+		"expires_at": bson.M{"$not": bson.M{"$lte": now}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	public := &models.PublicLinkCollection{
+		Name:        collection.Name,
+		Slug:        collection.Slug,
+		Description: collection.Description,
+		Links:       make([]models.PublicCollectionLink, 0, len(links)),
+		UpdatedAt:   collection.UpdatedAt,
+	}
+	for _, link := range links {
+		key := link.Slug
+		if key == "" {
+			key = link.ID.Hex()
+		}
+		item := models.PublicCollectionLink{
+			ID:          link.ID.Hex(),
+			Title:       link.Title,
+			Description: link.Description,
+			Category:    link.Category,
+			Tags:        link.Tags,
+			URL:         redirectBase + "/go/" + url.PathEscape(key) + "?collection=" + url.QueryEscape(collection.Slug),
+			Host:        policyHost(link.URL),
+		}
+		if link.Metadata != nil {
+			if item.Title == "" {
+				item.Title = link.Metadata.Title
+			}
+			if item.Description == "" {
+				item.Description = link.Metadata.Description
+			}
+			item.ImageURL = link.Metadata.ImageURL
+		}
+		if item.Title == "" {
+			item.Title = item.Host
+		}
+		public.Links = append(public.Links, item)
+	}
+	return public, nil
+}
+
+// passwordBlocked 返回该来源还需等待多久才能再次尝试密码，未达到错误次数上限时返回 0
+// 查询失败时不拦截，密码仍然需要校验
+func (s *LinkCollectionService) passwordBlocked(ctx context.Context, key string, now time.Time) time.Duration {
+	var record passwordFailures
+	err := s.failureCollection().FindOne(ctx, bson.M{"_id": key}).Decode(&record)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			logger.Error("获取密码错误记录失败", zap.String("key", key), zap.Error(err))
+		}
+		return 0
+	}
+	return record.wait(now)
+}
+
+// recordPasswordFailure 记录一次密码错误，窗口从该来源第一次输错时开始计算
+func (s *LinkCollectionService) recordPasswordFailure(ctx context.Context, key string, now time.Time) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := s.failureCollection().UpdateOne(ctx,
+			bson.M{"_id": key, "reset_at": bson.M{"$gt": now}},
+			bson.M{"$inc": bson.M{"count": 1}},
+		)
+		if err == nil && result.MatchedCount > 0 {
+			return
+		}
+		if err == nil {
+			// 没有未结束的窗口，从本次错误开始新的窗口
+			_, err = s.failureCollection().UpdateOne(ctx,
+				bson.M{"_id": key, "reset_at": bson.M{"$lte": now}},
+				bson.M{"$set": bson.M{"count": 1, "reset_at": now.Add(passwordFailureWindow)}},
+				options.Update().SetUpsert(true),
+			)
+			if err == nil {
+				return
+			}
+		}
+		// 其他实例同时开始了新的窗口时 upsert 会因 _id 冲突失败，重新累加一次即可
+		if !mongo.IsDuplicateKeyError(err) {
+			logger.Error("记录密码错误失败", zap.String("key", key), zap.Error(err))
+			return
+		}
+	}
+}
+
+// clearPasswordFailures 密码正确后清除该来源的错误记录
+func (s *LinkCollectionService) clearPasswordFailures(ctx context.Context, key string) {
+	if _, err := s.failureCollection().DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		logger.Error("清除密码错误记录失败", zap.String("key", key), zap.Error(err))
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPasswordFailuresBlockUntilWindowEnds(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	resetAt := start.Add(passwordFailureWindow)
+
+	tests := []struct {
+		name  string
+		count int
+		now   time.Time
+		want  time.Duration
+	}{
+		{"below the limit", maxPasswordFailures - 1, start.Add(time.Minute), 0},
+		{"limit reached", maxPasswordFailures, start.Add(time.Minute), passwordFailureWindow - time.Minute},
+		{"over the limit", maxPasswordFailures + 3, start.Add(time.Minute), passwordFailureWindow - time.Minute},
+		{"window ended", maxPasswordFailures, resetAt, 0},
+		{"after the window", maxPasswordFailures, resetAt.Add(time.Second), 0},
+	}
+	for _, tt := range tests {
+		record := &passwordFailures{Key: "team-links|203.0.113.7", Count: tt.count, ResetAt: resetAt}
+		if got := record.wait(tt.now); got != tt.want {
+			t.Errorf("%s: wait = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
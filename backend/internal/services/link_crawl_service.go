@@ -0,0 +1,889 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// maxCrawlSeeds 单个任务最多的起始页面数
+	maxCrawlSeeds = 20
+	// maxFoundOnPages 每个链接最多保留的来源页面数
+	maxFoundOnPages = 20
+	// crawlSaveBatchSize 每批写入的链接数
+	crawlSaveBatchSize = 500
+	// crawlCancelPoll 检查取消标记的间隔
+	crawlCancelPoll = 5 * time.Second
+)
+
+// LinkCrawlConfig 站点爬取配置，请求中的深度和页面数不能超过这里的上限
+type LinkCrawlConfig struct {
+	DefaultDepth int           // 请求未指定深度时使用的深度
+	MaxDepth     int           // 允许的最大深度
+	MaxPages     int           // 单个任务最多抓取的页面数
+	MaxLinks     int           // 单个任务最多记录的站外链接数
+	Concurrency  int           // 同时抓取的页面数
+	PageTimeout  time.Duration // 单个页面的超时时间
+	MaxPageBytes int64         // 每个页面最多解析的字节数
+	UserAgent    string
+}
+
+// LinkCrawlService 站点爬取服务
+// 从自有站点的页面中发现站外链接并写入外链列表，记录链接所在页面，完成后交给批量检测任务检测；
+// 任务在创建它的实例上执行，状态保存在 link_crawl_jobs 集合中，执行期间定期更新心跳，心跳过期的任务由任意实例标记为失败
+type LinkCrawlService struct {
+	db          *mongo.Database
+	linkService *ExternalLinkService
+	checkJobs   *LinkCheckJobService
+	cfg         LinkCrawlConfig
+	worker      string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[primitive.ObjectID]context.CancelFunc
+}
+
+// NewLinkCrawlService 创建站点爬取服务，worker 为当前实例标识
+func NewLinkCrawlService(db *mongo.Database, linkService *ExternalLinkService, checkJobs *LinkCheckJobService, cfg LinkCrawlConfig, worker string) *LinkCrawlService {
+	if cfg.MaxDepth < 0 {
+		cfg.MaxDepth = 0
+	}
+	if cfg.DefaultDepth < 0 || cfg.DefaultDepth > cfg.MaxDepth {
+		cfg.DefaultDepth = cfg.MaxDepth
+	}
+	if cfg.MaxPages <= 0 {
+		cfg.MaxPages = 500
+	}
+	if cfg.MaxLinks <= 0 {
+		cfg.MaxLinks = 5000
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PageTimeout <= 0 {
+		cfg.PageTimeout = 15 * time.Second
+	}
+	if cfg.MaxPageBytes <= 0 {
+		cfg.MaxPageBytes = 2 << 20
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultPoliteUserAgent
+	}
+
+	return &LinkCrawlService{
+		db:          db,
+		linkService: linkService,
+		checkJobs:   checkJobs,
+		cfg:         cfg,
+		worker:      worker,
+		running:     make(map[primitive.ObjectID]context.CancelFunc),
+	}
+}
+
+// Start 启动服务，将执行实例已退出的未完成任务标记为失败（爬取进度只保存在执行实例的内存中，无法恢复）
+func (s *LinkCrawlService) Start(ctx context.Context) {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	jobs := s.db.Collection("link_crawl_jobs")
+	active := []string{models.LinkCrawlPending, models.LinkCrawlRunning}
+	const reason = "执行爬取的实例已退出，请重新创建任务"
+	if _, err := failOrphanedJobs(ctx, jobs, active, models.LinkCrawlFailed, reason); err != nil {
+		logger.Warn("重置中断的爬取任务失败", zap.Error(err))
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		reapOrphanedJobs(s.ctx, jobs, active, models.LinkCrawlFailed, reason)
+	}()
+
+	_, err := s.db.Collection("link_crawl_pages").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "job_id", Value: 1}, {Key: "crawled_at", Value: 1}},
+	})
+	if err != nil {
+		logger.Warn("创建爬取页面索引失败", zap.Error(err))
+	}
+}
+
+// Stop 停止服务并等待正在执行的任务退出
+func (s *LinkCrawlService) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// CreateJob 校验爬取范围并创建后台爬取任务
+func (s *LinkCrawlService) CreateJob(ctx context.Context, req models.LinkCrawlRequest) (*models.LinkCrawlJob, error) {
+	if s.ctx == nil {
+		return nil, errors.NewError("爬取服务未启动", http.StatusServiceUnavailable)
+	}
+
+	seeds, hosts, err := crawlScope(req.Seeds, req.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	depth := s.cfg.DefaultDepth
+	if req.MaxDepth != nil {
+		if *req.MaxDepth < 0 || *req.MaxDepth > s.cfg.MaxDepth {
+			return nil, errors.NewError(fmt.Sprintf("爬取深度范围为 0-%d", s.cfg.MaxDepth), http.StatusBadRequest)
+		}
+		depth = *req.MaxDepth
+	}
+	maxPages := req.MaxPages
+	if maxPages <= 0 || maxPages > s.cfg.MaxPages {
+		maxPages = s.cfg.MaxPages
+	}
+
+	now := time.Now()
+	job := &models.LinkCrawlJob{
+		ID:          primitive.NewObjectID(),
+		Status:      models.LinkCrawlPending,
+		Seeds:       seeds,
+		Hosts:       hosts,
+		MaxDepth:    depth,
+		MaxPages:    maxPages,
+		Category:    strings.TrimSpace(req.Category),
+		Check:       req.Check == nil || *req.Check,
+		Worker:      s.worker,
+		HeartbeatAt: &now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if actor := LinkActorFrom(ctx); actor != nil {
+		job.Owner = actor.OwnerKey()
+		job.CreatedBy = actor.UserID
+	}
+	if actor := restrictedActor(ctx); actor != nil {
+		job.Owners = actor.OwnerKeys()
+	}
+
+	if _, err := s.db.Collection("link_crawl_jobs").InsertOne(ctx, job); err != nil {
+		logger.Error("创建爬取任务失败", zap.Error(err))
+		return nil, errors.NewError("创建爬取任务失败", http.StatusInternalServerError)
+	}
+
+	jobCtx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.running[job.ID] = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, job.ID)
+			s.mu.Unlock()
+			cancel()
+		}()
+		s.run(jobCtx, job)
+	}()
+
+	return job, nil
+}
+
+// crawlScope 校验起始页面，返回去重后的起始页面和爬取范围内的主机
+func crawlScope(rawSeeds, rawHosts []string) ([]string, []string, error) {
+	if len(rawSeeds) == 0 {
+		return nil, nil, errors.NewError("请指定起始页面", http.StatusBadRequest)
+	}
+	if len(rawSeeds) > maxCrawlSeeds {
+		return nil, nil, errors.NewError(fmt.Sprintf("起始页面不能超过 %d 个", maxCrawlSeeds), http.StatusBadRequest)
+	}
+
+	hostSet := make(map[string]bool)
+	seen := make(map[string]bool)
+	seeds := make([]string, 0, len(rawSeeds))
+	for _, raw := range rawSeeds {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return nil, nil, errors.NewError(fmt.Sprintf("无效的起始页面: %s", raw), http.StatusBadRequest)
+		}
+		u.Fragment = ""
+		hostSet[strings.ToLower(u.Hostname())] = true
+		if seed := u.String(); !seen[seed] {
+			seen[seed] = true
+			seeds = append(seeds, seed)
+		}
+	}
+
+	for _, raw := range rawHosts {
+		host := strings.ToLower(strings.TrimSpace(raw))
+		if strings.Contains(host, "://") {
+			if u, err := url.Parse(host); err == nil {
+				host = u.Hostname()
+			}
+		}
+		if host != "" {
+			hostSet[host] = true
+		}
+	}
+
+	hosts := make([]string, 0, len(hostSet))
+	for host := range hostSet {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return seeds, hosts, nil
+}
+
+// GetJob 获取爬取任务
+func (s *LinkCrawlService) GetJob(ctx context.Context, id string) (*models.LinkCrawlJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+
+	var job models.LinkCrawlJob
+	if err := s.db.Collection("link_crawl_jobs").FindOne(ctx, jobScope(ctx, bson.M{"_id": objectID})).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("爬取任务不存在", http.StatusNotFound)
+		}
+		logger.Error("获取爬取任务失败", zap.String("job_id", id), zap.Error(err))
+		return nil, errors.NewError("获取爬取任务失败", http.StatusInternalServerError)
+	}
+
+	return &job, nil
+}
+
+// ListJobs 获取最近的爬取任务
+func (s *LinkCrawlService) ListJobs(ctx context.Context, limit int) ([]models.LinkCrawlJob, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	cursor, err := s.db.Collection("link_crawl_jobs").Find(ctx, jobScope(ctx, bson.M{}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		logger.Error("获取爬取任务列表失败", zap.Error(err))
+		return nil, errors.NewError("获取爬取任务列表失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.LinkCrawlJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		logger.Error("解析爬取任务列表失败", zap.Error(err))
+		return nil, errors.NewError("解析爬取任务列表失败", http.StatusInternalServerError)
+	}
+
+	return jobs, nil
+}
+
+// ListJobPages 分页获取任务抓取过的页面，failed 为空时返回全部
+func (s *LinkCrawlService) ListJobPages(ctx context.Context, id string, failed *bool, page, perPage int) (*models.LinkCrawlPageResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 500 {
+		perPage = 50
+	}
+	if _, err := s.GetJob(ctx, id); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"job_id": objectID}
+	if failed != nil {
+		filter["failed"] = *failed
+	}
+	total, err := s.db.Collection("link_crawl_pages").CountDocuments(ctx, filter)
+	if err != nil {
+		logger.Error("获取爬取页面总数失败", zap.Error(err))
+		return nil, errors.NewError("获取爬取页面失败", http.StatusInternalServerError)
+	}
+
+	cursor, err := s.db.Collection("link_crawl_pages").Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "crawled_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetSkip(int64((page-1)*perPage)).
+			SetLimit(int64(perPage)))
+	if err != nil {
+		logger.Error("获取爬取页面失败", zap.Error(err))
+		return nil, errors.NewError("获取爬取页面失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	response := &models.LinkCrawlPageResponse{Data: []models.LinkCrawlPage{}}
+	if err := cursor.All(ctx, &response.Data); err != nil {
+		logger.Error("解析爬取页面失败", zap.Error(err))
+		return nil, errors.NewError("解析爬取页面失败", http.StatusInternalServerError)
+	}
+
+	response.Meta.Total = int(total)
+	response.Meta.PerPage = perPage
+	response.Meta.CurrentPage = page
+	response.Meta.LastPage = int(math.Ceil(float64(total) / float64(perPage)))
+	return response, nil
+}
+
+// CancelJob 取消爬取任务，已发现的链接仍会写入，但不再创建检测任务
+func (s *LinkCrawlService) CancelJob(ctx context.Context, id string) (*models.LinkCrawlJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+
+	result, err := s.db.Collection("link_crawl_jobs").UpdateOne(ctx,
+		jobScope(ctx, bson.M{"_id": objectID, "status": bson.M{"$in": []string{models.LinkCrawlPending, models.LinkCrawlRunning}}}),
+		bson.M{"$set": bson.M{"cancel_requested": true, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		logger.Error("取消爬取任务失败", zap.Error(err))
+		return nil, errors.NewError("取消爬取任务失败", http.StatusInternalServerError)
+	}
+	if result.MatchedCount == 0 {
+		job, err := s.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return job, errors.NewError("任务已结束，无法取消", http.StatusConflict)
+	}
+
+	// 其他实例上的任务由其定期检查取消标记后停止
+	s.mu.Lock()
+	if cancel, ok := s.running[objectID]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	return s.GetJob(ctx, id)
+}
+
+// run 执行爬取任务
+func (s *LinkCrawlService) run(ctx context.Context, job *models.LinkCrawlJob) {
+	startedAt := time.Now()
+	s.updateJob(job.ID, bson.M{"status": models.LinkCrawlRunning, "started_at": startedAt, "heartbeat_at": startedAt})
+	logger.Info("开始执行爬取任务", zap.String("job_id", job.ID.Hex()), zap.Strings("seeds", job.Seeds), zap.Int("max_depth", job.MaxDepth))
+
+	// 心跳持续到写入最终状态，保存结果期间任务不会被其他实例判定为中断
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	defer stopHeartbeat()
+	go keepJobAlive(heartbeatCtx, s.db.Collection("link_crawl_jobs"), job.ID)
+
+	crawlCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.watchCancel(crawlCtx, cancel, job.ID)
+
+	crawler := newSiteCrawler(s, job)
+	crawler.crawl(crawlCtx)
+
+	update := bson.M{"status": models.LinkCrawlCompleted}
+	cancelled := crawlCtx.Err() != nil
+	if s.ctx.Err() != nil {
+		// 服务关闭，爬取进度无法恢复
+		update["status"] = models.LinkCrawlFailed
+		update["error"] = "服务关闭导致爬取中断，请重新创建任务"
+		update["finished_at"] = time.Now()
+		s.updateJob(job.ID, update)
+		return
+	}
+	if cancelled {
+		update["status"] = models.LinkCrawlCancelled
+	}
+
+	// 取消时也写入已发现的链接，使用独立的上下文
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer saveCancel()
+	linkIDs, err := crawler.saveLinks(saveCtx)
+	job.LinksCreated = crawler.created
+	update["links_created"] = job.LinksCreated
+	switch {
+	case err != nil:
+		update["status"] = models.LinkCrawlFailed
+		update["error"] = err.Error()
+		logger.Error("保存爬取结果失败", zap.String("job_id", job.ID.Hex()), zap.Error(err))
+	case !cancelled && job.Check && len(linkIDs) > 0:
+		checkJob, err := s.checkJobs.CreateJobForLinks(saveCtx, linkIDs, job.CreatedBy, job.Owners)
+		if err != nil {
+			update["error"] = "创建检测任务失败"
+		} else {
+			update["check_job_id"] = checkJob.ID
+		}
+	}
+
+	update["finished_at"] = time.Now()
+	s.updateJob(job.ID, update)
+	logger.Info("爬取任务结束",
+		zap.String("job_id", job.ID.Hex()),
+		zap.Any("status", update["status"]),
+		zap.Int("pages", crawler.pagesCrawled),
+		zap.Int("links", len(crawler.links)),
+		zap.Int("created", crawler.created))
+}
+
+// watchCancel 定期检查取消标记，在其他实例上请求的取消也能生效
+func (s *LinkCrawlService) watchCancel(ctx context.Context, cancel context.CancelFunc, id primitive.ObjectID) {
+	ticker := time.NewTicker(crawlCancelPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var job models.LinkCrawlJob
+		err := s.db.Collection("link_crawl_jobs").FindOne(ctx, bson.M{"_id": id},
+			options.FindOne().SetProjection(bson.M{"cancel_requested": 1})).Decode(&job)
+		if err == nil && job.CancelRequested {
+			cancel()
+			return
+		}
+	}
+}
+
+func (s *LinkCrawlService) updateJob(id primitive.ObjectID, fields bson.M) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields["updated_at"] = time.Now()
+	if _, err := s.db.Collection("link_crawl_jobs").UpdateOne(dbCtx, bson.M{"_id": id}, bson.M{"$set": fields}); err != nil {
+		logger.Error("更新爬取任务失败", zap.String("job_id", id.Hex()), zap.Error(err))
+	}
+}
+
+// crawledLink 爬取中发现的站外链接
+type crawledLink struct {
+	url        string
+	normalized string
+	pages      []string // 包含该链接的页面，最多 maxFoundOnPages 个
+}
+
+// siteCrawler 单个任务的爬取状态，按深度逐层抓取
+type siteCrawler struct {
+	service *LinkCrawlService
+	job     *models.LinkCrawlJob
+	client  *http.Client
+	hosts   map[string]bool
+
+	mu           sync.Mutex
+	visited      map[string]bool // 已加入抓取队列的页面
+	parsed       map[string]bool // 成功解析的页面，用于更新来源页面列表
+	links        map[string]*crawledLink
+	pagesCrawled int
+	pagesFailed  int
+	truncated    bool
+	created      int
+}
+
+func newSiteCrawler(s *LinkCrawlService, job *models.LinkCrawlJob) *siteCrawler {
+	hosts := make(map[string]bool, len(job.Hosts))
+	for _, host := range job.Hosts {
+		hosts[host] = true
+	}
+
+	// 与链接检测共用传输层，经默认代理访问并使用相同的 IP 协议和礼貌模式
+	client := &http.Client{
+		Timeout:   s.cfg.PageTimeout,
+		Transport: s.linkService.checkers.Transport(""),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("重定向次数过多")
+			}
+			return nil
+		},
+	}
+
+	return &siteCrawler{
+		service: s,
+		job:     job,
+		client:  client,
+		hosts:   hosts,
+		visited: make(map[string]bool),
+		parsed:  make(map[string]bool),
+		links:   make(map[string]*crawledLink),
+	}
+}
+
+// inScope 地址是否属于爬取范围内的主机
+func (c *siteCrawler) inScope(u *url.URL) bool {
+	return c.hosts[strings.ToLower(u.Hostname())]
+}
+
+// crawl 从起始页面开始逐层抓取，直到达到深度或页面数上限
+func (c *siteCrawler) crawl(ctx context.Context) {
+	level := make([]string, 0, len(c.job.Seeds))
+	for _, seed := range c.job.Seeds {
+		if len(c.visited) >= c.job.MaxPages {
+			c.truncated = true
+			break
+		}
+		c.visited[seed] = true
+		level = append(level, seed)
+	}
+
+	for depth := 0; len(level) > 0 && ctx.Err() == nil; depth++ {
+		var (
+			wg    sync.WaitGroup
+			next  []string
+			pages []interface{}
+		)
+		semaphore := make(chan struct{}, c.service.cfg.Concurrency)
+		for _, pageURL := range level {
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(pageURL string) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				page := c.fetchPage(ctx, pageURL, depth)
+				// 被取消时正在进行的请求结果不可信，不记录
+				if ctx.Err() != nil {
+					return
+				}
+
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				c.pagesCrawled++
+				if page.record.Failed {
+					c.pagesFailed++
+				}
+				if page.parsed {
+					c.parsed[page.record.URL] = true
+					page.record.Links = c.recordLinks(page.record.URL, page.outbound)
+				}
+				pages = append(pages, page.record)
+				if depth < c.job.MaxDepth {
+					next = append(next, c.enqueue(page.internal)...)
+				}
+			}(pageURL)
+		}
+		wg.Wait()
+
+		c.savePages(pages)
+		c.mu.Lock()
+		progress := bson.M{
+			"pages_crawled": c.pagesCrawled,
+			"pages_failed":  c.pagesFailed,
+			"links_found":   len(c.links),
+			"truncated":     c.truncated,
+		}
+		c.mu.Unlock()
+		c.service.updateJob(c.job.ID, progress)
+
+		level = next
+	}
+}
+
+// enqueue 将未访问过的站内页面加入下一层，调用方需持有锁
+func (c *siteCrawler) enqueue(internal []string) []string {
+	var queued []string
+	for _, link := range internal {
+		if c.visited[link] {
+			continue
+		}
+		if len(c.visited) >= c.job.MaxPages {
+			c.truncated = true
+			break
+		}
+		c.visited[link] = true
+		queued = append(queued, link)
+	}
+	return queued
+}
+
+// recordLinks 记录页面中的站外链接，返回页面中的站外链接数，调用方需持有锁
+func (c *siteCrawler) recordLinks(pageURL string, outbound []string) int {
+	count := 0
+	for _, raw := range outbound {
+		normalized, err := NormalizeURL(raw)
+		if err != nil {
+			continue
+		}
+		count++
+
+		link, ok := c.links[normalized]
+		if !ok {
+			if len(c.links) >= c.service.cfg.MaxLinks {
+				c.truncated = true
+				continue
+			}
+			link = &crawledLink{url: raw, normalized: normalized}
+			c.links[normalized] = link
+		}
+		if len(link.pages) < maxFoundOnPages && !containsString(link.pages, pageURL) {
+			link.pages = append(link.pages, pageURL)
+		}
+	}
+	return count
+}
+
+// crawledPage 单个页面的抓取结果
+type crawledPage struct {
+	record   models.LinkCrawlPage
+	parsed   bool     // 是否解析了页面内容
+	internal []string // 范围内的页面
+	outbound []string // 站外链接
+}
+
+// fetchPage 抓取页面并提取链接，重定向到范围外的页面和非 HTML 内容不解析
+func (c *siteCrawler) fetchPage(ctx context.Context, pageURL string, depth int) *crawledPage {
+	page := &crawledPage{record: models.LinkCrawlPage{
+		JobID:     c.job.ID,
+		URL:       pageURL,
+		Depth:     depth,
+		CrawledAt: time.Now(),
+	}}
+	fail := func(message string) *crawledPage {
+		page.record.Failed = true
+		page.record.Error = message
+		return page
+	}
+
+	policy := c.service.linkService.policies.Resolve(ctx, pageURL)
+	if err := c.service.linkService.policies.WaitTurn(ctx, pageURL, policy); err != nil {
+		return fail("爬取已取消")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return fail(fmt.Sprintf("创建请求失败: %v", err))
+	}
+	req.Header.Set("User-Agent", c.service.cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+	applyPolicyHeaders(req, policy)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if stderrors.Is(err, errRobotsDisallowed) {
+			return fail(errRobotsDisallowed.Error())
+		}
+		return fail(c.service.linkService.formatNetworkError(err))
+	}
+	defer resp.Body.Close()
+
+	page.record.StatusCode = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fail(fmt.Sprintf("页面返回状态码 %d", resp.StatusCode))
+	}
+	final := resp.Request.URL
+	if !c.inScope(final) {
+		return page
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return page
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, c.service.cfg.MaxPageBytes), contentType)
+	if err != nil {
+		return fail(fmt.Sprintf("读取页面失败: %v", err))
+	}
+	// 来源页面记录为重定向后的实际地址
+	page.record.URL = final.String()
+	page.parsed = true
+
+	for _, link := range extractPageLinks(body, final) {
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if c.inScope(u) {
+			page.internal = append(page.internal, link)
+		} else {
+			page.outbound = append(page.outbound, link)
+		}
+	}
+	return page
+}
+
+// savePages 保存一层抓取的页面记录
+func (c *siteCrawler) savePages(pages []interface{}) {
+	if len(pages) == 0 {
+		return
+	}
+	dbCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := c.service.db.Collection("link_crawl_pages").InsertMany(dbCtx, pages, options.InsertMany().SetOrdered(false)); err != nil {
+		logger.Warn("保存爬取页面失败", zap.String("job_id", c.job.ID.Hex()), zap.Error(err))
+	}
+}
+
+// saveLinks 分批写入发现的链接，返回全部链接的ID
+// 已存在的链接只更新来源页面：本次抓取过的页面以本次结果为准，其余页面保留之前的记录
+func (c *siteCrawler) saveLinks(ctx context.Context) ([]primitive.ObjectID, error) {
+	links := make([]*crawledLink, 0, len(c.links))
+	for _, link := range c.links {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].normalized < links[j].normalized })
+
+	ids := make([]primitive.ObjectID, 0, len(links))
+	for start := 0; start < len(links); start += crawlSaveBatchSize {
+		end := start + crawlSaveBatchSize
+		if end > len(links) {
+			end = len(links)
+		}
+		batchIDs, err := c.saveLinkBatch(ctx, links[start:end])
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, batchIDs...)
+	}
+	return ids, nil
+}
+
+func (c *siteCrawler) saveLinkBatch(ctx context.Context, batch []*crawledLink) ([]primitive.ObjectID, error) {
+	collection := c.service.db.Collection("external_links")
+
+	normalized := make([]string, len(batch))
+	for i, link := range batch {
+		normalized[i] = link.normalized
+	}
+	cursor, err := collection.Find(ctx,
+		bson.M{"normalized_url": bson.M{"$in": normalized}},
+		options.Find().SetProjection(bson.M{"normalized_url": 1, "found_on": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("查询已存在的链接失败: %w", err)
+	}
+	var existing []models.ExternalLink
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, fmt.Errorf("查询已存在的链接失败: %w", err)
+	}
+	byURL := make(map[string]models.ExternalLink, len(existing))
+	for _, link := range existing {
+		byURL[link.NormalizedURL] = link
+	}
+
+	now := time.Now()
+	var (
+		writes  []mongo.WriteModel
+		ids     []primitive.ObjectID
+		inserts = make(map[int]bool)
+	)
+	for _, link := range batch {
+		if found, ok := byURL[link.normalized]; ok {
+			ids = append(ids, found.ID)
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": found.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"found_on": c.mergeFoundOn(found.FoundOn, link.pages)}}))
+			continue
+		}
+
+		doc := models.ExternalLink{
+			ID:            primitive.NewObjectID(),
+			URL:           link.url,
+			NormalizedURL: link.normalized,
+			Category:      c.job.Category,
+			Status:        true,
+			IsValid:       true,
+			IsActive:      true,
+			Owner:         c.job.Owner,
+			CreatedBy:     c.job.CreatedBy,
+			UpdatedBy:     c.job.CreatedBy,
+			FoundOn:       link.pages,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		ids = append(ids, doc.ID)
+		inserts[len(writes)] = true
+		writes = append(writes, mongo.NewInsertOneModel().SetDocument(doc))
+	}
+
+	_, err = collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	failedInserts := 0
+	var bulkErr mongo.BulkWriteException
+	switch {
+	case err == nil:
+	case stderrors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+		// 无序写入时单条失败不影响其他链接，插入时重复说明链接刚被其他流程创建
+		for _, writeErr := range bulkErr.WriteErrors {
+			if inserts[writeErr.Index] {
+				failedInserts++
+			}
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				logger.Warn("写入爬取链接失败", zap.String("job_id", c.job.ID.Hex()), zap.String("error", writeErr.Message))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("写入链接失败: %w", err)
+	}
+	c.created += len(inserts) - failedInserts
+	return ids, nil
+}
+
+// mergeFoundOn 合并来源页面：本次解析过的页面以本次结果为准，其余页面保留
+func (c *siteCrawler) mergeFoundOn(previous, current []string) []string {
+	merged := append([]string{}, current...)
+	for _, page := range previous {
+		if len(merged) >= maxFoundOnPages {
+			break
+		}
+		if !c.parsed[page] && !containsString(merged, page) {
+			merged = append(merged, page)
+		}
+	}
+	return merged
+}
+
+// extractPageLinks 提取页面中 <a> 和 <area> 的链接，按 <base> 解析为绝对地址并去重
+func extractPageLinks(r io.Reader, base *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// 读完或达到长度限制
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "base":
+				if resolved := resolveMetadataURL(base, tokenAttrs(z, hasAttr)["href"]); resolved != "" {
+					base, _ = url.Parse(resolved)
+				}
+			case "a", "area":
+				link := resolveMetadataURL(base, tokenAttrs(z, hasAttr)["href"])
+				if link != "" && !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
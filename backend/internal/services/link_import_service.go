@@ -0,0 +1,821 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// importBatchSize 每批写入的链接数
+	importBatchSize = 500
+	// previewSampleSize 预演时返回的样例数
+	previewSampleSize = 20
+	// previewErrorLimit 预演时最多返回的错误行数
+	previewErrorLimit = 100
+)
+
+// importFields 支持导入的字段
+var importFields = []string{"url", "category", "is_active", "tags", "priority", "expires_at"}
+
+// LinkImportService 外链批量导入服务
+// 上传的文件先落盘，再由后台任务流式解析并分批写入，任务状态保存在 link_import_jobs 集合中；
+// 任务只能在保存了上传文件的实例上执行，执行期间定期更新心跳，心跳过期的任务由任意实例标记为失败
+type LinkImportService struct {
+	db      *mongo.Database
+	tempDir string
+	worker  string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLinkImportService 创建外链批量导入服务，worker 为当前实例标识
+func NewLinkImportService(db *mongo.Database, worker string) *LinkImportService {
+	return &LinkImportService{
+		db:      db,
+		tempDir: filepath.Join(os.TempDir(), "link-imports"),
+		worker:  worker,
+	}
+}
+
+// Start 启动服务，将执行实例已退出的未完成任务标记为失败（上传的临时文件只保存在执行实例上，无法由其他实例恢复）
+func (s *LinkImportService) Start(ctx context.Context) {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	if err := os.MkdirAll(s.tempDir, 0o755); err != nil {
+		logger.Warn("创建导入临时目录失败", zap.Error(err))
+	}
+
+	jobs := s.db.Collection("link_import_jobs")
+	active := []string{models.LinkImportPending, models.LinkImportRunning}
+	const reason = "执行导入的实例已退出，请重新上传"
+	if _, err := failOrphanedJobs(ctx, jobs, active, models.LinkImportFailed, reason); err != nil {
+		logger.Warn("重置中断的导入任务失败", zap.Error(err))
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		reapOrphanedJobs(s.ctx, jobs, active, models.LinkImportFailed, reason)
+	}()
+
+	_, err := s.db.Collection("link_import_errors").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "job_id", Value: 1}, {Key: "row", Value: 1}},
+	})
+	if err != nil {
+		logger.Warn("创建导入错误索引失败", zap.Error(err))
+	}
+}
+
+// Stop 停止服务并等待正在执行的导入结束当前批次
+func (s *LinkImportService) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Preview 预演导入：完整解析文件并校验、去重，但不写入数据库
+func (s *LinkImportService) Preview(ctx context.Context, file io.Reader, opts models.LinkImportOptions) (*models.LinkImportPreview, error) {
+	reader, err := newLinkRecordReader(file, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.LinkImportPreview{
+		Format: opts.Format,
+		Sample: []models.ExternalLink{},
+		Errors: []models.LinkImportRowError{},
+	}
+	addError := func(rowErr models.LinkImportRowError) {
+		if len(preview.Errors) < previewErrorLimit {
+			preview.Errors = append(preview.Errors, rowErr)
+		}
+	}
+
+	err = s.processRecords(ctx, reader, opts, func(batch []importRow) error {
+		existing, err := s.existingLinks(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for _, row := range batch {
+			preview.Total++
+			existingID, exists := existing[row.link.NormalizedURL]
+			switch {
+			case row.err != "":
+				preview.Failed++
+				addError(models.LinkImportRowError{Row: row.row, URL: row.link.URL, Reason: row.err})
+			case row.duplicate || exists:
+				preview.Duplicates++
+				addError(models.LinkImportRowError{Row: row.row, URL: row.link.URL, Reason: "链接已存在", ExistingID: existingID})
+			default:
+				preview.Valid++
+				if len(preview.Sample) < previewSampleSize {
+					preview.Sample = append(preview.Sample, row.link)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+// CreateJob 保存上传文件并创建后台导入任务
+func (s *LinkImportService) CreateJob(ctx context.Context, file io.Reader, fileName string, opts models.LinkImportOptions) (*models.LinkImportJob, error) {
+	if s.ctx == nil {
+		return nil, errors.NewError("导入服务未启动", http.StatusServiceUnavailable)
+	}
+	if err := validateImportOptions(opts); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &models.LinkImportJob{
+		ID:          primitive.NewObjectID(),
+		Status:      models.LinkImportPending,
+		FileName:    fileName,
+		Options:     opts,
+		Worker:      s.worker,
+		HeartbeatAt: &now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if actor := LinkActorFrom(ctx); actor != nil {
+		job.Owner = actor.OwnerKey()
+		job.CreatedBy = actor.UserID
+	}
+
+	path := filepath.Join(s.tempDir, job.ID.Hex())
+	out, err := os.Create(path)
+	if err != nil {
+		logger.Error("保存导入文件失败", zap.Error(err))
+		return nil, errors.NewError("保存导入文件失败", http.StatusInternalServerError)
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		os.Remove(path)
+		logger.Error("保存导入文件失败", zap.Error(err))
+		return nil, errors.NewError("保存导入文件失败", http.StatusInternalServerError)
+	}
+	out.Close()
+
+	if _, err := s.db.Collection("link_import_jobs").InsertOne(ctx, job); err != nil {
+		os.Remove(path)
+		logger.Error("创建导入任务失败", zap.Error(err))
+		return nil, errors.NewError("创建导入任务失败", http.StatusInternalServerError)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer os.Remove(path)
+		s.run(job, path)
+	}()
+
+	return job, nil
+}
+
+// GetJob 获取导入任务
+func (s *LinkImportService) GetJob(ctx context.Context, id string) (*models.LinkImportJob, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+
+	var job models.LinkImportJob
+	if err := s.db.Collection("link_import_jobs").FindOne(ctx, jobScope(ctx, bson.M{"_id": objectID})).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.NewError("导入任务不存在", http.StatusNotFound)
+		}
+		logger.Error("获取导入任务失败", zap.String("job_id", id), zap.Error(err))
+		return nil, errors.NewError("获取导入任务失败", http.StatusInternalServerError)
+	}
+
+	return &job, nil
+}
+
+// ListJobs 获取最近的导入任务
+func (s *LinkImportService) ListJobs(ctx context.Context, limit int) ([]models.LinkImportJob, error) {
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	cursor, err := s.db.Collection("link_import_jobs").Find(ctx, jobScope(ctx, bson.M{}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		logger.Error("获取导入任务列表失败", zap.Error(err))
+		return nil, errors.NewError("获取导入任务列表失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.LinkImportJob{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		logger.Error("解析导入任务列表失败", zap.Error(err))
+		return nil, errors.NewError("解析导入任务列表失败", http.StatusInternalServerError)
+	}
+
+	return jobs, nil
+}
+
+// ListJobErrors 分页获取导入任务的错误行
+func (s *LinkImportService) ListJobErrors(ctx context.Context, id string, page, perPage int) (*models.LinkImportErrorResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.NewError("无效的任务ID", http.StatusBadRequest)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 500 {
+		perPage = 50
+	}
+	if _, err := s.GetJob(ctx, id); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"job_id": objectID}
+	total, err := s.db.Collection("link_import_errors").CountDocuments(ctx, filter)
+	if err != nil {
+		logger.Error("获取导入错误总数失败", zap.Error(err))
+		return nil, errors.NewError("获取导入错误失败", http.StatusInternalServerError)
+	}
+
+	cursor, err := s.db.Collection("link_import_errors").Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "row", Value: 1}}).
+			SetSkip(int64((page-1)*perPage)).
+			SetLimit(int64(perPage)))
+	if err != nil {
+		logger.Error("获取导入错误失败", zap.Error(err))
+		return nil, errors.NewError("获取导入错误失败", http.StatusInternalServerError)
+	}
+	defer cursor.Close(ctx)
+
+	response := &models.LinkImportErrorResponse{Data: []models.LinkImportRowError{}}
+	if err := cursor.All(ctx, &response.Data); err != nil {
+		logger.Error("解析导入错误失败", zap.Error(err))
+		return nil, errors.NewError("解析导入错误失败", http.StatusInternalServerError)
+	}
+
+	response.Meta.Total = int(total)
+	response.Meta.PerPage = perPage
+	response.Meta.CurrentPage = page
+	response.Meta.LastPage = int(math.Ceil(float64(total) / float64(perPage)))
+	return response, nil
+}
+
+// run 执行导入任务
+func (s *LinkImportService) run(job *models.LinkImportJob, path string) {
+	ctx := s.ctx
+	startedAt := time.Now()
+	s.updateJob(job.ID, bson.M{"status": models.LinkImportRunning, "started_at": startedAt, "heartbeat_at": startedAt})
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go keepJobAlive(heartbeatCtx, s.db.Collection("link_import_jobs"), job.ID)
+
+	err := func() error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		reader, err := newLinkRecordReader(file, job.Options)
+		if err != nil {
+			return err
+		}
+
+		return s.processRecords(ctx, reader, job.Options, func(batch []importRow) error {
+			return s.importBatch(ctx, job, batch)
+		})
+	}()
+
+	finishedAt := time.Now()
+	update := bson.M{
+		"status":      models.LinkImportCompleted,
+		"finished_at": finishedAt,
+		"total":       job.Total,
+		"created":     job.Created,
+		"duplicates":  job.Duplicates,
+		"failed":      job.Failed,
+	}
+	if err != nil {
+		update["status"] = models.LinkImportFailed
+		update["error"] = err.Error()
+		logger.Error("导入任务失败", zap.String("job_id", job.ID.Hex()), zap.Error(err))
+	} else {
+		logger.Info("导入任务完成",
+			zap.String("job_id", job.ID.Hex()),
+			zap.Int("created", job.Created),
+			zap.Int("duplicates", job.Duplicates),
+			zap.Int("failed", job.Failed))
+	}
+	s.updateJob(job.ID, update)
+}
+
+// importBatch 写入一批链接并记录错误行
+func (s *LinkImportService) importBatch(ctx context.Context, job *models.LinkImportJob, batch []importRow) error {
+	existing, err := s.existingLinks(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	var (
+		docs      []interface{}
+		docRows   []importRow
+		rowErrors []interface{}
+	)
+	now := time.Now()
+	for _, row := range batch {
+		job.Total++
+		existingID, exists := existing[row.link.NormalizedURL]
+		switch {
+		case row.err != "":
+			job.Failed++
+			rowErrors = append(rowErrors, models.LinkImportRowError{JobID: job.ID, Row: row.row, URL: row.link.URL, Reason: row.err})
+		case row.duplicate || exists:
+			job.Duplicates++
+			rowErrors = append(rowErrors, models.LinkImportRowError{JobID: job.ID, Row: row.row, URL: row.link.URL, Reason: "链接已存在", ExistingID: existingID})
+		default:
+			link := row.link
+			link.CreatedAt = now
+			link.UpdatedAt = now
+			link.Owner = job.Owner
+			link.CreatedBy = job.CreatedBy
+			link.UpdatedBy = job.CreatedBy
+			link.Status = true
+			link.IsValid = true
+			docs = append(docs, link)
+			docRows = append(docRows, row)
+		}
+	}
+
+	if len(docs) > 0 {
+		_, err := s.db.Collection("external_links").InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		switch {
+		case err == nil:
+			job.Created += len(docs)
+		case stderrors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+			// 无序写入时单条失败不影响其他链接，失败的记为错误行
+			job.Created += len(docs) - len(bulkErr.WriteErrors)
+			for _, writeErr := range bulkErr.WriteErrors {
+				row := docRows[writeErr.Index]
+				reason := "写入失败"
+				if mongo.IsDuplicateKeyError(writeErr) {
+					reason = "链接已存在"
+				}
+				job.Failed++
+				rowErrors = append(rowErrors, models.LinkImportRowError{JobID: job.ID, Row: row.row, URL: row.link.URL, Reason: reason})
+			}
+		default:
+			return fmt.Errorf("写入链接失败: %w", err)
+		}
+	}
+	if len(rowErrors) > 0 {
+		if _, err := s.db.Collection("link_import_errors").InsertMany(ctx, rowErrors); err != nil {
+			logger.Warn("保存导入错误失败", zap.String("job_id", job.ID.Hex()), zap.Error(err))
+		}
+	}
+
+	s.updateJob(job.ID, bson.M{
+		"total":      job.Total,
+		"created":    job.Created,
+		"duplicates": job.Duplicates,
+		"failed":     job.Failed,
+	})
+	return nil
+}
+
+func (s *LinkImportService) updateJob(id primitive.ObjectID, fields bson.M) {
+	dbCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fields["updated_at"] = time.Now()
+	if _, err := s.db.Collection("link_import_jobs").UpdateOne(dbCtx, bson.M{"_id": id}, bson.M{"$set": fields}); err != nil {
+		logger.Error("更新导入任务失败", zap.String("job_id", id.Hex()), zap.Error(err))
+	}
+}
+
+// importRow 解析并校验后的一行
+type importRow struct {
+	row       int
+	link      models.ExternalLink
+	duplicate bool // 与文件中前面的行重复
+	err       string
+}
+
+// processRecords 流式读取记录，校验并按批交给 handle 处理
+func (s *LinkImportService) processRecords(ctx context.Context, reader linkRecordReader, opts models.LinkImportOptions, handle func([]importRow) error) error {
+	seen := make(map[string]bool)
+	batch := make([]importRow, 0, importBatchSize)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		row := buildImportRow(record, opts)
+		if row.err == "" {
+			row.duplicate = seen[row.link.NormalizedURL]
+			seen[row.link.NormalizedURL] = true
+		}
+		batch = append(batch, row)
+
+		if len(batch) == importBatchSize {
+			if err := handle(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		return handle(batch)
+	}
+	return nil
+}
+
+// existingLinks 查询一批链接中已存在于数据库的链接，返回规范化地址到已有链接ID的映射
+func (s *LinkImportService) existingLinks(ctx context.Context, batch []importRow) (map[string]string, error) {
+	normalized := make([]string, 0, len(batch))
+	for _, row := range batch {
+		if row.err == "" && !row.duplicate {
+			normalized = append(normalized, row.link.NormalizedURL)
+		}
+	}
+
+	existing := make(map[string]string)
+	if len(normalized) == 0 {
+		return existing, nil
+	}
+
+	cursor, err := s.db.Collection("external_links").Find(ctx,
+		bson.M{"normalized_url": bson.M{"$in": normalized}},
+		options.Find().SetProjection(bson.M{"normalized_url": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("查询已存在的链接失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID            primitive.ObjectID `bson:"_id"`
+			NormalizedURL string             `bson:"normalized_url"`
+		}
+		if err := cursor.Decode(&doc); err == nil {
+			existing[doc.NormalizedURL] = doc.ID.Hex()
+		}
+	}
+	return existing, cursor.Err()
+}
+
+// buildImportRow 将原始记录转换为外链并校验
+func buildImportRow(record *linkRecord, opts models.LinkImportOptions) importRow {
+	row := importRow{row: record.row}
+	row.link.URL = strings.TrimSpace(record.fields["url"])
+	row.link.Category = strings.TrimSpace(record.fields["category"])
+	if row.link.Category == "" {
+		row.link.Category = opts.DefaultCategory
+	}
+
+	row.link.IsActive = true
+	if raw := strings.TrimSpace(record.fields["is_active"]); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			row.err = fmt.Sprintf("is_active 无效: %s", raw)
+			return row
+		}
+		row.link.IsActive = active
+	}
+
+	tags, err := normalizeTags(splitTags(record.fields["tags"]))
+	if err != nil {
+		row.err = err.Error()
+		return row
+	}
+	if len(tags) > 0 {
+		row.link.Tags = tags
+	}
+	if raw := strings.TrimSpace(record.fields["priority"]); raw != "" {
+		priority, err := strconv.Atoi(raw)
+		if err != nil {
+			row.err = fmt.Sprintf("priority 无效: %s", raw)
+			return row
+		}
+		row.link.Priority = priority
+	}
+	if raw := strings.TrimSpace(record.fields["expires_at"]); raw != "" {
+		expiresAt, err := parseExpiresAt(raw)
+		if err != nil {
+			row.err = err.Error()
+			return row
+		}
+		row.link.ExpiresAt = &expiresAt
+	}
+
+	if row.link.URL == "" {
+		row.err = "缺少链接地址"
+		return row
+	}
+	parsed, err := url.Parse(row.link.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		row.err = "无效的链接地址"
+		return row
+	}
+	if row.link.NormalizedURL, err = NormalizeURL(row.link.URL); err != nil {
+		row.err = "无效的链接地址"
+	}
+	return row
+}
+
+// validateImportOptions 校验导入格式和字段映射
+func validateImportOptions(opts models.LinkImportOptions) error {
+	switch opts.Format {
+	case models.LinkFormatCSV, models.LinkFormatJSONL, models.LinkFormatBookmarks:
+	default:
+		return errors.NewError("不支持的文件格式，可选值: csv, jsonl, bookmarks", http.StatusBadRequest)
+	}
+
+	for field := range opts.Mapping {
+		supported := false
+		for _, name := range importFields {
+			if field == name {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return errors.NewError(fmt.Sprintf("不支持映射字段: %s", field), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// DetectLinkFormat 根据文件扩展名推断导入格式
+func DetectLinkFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return models.LinkFormatCSV
+	case ".jsonl", ".ndjson", ".json":
+		return models.LinkFormatJSONL
+	case ".html", ".htm":
+		return models.LinkFormatBookmarks
+	}
+	return ""
+}
+
+// linkRecord 从文件中读出的一条原始记录，fields 的键为目标字段名
+type linkRecord struct {
+	row    int
+	fields map[string]string
+}
+
+// linkRecordReader 流式读取导入记录，读完时返回 io.EOF
+type linkRecordReader interface {
+	Next() (*linkRecord, error)
+}
+
+func newLinkRecordReader(r io.Reader, opts models.LinkImportOptions) (linkRecordReader, error) {
+	if err := validateImportOptions(opts); err != nil {
+		return nil, err
+	}
+
+	switch opts.Format {
+	case models.LinkFormatCSV:
+		return newCSVRecordReader(r, opts.Mapping)
+	case models.LinkFormatJSONL:
+		return newJSONLRecordReader(r, opts.Mapping), nil
+	default:
+		return newBookmarkRecordReader(r), nil
+	}
+}
+
+// sourceName 返回目标字段在文件中对应的列名
+func sourceName(mapping map[string]string, field string) string {
+	if name, ok := mapping[field]; ok && name != "" {
+		return name
+	}
+	return field
+}
+
+// csvRecordReader 读取带表头的 CSV
+type csvRecordReader struct {
+	reader  *csv.Reader
+	columns map[string]int // 目标字段 -> 列序号
+	row     int
+}
+
+func newCSVRecordReader(r io.Reader, mapping map[string]string) (*csvRecordReader, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.NewError("无法读取CSV表头", http.StatusBadRequest)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // 去掉 Excel 导出的 BOM
+	}
+
+	columns := make(map[string]int)
+	for _, field := range importFields {
+		name := sourceName(mapping, field)
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), name) {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.NewError(fmt.Sprintf("CSV中找不到链接地址列: %s", sourceName(mapping, "url")), http.StatusBadRequest)
+	}
+
+	return &csvRecordReader{reader: reader, columns: columns, row: 1}, nil
+}
+
+// Next 读取下一行
+func (r *csvRecordReader) Next() (*linkRecord, error) {
+	values, err := r.reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("解析CSV失败: %w", err)
+	}
+	r.row++
+
+	record := &linkRecord{row: r.row, fields: make(map[string]string)}
+	for field, index := range r.columns {
+		if index < len(values) {
+			record.fields[field] = csvUncell(values[index])
+		}
+	}
+	return record, nil
+}
+
+// jsonlRecordReader 读取每行一个 JSON 对象的文件
+type jsonlRecordReader struct {
+	scanner *bufio.Scanner
+	mapping map[string]string
+	row     int
+}
+
+func newJSONLRecordReader(r io.Reader, mapping map[string]string) *jsonlRecordReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &jsonlRecordReader{scanner: scanner, mapping: mapping}
+}
+
+// Next 读取下一个非空行，单行解析失败时作为错误行返回而不中断导入
+func (r *jsonlRecordReader) Next() (*linkRecord, error) {
+	for r.scanner.Scan() {
+		r.row++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		record := &linkRecord{row: r.row, fields: make(map[string]string)}
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &values); err != nil {
+			// url 为空会在校验时记为错误行
+			return record, nil
+		}
+		for _, field := range importFields {
+			value, ok := values[sourceName(r.mapping, field)]
+			if !ok || value == nil {
+				continue
+			}
+			if list, isList := value.([]interface{}); isList {
+				// 标签可以写成数组
+				items := make([]string, 0, len(list))
+				for _, item := range list {
+					items = append(items, fmt.Sprint(item))
+				}
+				record.fields[field] = strings.Join(items, ",")
+				continue
+			}
+			record.fields[field] = fmt.Sprint(value)
+		}
+		return record, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取JSONL失败: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// bookmarkRecordReader 读取浏览器导出的 Netscape 书签文件，所在文件夹作为分类
+type bookmarkRecordReader struct {
+	tokenizer *html.Tokenizer
+	folders   []string
+	pending   string // 刚读到、尚未进入的文件夹名称
+	inFolder  bool   // 正在读取 H3 文件夹名称
+	row       int
+}
+
+func newBookmarkRecordReader(r io.Reader) *bookmarkRecordReader {
+	return &bookmarkRecordReader{tokenizer: html.NewTokenizer(r)}
+}
+
+// Next 读取下一个书签
+func (r *bookmarkRecordReader) Next() (*linkRecord, error) {
+	for {
+		switch r.tokenizer.Next() {
+		case html.ErrorToken:
+			err := r.tokenizer.Err()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("解析书签文件失败: %w", err)
+
+		case html.StartTagToken:
+			name, hasAttr := r.tokenizer.TagName()
+			switch string(name) {
+			case "h3":
+				r.inFolder = true
+				r.pending = ""
+			case "dl":
+				r.folders = append(r.folders, r.pending)
+				r.pending = ""
+			case "a":
+				href, tags := "", ""
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = r.tokenizer.TagAttr()
+					switch string(key) {
+					case "href":
+						href = string(value)
+					case "tags":
+						tags = string(value)
+					}
+				}
+				r.row++
+				record := &linkRecord{row: r.row, fields: map[string]string{"url": href, "tags": tags}}
+				if len(r.folders) > 0 {
+					record.fields["category"] = r.folders[len(r.folders)-1]
+				}
+				return record, nil
+			}
+
+		case html.TextToken:
+			if r.inFolder {
+				r.pending += strings.TrimSpace(string(r.tokenizer.Text()))
+			}
+
+		case html.EndTagToken:
+			name, _ := r.tokenizer.TagName()
+			switch string(name) {
+			case "h3":
+				r.inFolder = false
+			case "dl":
+				if len(r.folders) > 0 {
+					r.folders = r.folders[:len(r.folders)-1]
+				}
+			}
+		}
+	}
+}
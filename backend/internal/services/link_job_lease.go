@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// jobLeaseTTL 后台任务心跳超过该时长未更新，视为执行任务的实例已退出
+	jobLeaseTTL = time.Minute
+	// jobHeartbeatInterval 执行中的任务更新心跳的间隔
+	jobHeartbeatInterval = 10 * time.Second
+)
+
+// failOrphanedJobs 将执行实例已退出（心跳过期）的未完成任务标记为失败，其他实例正在执行的任务不受影响
+func failOrphanedJobs(ctx context.Context, collection *mongo.Collection, active []string, failed, reason string) (int64, error) {
+	now := time.Now()
+	result, err := collection.UpdateMany(ctx,
+		bson.M{
+			"status": bson.M{"$in": active},
+			"$or": []bson.M{
+				{"heartbeat_at": bson.M{"$lt": now.Add(-jobLeaseTTL)}},
+				{"heartbeat_at": bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			"status":      failed,
+			"error":       reason,
+			"finished_at": now,
+			"updated_at":  now,
+		}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// reapOrphanedJobs 定期清理执行实例已退出的任务，直到 ctx 结束
+func reapOrphanedJobs(ctx context.Context, collection *mongo.Collection, active []string, failed, reason string) {
+	ticker := time.NewTicker(jobLeaseTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n, err := failOrphanedJobs(ctx, collection, active, failed, reason); err != nil {
+			logger.Warn("清理中断的后台任务失败", zap.String("collection", collection.Name()), zap.Error(err))
+		} else if n > 0 {
+			logger.Info("已将中断的后台任务标记为失败", zap.String("collection", collection.Name()), zap.Int64("count", n))
+		}
+	}
+}
+
+// keepJobAlive 定期更新任务心跳，直到 ctx 结束
+func keepJobAlive(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"heartbeat_at": time.Now()}}); err != nil && ctx.Err() == nil {
+			logger.Warn("更新任务心跳失败", zap.String("collection", collection.Name()), zap.String("job_id", id.Hex()), zap.Error(err))
+		}
+	}
+}
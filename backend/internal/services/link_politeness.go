@@ -0,0 +1,453 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/logger"
+)
+
+const (
+	// defaultPoliteUserAgent 礼貌模式默认使用的 User-Agent
+	defaultPoliteUserAgent = "vite-pluginend-linkchecker/1.0"
+	// maxRobotsBytes robots.txt 最多读取的字节数
+	maxRobotsBytes = 500 << 10
+	// robotsFetchTimeout 获取 robots.txt 的超时时间
+	robotsFetchTimeout = 10 * time.Second
+	// robotsRetryAfter robots.txt 暂时无法获取时的缓存时长
+	robotsRetryAfter = 10 * time.Minute
+	// maxRobotsEntries 缓存的站点数超过该值时清理过期项
+	maxRobotsEntries = 10000
+)
+
+// errRobotsDisallowed robots.txt 禁止访问，礼貌模式下由传输层返回
+var errRobotsDisallowed = stderrors.New("robots.txt 禁止访问该地址")
+
+// spoofedHeaders 模拟浏览器时设置的请求头，礼貌模式下全部移除
+var spoofedHeaders = []string{
+	"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User",
+	"Sec-CH-UA", "Sec-CH-UA-Mobile", "Sec-CH-UA-Platform",
+	"Upgrade-Insecure-Requests", "DNT", "Referer", "X-Requested-With",
+}
+
+// LinkPolitenessConfig 礼貌检测模式配置
+type LinkPolitenessConfig struct {
+	Enabled         bool          // 是否启用礼貌模式
+	UserAgent       string        // 可识别的 User-Agent，robots.txt 按其产品名匹配规则组
+	RobotsCacheTTL  time.Duration // robots.txt 缓存时长
+	HostConcurrency int           // 同一主机同时进行中的请求数
+	MaxCrawlDelay   time.Duration // Crawl-delay 的上限，避免单个站点长时间占用检测任务
+}
+
+// ConfigurePoliteness 设置礼貌检测模式，未启用时检测行为不变
+func (s *ExternalLinkService) ConfigurePoliteness(cfg LinkPolitenessConfig) {
+	if !cfg.Enabled {
+		s.polite = nil
+		return
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultPoliteUserAgent
+	}
+	if cfg.HostConcurrency <= 0 {
+		cfg.HostConcurrency = 1
+	}
+	s.polite = newPoliteness(cfg)
+	if s.checkers != nil {
+		s.polite.client.Transport = s.checkers.proxyTransport("")
+	}
+	logger.Info("链接检测已启用礼貌模式", zap.String("user_agent", cfg.UserAgent), zap.Int("host_concurrency", cfg.HostConcurrency))
+}
+
+// politeTransport 礼貌模式下包装传输层，未启用时原样返回
+func (s *ExternalLinkService) politeTransport(next http.RoundTripper) http.RoundTripper {
+	if s.polite == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &politeRoundTripper{next: next, polite: s.polite}
+}
+
+// robotsDisallowed 礼貌模式下 robots.txt 是否禁止访问该地址
+func (s *ExternalLinkService) robotsDisallowed(ctx context.Context, rawURL string) bool {
+	if s.polite == nil {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	allowed, _ := s.polite.allowed(ctx, u)
+	return !allowed
+}
+
+// markSkippedByRobots 将检测结果标记为因 robots.txt 未检测
+func markSkippedByRobots(result *models.LinkCheckResult) {
+	result.IsValid = false
+	result.Skipped = true
+	result.SkipReason = models.LinkSkipRobots
+	result.Message = "robots.txt 禁止访问，未检测"
+	result.ErrorMessage = ""
+	result.ErrorClass = ""
+}
+
+// politeness 按主机缓存 robots.txt 并限制请求并发和间隔
+type politeness struct {
+	cfg    LinkPolitenessConfig
+	agent  string // User-Agent 的产品名，小写
+	client *http.Client
+
+	mu     sync.Mutex
+	robots map[string]*robotsEntry
+	hosts  map[string]*hostLimiter
+}
+
+type robotsEntry struct {
+	ready   chan struct{} // 获取完成后关闭，并发请求同一站点时只获取一次
+	rules   *robotsRules
+	expires time.Time
+}
+
+type hostLimiter struct {
+	slots  chan struct{}
+	nextAt time.Time
+}
+
+func newPoliteness(cfg LinkPolitenessConfig) *politeness {
+	agent := strings.ToLower(cfg.UserAgent)
+	if i := strings.IndexAny(agent, "/ "); i > 0 {
+		agent = agent[:i]
+	}
+	return &politeness{
+		cfg:   cfg,
+		agent: agent,
+		client: &http.Client{
+			Timeout: robotsFetchTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return fmt.Errorf("重定向次数过多")
+				}
+				return nil
+			},
+		},
+		robots: make(map[string]*robotsEntry),
+		hosts:  make(map[string]*hostLimiter),
+	}
+}
+
+// allowed 返回是否允许访问该地址以及站点要求的请求间隔
+func (p *politeness) allowed(ctx context.Context, u *url.URL) (bool, time.Duration) {
+	rules := p.rulesFor(ctx, u)
+	if rules == nil {
+		return true, 0
+	}
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	delay := rules.crawlDelay
+	if p.cfg.MaxCrawlDelay > 0 && delay > p.cfg.MaxCrawlDelay {
+		delay = p.cfg.MaxCrawlDelay
+	}
+	return rules.allowed(target), delay
+}
+
+// rulesFor 获取站点适用于本检测器的规则，优先使用缓存
+func (p *politeness) rulesFor(ctx context.Context, u *url.URL) *robotsRules {
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	p.mu.Lock()
+	entry, ok := p.robots[origin]
+	if ok {
+		select {
+		case <-entry.ready:
+			if time.Now().After(entry.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		if len(p.robots) >= maxRobotsEntries {
+			p.pruneRobots()
+		}
+		entry = &robotsEntry{ready: make(chan struct{})}
+		p.robots[origin] = entry
+		p.mu.Unlock()
+
+		entry.rules, entry.expires = p.fetchRobots(origin)
+		close(entry.ready)
+		return entry.rules
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.rules
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// pruneRobots 清理过期的 robots.txt 缓存，调用方需持有锁
+func (p *politeness) pruneRobots() {
+	now := time.Now()
+	for origin, entry := range p.robots {
+		select {
+		case <-entry.ready:
+			if now.After(entry.expires) {
+				delete(p.robots, origin)
+			}
+		default:
+		}
+	}
+}
+
+// fetchRobots 获取并解析 robots.txt，返回规则和缓存截止时间
+// 按 RFC 9309，4xx 视为没有限制；站点无法访问或返回 5xx 时同样放行，
+// 因为链接检测本身就需要发现站点不可用，短时间后重新获取
+func (p *politeness) fetchRobots(origin string) (*robotsRules, time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), robotsFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, time.Now().Add(robotsRetryAfter)
+	}
+	req.Header.Set("User-Agent", p.cfg.UserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		logger.Warn("获取 robots.txt 失败", zap.String("origin", origin), zap.Error(err))
+		return nil, time.Now().Add(robotsRetryAfter)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), p.agent), time.Now().Add(p.cfg.RobotsCacheTTL)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return nil, time.Now().Add(p.cfg.RobotsCacheTTL)
+	default:
+		logger.Warn("robots.txt 暂时不可用", zap.String("origin", origin), zap.Int("status", resp.StatusCode))
+		return nil, time.Now().Add(robotsRetryAfter)
+	}
+}
+
+// acquire 占用主机的一个并发名额，并按 Crawl-delay 等待到下一个请求时间
+func (p *politeness) acquire(ctx context.Context, host string, delay time.Duration) (func(), error) {
+	p.mu.Lock()
+	limiter, ok := p.hosts[host]
+	if !ok {
+		limiter = &hostLimiter{slots: make(chan struct{}, p.cfg.HostConcurrency)}
+		p.hosts[host] = limiter
+	}
+	p.mu.Unlock()
+
+	select {
+	case limiter.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-limiter.slots }
+
+	if delay > 0 {
+		p.mu.Lock()
+		now := time.Now()
+		slot := limiter.nextAt
+		if slot.Before(now) {
+			slot = now
+		}
+		limiter.nextAt = slot.Add(delay)
+		p.mu.Unlock()
+
+		if wait := time.Until(slot); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
+// politeRoundTripper 礼貌模式的传输层，重定向的每一跳都会经过
+type politeRoundTripper struct {
+	next   http.RoundTripper
+	polite *politeness
+}
+
+func (t *politeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	allowed, delay := t.polite.allowed(ctx, req.URL)
+	if !allowed {
+		return nil, errRobotsDisallowed
+	}
+
+	// 只限制收到响应头之前的阶段，读取响应体时不占用名额，避免同一次检测中的嵌套请求互相等待
+	release, err := t.polite.acquire(ctx, strings.ToLower(req.URL.Host), delay)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	req = req.Clone(ctx)
+	for _, name := range spoofedHeaders {
+		req.Header.Del(name)
+	}
+	req.Header.Set("User-Agent", t.polite.cfg.UserAgent)
+	return t.next.RoundTrip(req)
+}
+
+// robotsRules 适用于本检测器的 robots.txt 规则
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int // 原始规则长度，匹配多条时最长的优先
+	pattern *regexp.Regexp
+}
+
+// allowed 按 RFC 9309 判断路径是否允许访问：最长匹配优先，长度相同时 Allow 优先
+func (r *robotsRules) allowed(target string) bool {
+	best := -1
+	allow := true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best = rule.length
+			allow = rule.allow
+		}
+	}
+	return allow
+}
+
+// parseRobots 解析 robots.txt，返回与 agent 匹配的规则组，没有匹配时使用 * 组
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	var (
+		groups    []*group
+		current   *group
+		lastAgent bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRobotsBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// 连续的 User-Agent 行属于同一组
+			if current == nil || !lastAgent {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastAgent = true
+		case "allow", "disallow":
+			lastAgent = false
+			if current == nil || value == "" {
+				continue
+			}
+			if pattern, err := robotsPattern(value); err == nil {
+				current.rules.rules = append(current.rules.rules, robotsRule{
+					allow:   key == "allow",
+					length:  len(value),
+					pattern: pattern,
+				})
+			}
+		case "crawl-delay":
+			lastAgent = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			lastAgent = false
+		}
+	}
+
+	// 同一 User-Agent 出现在多个组时合并规则
+	merge := func(match func(string) bool) *robotsRules {
+		var merged *robotsRules
+		for _, g := range groups {
+			for _, name := range g.agents {
+				if !match(name) {
+					continue
+				}
+				if merged == nil {
+					merged = &robotsRules{}
+				}
+				merged.rules = append(merged.rules, g.rules.rules...)
+				if g.rules.crawlDelay > merged.crawlDelay {
+					merged.crawlDelay = g.rules.crawlDelay
+				}
+				break
+			}
+		}
+		return merged
+	}
+	if rules := merge(func(name string) bool { return name != "*" && name != "" && strings.Contains(agent, name) }); rules != nil {
+		return rules
+	}
+	if rules := merge(func(name string) bool { return name == "*" }); rules != nil {
+		return rules
+	}
+	return &robotsRules{}
+}
+
+// robotsPattern 将规则转换为正则，支持 * 通配和结尾的 $ 锚定
+func robotsPattern(value string) (*regexp.Regexp, error) {
+	anchored := strings.HasSuffix(value, "$")
+	value = strings.TrimSuffix(value, "$")
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.Compile(expr)
+}
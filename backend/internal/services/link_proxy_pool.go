@@ -0,0 +1,545 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/proxy"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/logger"
+)
+
+// 检测连接使用的 IP 协议
+const (
+	LinkIPv4 = "ipv4" // 只使用 IPv4
+	LinkIPv6 = "ipv6" // 只使用 IPv6
+	LinkDual = "dual" // 由系统决定，同时尝试 IPv4 和 IPv6
+)
+
+// defaultProxyCooldown 代理连接失败后默认暂停使用的时长
+const defaultProxyCooldown = time.Minute
+
+var (
+	// errProxyUnavailable 域名策略要求的代理均不可用或没有匹配的代理
+	errProxyUnavailable = stderrors.New("出站代理均不可用")
+	// errProxyRejected 代理拒绝转发请求，通常是认证失败或目标不在允许范围内
+	errProxyRejected = stderrors.New("代理拒绝转发请求")
+)
+
+// LinkProxyConfig 出站代理，URL 支持 http、https 和 socks5，认证信息写在 URL 中
+type LinkProxyConfig struct {
+	Name   string // 为空时使用代理的主机地址
+	URL    string
+	Region string // 代理出口所在地区，域名策略可以通过 region:<地区> 选择
+}
+
+// linkProxy 代理池中的单个代理及其统计
+type linkProxy struct {
+	name   string
+	region string
+	url    *url.URL
+
+	mu                  sync.Mutex
+	requests            int64
+	failures            int64
+	consecutiveFailures int
+	latencySum          time.Duration
+	latencyCount        int64
+	downUntil           time.Time
+	lastError           string
+	lastUsed            time.Time
+	lastFailure         time.Time
+}
+
+// available 代理当前是否可用，连接失败后在暂停期内视为不可用
+func (px *linkProxy) available(now time.Time) bool {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	return !now.Before(px.downUntil)
+}
+
+// resumeAt 暂停结束的时间
+func (px *linkProxy) resumeAt() time.Time {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+	return px.downUntil
+}
+
+// record 记录一次经该代理的请求，failure 为代理本身的错误，目标网站的错误不算代理失败
+// 连续失败时暂停时间翻倍，最长为 cooldown 的 8 倍
+func (px *linkProxy) record(now time.Time, latency time.Duration, failure error, cooldown time.Duration) {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+
+	px.requests++
+	px.lastUsed = now
+	if failure == nil {
+		px.consecutiveFailures = 0
+		px.downUntil = time.Time{}
+		px.latencySum += latency
+		px.latencyCount++
+		return
+	}
+
+	px.failures++
+	px.consecutiveFailures++
+	px.lastError = failure.Error()
+	px.lastFailure = now
+	shift := px.consecutiveFailures - 1
+	if shift > 3 {
+		shift = 3
+	}
+	px.downUntil = now.Add(cooldown << shift)
+}
+
+// stats 生成统计信息，代理地址中的密码会被隐去
+func (px *linkProxy) stats(now time.Time) models.LinkProxyStats {
+	px.mu.Lock()
+	defer px.mu.Unlock()
+
+	stats := models.LinkProxyStats{
+		Name:                px.name,
+		URL:                 px.url.Redacted(),
+		Region:              px.region,
+		Healthy:             !now.Before(px.downUntil),
+		Requests:            px.requests,
+		Failures:            px.failures,
+		ConsecutiveFailures: px.consecutiveFailures,
+		LastError:           px.lastError,
+	}
+	if !stats.Healthy {
+		downUntil := px.downUntil
+		stats.DownUntil = &downUntil
+	}
+	if px.latencyCount > 0 {
+		stats.AvgLatencyMs = (px.latencySum / time.Duration(px.latencyCount)).Milliseconds()
+	}
+	if !px.lastUsed.IsZero() {
+		lastUsed := px.lastUsed
+		stats.LastUsedAt = &lastUsed
+	}
+	if !px.lastFailure.IsZero() {
+		lastFailure := px.lastFailure
+		stats.LastFailureAt = &lastFailure
+	}
+	return stats
+}
+
+// linkProxyPool 出站代理池，按域名策略选择代理，连接失败的代理暂停使用一段时间
+type linkProxyPool struct {
+	clock    Clock
+	cooldown time.Duration
+	fallback string // 域名策略未指定代理时使用的选择
+
+	mu      sync.Mutex
+	proxies []*linkProxy          // 配置中的代理，按配置顺序
+	byName  map[string]*linkProxy // 包括域名策略中直接填写的代理地址
+	next    int                   // 轮询起点，使请求均匀分布到各个代理
+}
+
+// newLinkProxyPool 创建代理池，无效的代理配置记录日志后忽略
+func newLinkProxyPool(cfg LinkCheckerConfig, clock Clock) *linkProxyPool {
+	pool := &linkProxyPool{
+		clock:    clock,
+		cooldown: cfg.ProxyCooldown,
+		fallback: cfg.DefaultProxy,
+		byName:   make(map[string]*linkProxy),
+	}
+	if pool.cooldown <= 0 {
+		pool.cooldown = defaultProxyCooldown
+	}
+
+	for _, item := range cfg.Proxies {
+		if err := validateProxyURL(item.URL); err != nil {
+			logger.Error("忽略无效的出站代理配置", zap.String("name", item.Name), zap.Error(err))
+			continue
+		}
+		parsed, _ := url.Parse(item.URL)
+		name := item.Name
+		if name == "" {
+			name = parsed.Host
+		}
+		if _, exists := pool.byName[name]; exists {
+			logger.Error("忽略重名的出站代理配置", zap.String("name", name))
+			continue
+		}
+		px := &linkProxy{name: name, region: strings.ToLower(item.Region), url: parsed}
+		pool.proxies = append(pool.proxies, px)
+		pool.byName[name] = px
+	}
+	if len(pool.proxies) > 0 {
+		logger.Info("链接检测已配置出站代理", zap.Int("count", len(pool.proxies)), zap.String("default", pool.fallback))
+	}
+	return pool
+}
+
+// direct 按代理选择是否直连
+func (p *linkProxyPool) direct(selector string) bool {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		selector = p.fallback
+	}
+	return selector == "" || selector == models.LinkProxyDirect
+}
+
+// route 按代理选择返回本次检测依次尝试的代理，返回 nil 表示直连
+// 可用的代理按轮询顺序在前，暂停中的代理按恢复时间排在最后，全部暂停时仍会尝试
+func (p *linkProxyPool) route(selector string) ([]*linkProxy, error) {
+	if p.direct(selector) {
+		return nil, nil
+	}
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		selector = p.fallback
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var matched []*linkProxy
+	switch {
+	case strings.Contains(selector, "://"):
+		px, err := p.adhocLocked(selector)
+		if err != nil {
+			return nil, err
+		}
+		return []*linkProxy{px}, nil
+	case selector == models.LinkProxyPool:
+		matched = p.proxies
+	case strings.HasPrefix(selector, models.LinkProxyRegionPrefix):
+		region := strings.ToLower(strings.TrimPrefix(selector, models.LinkProxyRegionPrefix))
+		for _, px := range p.proxies {
+			if px.region == region {
+				matched = append(matched, px)
+			}
+		}
+	default:
+		if px := p.byName[selector]; px != nil {
+			matched = []*linkProxy{px}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: 没有与 %s 匹配的代理", errProxyUnavailable, selector)
+	}
+
+	start := p.next % len(matched)
+	p.next++
+	now := p.clock.Now()
+	up := make([]*linkProxy, 0, len(matched))
+	var down []*linkProxy
+	for i := range matched {
+		px := matched[(start+i)%len(matched)]
+		if px.available(now) {
+			up = append(up, px)
+		} else {
+			down = append(down, px)
+		}
+	}
+	sort.SliceStable(down, func(i, j int) bool {
+		return down[i].resumeAt().Before(down[j].resumeAt())
+	})
+	return append(up, down...), nil
+}
+
+// adhocLocked 域名策略直接填写的代理地址，按地址记录统计，调用方需持有锁
+func (p *linkProxyPool) adhocLocked(raw string) (*linkProxy, error) {
+	if px := p.byName[raw]; px != nil {
+		return px, nil
+	}
+	if err := validateProxyURL(raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", errProxyUnavailable, err)
+	}
+	parsed, _ := url.Parse(raw)
+	px := &linkProxy{name: parsed.Redacted(), url: parsed}
+	p.byName[raw] = px
+	return px, nil
+}
+
+// stats 所有代理的统计，配置中的代理在前，域名策略直接填写的代理在后
+func (p *linkProxyPool) stats() []models.LinkProxyStats {
+	p.mu.Lock()
+	configured := make(map[*linkProxy]bool, len(p.proxies))
+	list := make([]*linkProxy, 0, len(p.byName))
+	for _, px := range p.proxies {
+		configured[px] = true
+		list = append(list, px)
+	}
+	var adhoc []*linkProxy
+	for _, px := range p.byName {
+		if !configured[px] {
+			adhoc = append(adhoc, px)
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Slice(adhoc, func(i, j int) bool { return adhoc[i].name < adhoc[j].name })
+	list = append(list, adhoc...)
+
+	now := p.clock.Now()
+	stats := make([]models.LinkProxyStats, 0, len(list))
+	for _, px := range list {
+		stats = append(stats, px.stats(now))
+	}
+	return stats
+}
+
+// proxyFailure 判断请求失败是否是代理本身的问题：无法连接代理、代理认证失败或拒绝转发
+// SOCKS 代理对目标地址的答复（如目标拒绝连接）属于目标网站的问题
+func proxyFailure(outcome LinkCheckOutcome) error {
+	if outcome.Err == nil {
+		if outcome.StatusCode == http.StatusProxyAuthRequired {
+			return fmt.Errorf("%w: 代理要求认证", errProxyRejected)
+		}
+		return nil
+	}
+	if stderrors.Is(outcome.Err, errProxyRejected) {
+		return outcome.Err
+	}
+	var opErr *net.OpError
+	if stderrors.As(outcome.Err, &opErr) {
+		switch opErr.Op {
+		case "proxyconnect":
+			return outcome.Err
+		case "socks connect":
+			if opErr.Err != nil && !strings.HasPrefix(opErr.Err.Error(), "unknown error ") {
+				return outcome.Err
+			}
+		}
+	}
+	return nil
+}
+
+// Transport 爬取页面、读取元数据等辅助请求使用的传输层，与检测共用连接池、解析器、IP 协议和礼貌模式
+// selector 取值同 DomainPolicy.Proxy，为空时使用默认代理；连接代理失败时暂停该代理并切换到下一个
+func (c *LinkCheckers) Transport(selector string) http.RoundTripper {
+	transport := c.proxyTransport(selector)
+	if c.wrap != nil {
+		transport = c.wrap(transport)
+	}
+	return transport
+}
+
+// proxyTransport 同 Transport，但不经过礼貌模式，用于获取 robots.txt
+func (c *LinkCheckers) proxyTransport(selector string) http.RoundTripper {
+	return &poolRoundTripper{env: c, next: c.transport, selector: selector}
+}
+
+// resolverTransport DoH 查询使用的传输层，经默认代理访问；
+// DoH 服务器本身的地址不能再由检测解析器解析，改用系统解析并遵循 IP 协议配置
+func (c *LinkCheckers) resolverTransport() http.RoundTripper {
+	return &poolRoundTripper{env: c, next: &http.Transport{
+		Proxy:                  checkProxy,
+		OnProxyConnectResponse: onProxyConnectResponse,
+		DialContext:            c.dialSystem,
+		ForceAttemptHTTP2:      true,
+		MaxIdleConnsPerHost:    c.cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:        c.cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:    c.cfg.TLSHandshakeTimeout,
+	}}
+}
+
+// dialSystem 用系统解析建立连接，只使用配置的 IP 协议的地址
+func (c *LinkCheckers) dialSystem(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network == "tcp" {
+		switch c.cfg.IPFamily {
+		case LinkIPv4:
+			network = "tcp4"
+		case LinkIPv6:
+			network = "tcp6"
+		}
+	}
+	return c.dialer.DialContext(ctx, network, addr)
+}
+
+// poolRoundTripper 每次请求从代理池中选择代理，代理本身失败时依次尝试下一个
+type poolRoundTripper struct {
+	env      *LinkCheckers
+	next     http.RoundTripper
+	selector string
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (p *poolRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	route, err := p.env.proxies.route(p.selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(route) == 0 {
+		return p.next.RoundTrip(req)
+	}
+
+	var lastErr error
+	for _, px := range route {
+		start := p.env.clock.Now()
+		resp, err := p.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), checkProxyKey{}, px.url)))
+		outcome := LinkCheckOutcome{Err: err}
+		if resp != nil {
+			outcome.StatusCode = resp.StatusCode
+		}
+		failure := proxyFailure(outcome)
+		px.record(p.env.clock.Now(), p.env.clock.Now().Sub(start), failure, p.env.proxies.cooldown)
+		if failure == nil {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		logger.Warn("出站代理不可用，切换到下一个代理", zap.String("proxy", px.name), zap.String("url", req.URL.String()), zap.Error(failure))
+		lastErr = failure
+		// 请求体已被读取时无法重放
+		if req.Context().Err() != nil || (req.Body != nil && req.Body != http.NoBody) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", errProxyUnavailable, lastErr)
+}
+
+// onProxyConnectResponse 代理拒绝 CONNECT 请求时返回 errProxyRejected，以便切换到其他代理
+func onProxyConnectResponse(_ context.Context, _ *url.URL, _ *http.Request, resp *http.Response) error {
+	if resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %s", errProxyRejected, resp.Status)
+	}
+	return nil
+}
+
+// dialContext 用检测的解析器解析主机，再按配置的 IP 协议依次尝试解析到的地址
+func (c *LinkCheckers) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || network != "tcp" || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+
+	info := c.dns.lookup(ctx, host)
+	if !info.Resolved() {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: dnsLookupError(info)}
+	}
+	var ips []string
+	switch c.cfg.IPFamily {
+	case LinkIPv4:
+		ips = info.A
+	case LinkIPv6:
+		ips = info.AAAA
+	default:
+		ips = append(append(ips, info.A...), info.AAAA...)
+	}
+	if len(ips) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{
+			Err:    fmt.Sprintf("没有 %s 地址，检查 IP 协议配置", c.cfg.IPFamily),
+			Name:   host,
+			Server: info.Resolver,
+		}}
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// dialVia 经代理建立到 addr 的 TCP 连接，用于读取证书等不经过 http.Transport 的请求
+func (c *LinkCheckers) dialVia(ctx context.Context, px *url.URL, addr string) (net.Conn, error) {
+	if strings.EqualFold(px.Scheme, "socks5") {
+		dialer, err := proxy.FromURL(px, contextDialerFunc(c.dialContext))
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	}
+
+	conn, err := c.dialContext(ctx, "tcp", canonicalProxyAddr(px))
+	if err != nil {
+		return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+	}
+	if strings.EqualFold(px.Scheme, "https") {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: px.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if px.User != nil {
+		password, _ := px.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(px.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+	}
+	// 代理在客户端开始 TLS 握手前不会发送更多数据，这里可以直接丢弃缓冲区
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Err: err}
+	}
+	resp.Body.Close()
+	if err := onProxyConnectResponse(ctx, px, req, resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("代理转发失败: %s", resp.Status)
+	}
+	return conn, nil
+}
+
+// canonicalProxyAddr 代理的 host:port，未指定端口时按协议补全
+func canonicalProxyAddr(px *url.URL) string {
+	if px.Port() != "" {
+		return px.Host
+	}
+	port := "80"
+	switch strings.ToLower(px.Scheme) {
+	case "https":
+		port = "443"
+	case "socks5":
+		port = "1080"
+	}
+	return net.JoinHostPort(px.Hostname(), port)
+}
+
+// contextDialerFunc 将拨号函数适配为 proxy.Dialer 和 proxy.ContextDialer
+type contextDialerFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (f contextDialerFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+func (f contextDialerFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
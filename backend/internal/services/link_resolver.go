@@ -0,0 +1,683 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/idna"
+
+	"vite-pluginend/internal/models"
+)
+
+// 解析缓存的默认配置
+const (
+	defaultDNSTimeout     = 5 * time.Second
+	defaultDNSCacheTTL    = 5 * time.Minute
+	defaultDNSNegativeTTL = 30 * time.Second
+	dnsCacheSweepSize     = 1024 // 缓存条目超过该数量时清理过期条目
+	maxCNAMEChain         = 8
+)
+
+// LinkResolver 链接检测使用的域名解析器
+type LinkResolver interface {
+	Name() string
+	// Resolve 查询主机的 A、AAAA 记录和 CNAME 链，ttl 为记录的有效期，未知时返回 0
+	// 返回结果中的 Host、Resolver、LatencyMs 和 ResolvedAt 由调用方填写
+	Resolve(ctx context.Context, host string) (info models.DNSInfo, ttl time.Duration)
+}
+
+// NewLinkResolver 按配置创建解析器：
+// 为空或 system 使用系统解析；udp://host[:port] 或 host[:port] 直接查询指定的 DNS 服务器，响应被截断时改用 TCP；
+// https:// 开头的地址使用 DNS-over-HTTPS；stub:<文件> 只从本地文件解析，用于测试环境，格式见 loadStubResolver
+func NewLinkResolver(spec string) (LinkResolver, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "", spec == "system":
+		return systemResolver{}, nil
+	case strings.HasPrefix(spec, "stub:"):
+		return loadStubResolver(strings.TrimPrefix(spec, "stub:"))
+	case strings.HasPrefix(spec, "https://"):
+		endpoint, err := url.Parse(spec)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("无效的 DoH 地址: %s", spec)
+		}
+		return newDoHResolver(endpoint.String(), nil), nil
+	}
+
+	server := strings.TrimPrefix(spec, "udp://")
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	if host, _, _ := net.SplitHostPort(server); host == "" {
+		return nil, fmt.Errorf("无效的 DNS 服务器地址: %s", spec)
+	}
+	return newUDPResolver(server), nil
+}
+
+// systemResolver 使用系统解析，无法区分域名不存在和没有地址记录，也拿不到记录的 TTL
+type systemResolver struct{}
+
+func (systemResolver) Name() string {
+	return "system"
+}
+
+func (systemResolver) Resolve(ctx context.Context, host string) (models.DNSInfo, time.Duration) {
+	var info models.DNSInfo
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		info.Status = systemDNSStatus(err)
+		info.Error = err.Error()
+		return info, 0
+	}
+
+	info.Status = models.DNSStatusOK
+	for _, addr := range addrs {
+		if v4 := addr.IP.To4(); v4 != nil {
+			info.A = append(info.A, v4.String())
+		} else {
+			info.AAAA = append(info.AAAA, addr.IP.String())
+		}
+	}
+	if cname, err := net.DefaultResolver.LookupCNAME(ctx, host); err == nil {
+		if cname = strings.TrimSuffix(cname, "."); !strings.EqualFold(cname, host) {
+			info.CNAME = []string{cname}
+		}
+	}
+	return info, 0
+}
+
+// systemDNSStatus 按标准库的错误标记判断解析失败的类型
+func systemDNSStatus(err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case stderrors.As(err, &dnsErr) && dnsErr.IsTimeout, stderrors.Is(err, context.DeadlineExceeded):
+		return models.DNSStatusTimeout
+	case dnsErr != nil && dnsErr.IsNotFound:
+		return models.DNSStatusNXDomain
+	case dnsErr != nil && dnsErr.IsTemporary:
+		return models.DNSStatusServFail
+	}
+	return models.DNSStatusError
+}
+
+// wireResolver 自行构造 DNS 报文查询，可以拿到准确的响应码、CNAME 链和 TTL
+type wireResolver struct {
+	name     string
+	exchange func(ctx context.Context, query []byte) ([]byte, error)
+	doh      bool
+}
+
+// transportResolver 经 HTTP 查询的解析器，由检测策略集合替换为与检测一致的代理和 IP 协议
+type transportResolver interface {
+	withTransport(transport http.RoundTripper) LinkResolver
+}
+
+// newUDPResolver 直接查询指定的 DNS 服务器
+func newUDPResolver(server string) *wireResolver {
+	return &wireResolver{
+		name: "udp://" + server,
+		exchange: func(ctx context.Context, query []byte) ([]byte, error) {
+			return udpExchange(ctx, server, query)
+		},
+	}
+}
+
+// newDoHResolver 使用 DNS-over-HTTPS（RFC 8484）查询，DoH 服务器本身的地址由系统解析
+// transport 为空时使用标准库默认的传输层，由检测策略集合使用时会替换为经代理池的传输层
+func newDoHResolver(endpoint string, transport http.RoundTripper) *wireResolver {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client := &http.Client{Transport: transport}
+	return &wireResolver{
+		name: endpoint,
+		doh:  true,
+		exchange: func(ctx context.Context, query []byte) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(query))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/dns-message")
+			req.Header.Set("Accept", "application/dns-message")
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("DoH 服务器返回 %s", resp.Status)
+			}
+			return io.ReadAll(io.LimitReader(resp.Body, math.MaxUint16))
+		},
+	}
+}
+
+func (w *wireResolver) Name() string {
+	return w.name
+}
+
+// withTransport DoH 解析器返回使用指定传输层的副本，其他解析器原样返回
+func (w *wireResolver) withTransport(transport http.RoundTripper) LinkResolver {
+	if !w.doh {
+		return w
+	}
+	return newDoHResolver(w.name, transport)
+}
+
+func (w *wireResolver) Resolve(ctx context.Context, host string) (models.DNSInfo, time.Duration) {
+	types := [2]dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	var replies [2]*dnsmessage.Message
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i := range types {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replies[i], errs[i] = w.query(ctx, host, types[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var info models.DNSInfo
+	var statuses []string
+	ttl := uint32(math.MaxUint32)
+	for i, reply := range replies {
+		if errs[i] != nil {
+			status := models.DNSStatusError
+			var netErr net.Error
+			if stderrors.Is(errs[i], context.DeadlineExceeded) || (stderrors.As(errs[i], &netErr) && netErr.Timeout()) {
+				status = models.DNSStatusTimeout
+			}
+			statuses = append(statuses, status)
+			info.Error = errs[i].Error()
+			continue
+		}
+
+		switch reply.RCode {
+		case dnsmessage.RCodeSuccess:
+			statuses = append(statuses, models.DNSStatusNoData)
+		case dnsmessage.RCodeNameError:
+			statuses = append(statuses, models.DNSStatusNXDomain)
+		case dnsmessage.RCodeServerFailure:
+			statuses = append(statuses, models.DNSStatusServFail)
+		case dnsmessage.RCodeRefused:
+			statuses = append(statuses, models.DNSStatusRefused)
+		default:
+			statuses = append(statuses, models.DNSStatusError)
+			info.Error = "DNS 服务器返回 " + reply.RCode.String()
+		}
+
+		chain, addrs, minTTL := readAnswers(host, reply.Answers)
+		if len(info.CNAME) == 0 {
+			info.CNAME = chain
+		}
+		if types[i] == dnsmessage.TypeA {
+			info.A = addrs
+		} else {
+			info.AAAA = addrs
+		}
+		if minTTL < ttl {
+			ttl = minTTL
+		}
+	}
+
+	if len(info.A) > 0 || len(info.AAAA) > 0 {
+		info.Status = models.DNSStatusOK
+		info.Error = ""
+		return info, time.Duration(ttl) * time.Second
+	}
+	info.Status = worstDNSStatus(statuses)
+	return info, 0
+}
+
+// worstDNSStatus A 和 AAAA 都没有结果时取更明确的失败原因
+func worstDNSStatus(statuses []string) string {
+	for _, status := range []string{
+		models.DNSStatusNXDomain,
+		models.DNSStatusServFail,
+		models.DNSStatusRefused,
+		models.DNSStatusTimeout,
+		models.DNSStatusError,
+	} {
+		for _, s := range statuses {
+			if s == status {
+				return status
+			}
+		}
+	}
+	return models.DNSStatusNoData
+}
+
+// readAnswers 从应答中沿 CNAME 链读取地址记录，返回 CNAME 链、地址和最短 TTL
+func readAnswers(host string, answers []dnsmessage.Resource) ([]string, []string, uint32) {
+	var chain, addrs []string
+	ttl := uint32(math.MaxUint32)
+	name := strings.ToLower(host) + "."
+	for i := 0; i < maxCNAMEChain; i++ {
+		next := ""
+		for _, answer := range answers {
+			if cname, ok := answer.Body.(*dnsmessage.CNAMEResource); ok && strings.EqualFold(answer.Header.Name.String(), name) {
+				next = strings.ToLower(cname.CNAME.String())
+				if answer.Header.TTL < ttl {
+					ttl = answer.Header.TTL
+				}
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		chain = append(chain, strings.TrimSuffix(next, "."))
+		name = next
+	}
+
+	for _, answer := range answers {
+		if !strings.EqualFold(answer.Header.Name.String(), name) {
+			continue
+		}
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, net.IP(body.AAAA[:]).String())
+		default:
+			continue
+		}
+		if answer.Header.TTL < ttl {
+			ttl = answer.Header.TTL
+		}
+	}
+	return chain, addrs, ttl
+}
+
+// query 查询一种记录类型
+func (w *wireResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, fmt.Errorf("无效的域名: %w", err)
+	}
+	id := uint16(rand.Intn(math.MaxUint16 + 1))
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := w.exchange(ctx, packed)
+	if err != nil {
+		return nil, err
+	}
+	var reply dnsmessage.Message
+	if err := reply.Unpack(raw); err != nil {
+		return nil, fmt.Errorf("无法解析 DNS 响应: %w", err)
+	}
+	if reply.Header.ID != id || !reply.Header.Response {
+		return nil, stderrors.New("DNS 响应与查询不匹配")
+	}
+	return &reply, nil
+}
+
+// udpExchange 通过 UDP 发送查询，响应被截断时改用 TCP 重新查询
+func udpExchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	// 报文头第 3 个字节的 TC 标记
+	if n > 2 && buf[2]&0x02 != 0 {
+		return tcpExchange(ctx, server, query)
+	}
+	return buf[:n], nil
+}
+
+// tcpExchange 通过 TCP 发送查询，报文前带两个字节的长度
+func tcpExchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// stubResolver 只从预先配置的记录解析，没有配置的主机视为不存在，用于测试环境
+type stubResolver struct {
+	name    string
+	records map[string]models.DNSInfo
+}
+
+// NewStubResolver 使用固定记录的解析器，键为主机名，Status 为空的记录视为解析成功
+// 只有 CNAME 的记录会继续解析 CNAME 的目标
+func NewStubResolver(records map[string]models.DNSInfo) LinkResolver {
+	stub := &stubResolver{name: "stub", records: make(map[string]models.DNSInfo, len(records))}
+	for host, info := range records {
+		stub.records[strings.ToLower(host)] = info
+	}
+	return stub
+}
+
+// loadStubResolver 从文件读取解析记录，每行为“值 主机名...”，# 开头为注释
+// 值可以是 IP 地址、@目标主机名（CNAME）或 nxdomain、nodata、servfail、refused、timeout 之一，
+// 同一主机可以写多行以配置多个地址
+func loadStubResolver(path string) (LinkResolver, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 DNS 记录文件失败: %w", err)
+	}
+	defer file.Close()
+
+	records := make(map[string]models.DNSInfo)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			continue
+		}
+		value := strings.ToLower(fields[0])
+		for _, host := range fields[1:] {
+			host = strings.ToLower(host)
+			info := records[host]
+			switch {
+			case strings.HasPrefix(value, "@"):
+				info.CNAME = []string{strings.TrimPrefix(value, "@")}
+			case net.ParseIP(value) != nil && net.ParseIP(value).To4() != nil:
+				info.A = append(info.A, value)
+			case net.ParseIP(value) != nil:
+				info.AAAA = append(info.AAAA, value)
+			case value == models.DNSStatusNXDomain, value == models.DNSStatusNoData, value == models.DNSStatusServFail,
+				value == models.DNSStatusRefused, value == models.DNSStatusTimeout:
+				info.Status = value
+			default:
+				return nil, fmt.Errorf("DNS 记录文件第 %d 行无效: %s", line, scanner.Text())
+			}
+			records[host] = info
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 DNS 记录文件失败: %w", err)
+	}
+
+	stub := NewStubResolver(records).(*stubResolver)
+	stub.name = "stub:" + path
+	return stub, nil
+}
+
+func (s *stubResolver) Name() string {
+	return s.name
+}
+
+func (s *stubResolver) Resolve(_ context.Context, host string) (models.DNSInfo, time.Duration) {
+	var info models.DNSInfo
+	name := strings.ToLower(host)
+	for i := 0; i <= maxCNAMEChain; i++ {
+		record, ok := s.records[name]
+		if !ok {
+			info.Status = models.DNSStatusNXDomain
+			return info, 0
+		}
+		if record.Status != "" && record.Status != models.DNSStatusOK {
+			info.Status = record.Status
+			return info, 0
+		}
+		if len(record.A) > 0 || len(record.AAAA) > 0 {
+			info.A, info.AAAA = record.A, record.AAAA
+			info.Status = models.DNSStatusOK
+			return info, 0
+		}
+		if len(record.CNAME) == 0 {
+			info.Status = models.DNSStatusNoData
+			return info, 0
+		}
+		info.CNAME = append(info.CNAME, record.CNAME...)
+		name = strings.ToLower(record.CNAME[len(record.CNAME)-1])
+	}
+	info.Status = models.DNSStatusError
+	info.Error = "CNAME 链过长"
+	return info, 0
+}
+
+// dnsCache 按主机缓存解析结果，批量检测同一域名的大量链接时只解析一次，并发查询同一主机时共用一次解析
+type dnsCache struct {
+	resolver    LinkResolver
+	clock       Clock
+	timeout     time.Duration
+	ttl         time.Duration // 解析成功时的最长缓存时间，记录的 TTL 更短时以 TTL 为准
+	negativeTTL time.Duration // 解析失败时的缓存时间
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// dnsEntry 缓存条目，ready 关闭后 info 和 expires 才可读
+type dnsEntry struct {
+	ready   chan struct{}
+	info    models.DNSInfo
+	expires time.Time
+}
+
+func (e *dnsEntry) done() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// newDNSCache 创建解析缓存，未配置解析器时使用系统解析
+func newDNSCache(cfg LinkCheckerConfig, clock Clock) *dnsCache {
+	d := &dnsCache{
+		resolver:    cfg.Resolver,
+		clock:       clock,
+		timeout:     cfg.DNSTimeout,
+		ttl:         cfg.DNSCacheTTL,
+		negativeTTL: cfg.DNSNegativeTTL,
+		entries:     make(map[string]*dnsEntry),
+	}
+	if d.resolver == nil {
+		d.resolver = systemResolver{}
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultDNSTimeout
+	}
+	if d.ttl <= 0 {
+		d.ttl = defaultDNSCacheTTL
+	}
+	if d.negativeTTL <= 0 {
+		d.negativeTTL = defaultDNSNegativeTTL
+	}
+	return d
+}
+
+// lookup 解析主机，缓存有效期内直接返回缓存结果，Cached 标记结果是否来自缓存
+func (d *dnsCache) lookup(ctx context.Context, host string) models.DNSInfo {
+	host = normalizeDNSHost(host)
+	now := d.clock.Now()
+
+	d.mu.Lock()
+	entry := d.entries[host]
+	if entry != nil && entry.done() && !now.Before(entry.expires) {
+		entry = nil
+	}
+	owner := entry == nil
+	if owner {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		d.entries[host] = entry
+		if len(d.entries) > dnsCacheSweepSize {
+			d.sweepLocked(now)
+		}
+	}
+	d.mu.Unlock()
+
+	if owner {
+		d.resolve(ctx, host, entry)
+		return entry.info
+	}
+
+	select {
+	case <-entry.ready:
+		info := entry.info
+		info.Cached = true
+		return info
+	case <-ctx.Done():
+		return models.DNSInfo{
+			Host:       host,
+			Resolver:   d.resolver.Name(),
+			Status:     models.DNSStatusTimeout,
+			Error:      ctx.Err().Error(),
+			ResolvedAt: now,
+		}
+	}
+}
+
+// resolve 实际解析并写入缓存条目，检测取消时仍完成解析，以免等待同一主机的其他检测拿到取消的结果
+func (d *dnsCache) resolve(ctx context.Context, host string, entry *dnsEntry) {
+	lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.timeout)
+	defer cancel()
+
+	start := d.clock.Now()
+	info, ttl := d.resolver.Resolve(lookupCtx, host)
+	end := d.clock.Now()
+	info.Host = host
+	info.Resolver = d.resolver.Name()
+	info.LatencyMs = end.Sub(start).Milliseconds()
+	info.ResolvedAt = start
+
+	keep := d.negativeTTL
+	if info.Resolved() {
+		keep = d.ttl
+		if ttl > 0 && ttl < keep {
+			keep = ttl
+		}
+	}
+	entry.info = info
+	entry.expires = end.Add(keep)
+	close(entry.ready)
+}
+
+// sweepLocked 清理过期的缓存条目，调用方需持有锁
+func (d *dnsCache) sweepLocked(now time.Time) {
+	for host, entry := range d.entries {
+		if entry.done() && !now.Before(entry.expires) {
+			delete(d.entries, host)
+		}
+	}
+}
+
+// normalizeDNSHost 主机名转为小写的 ASCII 形式，国际化域名转为 punycode
+func normalizeDNSHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// dnsLookupError 将解析失败转换为 *net.DNSError，错误文本与标准库一致，沿用已有的错误分类
+func dnsLookupError(info models.DNSInfo) error {
+	err := &net.DNSError{Name: info.Host, Server: info.Resolver, Err: info.Error}
+	switch info.Status {
+	case models.DNSStatusNXDomain, models.DNSStatusNoData:
+		err.Err = "no such host"
+		err.IsNotFound = true
+	case models.DNSStatusServFail:
+		err.Err = "server misbehaving"
+		err.IsTemporary = true
+	case models.DNSStatusTimeout:
+		err.Err = "i/o timeout"
+		err.IsTimeout = true
+		err.IsTemporary = true
+	case models.DNSStatusRefused:
+		err.Err = "query refused"
+	}
+	if err.Err == "" {
+		err.Err = "lookup failed"
+	}
+	return err
+}
+
+// dnsErrorCode 解析失败对应的错误分类
+func dnsErrorCode(status string) models.LinkErrorCode {
+	switch status {
+	case models.DNSStatusNXDomain:
+		return models.LinkErrorDNSNXDomain
+	case models.DNSStatusServFail:
+		return models.LinkErrorDNSServFail
+	case models.DNSStatusTimeout:
+		return models.LinkErrorDNSTimeout
+	}
+	return models.LinkErrorDNS
+}
+
+// dnsFailureMessage 解析失败时的说明
+func dnsFailureMessage(info *models.DNSInfo) string {
+	switch info.Status {
+	case models.DNSStatusNXDomain:
+		return "域名不存在 (NXDOMAIN)，网站可能已停用或域名已过期"
+	case models.DNSStatusNoData:
+		return "域名存在但没有可用的地址记录"
+	case models.DNSStatusServFail:
+		return "DNS 服务器无法完成解析 (SERVFAIL)，可能是域名配置错误或权威服务器故障"
+	case models.DNSStatusRefused:
+		return "DNS 服务器拒绝查询 (REFUSED)"
+	case models.DNSStatusTimeout:
+		return "域名解析超时，DNS 服务器未响应"
+	}
+	if info.Error != "" {
+		return "域名解析失败: " + info.Error
+	}
+	return "域名解析失败"
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"vite-pluginend/internal/models"
+)
+
+// countingResolver 记录解析次数并返回固定的 TTL，gate 不为空时解析会等待 gate 关闭
+type countingResolver struct {
+	LinkResolver
+	ttl   time.Duration
+	gate  chan struct{}
+	calls atomic.Int32
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, host string) (models.DNSInfo, time.Duration) {
+	r.calls.Add(1)
+	if r.gate != nil {
+		<-r.gate
+	}
+	info, _ := r.LinkResolver.Resolve(ctx, host)
+	return info, r.ttl
+}
+
+func newTestDNSCache(resolver LinkResolver) (*dnsCache, *fakeClock) {
+	clock := newFakeClock()
+	return newDNSCache(LinkCheckerConfig{
+		Resolver:       resolver,
+		DNSCacheTTL:    5 * time.Minute,
+		DNSNegativeTTL: 30 * time.Second,
+	}, clock), clock
+}
+
+func TestDNSCacheSharesConcurrentLookupsPerHost(t *testing.T) {
+	resolver := &countingResolver{
+		LinkResolver: NewStubResolver(map[string]models.DNSInfo{
+			"example.com": {A: []string{"192.0.2.1"}},
+			"example.org": {A: []string{"192.0.2.2"}},
+		}),
+		gate: make(chan struct{}),
+	}
+	cache, _ := newTestDNSCache(resolver)
+
+	hosts := []string{"example.com", "Example.COM", "example.com."}
+	results := make([]models.DNSInfo, 30)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = cache.lookup(context.Background(), hosts[i%len(hosts)])
+		}(i)
+	}
+	for resolver.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(resolver.gate)
+	wg.Wait()
+
+	if calls := resolver.calls.Load(); calls != 1 {
+		t.Fatalf("resolver called %d times, want 1", calls)
+	}
+	fresh := 0
+	for _, info := range results {
+		if info.Status != models.DNSStatusOK || info.Host != "example.com" || len(info.A) != 1 || info.A[0] != "192.0.2.1" {
+			t.Fatalf("info = %+v, want example.com -> 192.0.2.1", info)
+		}
+		if !info.Cached {
+			fresh++
+		}
+	}
+	if fresh != 1 {
+		t.Fatalf("%d lookups were not marked cached, want only the one that resolved", fresh)
+	}
+
+	if info := cache.lookup(context.Background(), "example.org"); info.Cached || resolver.calls.Load() != 2 {
+		t.Fatalf("another host should be resolved separately, got %+v after %d calls", info, resolver.calls.Load())
+	}
+}
+
+func TestDNSCacheExpiresFailuresAfterNegativeTTL(t *testing.T) {
+	resolver := &countingResolver{LinkResolver: NewStubResolver(map[string]models.DNSInfo{
+		"up.example": {A: []string{"192.0.2.1"}},
+	})}
+	cache, clock := newTestDNSCache(resolver)
+	ctx := context.Background()
+
+	if info := cache.lookup(ctx, "gone.example"); info.Status != models.DNSStatusNXDomain || info.Cached {
+		t.Fatalf("info = %+v, want fresh NXDOMAIN", info)
+	}
+	cache.lookup(ctx, "up.example")
+
+	clock.Advance(29 * time.Second)
+	if info := cache.lookup(ctx, "gone.example"); !info.Cached {
+		t.Fatal("failure should stay cached within the negative TTL")
+	}
+	clock.Advance(time.Second)
+	if info := cache.lookup(ctx, "gone.example"); info.Cached {
+		t.Fatal("failure should be resolved again once the negative TTL has passed")
+	}
+	if info := cache.lookup(ctx, "up.example"); !info.Cached {
+		t.Fatal("successful lookup should outlive the negative TTL")
+	}
+	if calls := resolver.calls.Load(); calls != 3 {
+		t.Fatalf("resolver called %d times, want 3", calls)
+	}
+
+	clock.Advance(5 * time.Minute)
+	if info := cache.lookup(ctx, "up.example"); info.Cached {
+		t.Fatal("successful lookup should expire after the cache TTL")
+	}
+}
+
+func TestDNSCacheHonoursShorterRecordTTL(t *testing.T) {
+	resolver := &countingResolver{
+		LinkResolver: NewStubResolver(map[string]models.DNSInfo{"up.example": {A: []string{"192.0.2.1"}}}),
+		ttl:          10 * time.Second,
+	}
+	cache, clock := newTestDNSCache(resolver)
+	ctx := context.Background()
+
+	cache.lookup(ctx, "up.example")
+	clock.Advance(9 * time.Second)
+	if info := cache.lookup(ctx, "up.example"); !info.Cached {
+		t.Fatal("lookup should be cached within the record TTL")
+	}
+	clock.Advance(time.Second)
+	if info := cache.lookup(ctx, "up.example"); info.Cached {
+		t.Fatal("lookup should expire with the record TTL")
+	}
+}
+
+func TestDNSCacheClassifiesFailures(t *testing.T) {
+	cache, _ := newTestDNSCache(NewStubResolver(map[string]models.DNSInfo{
+		"nx.example":       {Status: models.DNSStatusNXDomain},
+		"servfail.example": {Status: models.DNSStatusServFail},
+		"timeout.example":  {Status: models.DNSStatusTimeout},
+	}))
+
+	tests := []struct {
+		host   string
+		status string
+		code   models.LinkErrorCode
+	}{
+		{"nx.example", models.DNSStatusNXDomain, models.LinkErrorDNSNXDomain},
+		{"unknown.example", models.DNSStatusNXDomain, models.LinkErrorDNSNXDomain},
+		{"servfail.example", models.DNSStatusServFail, models.LinkErrorDNSServFail},
+		{"timeout.example", models.DNSStatusTimeout, models.LinkErrorDNSTimeout},
+	}
+	for _, tt := range tests {
+		info := cache.lookup(context.Background(), tt.host)
+		if info.Status != tt.status {
+			t.Errorf("%s: status = %q, want %q", tt.host, info.Status, tt.status)
+			continue
+		}
+		if code := dnsErrorCode(info.Status); code != tt.code {
+			t.Errorf("%s: dnsErrorCode = %q, want %q", tt.host, code, tt.code)
+		}
+		if code := classifyCheckError(dnsLookupError(info)); code != tt.code {
+			t.Errorf("%s: classifyCheckError = %q, want %q", tt.host, code, tt.code)
+		}
+	}
+}
+
+func TestDNSCacheWaiterTimesOutWhileLookupIsInFlight(t *testing.T) {
+	resolver := &countingResolver{
+		LinkResolver: NewStubResolver(map[string]models.DNSInfo{"slow.example": {A: []string{"192.0.2.1"}}}),
+		gate:         make(chan struct{}),
+	}
+	cache, _ := newTestDNSCache(resolver)
+
+	done := make(chan models.DNSInfo)
+	go func() { done <- cache.lookup(context.Background(), "slow.example") }()
+	for resolver.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if info := cache.lookup(ctx, "slow.example"); info.Status != models.DNSStatusTimeout {
+		t.Fatalf("waiter info = %+v, want timeout", info)
+	}
+	close(resolver.gate)
+	if info := <-done; info.Status != models.DNSStatusOK {
+		t.Fatalf("owner info = %+v, want the resolved record", info)
+	}
+}
+
+// rcodeResolver 直接按查询构造响应的解析器，err 不为空时模拟查询失败
+func rcodeResolver(rcode dnsmessage.RCode, err error) *wireResolver {
+	return &wireResolver{
+		name: "test",
+		exchange: func(ctx context.Context, query []byte) ([]byte, error) {
+			if err != nil {
+				return nil, err
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(query); err != nil {
+				return nil, err
+			}
+			msg.Header.Response = true
+			msg.Header.RCode = rcode
+			return msg.Pack()
+		},
+	}
+}
+
+func TestWireResolverClassifiesResponseCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver *wireResolver
+		status   string
+	}{
+		{"nxdomain", rcodeResolver(dnsmessage.RCodeNameError, nil), models.DNSStatusNXDomain},
+		{"servfail", rcodeResolver(dnsmessage.RCodeServerFailure, nil), models.DNSStatusServFail},
+		{"refused", rcodeResolver(dnsmessage.RCodeRefused, nil), models.DNSStatusRefused},
+		{"nodata", rcodeResolver(dnsmessage.RCodeSuccess, nil), models.DNSStatusNoData},
+		{"timeout", rcodeResolver(0, context.DeadlineExceeded), models.DNSStatusTimeout},
+	}
+	for _, tt := range tests {
+		info, ttl := tt.resolver.Resolve(context.Background(), "example.com")
+		if info.Status != tt.status || ttl != 0 {
+			t.Errorf("%s: status = %q ttl = %v, want %q and no TTL", tt.name, info.Status, ttl, tt.status)
+		}
+	}
+}
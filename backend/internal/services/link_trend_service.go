@@ -0,0 +1,537 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	_ "time/tzdata" // 容器中可能没有系统时区数据
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// 趋势时间粒度
+const (
+	TrendIntervalHour  = "hour"
+	TrendIntervalDay   = "day"
+	TrendIntervalWeek  = "week"
+	TrendIntervalMonth = "month"
+)
+
+const (
+	// maxTrendBuckets 单次查询最多返回的时间桶数量
+	maxTrendBuckets = 1000
+	// trendCacheTTL 趋势查询结果缓存时长
+	trendCacheTTL = time.Minute
+)
+
+// defaultTrendLimits 未指定开始时间时各粒度默认返回的时间桶数量
+var defaultTrendLimits = map[string]int{
+	TrendIntervalHour:  24,
+	TrendIntervalDay:   7,
+	TrendIntervalWeek:  4,
+	TrendIntervalMonth: 6,
+}
+
+// trendCounts 一个小时内的各项计数
+type trendCounts struct {
+	Clicks        int `bson:"clicks"`
+	NewLinks      int `bson:"new_links"`
+	ChecksValid   int `bson:"checks_valid"`
+	ChecksInvalid int `bson:"checks_invalid"`
+}
+
+func (c *trendCounts) add(other trendCounts) {
+	c.Clicks += other.Clicks
+	c.NewLinks += other.NewLinks
+	c.ChecksValid += other.ChecksValid
+	c.ChecksInvalid += other.ChecksInvalid
+}
+
+// hourBucket 将时间字段截断到 UTC 整点，兼容不支持 $dateTrunc 的 MongoDB 版本
+func hourBucket(field string) bson.M {
+	return bson.M{"$dateFromString": bson.M{"dateString": bson.M{
+		"$dateToString": bson.M{"format": "%Y-%m-%dT%H:00:00Z", "date": field},
+	}}}
+}
+
+// trendKey 趋势汇总的分组，不按所有者汇总时 Owner 为空
+type trendKey struct {
+	Hour  time.Time `bson:"hour"`
+	Owner string    `bson:"owner"`
+}
+
+// aggregateTrendHours 从点击事件、外链创建时间和检测记录中按小时统计 [from, until) 内的计数，from 为零值时不限开始时间
+func (s *ExternalLinkService) aggregateTrendHours(ctx context.Context, from, until time.Time) (map[time.Time]*trendCounts, error) {
+	grouped, err := s.aggregateTrends(ctx, from, until, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sumTrendHours(grouped), nil
+}
+
+// aggregateTrends 按小时统计计数，byOwner 时同时按链接当前的所有者分组，未分配所有者记为空字符串
+// owners 不为 nil 时只统计这些所有者；点击和检测记录通过 link_id 关联链接，已删除链接的记录不计入
+func (s *ExternalLinkService) aggregateTrends(ctx context.Context, from, until time.Time, byOwner bool, owners []string) (map[trendKey]*trendCounts, error) {
+	result := make(map[trendKey]*trendCounts)
+	sources := []struct {
+		collection string
+		timeField  string
+		group      bson.M
+	}{
+		{"link_click_events", "clicked_at", bson.M{"clicks": bson.M{"$sum": 1}}},
+		{"external_links", "created_at", bson.M{"new_links": bson.M{"$sum": 1}}},
+		{"link_checks", "checked_at", bson.M{
+			"checks_valid":   bson.M{"$sum": bson.M{"$cond": bson.A{"$is_valid", 1, 0}}},
+			"checks_invalid": bson.M{"$sum": bson.M{"$cond": bson.A{"$is_valid", 0, 1}}},
+		}},
+	}
+
+	for _, source := range sources {
+		match := bson.M{"$lt": until}
+		if !from.IsZero() {
+			match["$gte"] = from
+		}
+		pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{source.timeField: match}}}}
+		id := bson.M{"hour": hourBucket("$" + source.timeField)}
+		if byOwner {
+			owner := "$owner"
+			if source.collection != "external_links" {
+				pipeline = append(pipeline,
+					bson.D{{Key: "$lookup", Value: bson.M{"from": "external_links", "localField": "link_id", "foreignField": "_id", "as": "link"}}},
+					bson.D{{Key: "$unwind", Value: "$link"}},
+				)
+				owner = "$link.owner"
+			}
+			pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{"trend_owner": bson.M{"$ifNull": bson.A{owner, ""}}}}})
+			if owners != nil {
+				pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"trend_owner": bson.M{"$in": owners}}}})
+			}
+			id["owner"] = "$trend_owner"
+		}
+		group := bson.M{"_id": id}
+		for key, value := range source.group {
+			group[key] = value
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$group", Value: group}})
+
+		cursor, err := s.db.Collection(source.collection).Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("统计 %s 失败: %w", source.collection, err)
+		}
+		for cursor.Next(ctx) {
+			var row struct {
+				Key         trendKey `bson:"_id"`
+				trendCounts `bson:",inline"`
+			}
+			if err := cursor.Decode(&row); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			counts, ok := result[row.Key]
+			if !ok {
+				counts = &trendCounts{}
+				result[row.Key] = counts
+			}
+			counts.add(row.trendCounts)
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// sumTrendHours 合并各所有者的计数，只保留小时维度
+func sumTrendHours(grouped map[trendKey]*trendCounts) map[time.Time]*trendCounts {
+	hours := make(map[time.Time]*trendCounts)
+	for key, counts := range grouped {
+		total, ok := hours[key.Hour]
+		if !ok {
+			total = &trendCounts{}
+			hours[key.Hour] = total
+		}
+		total.add(*counts)
+	}
+	return hours
+}
+
+// trendRolledUntil 读取趋势汇总进度，stateKey 为 trends 或 trends_owner
+func (s *ExternalLinkService) trendRolledUntil(ctx context.Context, stateKey string) (time.Time, error) {
+	var state struct {
+		RolledUntil time.Time `bson:"rolled_until"`
+	}
+	err := s.db.Collection("link_check_rollup_state").FindOne(ctx, bson.M{"_id": stateKey}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return time.Time{}, err
+	}
+	return state.RolledUntil, nil
+}
+
+// RollupTrends 将 until 之前已结束且尚未汇总的小时写入 link_trend_hourly
+// 每次只处理新的整小时并整体覆盖对应文档，中断后重复执行是幂等的；首次执行会汇总全部历史数据
+func (s *ExternalLinkService) RollupTrends(ctx context.Context, until time.Time) error {
+	until = until.UTC().Truncate(time.Hour)
+
+	rolledUntil, err := s.trendRolledUntil(ctx, "trends")
+	if err != nil {
+		logger.Error("读取趋势汇总进度失败", zap.Error(err))
+		return err
+	}
+	if !rolledUntil.Before(until) {
+		return nil
+	}
+
+	hours, err := s.aggregateTrendHours(ctx, rolledUntil, until)
+	if err != nil {
+		logger.Error("统计趋势数据失败", zap.Error(err))
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(hours))
+	for hour, counts := range hours {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": hour}).
+			SetReplacement(counts).
+			SetUpsert(true))
+	}
+	if err := s.saveTrendRollup(ctx, "link_trend_hourly", "trends", writes, until); err != nil {
+		return err
+	}
+
+	logger.Info("趋势数据汇总完成", zap.Time("until", until), zap.Int("hours", len(hours)))
+	return nil
+}
+
+// EnsureTrendIndexes 创建按所有者汇总的趋势数据索引，全局汇总以小时为 _id 不需要额外索引
+func (s *ExternalLinkService) EnsureTrendIndexes(ctx context.Context) error {
+	_, err := s.db.Collection("link_trend_owner_hourly").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "owner", Value: 1}, {Key: "hour", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.Error("创建所有者趋势汇总索引失败", zap.Error(err))
+	}
+	return err
+}
+
+// RollupOwnerTrends 按所有者将 until 之前已结束且尚未汇总的小时写入 link_trend_owner_hourly
+// 计数归属于汇总时链接的所有者，之后转移所有权不会改变已汇总的历史数据
+func (s *ExternalLinkService) RollupOwnerTrends(ctx context.Context, until time.Time) error {
+	until = until.UTC().Truncate(time.Hour)
+
+	rolledUntil, err := s.trendRolledUntil(ctx, "trends_owner")
+	if err != nil {
+		logger.Error("读取所有者趋势汇总进度失败", zap.Error(err))
+		return err
+	}
+	if !rolledUntil.Before(until) {
+		return nil
+	}
+
+	grouped, err := s.aggregateTrends(ctx, rolledUntil, until, true, nil)
+	if err != nil {
+		logger.Error("按所有者统计趋势数据失败", zap.Error(err))
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(grouped))
+	for key, counts := range grouped {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"hour": key.Hour, "owner": key.Owner}).
+			SetReplacement(bson.M{
+				"hour": key.Hour, "owner": key.Owner,
+				"clicks": counts.Clicks, "new_links": counts.NewLinks,
+				"checks_valid": counts.ChecksValid, "checks_invalid": counts.ChecksInvalid,
+			}).
+			SetUpsert(true))
+	}
+	if err := s.saveTrendRollup(ctx, "link_trend_owner_hourly", "trends_owner", writes, until); err != nil {
+		return err
+	}
+
+	logger.Info("所有者趋势数据汇总完成", zap.Time("until", until), zap.Int("rows", len(grouped)))
+	return nil
+}
+
+// saveTrendRollup 分批写入汇总结果并更新汇总进度
+func (s *ExternalLinkService) saveTrendRollup(ctx context.Context, collection, stateKey string, writes []mongo.WriteModel, until time.Time) error {
+	for start := 0; start < len(writes); start += 500 {
+		end := min(start+500, len(writes))
+		if _, err := s.db.Collection(collection).BulkWrite(ctx, writes[start:end], options.BulkWrite().SetOrdered(false)); err != nil {
+			logger.Error("保存趋势汇总失败", zap.String("collection", collection), zap.Error(err))
+			return err
+		}
+	}
+
+	_, err := s.db.Collection("link_check_rollup_state").UpdateOne(ctx,
+		bson.M{"_id": stateKey},
+		bson.M{"$set": bson.M{"rolled_until": until, "updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		logger.Error("保存趋势汇总进度失败", zap.String("state", stateKey), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetExternalTrends 获取外链趋势数据
+// 已汇总的小时从 link_trend_hourly 读取，汇总进度之后的部分实时统计，再按请求时区合并为时间桶并补零
+// 时间桶由 UTC 整点汇总合并而来，桶边界落在非整小时偏移上的时区（如 Asia/Kolkata）会被拒绝
+// 指定 owner 或调用者不是管理员时改用按所有者汇总的数据，只统计可访问的所有者
+func (s *ExternalLinkService) GetExternalTrends(ctx context.Context, query models.ExternalTrendQuery) ([]models.ExternalTrend, error) {
+	interval := query.Interval
+	if interval == "" {
+		interval = query.Period
+	}
+	if interval == "" {
+		interval = TrendIntervalDay
+	}
+	if _, ok := defaultTrendLimits[interval]; !ok {
+		return nil, errors.NewError("无效的时间周期，可选值: hour, day, week, month", http.StatusBadRequest)
+	}
+	owners, err := trendOwners(ctx, query.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := time.UTC
+	if query.Timezone != "" {
+		if loc, err = time.LoadLocation(query.Timezone); err != nil {
+			return nil, errors.NewError("无效的时区", http.StatusBadRequest)
+		}
+	}
+
+	to := time.Now().In(loc)
+	if query.To != "" {
+		parsed, err := parseTimeInLocation(query.To, loc)
+		if err != nil {
+			return nil, errors.NewError("无效的结束时间", http.StatusBadRequest)
+		}
+		to = parsed
+	}
+
+	var from time.Time
+	if query.From != "" {
+		parsed, err := parseTimeInLocation(query.From, loc)
+		if err != nil {
+			return nil, errors.NewError("无效的开始时间", http.StatusBadRequest)
+		}
+		from = trendBucketStart(parsed, interval)
+	} else {
+		limit := query.Limit
+		if limit <= 0 {
+			limit = defaultTrendLimits[interval]
+		}
+		if limit > maxTrendBuckets {
+			return nil, errors.NewError(fmt.Sprintf("时间桶数量不能超过 %d", maxTrendBuckets), http.StatusBadRequest)
+		}
+		from = trendBucketStart(to, interval)
+		for i := 1; i < limit; i++ {
+			from = addTrendInterval(from, interval, -1)
+		}
+	}
+	if !to.After(from) {
+		return nil, errors.NewError("结束时间必须晚于开始时间", http.StatusBadRequest)
+	}
+
+	buckets := []time.Time{}
+	for bucket := from; bucket.Before(to); bucket = addTrendInterval(bucket, interval, 1) {
+		if len(buckets) == maxTrendBuckets {
+			return nil, errors.NewError(fmt.Sprintf("时间桶数量不能超过 %d，请缩小时间范围或增大统计粒度", maxTrendBuckets), http.StatusBadRequest)
+		}
+		if _, offset := bucket.Zone(); offset%3600 != 0 {
+			return nil, errors.NewError("不支持非整小时偏移的时区", http.StatusBadRequest)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	cacheKey := fmt.Sprintf("external_links:trends:%s:%s:%d:%d", interval, loc.String(), from.Unix(), to.Truncate(time.Minute).Unix())
+	if owners != nil {
+		cacheKey += fmt.Sprintf(":%q", owners)
+	}
+	var cached []models.ExternalTrend
+	if err := s.cache.Get(ctx, cacheKey, &cached); err == nil {
+		return cached, nil
+	}
+
+	hours, err := s.loadTrendHours(ctx, from, to, owners)
+	if err != nil {
+		logger.Error("获取趋势数据失败", zap.Error(err))
+		return nil, errors.NewError("获取趋势数据失败", http.StatusInternalServerError)
+	}
+
+	totals := make(map[time.Time]*trendCounts, len(buckets))
+	for _, bucket := range buckets {
+		totals[bucket] = &trendCounts{}
+	}
+	for hour, counts := range hours {
+		if total, ok := totals[trendBucketStart(hour.In(loc), interval)]; ok {
+			total.add(*counts)
+		}
+	}
+
+	result := make([]models.ExternalTrend, 0, len(buckets))
+	for _, bucket := range buckets {
+		counts := totals[bucket]
+		result = append(result, models.ExternalTrend{
+			Date:          bucket.Format(time.RFC3339),
+			NewLinks:      counts.NewLinks,
+			TotalClicks:   counts.Clicks,
+			ChecksValid:   counts.ChecksValid,
+			ChecksInvalid: counts.ChecksInvalid,
+		})
+	}
+
+	if err := s.cache.Set(ctx, cacheKey, result, trendCacheTTL); err != nil {
+		logger.Warn("缓存趋势数据失败", zap.Error(err))
+	}
+	return result, nil
+}
+
+// trendOwners 解析趋势查询的所有者范围，返回 nil 表示全局趋势
+// 普通用户未指定 owner 时统计本人、所在团队及未分配所有者的链接
+func trendOwners(ctx context.Context, owner string) ([]string, error) {
+	if owner == "" {
+		actor := restrictedActor(ctx)
+		if actor == nil {
+			return nil, nil
+		}
+		return append([]string{""}, actor.OwnerKeys()...), nil
+	}
+	if _, err := resolveOwnerFilter(ctx, owner); err != nil {
+		return nil, err
+	}
+	switch owner {
+	case models.LinkOwnerNone:
+		return []string{""}, nil
+	case models.LinkOwnerMe:
+		return []string{LinkActorFrom(ctx).OwnerKey()}, nil
+	}
+	return []string{owner}, nil
+}
+
+// loadTrendHours 读取 [from, to) 内的小时计数，已汇总部分读 link_trend_hourly，其余实时统计
+// owners 不为 nil 时读取按所有者汇总的数据并合并这些所有者的计数
+func (s *ExternalLinkService) loadTrendHours(ctx context.Context, from, to time.Time, owners []string) (map[time.Time]*trendCounts, error) {
+	from = from.UTC().Truncate(time.Hour)
+	stateKey := "trends"
+	if owners != nil {
+		stateKey = "trends_owner"
+	}
+	rolledUntil, err := s.trendRolledUntil(ctx, stateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := make(map[time.Time]*trendCounts)
+	if rolledUntil.After(from) {
+		end := to
+		if rolledUntil.Before(end) {
+			end = rolledUntil
+		}
+		collection, filter := "link_trend_hourly", bson.M{"_id": bson.M{"$gte": from, "$lt": end}}
+		if owners != nil {
+			collection, filter = "link_trend_owner_hourly", bson.M{"hour": bson.M{"$gte": from, "$lt": end}, "owner": bson.M{"$in": owners}}
+		}
+		cursor, err := s.db.Collection(collection).Find(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var row struct {
+				ID          interface{} `bson:"_id"`
+				Hour        time.Time   `bson:"hour"`
+				trendCounts `bson:",inline"`
+			}
+			if err := cursor.Decode(&row); err != nil {
+				return nil, err
+			}
+			hour := row.Hour
+			if owners == nil {
+				hour, _ = row.ID.(time.Time)
+			}
+			counts, ok := hours[hour]
+			if !ok {
+				counts = &trendCounts{}
+				hours[hour] = counts
+			}
+			counts.add(row.trendCounts)
+		}
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if to.After(rolledUntil) {
+		liveFrom := from
+		if rolledUntil.After(liveFrom) {
+			liveFrom = rolledUntil
+		}
+		var live map[time.Time]*trendCounts
+		if owners == nil {
+			live, err = s.aggregateTrendHours(ctx, liveFrom, to)
+		} else {
+			var grouped map[trendKey]*trendCounts
+			grouped, err = s.aggregateTrends(ctx, liveFrom, to, true, owners)
+			live = sumTrendHours(grouped)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for hour, counts := range live {
+			hours[hour] = counts
+		}
+	}
+
+	return hours, nil
+}
+
+// trendBucketStart 返回 t 所在时间桶的起点，周以周一为第一天
+func trendBucketStart(t time.Time, interval string) time.Time {
+	year, month, day := t.Date()
+	loc := t.Location()
+	switch interval {
+	case TrendIntervalHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, loc)
+	case TrendIntervalWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, loc)
+	case TrendIntervalMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// addTrendInterval 将时间桶起点前后移动 n 个粒度，按日历计算以正确处理夏令时和月份天数
+func addTrendInterval(t time.Time, interval string, n int) time.Time {
+	switch interval {
+	case TrendIntervalHour:
+		return t.Add(time.Duration(n) * time.Hour)
+	case TrendIntervalWeek:
+		return t.AddDate(0, 0, 7*n)
+	case TrendIntervalMonth:
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// parseTimeInLocation 解析 RFC3339 或 2006-01-02 格式的时间，日期格式按指定时区解释
+func parseTimeInLocation(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.In(loc), nil
+	}
+	return time.ParseInLocation("2006-01-02", raw, loc)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/internal/models"
+	customerrors "vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
+)
+
+// PluginEnv 插件读取配置的入口，外部环境变量优先，其次是该插件在配置存储中的值
+type PluginEnv func(name string) string
+
+// PluginSettingService 插件配置存储服务
+// 存储的值按插件分别缓存在内存中，插件通过 Env 返回的 PluginEnv 读取，不写入进程环境变量
+type PluginSettingService struct {
+	db *mongo.Database
+
+	mu     sync.RWMutex
+	values map[string]map[string]string // 插件标识 -> 变量名 -> 存储的值
+}
+
+// NewPluginSettingService 创建插件配置存储服务
+func NewPluginSettingService(db *mongo.Database) *PluginSettingService {
+	return &PluginSettingService{db: db, values: make(map[string]map[string]string)}
+}
+
+// GetSetting 获取插件的单个配置项，不存在时返回 nil
+func (s *PluginSettingService) GetSetting(ctx context.Context, pluginKey, name string) (*models.PluginSetting, error) {
+	var setting models.PluginSetting
+	err := s.db.Collection("plugin_settings").FindOne(ctx, bson.M{
+		"plugin_key": pluginKey,
+		"name":       name,
+	}).Decode(&setting)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		logger.Error("获取插件配置失败", zap.String("plugin", pluginKey), zap.String("name", name), zap.Error(err))
+		return nil, customerrors.NewError("获取插件配置失败", http.StatusInternalServerError)
+	}
+
+	return &setting, nil
+}
+
+// Load 加载存储的插件配置，插件在创建时读取配置，需要在加载插件之前调用
+func (s *PluginSettingService) Load(ctx context.Context) error {
+	cursor, err := s.db.Collection("plugin_settings").Find(ctx, bson.M{"value": bson.M{"$ne": ""}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var settings []models.PluginSetting
+	if err := cursor.All(ctx, &settings); err != nil {
+		return err
+	}
+
+	for _, setting := range settings {
+		s.store(setting.PluginKey, setting.Name, setting.Value)
+	}
+	logger.Info("已加载插件配置", zap.Int("count", len(settings)))
+	return nil
+}
+
+// Env 返回插件读取配置的入口，外部已设置的环境变量优先
+func (s *PluginSettingService) Env(pluginKey string) PluginEnv {
+	return func(name string) string {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.values[pluginKey][name]
+	}
+}
+
+// store 更新内存中的配置值，value 为空时删除
+func (s *PluginSettingService) store(pluginKey, name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == "" {
+		delete(s.values[pluginKey], name)
+		return
+	}
+	if s.values[pluginKey] == nil {
+		s.values[pluginKey] = make(map[string]string)
+	}
+	s.values[pluginKey][name] = value
+}
+
+// EnsureIndexes 创建 (plugin_key, name) 唯一索引，保证同一插件的配置项不重复
+func (s *PluginSettingService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.db.Collection("plugin_settings").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "plugin_key", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// SaveSetting 保存插件配置项（存在则覆盖）
+func (s *PluginSettingService) SaveSetting(ctx context.Context, pluginKey, name, value string, secret bool) error {
+	now := time.Now()
+	_, err := s.db.Collection("plugin_settings").UpdateOne(
+		ctx,
+		bson.M{"plugin_key": pluginKey, "name": name},
+		bson.M{
+			"$set": bson.M{
+				"value":      value,
+				"secret":     secret,
+				"updated_at": now,
+			},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		logger.Error("保存插件配置失败", zap.String("plugin", pluginKey), zap.String("name", name), zap.Error(err))
+		return customerrors.NewError("保存插件配置失败", http.StatusInternalServerError)
+	}
+
+	// 已创建的插件在重启后才会读取新值
+	s.store(pluginKey, name, value)
+	return nil
+}
+
+// DeleteSetting 删除插件配置项
+func (s *PluginSettingService) DeleteSetting(ctx context.Context, pluginKey, name string) error {
+	result, err := s.db.Collection("plugin_settings").DeleteOne(ctx, bson.M{
+		"plugin_key": pluginKey,
+		"name":       name,
+	})
+	if err != nil {
+		logger.Error("删除插件配置失败", zap.String("plugin", pluginKey), zap.String("name", name), zap.Error(err))
+		return customerrors.NewError("删除插件配置失败", http.StatusInternalServerError)
+	}
+
+	if result.DeletedCount == 0 {
+		return customerrors.NewError("插件配置不存在", http.StatusNotFound)
+	}
+
+	s.store(pluginKey, name, "")
+	return nil
+}
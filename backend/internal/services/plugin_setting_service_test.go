@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestPluginEnvKeepsSettingsPerPlugin(t *testing.T) {
+	s := NewPluginSettingService(nil)
+	s.store("wailki", "LINK_CHECK_USER_AGENT", "wailki-bot")
+	s.store("other", "LINK_CHECK_USER_AGENT", "other-bot")
+
+	wailki, other := s.Env("wailki"), s.Env("other")
+	if got := wailki("LINK_CHECK_USER_AGENT"); got != "wailki-bot" {
+		t.Fatalf("wailki = %q, want its own setting", got)
+	}
+	if got := other("LINK_CHECK_USER_AGENT"); got != "other-bot" {
+		t.Fatalf("other = %q, want its own setting", got)
+	}
+
+	s.store("other", "LINK_CHECK_USER_AGENT", "")
+	if got := other("LINK_CHECK_USER_AGENT"); got != "" {
+		t.Fatalf("other = %q, want empty after delete", got)
+	}
+	if got := wailki("LINK_CHECK_USER_AGENT"); got != "wailki-bot" {
+		t.Fatalf("deleting another plugin's setting changed wailki to %q", got)
+	}
+
+	t.Setenv("LINK_CHECK_USER_AGENT", "from-env")
+	if got := wailki("LINK_CHECK_USER_AGENT"); got != "from-env" {
+		t.Fatalf("wailki = %q, want the process environment to win", got)
+	}
+}
@@ -13,8 +13,8 @@ import (
 
 	"go.uber.org/zap"
 
-	"vite-pluginend/pkg/logger"
 	customerrors "vite-pluginend/pkg/errors"
+	"vite-pluginend/pkg/logger"
 	"vite-pluginend/pkg/utils"
 )
 
@@ -58,7 +58,7 @@ func (s *UploadService) SaveFile(ctx context.Context, fileHeader *multipart.File
 		return "", customerrors.NewError("保存文件失败", http.StatusInternalServerError)
 	}
 
-	logger.Info("File saved successfully", 
+	logger.Info("File saved successfully",
 		zap.String("filename", filename),
 	)
 	return filename, nil
@@ -70,7 +70,7 @@ func (s *UploadService) GetFile(ctx context.Context, filename string) (string, [
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.Warn("File not found", 
+			logger.Warn("File not found",
 				zap.String("filename", filename),
 			)
 			return "", nil, customerrors.NewError("文件未找到", http.StatusNotFound)
@@ -79,7 +79,7 @@ func (s *UploadService) GetFile(ctx context.Context, filename string) (string, [
 		return "", nil, customerrors.NewError("读取文件失败", http.StatusInternalServerError)
 	}
 
-	logger.Debug("File found", 
+	logger.Debug("File found",
 		zap.String("filename", filename),
 	)
 	return filePath, data, nil
@@ -91,7 +91,7 @@ func (s *UploadService) DeleteFile(ctx context.Context, filename string) error {
 	err := os.Remove(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.Warn("File not found for deletion", 
+			logger.Warn("File not found for deletion",
 				zap.String("filename", filename),
 			)
 			return customerrors.NewError("文件未找到", http.StatusNotFound)
@@ -100,7 +100,7 @@ func (s *UploadService) DeleteFile(ctx context.Context, filename string) error {
 		return customerrors.NewError("删除文件失败", http.StatusInternalServerError)
 	}
 
-	logger.Info("File deleted successfully", 
+	logger.Info("File deleted successfully",
 		zap.String("filename", filename),
 	)
 	return nil
@@ -134,7 +134,7 @@ func (s *UploadService) ListFiles(pluginKey string) ([]string, error) {
 		return nil, customerrors.NewError("列出文件失败", http.StatusInternalServerError)
 	}
 
-	logger.Info("Files listed successfully", 
+	logger.Info("Files listed successfully",
 		zap.String("plugin_key", pluginKey),
 		zap.Int("count", len(files)),
 	)
@@ -147,7 +147,7 @@ func (s *UploadService) GetFileInfo(pluginKey, filename string) (os.FileInfo, er
 	info, err := os.Stat(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logger.Warn("File not found", 
+			logger.Warn("File not found",
 				zap.String("filename", filename),
 				zap.String("plugin_key", pluginKey),
 			)
@@ -157,9 +157,42 @@ func (s *UploadService) GetFileInfo(pluginKey, filename string) (os.FileInfo, er
 		return nil, customerrors.NewError("获取文件信息失败", http.StatusInternalServerError)
 	}
 
-	logger.Debug("File info retrieved successfully", 
+	logger.Debug("File info retrieved successfully",
 		zap.String("filename", filename),
 		zap.String("plugin_key", pluginKey),
 	)
 	return info, nil
-} 
\ No newline at end of file
+}
+
+// SaveData 以指定文件名保存数据，文件已存在时覆盖，超过 maxBytes 字节时放弃保存
+// 先写入临时文件再重命名，并发写入同一文件时读者不会看到不完整的内容
+func (s *UploadService) SaveData(ctx context.Context, filename string, r io.Reader, maxBytes int64) error {
+	if filename == "" || filepath.Base(filename) != filename || strings.HasPrefix(filename, ".") {
+		return customerrors.NewError("无效的文件名", http.StatusBadRequest)
+	}
+
+	tmp, err := os.CreateTemp(s.UploadDir, ".tmp-"+filename+"-*")
+	if err != nil {
+		logger.Error("创建文件失败", zap.Error(err))
+		return customerrors.NewError("创建文件失败", http.StatusInternalServerError)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(r, maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Error("保存文件失败", zap.Error(err))
+		return customerrors.NewError("保存文件失败", http.StatusInternalServerError)
+	}
+	if written > maxBytes {
+		return customerrors.NewError(fmt.Sprintf("文件超过 %d 字节", maxBytes), http.StatusRequestEntityTooLarge)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(s.UploadDir, filename)); err != nil {
+		logger.Error("保存文件失败", zap.Error(err))
+		return customerrors.NewError("保存文件失败", http.StatusInternalServerError)
+	}
+	return nil
+}
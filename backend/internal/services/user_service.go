@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.uber.org/zap"
+	"vite-pluginend/internal/models"
 	"vite-pluginend/pkg/cache"
 	customerrors "vite-pluginend/pkg/errors"
 	"vite-pluginend/pkg/logger"
@@ -18,11 +19,12 @@ import (
 // User 用户模型
 type User struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Username  string            `bson:"username" json:"username"`
-	Password  string            `bson:"password" json:"-"`
-	Role      string            `bson:"role" json:"role"`
-	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+	Username  string             `bson:"username" json:"username"`
+	Password  string             `bson:"password" json:"-"`
+	Role      string             `bson:"role" json:"role"`
+	Teams     []string           `bson:"teams,omitempty" json:"teams,omitempty"` // 所在团队，由管理员在数据库中分配
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
 // UserService 用户服务
@@ -50,7 +52,25 @@ func (s *UserService) Register(ctx context.Context, user *User) error {
 		return customerrors.NewError("数据库错误", http.StatusInternalServerError)
 	}
 
+	if err := prepareRegistration(user); err != nil {
+		return err
+	}
+
+	_, err = s.db.Collection("users").InsertOne(ctx, user)
+	if err != nil {
+		logger.Error("创建用户失败", zap.Error(err))
+		return customerrors.NewError("数据库错误", http.StatusInternalServerError)
+	}
+
+	return nil
+}
+
+// prepareRegistration 初始化注册用户的字段并加密密码
+// 角色和团队决定链接的访问范围，只能由管理员分配，忽略请求中的值
+func prepareRegistration(user *User) error {
 	user.ID = primitive.NewObjectID()
+	user.Role = models.RoleUser
+	user.Teams = nil
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
@@ -60,13 +80,6 @@ func (s *UserService) Register(ctx context.Context, user *User) error {
 		return customerrors.NewError("密码加密失败", http.StatusInternalServerError)
 	}
 	user.Password = hashedPassword
-
-	_, err = s.db.Collection("users").InsertOne(ctx, user)
-	if err != nil {
-		logger.Error("创建用户失败", zap.Error(err))
-		return customerrors.NewError("数据库错误", http.StatusInternalServerError)
-	}
-
 	return nil
 }
 
@@ -86,7 +99,7 @@ func (s *UserService) Login(ctx context.Context, username, password string) (str
 		return "", customerrors.NewError("用户名或密码错误", http.StatusUnauthorized)
 	}
 
-	token, err := utils.GenerateToken(user.ID.Hex(), user.Username, user.Role)
+	token, err := utils.GenerateToken(user.ID.Hex(), user.Username, user.Role, user.Teams)
 	if err != nil {
 		logger.Error("生成token失败", zap.Error(err))
 		return "", customerrors.NewError("生成token失败", http.StatusInternalServerError)
@@ -151,4 +164,4 @@ func (s *UserService) UpdateUser(ctx context.Context, id string, update User) er
 	s.cache.Delete(ctx, "users:"+id)
 
 	return nil
-} 
\ No newline at end of file
+}
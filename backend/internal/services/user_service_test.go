@@ -0,0 +1,32 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"vite-pluginend/internal/models"
+	"vite-pluginend/pkg/utils"
+)
+
+func TestPrepareRegistrationIgnoresClientRoleAndTeams(t *testing.T) {
+	var user User
+	// 与注册接口绑定请求体的方式相同
+	if err := json.Unmarshal([]byte(`{"username":"mallory","role":"admin","teams":["ops"]}`), &user); err != nil {
+		t.Fatal(err)
+	}
+	user.Password = "secret"
+	if user.Role != models.RoleAdmin {
+		t.Fatalf("role = %q, the request should be able to carry a role", user.Role)
+	}
+
+	if err := prepareRegistration(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Role != models.RoleUser || user.Teams != nil {
+		t.Fatalf("stored role = %q, teams = %v, want %q without teams", user.Role, user.Teams, models.RoleUser)
+	}
+	if user.ID.IsZero() || !utils.CheckPasswordHash("secret", user.Password) {
+		t.Fatalf("user = %+v, want a new ID and a hashed password", user)
+	}
+}
@@ -0,0 +1,112 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"vite-pluginend/pkg/logger"
+	"vite-pluginend/pkg/utils"
+)
+
+// MongoLock 基于 MongoDB 的分布式租约锁
+// 每个锁是一条以 key 为 _id 的文档，过期后可被其他实例抢占
+type MongoLock struct {
+	collection *mongo.Collection
+	owner      string
+}
+
+// NewMongoLock 创建分布式锁，owner 为空时自动生成实例标识
+func NewMongoLock(db *mongo.Database, collection, owner string) *MongoLock {
+	if owner == "" {
+		owner = InstanceID()
+	}
+	return &MongoLock{
+		collection: db.Collection(collection),
+		owner:      owner,
+	}
+}
+
+// InstanceID 生成当前进程的实例标识
+func InstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), utils.GenerateKey())
+}
+
+// Owner 返回锁持有者标识
+func (l *MongoLock) Owner() string {
+	return l.owner
+}
+
+// EnsureIndexes 创建过期清理索引
+func (l *MongoLock) EnsureIndexes(ctx context.Context) error {
+	_, err := l.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		logger.Error("Failed to create lock index", zap.Error(err))
+		return fmt.Errorf("failed to create lock index: %v", err)
+	}
+	return nil
+}
+
+// TryAcquire 尝试获取锁，锁被其他实例持有且未过期时返回 false
+// 同一 owner 重复获取会续期
+func (l *MongoLock) TryAcquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": key,
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$lte": now}},
+			{"owner": l.owner},
+		},
+	}
+	return l.acquire(ctx, filter, now, ttl)
+}
+
+// TryAcquireToken 获取一次性令牌，令牌未过期前任何实例（包括持有者自己）都无法再次获取
+// 用于限制访问频率，令牌不需要释放，到期后自动失效
+func (l *MongoLock) TryAcquireToken(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id":        key,
+		"expires_at": bson.M{"$lte": now},
+	}
+	return l.acquire(ctx, filter, now, ttl)
+}
+
+// acquire 按条件抢占锁文档，文档不存在时创建
+func (l *MongoLock) acquire(ctx context.Context, filter bson.M, now time.Time, ttl time.Duration) (bool, error) {
+	update := bson.M{"$set": bson.M{
+		"owner":       l.owner,
+		"acquired_at": now,
+		"expires_at":  now.Add(ttl),
+	}}
+
+	_, err := l.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// 文档存在但不满足条件时 upsert 会因 _id 冲突失败，说明锁被占用
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Release 释放锁，只会删除自己持有的锁
+func (l *MongoLock) Release(ctx context.Context, key string) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": key, "owner": l.owner})
+	return err
+}
@@ -11,9 +11,10 @@ import (
 
 // JWTClaims 自定义JWT声明
 type JWTClaims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID   string   `json:"user_id"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Teams    []string `json:"teams,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -32,8 +33,8 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(userID, username, role string) (string, error) {
+// GenerateToken 生成JWT令牌，teams 为用户所在的团队
+func GenerateToken(userID, username, role string, teams []string) (string, error) {
 	// 获取密钥
 	secretKey := os.Getenv("JWT_SECRET")
 	if secretKey == "" {
@@ -45,6 +46,7 @@ func GenerateToken(userID, username, role string) (string, error) {
 		UserID:   userID,
 		Username: username,
 		Role:     role,
+		Teams:    teams,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -90,4 +92,4 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 	}
 
 	return nil, errors.New("invalid token")
-} 
\ No newline at end of file
+}
@@ -5,6 +5,7 @@ export interface ExternalLink {
   id: number
   url: string
   category: string
+  title?: string
   description: string
   status: boolean
   is_valid: boolean
@@ -12,6 +13,99 @@ export interface ExternalLink {
   created_at: string
   updated_at: string
   last_clicked_at: string
+  tags?: string[]
+  priority: number
+  expires_at?: string
+  score?: number
+  metadata?: LinkMetadata
+  consecutive_failures?: number
+  alert_state?: 'down'
+  // 最近一次检测失败的分类，检测成功时为空
+  last_error_code?: LinkErrorCode
+  // 礼貌模式下因 robots.txt 未检测时为 robots_disallowed
+  skip_reason?: string
+  // 所有者，user:<用户ID> 或 team:<团队名>，为空表示所有用户共享
+  owner?: string
+  created_by?: string
+  updated_by?: string
+  // 站点爬取时发现该链接的页面
+  found_on?: string[]
+  // 检测器配置，为空时使用域名策略中的配置
+  check_profile?: LinkCheckProfile
+  // 最近一次检测时的域名解析结果
+  dns?: DNSInfo
+}
+
+// 检测时的域名解析结果，同一主机在缓存有效期内共用一次解析
+export interface DNSInfo {
+  host: string
+  // 使用的解析器，如 system、udp://1.1.1.1:53 或 DoH 地址
+  resolver: string
+  status: 'ok' | 'nxdomain' | 'nodata' | 'servfail' | 'refused' | 'timeout' | 'error'
+  a?: string[]
+  aaaa?: string[]
+  // CNAME 链，按解析顺序
+  cname?: string[]
+  latency_ms: number
+  // 结果来自缓存，latency_ms 为实际解析时的耗时
+  cached?: boolean
+  error?: string
+  resolved_at: string
+}
+
+// 检测器配置：head_get 先 HEAD 后 GET，get 只用 GET，browser 模拟浏览器请求头
+export type LinkCheckProfile = 'head_get' | 'get' | 'browser'
+
+// 检测失败分类，timeout、connection_reset、network、rate_limited、server_error、dns_servfail、dns_timeout 会先重试
+export type LinkErrorCode =
+  | 'timeout'
+  | 'dns'
+  | 'dns_nxdomain'
+  | 'dns_servfail'
+  | 'dns_timeout'
+  | 'tls'
+  | 'connection_refused'
+  | 'connection_reset'
+  | 'network'
+  | 'too_many_redirects'
+  | 'invalid_request'
+  | 'rate_limited'
+  | 'client_error'
+  | 'server_error'
+  | 'unknown_status'
+  | 'unexpected_status'
+  | 'cancelled'
+  | 'assertion_failed'
+  | 'soft_404'
+  | 'proxy'
+
+
+// 按所有者筛选：user:<ID>、team:<名称>、none（未分配）或 me（本人）
+export type LinkOwnerFilter = string
+
+// 批量转移所有权，ids 与 from 二选一
+export interface LinkTransferRequest {
+  ids?: string[]
+  from?: LinkOwnerFilter
+  to: string
+}
+
+export interface LinkTransferResult {
+  matched: number
+  updated: number
+}
+
+// 页面元数据，favicon_file 为本地缓存的图标，通过 /api/files/:filename 访问
+export interface LinkMetadata {
+  title?: string
+  description?: string
+  image_url?: string
+  favicon_url?: string
+  favicon_file?: string
+  language?: string
+  canonical_url?: string
+  error?: string
+  fetched_at: string
 }
 
 // 外链统计接口类型定义
@@ -19,6 +113,7 @@ export interface ExternalStatistics {
   total_links: number
   active_links: number
   expired_links: number
+  expiring_links: number
   invalid_links: number
   total_clicks: number
   average_clicks: number
@@ -35,7 +130,8 @@ export interface ExternalTrend {
   date: string
   new_links: number
   total_clicks: number
-  active_links: number
+  checks_valid: number
+  checks_invalid: number
 }
 
 // 点击量分布接口类型定义
@@ -52,8 +148,48 @@ export interface ExternalLinkQuery {
   category?: string
   status?: string
   is_valid?: string
-  sort_field?: string
+  tags?: string
+  min_priority?: number
+  max_priority?: number
+  popular?: boolean
+  expired?: boolean
+  expiring_days?: number
+  sort_field?: LinkSortField
   sort_order?: 'asc' | 'desc'
+  // 指定时使用游标分页，首页传空字符串，之后传上一页的 next_cursor
+  cursor?: string
+  count?: 'exact' | 'approx' | 'none'
+  owner?: LinkOwnerFilter
+}
+
+// 允许的排序字段，relevance 只在指定关键词时可用
+export type LinkSortField =
+  | 'relevance'
+  | 'created_at'
+  | 'updated_at'
+  | 'url'
+  | 'title'
+  | 'category'
+  | 'clicks'
+  | 'priority'
+  | 'is_valid'
+  | 'is_active'
+  | 'expires_at'
+  | 'last_checked_at'
+  | 'last_clicked_at'
+
+// 分面取值及数量
+export interface FacetCount {
+  value: string
+  count: number
+}
+
+// 外链列表分面统计
+export interface LinkFacets {
+  categories: FacetCount[]
+  tags: FacetCount[]
+  validity: FacetCount[]
+  hosts: FacetCount[]
 }
 
 // 外链列表响应接口
@@ -63,7 +199,11 @@ export interface ExternalLinkResponse {
     total: number
     page: number
     per_page: number
+    total_approximate?: boolean
+    next_cursor?: string
+    has_more?: boolean
   }
+  facets?: LinkFacets
 }
 
 // 外链创建接口
@@ -72,6 +212,7 @@ export interface ExternalLinkCreate {
   category: string
   description?: string
   status?: boolean
+  check_profile?: LinkCheckProfile | ''
 }
 
 // 外链更新接口
@@ -95,6 +236,179 @@ export interface LinkCheckResult {
   url: string
   status: 'success' | 'error'
   message: string
+  // 实际使用的检测器配置，经代理检测时带 +proxy 后缀
+  profile?: string
+  error_class?: LinkErrorCode
+  // 请求次数，暂时性失败重试过时大于 1
+  attempts?: number
+  // 经过的出站代理名称，直连时为空
+  proxy?: string
+  dns?: DNSInfo
+  skipped?: boolean
+  skip_reason?: string
+}
+
+export type LinkCheckJobStatus = 'pending' | 'running' | 'completed' | 'cancelled' | 'failed'
+
+// 异步批量检测任务
+export interface LinkCheckJob {
+  id: string
+  status: LinkCheckJobStatus
+  check_all: boolean
+  created_by?: string
+  total: number
+  processed: number
+  valid: number
+  invalid: number
+  skipped: number
+  percent: number
+  cancel_requested: boolean
+  error?: string
+  created_at: string
+  started_at?: string
+  finished_at?: string
+  updated_at: string
+}
+
+// 批量检测任务中单个链接的结果
+export interface LinkCheckJobResult {
+  job_id: string
+  link_id: string
+  url: string
+  is_valid: boolean
+  skipped?: boolean
+  message?: string
+  error_message?: string
+  error_class?: LinkErrorCode
+  found_on?: string[]
+  checked_at: string
+}
+
+const finishedJobStatuses: LinkCheckJobStatus[] = ['completed', 'cancelled', 'failed']
+
+// 链接状态变化事件
+export interface LinkAlertEvent {
+  id: string
+  link_id: string
+  url: string
+  title?: string
+  type: 'down' | 'recovered'
+  consecutive_failures: number
+  status_code?: number
+  error_class?: string
+  error_message?: string
+  occurred_at: string
+  digest_id?: string
+}
+
+// 告警摘要在单个渠道上的发送结果
+export interface LinkAlertDelivery {
+  channel: 'webhook' | 'email'
+  target: string
+  status: 'sent' | 'failed'
+  attempts: number
+  error?: string
+  delivered_at?: string
+}
+
+// 告警摘要
+export interface LinkAlertDigest {
+  id: string
+  test?: boolean
+  down: number
+  recovered: number
+  suppressed: number
+  events: LinkAlertEvent[]
+  deliveries: LinkAlertDelivery[]
+  created_at: string
+}
+
+// 链接集合，公开后可通过 /api/c/:slug 访问页面、/api/c/:slug/feed 获取 JSON
+export interface LinkCollection {
+  id: string
+  name: string
+  slug: string
+  description?: string
+  link_ids: string[]
+  public: boolean
+  has_password: boolean
+  owner?: string
+  created_by?: string
+  updated_by?: string
+  created_at: string
+  updated_at: string
+}
+
+// 创建或更新集合，未传的字段保持不变；password 传空字符串表示取消密码
+export interface LinkCollectionRequest {
+  name?: string
+  slug?: string
+  description?: string
+  public?: boolean
+  password?: string
+  link_ids?: string[]
+}
+
+// 站点爬取请求，从 seeds 开始抓取所在主机及 hosts 中的主机，范围外的链接写入外链列表
+export interface LinkCrawlRequest {
+  seeds: string[]
+  hosts?: string[]
+  max_depth?: number
+  max_pages?: number
+  category?: string
+  // 完成后是否检测发现的链接，默认检测
+  check?: boolean
+}
+
+// 出站代理的健康状态和使用统计，统计从服务启动时开始
+export interface LinkProxyStats {
+  name: string
+  url: string
+  region?: string
+  healthy: boolean
+  down_until?: string
+  requests: number
+  failures: number
+  consecutive_failures: number
+  avg_latency_ms: number
+  last_error?: string
+  last_used_at?: string
+  last_failure_at?: string
+}
+
+// 站点爬取任务，完成后 check_job_id 为发现链接的检测任务
+export interface LinkCrawlJob {
+  id: string
+  status: 'pending' | 'running' | 'completed' | 'cancelled' | 'failed'
+  seeds: string[]
+  hosts: string[]
+  max_depth: number
+  max_pages: number
+  category?: string
+  check: boolean
+  pages_crawled: number
+  pages_failed: number
+  links_found: number
+  links_created: number
+  truncated?: boolean
+  check_job_id?: string
+  cancel_requested: boolean
+  error?: string
+  created_at: string
+  started_at?: string
+  finished_at?: string
+  updated_at: string
+}
+
+// 爬取过的页面
+export interface LinkCrawlPage {
+  url: string
+  depth: number
+  status_code?: number
+  links: number
+  failed: boolean
+  error?: string
+  crawled_at: string
 }
 
 class ExternalApi {
@@ -145,9 +459,17 @@ class ExternalApi {
     return request.post(`/api/external-links/${id}/clicks`)
   }
 
-  // 获取统计数据
-  getExternalStatistics() {
-    return request.get<ExternalLinkStats>('/api/external-links/statistics')
+  // 获取统计数据，owner 可按所有者统计
+  getExternalStatistics(owner?: LinkOwnerFilter) {
+    return request.get<ExternalLinkStats>('/api/external-links/statistics', { params: { owner } })
+  }
+
+  // 批量转移链接所有权
+  transferOwnership(data: LinkTransferRequest) {
+    return request.post<{
+      message: string
+      data: LinkTransferResult
+    }>('/api/external-links/transfer', data)
   }
 
   // 检测链接可用性
@@ -160,11 +482,6 @@ class ExternalApi {
     return request.post<LinkCheckResult>(`/api/external-links/${id}/check`)
   }
 
-  // 批量检测链接
-  batchCheckLinks(ids: string[]) {
-    return request.post<LinkCheckResult[]>('/api/external-links/batch-check', { ids })
-  }
-
   // 获取所有外链（不分页）
   getAllExternalLinks() {
     return request.get<{
@@ -173,15 +490,209 @@ class ExternalApi {
     }>('/api/external-links/all')
   }
 
-  // 后端批量检测链接（支持检测所有链接）
-  batchCheckLinksBackend(ids: string[] = [], checkAll: boolean = false) {
+  // 创建批量检测任务，checkAll 为 true 时检测所有可见链接
+  createCheckJob(ids: string[] = [], checkAll: boolean = false) {
     return request.post<{
       message: string
-      results: LinkCheckResult[]
-    }>('/api/external-links/batch-check', { 
-      ids, 
-      all: checkAll 
+      job_id: string
+      job: LinkCheckJob
+    }>('/api/external-links/check-jobs', { ids, all: checkAll })
+  }
+
+  // 获取检测任务状态
+  getCheckJob(jobId: string) {
+    return request.get<LinkCheckJob>(`/api/external-links/check-jobs/${jobId}`)
+  }
+
+  // 分页获取检测任务结果
+  getCheckJobResults(jobId: string, params?: { page?: number; per_page?: number; is_valid?: boolean }) {
+    return request.get<{
+      data: LinkCheckJobResult[]
+      meta: {
+        total: number
+        per_page: number
+        current_page: number
+        last_page: number
+      }
+    }>(`/api/external-links/check-jobs/${jobId}/results`, { params })
+  }
+
+  // 取消检测任务
+  cancelCheckJob(jobId: string) {
+    return request.post<{ message: string; job: LinkCheckJob }>(`/api/external-links/check-jobs/${jobId}/cancel`)
+  }
+
+  // 订阅检测任务进度，事件流需要携带令牌，所以用 fetch 读取而不是 EventSource
+  // 连接在任务结束前断开时返回最后收到的状态，由调用方决定是否重新订阅
+  async watchCheckJob(jobId: string, onProgress?: (job: LinkCheckJob) => void): Promise<LinkCheckJob | undefined> {
+    const token = localStorage.getItem('token')
+    const response = await fetch(`${request.defaults.baseURL || ''}/api/external-links/check-jobs/${jobId}/events`, {
+      headers: token ? { Authorization: `Bearer ${token}` } : {}
     })
+    if (!response.ok || !response.body) {
+      throw new Error(`订阅检测任务失败: HTTP ${response.status}`)
+    }
+
+    const reader = response.body.getReader()
+    const decoder = new TextDecoder()
+    let buffer = ''
+    let latest: LinkCheckJob | undefined
+    for (;;) {
+      const { value, done } = await reader.read()
+      if (done) {
+        return latest
+      }
+      buffer += decoder.decode(value, { stream: true })
+
+      let end = buffer.indexOf('\n\n')
+      while (end >= 0) {
+        const block = buffer.slice(0, end)
+        buffer = buffer.slice(end + 2)
+        end = buffer.indexOf('\n\n')
+
+        let event = 'message'
+        let data = ''
+        for (const line of block.split('\n')) {
+          if (line.startsWith('event:')) {
+            event = line.slice(6).trim()
+          } else if (line.startsWith('data:')) {
+            data += line.slice(5).trim()
+          }
+        }
+        if (event === 'error') {
+          await reader.cancel()
+          throw new Error(JSON.parse(data).message || '检测任务进度获取失败')
+        }
+        if (event !== 'progress' && event !== 'done') {
+          continue
+        }
+        latest = JSON.parse(data) as LinkCheckJob
+        onProgress?.(latest)
+        if (event === 'done') {
+          await reader.cancel()
+          return latest
+        }
+      }
+    }
+  }
+
+  // 创建检测任务并等待结束，返回最终任务状态及全部结果
+  async runCheckJob(ids: string[] = [], checkAll: boolean = false, onProgress?: (job: LinkCheckJob) => void) {
+    const created = (await this.createCheckJob(ids, checkAll)) as unknown as { job: LinkCheckJob }
+    let job = created.job
+    onProgress?.(job)
+    while (!finishedJobStatuses.includes(job.status)) {
+      job = (await this.watchCheckJob(job.id, onProgress)) ||
+        ((await this.getCheckJob(job.id)) as unknown as LinkCheckJob)
+    }
+
+    const results: LinkCheckJobResult[] = []
+    for (let page = 1; ; page++) {
+      const resp = (await this.getCheckJobResults(job.id, { page, per_page: 200 })) as unknown as {
+        data: LinkCheckJobResult[]
+        meta: { last_page: number }
+      }
+      results.push(...(resp.data || []))
+      if (page >= resp.meta.last_page) {
+        break
+      }
+    }
+    return { job, results }
+  }
+
+  // 重新提取页面元数据
+  refreshLinkMetadata(id: string) {
+    return request.post<{
+      message: string
+      data: LinkMetadata
+    }>(`/api/external-links/${id}/metadata/refresh`)
+  }
+
+  // 获取告警事件，pending 为 true 时只返回尚未发送的
+  getAlertEvents(params?: { pending?: boolean; limit?: number }) {
+    return request.get<{ data: LinkAlertEvent[] }>('/api/external-links/alerts/events', { params })
+  }
+
+  // 获取告警摘要及发送结果
+  getAlertDigests(params?: { limit?: number }) {
+    return request.get<{ data: LinkAlertDigest[] }>('/api/external-links/alerts/digests', { params })
+  }
+
+  // 发送测试告警
+  sendTestAlert() {
+    return request.post<LinkAlertDigest>('/api/external-links/alerts/test')
+  }
+
+  // 获取链接集合列表
+  getCollections() {
+    return request.get<{ data: LinkCollection[] }>('/api/external-links/collections')
+  }
+
+  // 创建链接集合
+  createCollection(data: LinkCollectionRequest) {
+    return request.post<LinkCollection>('/api/external-links/collections', data)
+  }
+
+  // 更新链接集合，传入 link_ids 时按顺序整体替换
+  updateCollection(id: string, data: LinkCollectionRequest) {
+    return request.put<LinkCollection>(`/api/external-links/collections/${id}`, data)
+  }
+
+  // 删除链接集合
+  deleteCollection(id: string) {
+    return request.delete(`/api/external-links/collections/${id}`)
+  }
+
+  // 按顺序获取集合中的链接
+  getCollectionLinks(id: string) {
+    return request.get<{ data: ExternalLink[] }>(`/api/external-links/collections/${id}/links`)
+  }
+
+  // 向集合插入链接，position 为空时追加到末尾
+  addCollectionLinks(id: string, ids: string[], position?: number) {
+    return request.post<LinkCollection>(`/api/external-links/collections/${id}/links`, { ids, position })
+  }
+
+  // 从集合中移除链接
+  removeCollectionLink(id: string, linkId: string) {
+    return request.delete<LinkCollection>(`/api/external-links/collections/${id}/links/${linkId}`)
+  }
+
+  // 创建站点爬取任务
+  createCrawlJob(data: LinkCrawlRequest) {
+    return request.post<{
+      message: string
+      job_id: string
+      job: LinkCrawlJob
+    }>('/api/external-links/crawl-jobs', data)
+  }
+
+  // 获取最近的爬取任务
+  getCrawlJobs(limit = 20) {
+    return request.get<{ data: LinkCrawlJob[] }>('/api/external-links/crawl-jobs', { params: { limit } })
+  }
+
+  // 获取爬取任务进度
+  getCrawlJob(id: string) {
+    return request.get<LinkCrawlJob>(`/api/external-links/crawl-jobs/${id}`)
+  }
+
+  // 分页获取爬取过的页面，failed 为 true 时只返回抓取失败的页面
+  getCrawlJobPages(id: string, params?: { failed?: boolean; page?: number; per_page?: number }) {
+    return request.get<{
+      data: LinkCrawlPage[]
+      meta: { total: number; per_page: number; current_page: number; last_page: number }
+    }>(`/api/external-links/crawl-jobs/${id}/pages`, { params })
+  }
+
+  // 取消爬取任务
+  cancelCrawlJob(id: string) {
+    return request.post<{ message: string; job: LinkCrawlJob }>(`/api/external-links/crawl-jobs/${id}/cancel`)
+  }
+
+  // 获取出站代理统计（管理员）
+  getProxyStats() {
+    return request.get<{ data: LinkProxyStats[] }>('/api/external-links/proxies')
   }
 
   // 访问外链（后台访问）
@@ -1,5 +1,6 @@
 import request from '@/utils/request'
-import type { ExternalStatistics } from './external'
+import { externalApi as checkJobApi } from './external'
+import type { ExternalStatistics, LinkCheckJob, LinkFacets } from './external'
 
 // 外链相关接口
 interface ExternalLinkResponse {
@@ -9,7 +10,11 @@ interface ExternalLinkResponse {
     current_page: number
     per_page: number
     last_page: number
+    total_approximate?: boolean
+    next_cursor?: string
+    has_more?: boolean
   }
+  facets?: LinkFacets
 }
 
 interface ExternalLinkMeta {
@@ -33,6 +38,8 @@ export const externalApi = {
     category?: string
     sort_field?: string
     sort_order?: string
+    cursor?: string
+    count?: 'exact' | 'approx' | 'none'
   }): Promise<ExternalLinkResponse> {
     return request({
       url: '/api/external-links',
@@ -136,15 +143,11 @@ export const externalApi = {
     })
   },
 
-  // 后端批量检测外链
-  batchCheckLinksBackend(ids: string[] = [], checkAll: boolean = false) {
+  // 后端批量检测外链，创建检测任务并通过事件流等待结束，不受单次请求超时限制
+  async batchCheckLinksBackend(ids: string[] = [], checkAll: boolean = false, onProgress?: (job: LinkCheckJob) => void) {
     console.log('API调用参数:', { ids, checkAll })
-    return request({
-      url: '/api/external-links/batch-check',
-      method: 'post',
-      data: { ids, all: checkAll },
-      timeout: 120000 // 批量检测设置为2分钟超时
-    })
+    const { job, results } = await checkJobApi.runCheckJob(ids, checkAll, onProgress)
+    return { message: '批量检测完成', job, results }
   },
 
   // 获取外链统计数据
@@ -158,7 +161,7 @@ export const externalApi = {
   },
 
   // 获取外链趋势数据
-  getExternalTrends(params: { period: 'day' | 'week' | 'month', limit?: number }) {
+  getExternalTrends(params: { period?: 'hour' | 'day' | 'week' | 'month', interval?: 'hour' | 'day' | 'week' | 'month', tz?: string, from?: string, to?: string, limit?: number }) {
     return request({
       url: '/api/external-links/trends',
       method: 'get',